@@ -5,20 +5,84 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/davidwiese/fleet-tracker-backend/internal/api"
 	"github.com/davidwiese/fleet-tracker-backend/internal/config"
 	"github.com/davidwiese/fleet-tracker-backend/internal/database"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/notify"
 	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+	"github.com/davidwiese/fleet-tracker-backend/internal/version"
+	"github.com/davidwiese/fleet-tracker-backend/internal/webhook"
 	"github.com/davidwiese/fleet-tracker-backend/internal/websocket"
 	"github.com/joho/godotenv"
 )
 
+// Process exit codes, so the platform (and operators) can tell failures apart
+const (
+	exitOK            = 0
+	exitConfigError   = 2 // Missing or invalid configuration
+	exitDatabaseError = 3 // Database unreachable or schema setup failed
+	exitUpstreamError = 4 // OneStepGPS rejected our credentials
+	exitServerError   = 5 // HTTP server failed to start or stopped unexpectedly
+)
+
+// openDB connects to the database, replaced in tests
+var openDB = database.NewDB
+
+// shutdownTimeout bounds how long in-flight requests get to finish
+const shutdownTimeout = 15 * time.Second
+
+// exitError pairs a startup/runtime failure with the exit code to use
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
 func main() {
+	startedAt := time.Now()
+	err := run()
+
+	// Log a single final line either way
+	code, reason := exitCode(err)
+	log.Printf("Shutdown complete: reason=%q uptime=%s exit_code=%d", reason, time.Since(startedAt).Round(time.Second), code)
+	os.Exit(code)
+}
+
+// exitCode maps the error run returned to an exit code and the reason logged
+func exitCode(err error) (int, string) {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code, exitErr.Error()
+	}
+	if err != nil {
+		return exitServerError, err.Error()
+	}
+	return exitOK, "signal"
+}
+
+// run wires up all dependencies and serves until a shutdown signal arrives.
+// Returning (rather than log.Fatal) lets deferred cleanup like db.Close run.
+func run() error {
+	log.Println(version.Banner())
+
 	// Load environment variables from .env file for local development
 	// In production, these variables are set in AWS Elastic Beanstalk
 	if err := godotenv.Load(); err != nil {
@@ -29,21 +93,21 @@ func main() {
 	// See config/config.go for all available configuration options
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatal("Error loading config:", err)
+		return &exitError{exitConfigError, fmt.Errorf("error loading config: %w", err)}
 	}
 
 	// Initialize MySQL database connection
 	// Frontend uses this database to store user preferences for vehicle display
-	db, err := database.NewDB(cfg.DBConfig.DSN)
+	db, err := openDB(cfg.DBConfig.DSN)
 	if err != nil {
-		log.Fatal("Error initializing database:", err)
+		return &exitError{exitDatabaseError, fmt.Errorf("error initializing database: %w", err)}
 	}
 	defer db.Close() // Ensure database connection is closed when application exits
 
 	// Create necessary database tables if they don't exist
 	// Creates user_preferences table for frontend settings
 	if err := db.CreateTableIfNotExists(); err != nil {
-		log.Fatal("Error creating tables:", err)
+		return &exitError{exitDatabaseError, fmt.Errorf("error creating tables: %w", err)}
 	}
 
 	// Clean up old preferences
@@ -62,23 +126,99 @@ func main() {
 	// Initialize OneStepGPS API client
 	// This client is used to fetch real-time vehicle data
 	// Used by WebSocket hub to broadcast updates to connected clients
-	gpsClient := onestepgps.NewClient(cfg.APIConfig.GPSApiKey)
+	gpsClient := onestepgps.NewClient(cfg.APIConfig.GPSApiKey, cfg.APIConfig.GPSBaseURL, cfg.APIConfig.ReportFileTypes)
+	gpsClient.SetNameOverrides(cfg.APIConfig.DeviceNameOverrides)
+	if err := gpsClient.SetInvalidFixMode(cfg.APIConfig.InvalidFixMode); err != nil {
+		return &exitError{exitConfigError, err}
+	}
+	// One pooled transport for every OneStepGPS request, reusing keep-alive connections
+	if err := gpsClient.SetTransport(onestepgps.TransportConfig{
+		MaxIdleConns:        cfg.APIConfig.UpstreamMaxIdleConns,
+		MaxIdleConnsPerHost: cfg.APIConfig.UpstreamMaxIdleConnsPerHost,
+		IdleConnTimeout:     time.Duration(cfg.APIConfig.UpstreamIdleConnTimeout) * time.Second,
+		KeepAlive:           time.Duration(cfg.APIConfig.UpstreamKeepAlive) * time.Second,
+	}); err != nil {
+		return &exitError{exitConfigError, err}
+	}
+
+	// Warm the device cache so the first client gets instant data.
+	// Fail fast on a rejected API key, other upstream errors are transient
+	// and the hub keeps retrying on its poll interval (/readyz stays 503 until one succeeds)
+	if err := gpsClient.WarmCache(); err != nil {
+		var apiErr *models.APIError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+			return &exitError{exitUpstreamError, fmt.Errorf("OneStepGPS rejected GPS_API_KEY: %w", err)}
+		}
+		log.Printf("Warning: initial OneStepGPS request failed: %v", err)
+	}
+
+	// How devices without a stored preference are shown, e.g. hidden until acknowledged
+	preferenceDefaults, err := models.ParsePreferenceDefaults(cfg.APIConfig.UnpreferencedVisibility, cfg.APIConfig.UnpreferencedOrder)
+	if err != nil {
+		return &exitError{exitConfigError, err}
+	}
 
 	// Initialize WebSocket hub for real-time updates
 	// Frontend connects to this in HomeView.vue via initWebSocket()
 	// Broadcasts vehicle updates every 5 seconds to all connected clients
-	hub := websocket.NewHub(gpsClient, 5*time.Second)
+	// Polling is skipped when OneStepGPS pushes updates via webhook instead
+	updateInterval := 5 * time.Second
+	if cfg.Webhook.DisablePolling {
+		log.Println("Webhooks enabled, polling OneStepGPS disabled")
+		updateInterval = 0
+	}
+	hub, err := websocket.NewHub(gpsClient, updateInterval, cfg.WebSocket)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("error creating WebSocket hub: %w", err)}
+	}
+	// Streams with ?sort=preference follow the same order and defaults as /vehicles
+	hub.SetPreferences(db, preferenceDefaults)
 	go hub.Run() // Start the hub in a separate goroutine
 
+	// Report completion notifications (email/webhook), noop unless configured
+	notifier, err := notify.New(cfg.Notifier)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("error configuring report notifier: %w", err)}
+	}
+
 	// Create main API handler with all dependencies
 	// This handler manages all HTTP endpoints used by the frontend
 	handler := api.NewHandler(
 		db,
-		hub.Broadcast,
+		hub,
 		gpsClient,
 		api.HandlerConfig{
 			OneStepGPSAPIKey: cfg.APIConfig.GPSApiKey,
-			BaseURL:          "https://track.onestepgps.com/v3/api/public",
+			BaseURL:          cfg.APIConfig.GPSBaseURL,
+			AdminAPIKey:      cfg.APIConfig.AdminAPIKey,
+			WebhookSecret:    cfg.Webhook.Secret,
+			MaintenanceMode:  cfg.APIConfig.MaintenanceMode,
+			ReportOutputFields: cfg.APIConfig.ReportOutputFields,
+			DebugEndpoints:   cfg.APIConfig.DebugEndpoints,
+			MaxConcurrentReports: cfg.APIConfig.MaxConcurrentReports,
+			ReportQueueTimeout: time.Duration(cfg.APIConfig.ReportQueueTimeout) * time.Second,
+			Notifier:         notifier,
+			PublicBaseURL:    cfg.Notifier.PublicBaseURL,
+			DefaultPageSize:  cfg.APIConfig.DefaultPageSize,
+			MaxPageSize:      cfg.APIConfig.MaxPageSize,
+			TenantBaseDomain: cfg.APIConfig.TenantBaseDomain,
+			Tenants:          cfg.APIConfig.Tenants,
+			UniqueDisplayNames: cfg.APIConfig.UniqueDisplayNames,
+			MaxPollAge:       time.Duration(cfg.APIConfig.ReadyzStalePolls) * updateInterval, // 0 when polling is disabled
+			CORSAllowCredentials: cfg.APIConfig.CORSAllowCredentials,
+			CORSMaxAge:       cfg.APIConfig.CORSMaxAge,
+			RequestTimeout:   time.Duration(cfg.APIConfig.RequestTimeout) * time.Second,
+			RouteTimeouts:    cfg.APIConfig.RouteTimeouts,
+			MetadataFilterKeys: cfg.APIConfig.MetadataFilterKeys,
+			StrictQueryParams: cfg.APIConfig.StrictQueryParams,
+			PreferenceDefaults: preferenceDefaults,
+			RateLimitPerMinute: cfg.APIConfig.RateLimitPerMinute,
+			RateLimitBurst:     cfg.APIConfig.RateLimitBurst,
+			TrustedProxyHops:   cfg.APIConfig.TrustedProxyHops,
+			WebhookVerifier: webhook.Verifier{
+				Algorithm: cfg.Webhook.Algorithm,
+				Tolerance: time.Duration(cfg.Webhook.Tolerance) * time.Second,
+			},
 		},
 	)
 
@@ -88,16 +228,70 @@ func main() {
 	// - User preferences (/preferences) used in VehiclePreferences.vue
 	// - Report generation (/report/generate) used in ReportDialog.vue
 	fmt.Println("main.go: Setting up routes...")
-	handler.SetupRoutes()
+	mux := http.NewServeMux()
+	if err := handler.SetupRoutes(mux); err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("error setting up routes: %w", err)}
+	}
 	fmt.Println("main.go: Routes setup completed")
 
 	// Setup WebSocket endpoint
 	// Frontend connects to this in HomeView.vue for real-time vehicle updates
 	// Can maybe move to separate package?
-	http.HandleFunc("/ws", hub.HandleWebSocket)
+	mux.Handle("/ws", handler.WebSocketHandler()) // Tenant subdomains pick the preference owner, as in the API
+
+	// Enforce HTTPS in production, left off in development
+	var rootHandler http.Handler = mux
+	if cfg.APIConfig.ForceHTTPS {
+		log.Println("FORCE_HTTPS enabled, redirecting HTTP to HTTPS")
+		rootHandler = api.ForceHTTPS(rootHandler, cfg.APIConfig.HSTSMaxAge)
+	}
 
 	// Start HTTP server
 	// Serves both REST API endpoints and WebSocket connections
-	log.Printf("Server started on port %s", cfg.APIConfig.Port)
-	log.Fatal(http.ListenAndServe(":"+cfg.APIConfig.Port, nil))
-}
\ No newline at end of file
+	server := &http.Server{Addr: ":" + cfg.APIConfig.Port, Handler: rootHandler}
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := cfg.TLS.Build()
+		if err != nil {
+			return &exitError{exitConfigError, fmt.Errorf("error building TLS config: %w", err)}
+		}
+		server.TLSConfig = tlsConfig
+	}
+	// Listen for shutdown signals before serving, so one arriving as the
+	// server comes up still shuts down gracefully
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		// Terminate TLS here when a certificate is configured, otherwise a proxy does
+		if cfg.TLS.Enabled() {
+			log.Printf("Server started on port %s with TLS (min version %s)", cfg.APIConfig.Port, cfg.TLS.MinVersion)
+			serverErr <- server.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+			return
+		}
+		log.Printf("Server started on port %s", cfg.APIConfig.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Wait for a shutdown signal or the server failing on its own
+	select {
+	case err := <-serverErr:
+		return &exitError{exitServerError, fmt.Errorf("HTTP server error: %w", err)}
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Tell WebSocket clients to reconnect elsewhere, the HTTP server
+	// doesn't track hijacked connections. Queued broadcasts are flushed first.
+	hub.Shutdown(ctx)
+
+	// Let in-flight requests finish before closing the database
+	if err := server.Shutdown(ctx); err != nil {
+		return &exitError{exitServerError, fmt.Errorf("error during HTTP server shutdown: %w", err)}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// main_test.go drives run() against a stubbed OneStepGPS and database,
+// checking each startup failure maps to its exit code.
+
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/database"
+)
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+// fakeDriver is a database that accepts every statement, or fails every
+// Exec when opened with the DSN "fail-exec". Queries return a single row
+// holding 1, enough for the schema setup's column checks.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeConn{failExec: name == "fail-exec"}, nil
+}
+
+type fakeConn struct {
+	failExec bool
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c}, nil }
+func (fakeConn) Close() error                                 { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                    { return nil, errors.New("transactions not supported") }
+
+type fakeStmt struct {
+	conn fakeConn
+}
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.conn.failExec {
+		return nil, errors.New("exec failed")
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	done bool
+}
+
+func (*fakeRows) Columns() []string { return []string{"value"} }
+func (*fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+// openFakeDB connects to fakeDriver instead of MySQL
+func openFakeDB(dsn string) (*database.DB, error) {
+	db, err := sql.Open("fakedb", dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &database.DB{DB: db}, nil
+}
+
+// freePort returns a port nothing is listening on
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestRunExitCodes(t *testing.T) {
+	// Occupied for the server error case
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyPort := strconv.Itoa(busy.Addr().(*net.TCPAddr).Port)
+
+	tests := []struct {
+		name     string
+		dsn      string
+		openDB   func(string) (*database.DB, error)
+		upstream int // Status OneStepGPS answers the device list with
+		port     string
+		want     int
+	}{
+		{
+			name: "missing config",
+			want: exitConfigError,
+		},
+		{
+			name:   "database unreachable",
+			dsn:    "fleet",
+			openDB: func(string) (*database.DB, error) { return nil, errors.New("connection refused") },
+			want:   exitDatabaseError,
+		},
+		{
+			name:   "schema setup fails",
+			dsn:    "fail-exec",
+			openDB: openFakeDB,
+			want:   exitDatabaseError,
+		},
+		{
+			name:     "api key rejected",
+			dsn:      "fleet",
+			openDB:   openFakeDB,
+			upstream: http.StatusUnauthorized,
+			want:     exitUpstreamError,
+		},
+		{
+			name:     "port in use",
+			dsn:      "fleet",
+			openDB:   openFakeDB,
+			upstream: http.StatusOK,
+			port:     busyPort,
+			want:     exitServerError,
+		},
+		{
+			name:     "shutdown signal",
+			dsn:      "fleet",
+			openDB:   openFakeDB,
+			upstream: http.StatusOK,
+			want:     exitOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.upstream != http.StatusOK {
+					// Rejections come back as the load balancer's HTML page
+					w.Header().Set("Content-Type", "text/html")
+					w.WriteHeader(tt.upstream)
+					w.Write([]byte("<html><body>Unauthorized</body></html>"))
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"result_list":[]}`))
+			}))
+			defer upstream.Close()
+
+			port := tt.port
+			if port == "" {
+				port = freePort(t)
+			}
+			t.Setenv("DB_DSN", tt.dsn)
+			t.Setenv("GPS_API_KEY", "test-key")
+			t.Setenv("GPS_BASE_URL", upstream.URL)
+			t.Setenv("API_PORT", port)
+			if tt.openDB != nil {
+				openDB = tt.openDB
+				defer func() { openDB = database.NewDB }()
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- run() }()
+			if tt.want == exitOK {
+				waitForServer(t, port, done)
+				syscall.Kill(os.Getpid(), syscall.SIGTERM)
+			}
+
+			select {
+			case err := <-done:
+				if code, reason := exitCode(err); code != tt.want {
+					t.Errorf("exit code = %d (%s), want %d", code, reason, tt.want)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("run did not return")
+			}
+		})
+	}
+}
+
+// waitForServer blocks until /livez answers on port, failing if run
+// returns first
+func waitForServer(t *testing.T, port string, done <-chan error) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-done:
+			t.Fatalf("run returned before serving: %v", err)
+		default:
+		}
+		resp, err := http.Get("http://127.0.0.1:" + port + "/livez")
+		if err == nil {
+			resp.Body.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("server did not start")
+}
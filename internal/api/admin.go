@@ -0,0 +1,94 @@
+// admin.go handles operator-only endpoints under /api/admin.
+// All routes here are marked admin in routes.go, see withAuth.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// clientPreferencesPage is one client's page of preferences in the admin response
+type clientPreferencesPage struct {
+    Preferences []models.UserPreference `json:"preferences"`
+    Total       int                     `json:"total"`
+    Limit       int                     `json:"limit"`
+    Offset      int                     `json:"offset"`
+}
+
+// AdminPreferencesHandler handles GET /api/admin/preferences?client_ids=a,b,c
+// Returns preferences grouped by client, paginated per client with limit/offset.
+func (h *Handler) AdminPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+    var clientIDs []string
+    for _, id := range strings.Split(r.URL.Query().Get("client_ids"), ",") {
+        if id = strings.TrimSpace(id); id != "" {
+            clientIDs = append(clientIDs, id)
+        }
+    }
+    if len(clientIDs) == 0 {
+        respondError(w, newAppError(http.StatusBadRequest, "client_ids_required", "client_ids query parameter is required", nil))
+        return
+    }
+
+    page, perr := parsePagination(r, h.config.DefaultPageSize, h.config.MaxPageSize)
+    if perr != nil {
+        writePaginationError(w, perr)
+        return
+    }
+    limit, offset := page.Limit, page.Offset
+
+    // Fetch each client's page, duplicates in client_ids are only queried once
+    result := make(map[string]clientPreferencesPage, len(clientIDs))
+    for _, clientID := range clientIDs {
+        if _, done := result[clientID]; done {
+            continue
+        }
+        prefs, total, err := h.DB.GetPreferencesPageForClient(clientID, limit, offset)
+        if err != nil {
+            respondError(w, databaseError(fmt.Sprintf("Error fetching preferences for client %s", clientID), err))
+            return
+        }
+        result[clientID] = clientPreferencesPage{
+            Preferences: prefs,
+            Total:       total,
+            Limit:       limit,
+            Offset:      offset,
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "clients": result,
+    })
+}
+
+// AdminPreferencesCleanupHandler handles POST /api/admin/preferences/cleanup?days=N
+// Runs the daily stale-preference cleanup on demand, deleting preferences
+// not updated in the last N days.
+func (h *Handler) AdminPreferencesCleanupHandler(w http.ResponseWriter, r *http.Request) {
+    days, err := strconv.Atoi(r.URL.Query().Get("days"))
+    if err != nil || days <= 0 {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_days", "days query parameter must be a positive integer", nil))
+        return
+    }
+
+    deleted, err := h.DB.CleanupOldPreferences(time.Duration(days) * 24 * time.Hour)
+    if err != nil {
+        respondError(w, databaseError("Error cleaning up preferences", err))
+        return
+    }
+    fmt.Printf("Admin cleanup deleted %d preferences older than %d days\n", deleted, days)
+    h.units.invalidate("")
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]int64{
+        "deleted": deleted,
+        "days":    int64(days),
+    })
+}
@@ -0,0 +1,169 @@
+// admin_test.go covers the operator-only /api/admin endpoints.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const testAdminKey = "admin-key"
+
+// adminRequest builds a request to an admin route carrying the admin token
+func adminRequest(method, target string) *http.Request {
+    r := httptest.NewRequest(method, target, nil)
+    r.Header.Set("Authorization", "Bearer "+testAdminKey)
+    return r
+}
+
+// expectClientPage stubs GetPreferencesPageForClient for one client
+func expectClientPage(mock sqlmock.Sqlmock, clientID string, total int, rows *sqlmock.Rows, limit, offset int) {
+    mock.ExpectQuery(`SELECT COUNT\(\*\) FROM user_preferences WHERE client_id = \?`).
+        WithArgs(clientID).
+        WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(total))
+    mock.ExpectQuery(`WHERE client_id = \?\s+ORDER BY sort_order ASC, device_id ASC\s+LIMIT \? OFFSET \?`).
+        WithArgs(clientID, limit, offset).
+        WillReturnRows(rows)
+}
+
+func TestAdminPreferencesMultipleClients(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+    mock := mockDatabase(t, h)
+
+    // client-a is listed twice but only queried once
+    expectClientPage(mock, "client-a", 3, preferenceRows("dev-2", "client-a", "Van", 1, nil), 1, 1)
+    expectClientPage(mock, "client-b", 0, sqlmock.NewRows(preferenceColumns), 1, 1)
+
+    w := serve(mux, adminRequest(http.MethodGet, "/api/admin/preferences?client_ids=client-a,%20client-b,client-a,&limit=1&offset=1"))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+
+    var body struct {
+        Clients map[string]clientPreferencesPage `json:"clients"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if len(body.Clients) != 2 {
+        t.Fatalf("clients = %v, want client-a and client-b", body.Clients)
+    }
+    a := body.Clients["client-a"]
+    if a.Total != 3 || a.Limit != 1 || a.Offset != 1 || len(a.Preferences) != 1 || a.Preferences[0].DeviceID != "dev-2" {
+        t.Errorf("client-a = %+v", a)
+    }
+    b := body.Clients["client-b"]
+    if b.Total != 0 || len(b.Preferences) != 0 {
+        t.Errorf("client-b = %+v", b)
+    }
+}
+
+func TestAdminPreferencesRequiresClientIDs(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+    mockDatabase(t, h) // No queries expected
+
+    for _, target := range []string{"/api/admin/preferences", "/api/admin/preferences?client_ids=", "/api/admin/preferences?client_ids=,%20,"} {
+        if w := serve(mux, adminRequest(http.MethodGet, target)); w.Code != http.StatusBadRequest {
+            t.Errorf("GET %s = %d, want 400", target, w.Code)
+        }
+    }
+}
+
+func TestAdminPreferencesAuth(t *testing.T) {
+    target := "/api/admin/preferences?client_ids=client-a"
+
+    _, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+    if w := serve(mux, httptest.NewRequest(http.MethodGet, target, nil)); w.Code != http.StatusUnauthorized {
+        t.Errorf("without token = %d, want 401", w.Code)
+    }
+    wrong := httptest.NewRequest(http.MethodGet, target, nil)
+    wrong.Header.Set("Authorization", "Bearer nope")
+    if w := serve(mux, wrong); w.Code != http.StatusUnauthorized {
+        t.Errorf("wrong token = %d, want 401", w.Code)
+    }
+
+    // Without a configured key admin routes aren't discoverable
+    _, disabled := newTestHandler(t, HandlerConfig{}, nil)
+    if w := serve(disabled, adminRequest(http.MethodGet, target)); w.Code != http.StatusNotFound {
+        t.Errorf("admin disabled = %d, want 404", w.Code)
+    }
+}
+
+func TestAdminPreferencesCleanup(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+    mock := mockDatabase(t, h)
+    mock.ExpectExec(`DELETE FROM user_preferences\s+WHERE updated_at < NOW\(\) - INTERVAL \? DAY`).
+        WithArgs(45).
+        WillReturnResult(sqlmock.NewResult(0, 7))
+
+    w := serve(mux, adminRequest(http.MethodPost, "/api/admin/preferences/cleanup?days=45"))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    var body map[string]int64
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if body["deleted"] != 7 || body["days"] != 45 {
+        t.Errorf("body = %v, want 7 deleted for 45 days", body)
+    }
+}
+
+func TestAdminPreferencesCleanupInvalidDays(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+    mockDatabase(t, h) // Nothing is deleted
+
+    for _, query := range []string{"", "?days=", "?days=0", "?days=-3", "?days=abc", "?days=1.5"} {
+        if w := serve(mux, adminRequest(http.MethodPost, "/api/admin/preferences/cleanup"+query)); w.Code != http.StatusBadRequest {
+            t.Errorf("POST cleanup%s = %d, want 400", query, w.Code)
+        }
+    }
+
+    // Only admins may delete preferences
+    if w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/admin/preferences/cleanup?days=30", nil)); w.Code != http.StatusUnauthorized {
+        t.Errorf("without token = %d, want 401", w.Code)
+    }
+}
+
+func TestAdminErrors(t *testing.T) {
+    tests := []struct {
+        name       string
+        r          *http.Request
+        dbErr      bool
+        wantStatus int
+        wantCode   string
+        wantMsg    string
+    }{
+        {"no token", httptest.NewRequest(http.MethodGet, "/api/admin/preferences?client_ids=client-a", nil), false, http.StatusUnauthorized, "unauthorized", "Unauthorized"},
+        {"client ids required", adminRequest(http.MethodGet, "/api/admin/preferences"), false, http.StatusBadRequest, "client_ids_required", ""},
+        {"invalid days", adminRequest(http.MethodPost, "/api/admin/preferences/cleanup?days=0"), false, http.StatusBadRequest, "invalid_days", ""},
+        {"invalid enabled", adminRequest(http.MethodPost, "/api/admin/maintenance?enabled=maybe"), false, http.StatusBadRequest, "invalid_enabled", ""},
+        {"cleanup fails", adminRequest(http.MethodPost, "/api/admin/preferences/cleanup?days=30"), true, http.StatusInternalServerError, "database_error", "Error cleaning up preferences"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+            mock := mockDatabase(t, h)
+            if tt.dbErr {
+                mock.ExpectExec(`DELETE FROM user_preferences`).WillReturnError(errors.New("dial tcp 10.0.0.5:3306: connection refused"))
+            }
+
+            w := serve(mux, tt.r)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            body := errorBody(t, w)
+            if body.Error != tt.wantCode || body.Message == "" {
+                t.Errorf("body = %+v, want error %q with a message", body, tt.wantCode)
+            }
+            if tt.wantMsg != "" && body.Message != tt.wantMsg {
+                t.Errorf("message = %q, want %q", body.Message, tt.wantMsg)
+            }
+        })
+    }
+}
@@ -0,0 +1,38 @@
+// auth.go provides authentication for operator-only endpoints.
+
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// errUnauthorized is the 401 for a missing or wrong admin token
+var errUnauthorized = newAppError(http.StatusUnauthorized, "unauthorized", "Unauthorized", nil)
+
+// withAuth protects routes marked admin with the configured bearer token,
+// other routes pass through. Admin routes respond 404 when no AdminAPIKey
+// is configured so they are not discoverable on deployments that don't use them.
+func (h *Handler) withAuth(admin bool) Middleware {
+    return func(next http.Handler) http.Handler {
+        if !admin {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if h.config.AdminAPIKey == "" {
+                http.NotFound(w, r)
+                return
+            }
+
+            token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+            if subtle.ConstantTimeCompare([]byte(token), []byte(h.config.AdminAPIKey)) != 1 {
+                w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+                respondError(w, errUnauthorized)
+                return
+            }
+
+            next.ServeHTTP(w, r)
+        })
+    }
+}
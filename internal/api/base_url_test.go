@@ -0,0 +1,46 @@
+// base_url_test.go covers handlers reaching OneStepGPS under a custom API root.
+
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/davidwiese/fleet-tracker-backend/internal/database"
+	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+	"github.com/davidwiese/fleet-tracker-backend/internal/websocket"
+)
+
+func TestHandlerUsesCustomBasePath(t *testing.T) {
+    // Only the regional root answers, anything else is a 404
+    upstream := http.NewServeMux()
+    upstream.HandleFunc("/eu/v3/api/public/device", devicesReply(oneDevice))
+    srv := httptest.NewServer(upstream)
+    t.Cleanup(srv.Close)
+
+    gpsClient := onestepgps.NewClient("test-key", srv.URL+"/eu/v3/api/public", nil)
+    hub, err := websocket.NewHub(gpsClient, 0, config.WebSocketConfig{PingInterval: 54, PongWait: 60, WriteWait: 10})
+    if err != nil {
+        t.Fatal(err)
+    }
+    db, err := sql.Open("prefsdb", t.Name())
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { db.Close() })
+    h := NewHandler(&database.DB{DB: db}, hub, gpsClient, HandlerConfig{})
+    mux := http.NewServeMux()
+    if err := h.SetupRoutes(mux); err != nil {
+        t.Fatal(err)
+    }
+
+    if h.config.BaseURL != srv.URL+"/eu/v3/api/public" {
+        t.Errorf("BaseURL = %q, want the client's root", h.config.BaseURL)
+    }
+    if ids := vehicleIDs(t, mux, "/api/vehicles"); len(ids) != 1 || ids[0] != "dev1" {
+        t.Errorf("vehicles = %v, want [dev1]", ids)
+    }
+}
@@ -0,0 +1,253 @@
+// batch_test.go covers POST /api/preferences/batch in atomic and best-effort mode.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// mixedBatch has a valid item, one without a device_id, then two more valid ones
+const mixedBatch = `[
+    {"device_id":"dev-1","display_name":"Truck"},
+    {"display_name":"No device"},
+    {"device_id":"dev-3","display_name":"Van"},
+    {"device_id":"dev-4","display_name":"Car"}
+]`
+
+func TestBatchBestEffortMixedItems(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+
+    // Each valid item is written on its own, outside a transaction, so the
+    // failed write of dev-3 doesn't undo dev-1 or stop dev-4
+    mock.ExpectExec(`INSERT INTO user_preferences`).
+        WithArgs("dev-1", "default", "Truck", false, nil, "default").
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(preferenceRows("dev-1", "default", "Truck", 0, nil))
+    mock.ExpectExec(`INSERT INTO user_preferences`).
+        WithArgs("dev-3", "default", "Van", false, nil, "default").
+        WillReturnError(errors.New("deadlock"))
+    mock.ExpectExec(`INSERT INTO user_preferences`).
+        WithArgs("dev-4", "default", "Car", false, nil, "default").
+        WillReturnResult(sqlmock.NewResult(4, 1))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(preferenceRows("dev-4", "default", "Car", 1, nil))
+
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/preferences/batch?mode=best_effort", strings.NewReader(mixedBatch)))
+    if w.Code != http.StatusMultiStatus {
+        t.Fatalf("status = %d, want 207: %s", w.Code, w.Body)
+    }
+
+    var body struct {
+        Succeeded int               `json:"succeeded"`
+        Failed    int               `json:"failed"`
+        Results   []batchItemResult `json:"results"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    if body.Succeeded != 2 || body.Failed != 2 {
+        t.Errorf("succeeded = %d, failed = %d, want 2 and 2", body.Succeeded, body.Failed)
+    }
+
+    want := []struct {
+        deviceID string
+        status   int
+        failed   bool
+    }{
+        {"dev-1", http.StatusOK, false},
+        {"", http.StatusBadRequest, true},
+        {"dev-3", http.StatusInternalServerError, true},
+        {"dev-4", http.StatusOK, false},
+    }
+    if len(body.Results) != len(want) {
+        t.Fatalf("got %d results, want %d: %s", len(body.Results), len(want), w.Body)
+    }
+    for i, wt := range want {
+        got := body.Results[i]
+        if got.Index != i || got.DeviceID != wt.deviceID || got.Status != wt.status || (got.Error != "") != wt.failed {
+            t.Errorf("result %d = %+v, want device %q status %d", i, got, wt.deviceID, wt.status)
+        }
+    }
+    if !strings.Contains(body.Results[1].Error, "device_id is required") {
+        t.Errorf("validation error = %q", body.Results[1].Error)
+    }
+}
+
+func TestBatchAtomicRejectsInvalidItem(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mockDatabase(t, h) // Nothing is written, sqlmock fails on any query
+
+    for _, target := range []string{"/api/preferences/batch", "/api/preferences/batch?mode=atomic"} {
+        w := serve(mux, httptest.NewRequest(http.MethodPost, target, strings.NewReader(mixedBatch)))
+        if w.Code != http.StatusBadRequest {
+            t.Fatalf("%s: status = %d, want 400: %s", target, w.Code, w.Body)
+        }
+        body := errorBody(t, w)
+        if body.Error != "invalid_preference" || !strings.Contains(body.Message, "index 1") {
+            t.Errorf("%s: body = %+v", target, body)
+        }
+    }
+}
+
+func TestBatchAtomicRollsBackOnFailure(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WithArgs("dev-1", "default").
+        WillReturnRows(sqlmock.NewRows(preferenceColumns))
+    mock.ExpectExec(`INSERT INTO user_preferences`).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(preferenceRows("dev-1", "default", "Truck", 0, nil))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WithArgs("dev-2", "default").
+        WillReturnRows(sqlmock.NewRows(preferenceColumns))
+    mock.ExpectExec(`INSERT INTO user_preferences`).
+        WillReturnError(errors.New("deadlock"))
+    mock.ExpectRollback()
+
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/preferences/batch",
+        strings.NewReader(`[{"device_id":"dev-1","display_name":"Truck"},{"device_id":"dev-2","display_name":"Van"}]`)))
+    if w.Code != http.StatusInternalServerError {
+        t.Fatalf("status = %d, want 500: %s", w.Code, w.Body)
+    }
+}
+
+func TestBatchInvalidMode(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mockDatabase(t, h)
+
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/preferences/batch?mode=partial", strings.NewReader(mixedBatch)))
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+    }
+    if body := errorBody(t, w); body.Error != "invalid_mode" {
+        t.Errorf("error = %q, want invalid_mode", body.Error)
+    }
+}
+
+func TestBatchUniformClientID(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+
+    // The second item has no client_id and takes the header's, which matches
+    mock.ExpectBegin()
+    for _, id := range []string{"dev-1", "dev-2"} {
+        mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+            WithArgs(id, "client-a").
+            WillReturnRows(sqlmock.NewRows(preferenceColumns))
+        mock.ExpectExec(`INSERT INTO user_preferences`).
+            WithArgs(id, "client-a", "", false, nil, "client-a").
+            WillReturnResult(sqlmock.NewResult(1, 1))
+        mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+            WillReturnRows(preferenceRows(id, "client-a", "", 0, nil))
+    }
+    mock.ExpectCommit()
+    mock.ExpectQuery(`WHERE client_id = \?\s+ORDER BY`).
+        WithArgs("client-a").
+        WillReturnRows(preferenceRows("dev-1", "client-a", "", 0, nil).
+            AddRow(2, "dev-2", "client-a", "", false, 1, nil, time.Now(), time.Now()))
+
+    r := httptest.NewRequest(http.MethodPost, "/api/preferences/batch",
+        strings.NewReader(`[{"device_id":"dev-1","client_id":"client-a"},{"device_id":"dev-2"}]`))
+    r.Header.Set("X-Client-ID", "client-a")
+    w := serve(mux, r)
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+}
+
+func TestBatchMixedClientIDs(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mockDatabase(t, h) // Rejected before any query
+
+    body := `[
+        {"device_id":"dev-1","client_id":"client-a"},
+        {"device_id":"dev-2","client_id":"client-b"},
+        {"device_id":"dev-3"},
+        {"device_id":"dev-4","client_id":"client-a"}
+    ]`
+    // Best-effort batches are checked too, so valid items can't be written
+    // into another client's preferences either
+    for _, target := range []string{"/api/preferences/batch", "/api/preferences/batch?mode=best_effort"} {
+        w := serve(mux, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+        if w.Code != http.StatusBadRequest {
+            t.Fatalf("%s: status = %d, want 400: %s", target, w.Code, w.Body)
+        }
+
+        var resp struct {
+            Error      string             `json:"error"`
+            ClientID   string             `json:"client_id"`
+            Mismatches []clientIDMismatch `json:"mismatches"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+            t.Fatalf("decoding %q: %v", w.Body, err)
+        }
+        // The item without a client_id resolved to "default"
+        want := []clientIDMismatch{{Index: 1, ClientID: "client-b"}, {Index: 2, ClientID: "default"}}
+        if resp.Error != "mixed_client_ids" || resp.ClientID != "client-a" || !reflect.DeepEqual(resp.Mismatches, want) {
+            t.Errorf("%s: body = %+v, want mismatches %+v", target, resp, want)
+        }
+    }
+}
+
+func TestBatchAtomicSummary(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+
+    // expectItem stubs reading an item's stored row, then its upsert and re-read
+    expectItem := func(deviceID string, stored, saved *sqlmock.Rows) {
+        mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+            WithArgs(deviceID, "default").
+            WillReturnRows(stored)
+        mock.ExpectExec(`INSERT INTO user_preferences`).
+            WillReturnResult(sqlmock.NewResult(1, 1))
+        mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+            WillReturnRows(saved)
+    }
+    mock.ExpectBegin()
+    expectItem("dev-1", sqlmock.NewRows(preferenceColumns), preferenceRows("dev-1", "default", "Truck", 2, nil))
+    expectItem("dev-2", preferenceRows("dev-2", "default", "Van", 0, nil), preferenceRows("dev-2", "default", "Van", 0, nil))
+    expectItem("dev-3", preferenceRows("dev-3", "default", "Car", 1, nil), preferenceRows("dev-3", "default", "Sedan", 1, nil))
+    mock.ExpectCommit()
+    mock.ExpectQuery(`WHERE client_id = \?\s+ORDER BY sort_order ASC, device_id ASC`).
+        WithArgs("default").
+        WillReturnRows(sqlmock.NewRows(preferenceColumns))
+
+    // dev-1 is new, dev-2 is saved as stored and dev-3 gets a new name
+    body := `[
+        {"device_id":"dev-1","display_name":"Truck"},
+        {"device_id":"dev-2","display_name":"Van","sort_order":0},
+        {"device_id":"dev-3","display_name":"Sedan"}
+    ]`
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/preferences/batch?summary=true", strings.NewReader(body)))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    var summary batchSummary
+    if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    if !reflect.DeepEqual(summary.Created, []string{"dev-1"}) ||
+        !reflect.DeepEqual(summary.Unchanged, []string{"dev-2"}) ||
+        !reflect.DeepEqual(summary.Updated, []string{"dev-3"}) {
+        t.Errorf("summary = created %v, updated %v, unchanged %v; want [dev-1], [dev-3], [dev-2]",
+            summary.Created, summary.Updated, summary.Unchanged)
+    }
+    if summary.Preferences == nil {
+        t.Error("preferences = null, want the client's list")
+    }
+}
@@ -0,0 +1,43 @@
+// client_id.go resolves which client's preferences a request operates on.
+
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// defaultClientID is used when a request doesn't identify its client
+const defaultClientID = "default"
+
+// resolveClientID picks the client id for a preference request, in order:
+//  1. Tenant from the request subdomain, see tenant.go
+//  2. X-Client-ID header, set once by the frontend's API client
+//  3. ?client_id= query parameter, kept for existing callers
+//  4. "default"
+// A tenant can't be overridden by the header or query, so one tenant can't
+// read another's preferences.
+func resolveClientID(r *http.Request) string {
+    if id, ok := tenantClientID(r); ok {
+        return id
+    }
+    if id := strings.TrimSpace(r.Header.Get("X-Client-ID")); id != "" {
+        return id
+    }
+    if id := strings.TrimSpace(r.URL.Query().Get("client_id")); id != "" {
+        return id
+    }
+    return defaultClientID
+}
+
+// resolveBodyClientID is resolveClientID for handlers whose body may carry a
+// client_id: the tenant still wins, then the body, then the request
+func resolveBodyClientID(r *http.Request, bodyClientID string) string {
+    if id, ok := tenantClientID(r); ok {
+        return id
+    }
+    if bodyClientID != "" {
+        return bodyClientID
+    }
+    return resolveClientID(r)
+}
@@ -0,0 +1,196 @@
+// client_id_test.go covers the precedence of client id sources.
+
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+func TestResolveClientID(t *testing.T) {
+    tests := []struct {
+        name   string
+        tenant string
+        header string
+        query  string
+        want   string
+    }{
+        {"nothing", "", "", "", "default"},
+        {"query", "", "", "client-q", "client-q"},
+        {"header over query", "", "client-h", "client-q", "client-h"},
+        {"blank header falls through", "", "  ", "client-q", "client-q"},
+        {"blank query falls through", "", "", "%20%20", "default"},
+        {"tenant over header and query", "acme", "client-h", "client-q", "acme"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            target := "/api/preferences"
+            if tt.query != "" {
+                target += "?client_id=" + tt.query
+            }
+            r := httptest.NewRequest(http.MethodGet, target, nil)
+            if tt.header != "" {
+                r.Header.Set("X-Client-ID", tt.header)
+            }
+            if tt.tenant != "" {
+                r = r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tt.tenant))
+            }
+            if got := resolveClientID(r); got != tt.want {
+                t.Errorf("resolveClientID() = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestResolveBodyClientID(t *testing.T) {
+    r := httptest.NewRequest(http.MethodPost, "/api/preferences?client_id=client-q", nil)
+    r.Header.Set("X-Client-ID", "client-h")
+
+    if got := resolveBodyClientID(r, "client-b"); got != "client-b" {
+        t.Errorf("body id = %q, want client-b over header and query", got)
+    }
+    if got := resolveBodyClientID(r, ""); got != "client-h" {
+        t.Errorf("without body id = %q, want the header", got)
+    }
+
+    tenant := r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, "acme"))
+    if got := resolveBodyClientID(tenant, "client-b"); got != "acme" {
+        t.Errorf("tenant request = %q, want acme over the body", got)
+    }
+}
+
+func TestPreferencesListedForResolvedClient(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{
+        TenantBaseDomain: "fleet.example.com",
+        Tenants:          map[string]string{"acme": "client-t"},
+    }, nil)
+    setPreferences(t, []models.UserPreference{
+        {DeviceID: "dev-d", ClientID: "default"},
+        {DeviceID: "dev-q", ClientID: "client-q"},
+        {DeviceID: "dev-h", ClientID: "client-h"},
+        {DeviceID: "dev-t", ClientID: "client-t"},
+    })
+
+    tests := []struct {
+        name   string
+        host   string
+        header string
+        query  string
+        want   string
+    }{
+        {"default", "", "", "", "dev-d"},
+        {"query", "", "", "client-q", "dev-q"},
+        {"header", "", "client-h", "client-q", "dev-h"},
+        {"tenant", "acme.fleet.example.com", "client-h", "client-q", "dev-t"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            target := "/api/preferences"
+            if tt.query != "" {
+                target += "?client_id=" + tt.query
+            }
+            r := httptest.NewRequest(http.MethodGet, target, nil)
+            if tt.host != "" {
+                r.Host = tt.host
+            }
+            if tt.header != "" {
+                r.Header.Set("X-Client-ID", tt.header)
+            }
+            w := serve(mux, r)
+            if w.Code != http.StatusOK {
+                t.Fatalf("status = %d: %s", w.Code, w.Body)
+            }
+            var prefs []models.UserPreference
+            if err := json.Unmarshal(w.Body.Bytes(), &prefs); err != nil {
+                t.Fatalf("decoding %q: %v", w.Body, err)
+            }
+            if len(prefs) != 1 || prefs[0].DeviceID != tt.want {
+                t.Errorf("preferences = %+v, want only %s", prefs, tt.want)
+            }
+        })
+    }
+}
+
+// streamedIDs decodes the device ids of a vehicles message
+func streamedIDs(t *testing.T, data []byte) []string {
+    t.Helper()
+    var msg struct {
+        Vehicles []models.Vehicle `json:"vehicles"`
+    }
+    if err := json.Unmarshal(data, &msg); err != nil {
+        t.Fatalf("decoding %q: %v", data, err)
+    }
+    var ids []string
+    for _, v := range msg.Vehicles {
+        ids = append(ids, v.DeviceID)
+    }
+    return ids
+}
+
+func TestStreamsUseTenantClient(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{
+        TenantBaseDomain: "fleet.example.com",
+        Tenants:          map[string]string{"acme": "client-t"},
+    }, devicesReply(`{"result_list":[{"device_id":"dev1"},{"device_id":"dev2"}]}`))
+    h.Hub.SetPreferences(h.DB, models.PreferenceDefaults{})
+    mux.Handle("/ws", h.WebSocketHandler())
+    // The tenant puts dev2 first, the client named in the query hides it
+    setPreferences(t, []models.UserPreference{
+        {DeviceID: "dev2", ClientID: "client-t", SortOrder: 0},
+        {DeviceID: "dev1", ClientID: "client-t", SortOrder: 1},
+        {DeviceID: "dev2", ClientID: "client-q", IsHidden: true},
+    })
+    srv := httptest.NewServer(mux)
+    t.Cleanup(srv.Close)
+    want := []string{"dev2", "dev1"}
+
+    t.Run("sse", func(t *testing.T) {
+        ctx, cancel := context.WithCancel(context.Background())
+        defer cancel()
+        req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/vehicles/stream?sort=preference&client_id=client-q", nil)
+        req.Host = "acme.fleet.example.com"
+        resp, err := http.DefaultClient.Do(req)
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer resp.Body.Close()
+        scanner := bufio.NewScanner(resp.Body)
+        for scanner.Scan() {
+            if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+                if got := streamedIDs(t, []byte(data)); !reflect.DeepEqual(got, want) {
+                    t.Errorf("initial snapshot = %v, want the tenant's order %v", got, want)
+                }
+                return
+            }
+        }
+        t.Fatalf("stream ended without a snapshot: %v", scanner.Err())
+    })
+
+    t.Run("websocket", func(t *testing.T) {
+        header := http.Header{"Host": {"acme.fleet.example.com"}, "X-Client-ID": {"client-q"}}
+        conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?sort=preference", header)
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer conn.Close()
+        conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+        _, data, err := conn.ReadMessage()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got := streamedIDs(t, data); !reflect.DeepEqual(got, want) {
+            t.Errorf("initial snapshot = %v, want the tenant's order %v", got, want)
+        }
+    })
+}
@@ -0,0 +1,165 @@
+// clusters.go groups nearby vehicles into map clusters server-side, so
+// MapView.vue doesn't have to cluster large fleets in the browser.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/geo"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+const (
+    maxClusterZoom    = 22 // Deepest zoom web maps use
+    clusterCellPixels = 60 // Grid cell size on screen, about one marker's footprint
+)
+
+// mapBounds is the visible map area in decimal degrees
+type mapBounds struct {
+    South, West, North, East float64
+}
+
+// contains reports whether a point is inside the bounds, handling views
+// that cross the antimeridian (west > east)
+func (b mapBounds) contains(lat, lng float64) bool {
+    if lat < b.South || lat > b.North {
+        return false
+    }
+    if b.West <= b.East {
+        return lng >= b.West && lng <= b.East
+    }
+    return lng >= b.West || lng <= b.East
+}
+
+// vehicleCluster is two or more vehicles sharing a grid cell
+type vehicleCluster struct {
+    Latitude  float64  `json:"lat"` // Centroid of the clustered vehicles
+    Longitude float64  `json:"lng"`
+    Count     int      `json:"count"`
+    DeviceIDs []string `json:"device_ids"`
+}
+
+// vehicleMarker is a vehicle alone in its grid cell
+type vehicleMarker struct {
+    DeviceID  string  `json:"device_id"`
+    Latitude  float64 `json:"lat"`
+    Longitude float64 `json:"lng"`
+}
+
+// clusterResponse is the /vehicles/clusters response
+type clusterResponse struct {
+    Zoom       int              `json:"zoom"`
+    Clusters   []vehicleCluster `json:"clusters"`
+    Singletons []vehicleMarker  `json:"singletons"`
+}
+
+// parseBounds reads ?bounds=south,west,north,east
+func parseBounds(raw string) (mapBounds, error) {
+    parts := strings.Split(raw, ",")
+    if len(parts) != 4 {
+        return mapBounds{}, fmt.Errorf("bounds must be south,west,north,east")
+    }
+    var values [4]float64
+    for i, p := range parts {
+        v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+        if err != nil || math.IsNaN(v) {
+            return mapBounds{}, fmt.Errorf("bounds must be south,west,north,east in decimal degrees")
+        }
+        values[i] = v
+    }
+    b := mapBounds{South: values[0], West: values[1], North: values[2], East: values[3]}
+    if b.South < -90 || b.North > 90 || b.South > b.North {
+        return mapBounds{}, fmt.Errorf("bounds latitudes must be within -90..90 with south <= north")
+    }
+    if b.West < -180 || b.West > 180 || b.East < -180 || b.East > 180 {
+        return mapBounds{}, fmt.Errorf("bounds longitudes must be within -180..180")
+    }
+    return b, nil
+}
+
+// clusterVehicles grid-clusters vehicles with a valid fix inside bounds.
+// Cells are clusterCellPixels square in Web Mercator pixels at zoom, so
+// clusters split up as the map zooms in.
+func clusterVehicles(vehicles []models.Vehicle, zoom int, bounds mapBounds) clusterResponse {
+    type cell struct{ x, y int }
+    members := make(map[cell][]*models.Vehicle)
+    for i := range vehicles {
+        loc := vehicles[i].LastLocation
+        if loc == nil || !loc.HasFix || !bounds.contains(loc.Latitude, loc.Longitude) {
+            continue
+        }
+        px, py := geo.MercatorPixel(loc.Latitude, loc.Longitude, zoom)
+        key := cell{int(px / clusterCellPixels), int(py / clusterCellPixels)}
+        members[key] = append(members[key], &vehicles[i])
+    }
+
+    resp := clusterResponse{Zoom: zoom, Clusters: []vehicleCluster{}, Singletons: []vehicleMarker{}}
+    for _, group := range members {
+        if len(group) == 1 {
+            v := group[0]
+            resp.Singletons = append(resp.Singletons, vehicleMarker{
+                DeviceID:  v.DeviceID,
+                Latitude:  v.LastLocation.Latitude,
+                Longitude: v.LastLocation.Longitude,
+            })
+            continue
+        }
+        c := vehicleCluster{Count: len(group), DeviceIDs: make([]string, 0, len(group))}
+        for _, v := range group {
+            c.Latitude += v.LastLocation.Latitude
+            c.Longitude += v.LastLocation.Longitude
+            c.DeviceIDs = append(c.DeviceIDs, v.DeviceID)
+        }
+        c.Latitude /= float64(len(group))
+        c.Longitude /= float64(len(group))
+        sort.Strings(c.DeviceIDs)
+        resp.Clusters = append(resp.Clusters, c)
+    }
+
+    // Stable output: biggest clusters first, singletons by id
+    sort.Slice(resp.Clusters, func(i, j int) bool {
+        if resp.Clusters[i].Count != resp.Clusters[j].Count {
+            return resp.Clusters[i].Count > resp.Clusters[j].Count
+        }
+        return resp.Clusters[i].DeviceIDs[0] < resp.Clusters[j].DeviceIDs[0]
+    })
+    sort.Slice(resp.Singletons, func(i, j int) bool {
+        return resp.Singletons[i].DeviceID < resp.Singletons[j].DeviceID
+    })
+    return resp
+}
+
+// VehicleClustersHandler handles GET /vehicles/clusters?zoom=Z&bounds=s,w,n,e
+// Without bounds the whole world is clustered.
+func (h *Handler) VehicleClustersHandler(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    zoom, err := strconv.Atoi(query.Get("zoom"))
+    if err != nil || zoom < 0 || zoom > maxClusterZoom {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_zoom", fmt.Sprintf("zoom must be an integer from 0 to %d", maxClusterZoom), nil))
+        return
+    }
+
+    bounds := mapBounds{South: -90, West: -180, North: 90, East: 180}
+    if raw := query.Get("bounds"); raw != "" {
+        if bounds, err = parseBounds(raw); err != nil {
+            respondError(w, newAppError(http.StatusBadRequest, "invalid_bounds", err.Error(), err))
+            return
+        }
+    }
+
+    vehicles, err := h.GPSClient.GetDevicesCached(deviceCacheMaxAge)
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(clusterVehicles(vehicles, zoom, bounds))
+}
@@ -0,0 +1,122 @@
+// clusters_test.go covers GET /api/vehicles/clusters.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// denseFleet is five trucks parked together in a Denver yard, three vans a few
+// blocks apart in Boulder, one car in Chicago and a tracker without a fix
+var denseFleet = func() string {
+    var devices []string
+    add := func(id string, lat, lng float64) {
+        devices = append(devices, fmt.Sprintf(`{"device_id":%q,"latest_device_point":{"lat":%v,"lng":%v}}`, id, lat, lng))
+    }
+    for i := 0; i < 5; i++ {
+        add(fmt.Sprintf("yard-%d", i), 39.74010+float64(i)*0.00002, -104.99010+float64(i)*0.00002)
+    }
+    for i := 0; i < 3; i++ {
+        add(fmt.Sprintf("boulder-%d", i), 40.01500+float64(i)*0.004, -105.27000)
+    }
+    add("chicago", 41.8781, -87.6298)
+    add("no-fix", 0, 0)
+    return `{"result_list":[` + strings.Join(devices, ",") + `]}`
+}()
+
+// getClusters fetches target and decodes the cluster response
+func getClusters(t *testing.T, mux http.Handler, target string) clusterResponse {
+    t.Helper()
+    w := serve(mux, httptest.NewRequest(http.MethodGet, target, nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("GET %s = %d: %s", target, w.Code, w.Body)
+    }
+    var resp clusterResponse
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    return resp
+}
+
+// clusterCounts is the size of each cluster, biggest first
+func clusterCounts(resp clusterResponse) []int {
+    counts := []int{}
+    for _, c := range resp.Clusters {
+        counts = append(counts, c.Count)
+    }
+    return counts
+}
+
+func TestVehicleClustersByZoom(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(denseFleet))
+
+    tests := []struct {
+        zoom       int
+        clusters   []int
+        singletons int
+    }{
+        {3, []int{8}, 1},     // Colorado is one cluster, Chicago on its own
+        {10, []int{5, 3}, 1}, // Denver and Boulder split up
+        {15, []int{5}, 4},    // The Boulder vans are blocks apart
+        {22, []int{}, 9},     // Everything on its own
+    }
+    for _, tt := range tests {
+        resp := getClusters(t, mux, fmt.Sprintf("/api/vehicles/clusters?zoom=%d", tt.zoom))
+        if resp.Zoom != tt.zoom {
+            t.Errorf("zoom %d: response zoom = %d", tt.zoom, resp.Zoom)
+        }
+        if got := clusterCounts(resp); !reflect.DeepEqual(got, tt.clusters) || len(resp.Singletons) != tt.singletons {
+            t.Errorf("zoom %d: clusters %v with %d singletons, want %v with %d", tt.zoom, got, len(resp.Singletons), tt.clusters, tt.singletons)
+        }
+    }
+
+    // The yard cluster sits at the centroid of its trucks
+    resp := getClusters(t, mux, "/api/vehicles/clusters?zoom=10")
+    yard := resp.Clusters[0]
+    if yard.DeviceIDs[0] != "yard-0" || yard.Latitude < 39.7401 || yard.Latitude > 39.7402 {
+        t.Errorf("yard cluster = %+v", yard)
+    }
+}
+
+func TestVehicleClustersBounds(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(denseFleet))
+
+    // Only the Colorado Front Range is in view
+    resp := getClusters(t, mux, "/api/vehicles/clusters?zoom=3&bounds=39,-106,41,-104")
+    if got := clusterCounts(resp); !reflect.DeepEqual(got, []int{8}) || len(resp.Singletons) != 0 {
+        t.Errorf("clusters = %v with singletons %+v, want only the Colorado cluster", got, resp.Singletons)
+    }
+
+    // A view across the antimeridian holds none of the fleet
+    resp = getClusters(t, mux, "/api/vehicles/clusters?zoom=3&bounds=-10,170,10,-170")
+    if len(resp.Clusters)+len(resp.Singletons) != 0 {
+        t.Errorf("antimeridian view = %+v, want empty", resp)
+    }
+}
+
+func TestVehicleClustersInvalid(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(denseFleet))
+
+    for _, query := range []string{
+        "",
+        "?zoom=",
+        "?zoom=-1",
+        "?zoom=23",
+        "?zoom=abc",
+        "?zoom=5&bounds=1,2,3",
+        "?zoom=5&bounds=a,b,c,d",
+        "?zoom=5&bounds=41,-106,39,-104",  // South above north
+        "?zoom=5&bounds=-95,-106,41,-104", // Past the pole
+        "?zoom=5&bounds=39,-190,41,-104",
+    } {
+        if w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles/clusters"+query, nil)); w.Code != http.StatusBadRequest {
+            t.Errorf("GET clusters%s = %d, want 400", query, w.Code)
+        }
+    }
+}
@@ -0,0 +1,35 @@
+// conditional.go provides time-based conditional GET support.
+
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// notModified sets Last-Modified from lastModified and, when the request's
+// If-Modified-Since is at or after it, responds 304 and returns true.
+// A zero lastModified (no data refreshed yet) disables both.
+func notModified(w http.ResponseWriter, r *http.Request, lastModified time.Time) bool {
+    if lastModified.IsZero() {
+        return false
+    }
+    // HTTP dates have second precision
+    lastModified = lastModified.UTC().Truncate(time.Second)
+    w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+
+    since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+    if err != nil || lastModified.After(since) {
+        return false
+    }
+    w.WriteHeader(http.StatusNotModified)
+    return true
+}
+
+// preferenceDependent reports whether a /vehicles response depends on the
+// client's stored preferences (metadata filters, sort=preference, units),
+// which can change without the device list being refetched
+func preferenceDependent(r *http.Request, filters map[string][]string, units vehicleUnits) bool {
+    query := r.URL.Query()
+    return len(filters) > 0 || query.Get("sort") == "preference" || query.Has("units") || units.preferenceBased()
+}
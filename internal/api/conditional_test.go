@@ -0,0 +1,90 @@
+// conditional_test.go covers If-Modified-Since on GET /api/vehicles.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// getVehiclesSince requests target with If-Modified-Since set, unless since is empty
+func getVehiclesSince(mux http.Handler, target, since string) *httptest.ResponseRecorder {
+    r := httptest.NewRequest(http.MethodGet, target, nil)
+    if since != "" {
+        r.Header.Set("If-Modified-Since", since)
+    }
+    return serve(mux, r)
+}
+
+func TestVehiclesNotModified(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+
+    first := getVehiclesSince(mux, "/api/vehicles", "")
+    if first.Code != http.StatusOK {
+        t.Fatalf("first request: got %d, want 200", first.Code)
+    }
+    lastModified := first.Header().Get("Last-Modified")
+    if lastModified == "" {
+        t.Fatal("first request: no Last-Modified")
+    }
+
+    if w := getVehiclesSince(mux, "/api/vehicles", lastModified); w.Code != http.StatusNotModified {
+        t.Fatalf("unchanged list: got %d, want 304", w.Code)
+    }
+
+    older := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+    if w := getVehiclesSince(mux, "/api/vehicles", older); w.Code != http.StatusOK {
+        t.Fatalf("older If-Modified-Since: got %d, want 200", w.Code)
+    }
+
+    // Refetch in a later second, Last-Modified has second precision
+    time.Sleep(1100 * time.Millisecond)
+    if _, err := h.GPSClient.GetDevices(); err != nil {
+        t.Fatal(err)
+    }
+    w := getVehiclesSince(mux, "/api/vehicles", lastModified)
+    if w.Code != http.StatusOK {
+        t.Fatalf("after refetch: got %d, want 200", w.Code)
+    }
+    if got := w.Header().Get("Last-Modified"); got == lastModified {
+        t.Errorf("after refetch: Last-Modified still %s", got)
+    }
+}
+
+func TestVehiclesUnitsSkipsConditional(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+
+    future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+    w := getVehiclesSince(mux, "/api/vehicles?units=metric", future)
+    if w.Code != http.StatusOK {
+        t.Fatalf("got %d, want 200", w.Code)
+    }
+    if got := w.Header().Get("Last-Modified"); got != "" {
+        t.Errorf("Last-Modified = %q, want none", got)
+    }
+}
+
+func TestPreferenceDependent(t *testing.T) {
+    stored := vehicleUnits{stored: map[string]string{"dev1": "metric"}}
+    tests := []struct {
+        target  string
+        filters map[string][]string
+        units   vehicleUnits
+        want    bool
+    }{
+        {"/api/vehicles", nil, vehicleUnits{}, false},
+        {"/api/vehicles?sort=name", nil, vehicleUnits{}, false},
+        {"/api/vehicles?sort=preference", nil, vehicleUnits{}, true},
+        {"/api/vehicles?units=imperial", nil, vehicleUnits{system: "imperial"}, true},
+        {"/api/vehicles?meta.color=red", map[string][]string{"color": {"red"}}, vehicleUnits{}, true},
+        {"/api/vehicles", nil, stored, true},
+    }
+    for _, tt := range tests {
+        r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+        if got := preferenceDependent(r, tt.filters, tt.units); got != tt.want {
+            t.Errorf("%s (stored units %v): got %v, want %v", tt.target, tt.units.stored, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,59 @@
+// cors_reload.go holds the live set of CORS origins so ALLOWED_ORIGINS
+// changes can take effect without a redeploy.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// originSet is an immutable snapshot of allowed origins.
+// Swapped as a whole so a request never sees a half-applied reload.
+type originSet struct {
+    list    []string
+    allowed map[string]bool
+}
+
+func newOriginSet(origins []string) *originSet {
+    set := &originSet{list: origins, allowed: make(map[string]bool, len(origins))}
+    for _, origin := range origins {
+        set.allowed[origin] = true
+    }
+    return set
+}
+
+// isAllowedOrigin checks if an origin is allowed for CORS
+// Used by withCORS middleware to validate request origins
+func (h *Handler) isAllowedOrigin(origin string) bool {
+    return h.origins.Load().allowed[origin]
+}
+
+// loadAllowedOrigins reads ALLOWED_ORIGINS, preferring a value in the .env
+// file (re-read on every call) over the process environment
+func loadAllowedOrigins() []string {
+    if env, err := godotenv.Read(); err == nil {
+        if v, ok := env["ALLOWED_ORIGINS"]; ok {
+            return getAllowedOrigins(v)
+        }
+    }
+    return getAllowedOrigins(os.Getenv("ALLOWED_ORIGINS"))
+}
+
+// CORSReloadHandler handles POST /api/admin/cors/reload.
+// Re-reads ALLOWED_ORIGINS and swaps in the new set for subsequent requests.
+func (h *Handler) CORSReloadHandler(w http.ResponseWriter, r *http.Request) {
+    set := newOriginSet(loadAllowedOrigins())
+    previous := h.origins.Swap(set)
+    fmt.Printf("Reloaded CORS origins: %v (was %v)\n", set.list, previous.list)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string][]string{
+        "allowed_origins":  set.list,
+        "previous_origins": previous.list,
+    })
+}
@@ -0,0 +1,134 @@
+// cors_test.go covers the CORS headers sent to allowed origins and
+// reloading the origins live.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+const testOrigin = "http://localhost:5173"
+
+// corsRequest sends method /api/vehicles from origin through a handler
+// allowing testOrigin
+func corsRequest(t *testing.T, cfg HandlerConfig, method, origin string) http.Header {
+    t.Helper()
+    h, mux := newTestHandler(t, cfg, nil)
+    h.origins.Store(newOriginSet([]string{testOrigin}))
+
+    r := httptest.NewRequest(method, "/api/vehicles", nil)
+    r.Header.Set("Origin", origin)
+    if method == http.MethodOptions {
+        r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+    }
+    return serve(mux, r).Header()
+}
+
+func TestCORSCredentials(t *testing.T) {
+    tests := []struct {
+        name        string
+        credentials bool
+        origin      string
+        want        string
+    }{
+        {"credentialed", true, testOrigin, "true"},
+        {"not credentialed", false, testOrigin, ""},
+        {"disallowed origin", true, "http://evil.example", ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            header := corsRequest(t, HandlerConfig{CORSAllowCredentials: tt.credentials}, http.MethodGet, tt.origin)
+            if got := header.Get("Access-Control-Allow-Credentials"); got != tt.want {
+                t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.want)
+            }
+            wantOrigin := ""
+            if tt.origin == testOrigin {
+                wantOrigin = testOrigin
+            }
+            if got := header.Get("Access-Control-Allow-Origin"); got != wantOrigin {
+                t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, wantOrigin)
+            }
+        })
+    }
+}
+
+func TestCORSMaxAge(t *testing.T) {
+    tests := []struct {
+        name   string
+        maxAge int
+        method string
+        want   string
+    }{
+        {"preflight", 600, http.MethodOptions, "600"},
+        {"preflight without max-age", 0, http.MethodOptions, ""},
+        {"simple request", 600, http.MethodGet, ""}, // Only preflights are cached
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            header := corsRequest(t, HandlerConfig{CORSMaxAge: tt.maxAge}, tt.method, testOrigin)
+            if got := header.Get("Access-Control-Max-Age"); got != tt.want {
+                t.Errorf("Access-Control-Max-Age = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+// allowsOrigin reports whether mux answers a request from origin with CORS headers
+func allowsOrigin(mux http.Handler, origin string) bool {
+    r := httptest.NewRequest(http.MethodGet, "/api/vehicles", nil)
+    r.Header.Set("Origin", origin)
+    return serve(mux, r).Header().Get("Access-Control-Allow-Origin") == origin
+}
+
+func TestCORSReload(t *testing.T) {
+    const oldOrigin = "https://old.example.com"
+    t.Setenv("ALLOWED_ORIGINS", oldOrigin)
+    _, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+    if !allowsOrigin(mux, oldOrigin) || allowsOrigin(mux, "https://fleet.example.com") {
+        t.Fatal("initial origins not loaded from ALLOWED_ORIGINS")
+    }
+
+    // Reloads race with ordinary requests, each sees one whole set
+    t.Setenv("ALLOWED_ORIGINS", "https://fleet.example.com, https://ops.example.com")
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            allowsOrigin(mux, oldOrigin)
+        }()
+    }
+    w := serve(mux, adminRequest(http.MethodPost, "/api/admin/cors/reload"))
+    wg.Wait()
+    if w.Code != http.StatusOK {
+        t.Fatalf("reload status = %d: %s", w.Code, w.Body)
+    }
+    var body map[string][]string
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    // The development origin is always allowed
+    wantNew := []string{testOrigin, "https://fleet.example.com", "https://ops.example.com"}
+    if !reflect.DeepEqual(body["allowed_origins"], wantNew) || !reflect.DeepEqual(body["previous_origins"], []string{testOrigin, oldOrigin}) {
+        t.Errorf("reload body = %v", body)
+    }
+
+    if allowsOrigin(mux, oldOrigin) {
+        t.Error("removed origin still allowed after reload")
+    }
+    for _, origin := range wantNew {
+        if !allowsOrigin(mux, origin) {
+            t.Errorf("%s not allowed after reload", origin)
+        }
+    }
+
+    // Only admins may reload
+    if w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/admin/cors/reload", nil)); w.Code != http.StatusUnauthorized {
+        t.Errorf("without token = %d, want 401", w.Code)
+    }
+}
@@ -0,0 +1,25 @@
+// debug.go provides operator endpoints for incident debugging.
+// Always registered behind admin auth, but 404 unless DEBUG_ENDPOINTS is enabled.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// DebugHubHandler handles GET /api/debug/hub.
+// Returns websocket.HubState: the client count and each client's anonymized
+// id, encoding, connect time, subscriptions and dropped broadcasts, the last
+// poll and broadcast times, the device count of the last snapshot, whether
+// polling is enabled or paused, and total dropped messages. The hub's client
+// lock is held while copying, so broadcasts wait for it briefly.
+func (h *Handler) DebugHubHandler(w http.ResponseWriter, r *http.Request) {
+    if !h.config.DebugEndpoints {
+        http.NotFound(w, r)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(h.Hub.State())
+}
@@ -0,0 +1,96 @@
+// debug_test.go covers the DEBUG_ENDPOINTS hub state endpoint.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/websocket"
+)
+
+func TestDebugHubDisabledByDefault(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+
+    // Even with the admin token, the endpoint doesn't exist unless enabled
+    if w := serve(mux, adminRequest(http.MethodGet, "/api/debug/hub")); w.Code != http.StatusNotFound {
+        t.Errorf("status = %d, want 404", w.Code)
+    }
+}
+
+func TestDebugHubRequiresAdminToken(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey, DebugEndpoints: true}, nil)
+
+    if w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/debug/hub", nil)); w.Code != http.StatusUnauthorized {
+        t.Errorf("status = %d, want 401", w.Code)
+    }
+}
+
+func TestDebugHubState(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey, DebugEndpoints: true}, nil)
+    h.Hub.IngestVehicles([]models.Vehicle{{DeviceID: "dev1"}, {DeviceID: "dev2"}})
+
+    // Connect one SSE client subscribed to a single device
+    srv := httptest.NewServer(mux)
+    t.Cleanup(srv.Close)
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/vehicles/stream?device_ids=dev1", nil)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+
+    var state websocket.HubState
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        w := serve(mux, adminRequest(http.MethodGet, "/api/debug/hub"))
+        if w.Code != http.StatusOK {
+            t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+        }
+        if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+            t.Errorf("Content-Type = %q", ct)
+        }
+        // Every documented field is present in the body
+        var raw map[string]json.RawMessage
+        if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+            t.Fatalf("decoding %q: %v", w.Body, err)
+        }
+        for _, key := range []string{"client_count", "clients", "last_poll_time", "last_broadcast_time",
+            "last_snapshot_size", "polling_enabled", "polling_paused", "dropped_messages"} {
+            if _, ok := raw[key]; !ok {
+                t.Errorf("missing %q in %s", key, w.Body)
+            }
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+            t.Fatal(err)
+        }
+        if state.ClientCount == 1 || time.Now().After(deadline) {
+            break
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    if state.ClientCount != 1 || len(state.Clients) != 1 {
+        t.Fatalf("client_count = %d, clients = %v, want 1", state.ClientCount, state.Clients)
+    }
+    c := state.Clients[0]
+    if c.ID == "" || c.Encoding != "json" || c.ConnectedAt.IsZero() {
+        t.Errorf("client = %+v", c)
+    }
+    if len(c.Subscriptions) != 1 || c.Subscriptions[0] != "dev1" {
+        t.Errorf("subscriptions = %v, want [dev1]", c.Subscriptions)
+    }
+    if state.LastSnapshotSize != 2 {
+        t.Errorf("last_snapshot_size = %d, want 2", state.LastSnapshotSize)
+    }
+    if state.PollingEnabled || state.PollingPaused {
+        t.Errorf("polling_enabled = %v, polling_paused = %v, want both false", state.PollingEnabled, state.PollingPaused)
+    }
+}
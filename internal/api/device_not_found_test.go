@@ -0,0 +1,92 @@
+// device_not_found_test.go covers the structured 404 for unknown device ids.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// notFoundIDs decodes a device_not_found body and returns its device ids
+func notFoundIDs(t *testing.T, w *httptest.ResponseRecorder) []string {
+    t.Helper()
+    if w.Code != http.StatusNotFound {
+        t.Fatalf("status = %d, want 404 (body %s)", w.Code, w.Body)
+    }
+    var body deviceNotFoundResponse
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    if body.Error != "device_not_found" {
+        t.Errorf("error = %q, want device_not_found", body.Error)
+    }
+    return body.DeviceIDs
+}
+
+func TestDeviceNotFound(t *testing.T) {
+    tests := []struct {
+        name    string
+        request func() *http.Request
+        want    []string
+    }{
+        {
+            name: "single vehicle",
+            request: func() *http.Request {
+                return httptest.NewRequest(http.MethodGet, "/api/vehicles/ghost", nil)
+            },
+            want: []string{"ghost"},
+        },
+        {
+            name: "effective preference lookup",
+            request: func() *http.Request {
+                return httptest.NewRequest(http.MethodGet, "/api/preferences/ghost/effective", nil)
+            },
+            want: []string{"ghost"},
+        },
+        {
+            name: "report resolution",
+            request: func() *http.Request {
+                body := `{"report_spec":{"report_type":"general_info","device_id_list":["ghost","dev1","phantom"]}}`
+                return httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body))
+            },
+            want: []string{"ghost", "phantom"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(oneDevice))
+            if got := notFoundIDs(t, serve(mux, tt.request())); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("device_ids = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestGetVehicleUsesDeviceCache(t *testing.T) {
+    calls := map[string]*atomic.Int32{"/device": new(atomic.Int32)}
+    _, mux := newTestHandler(t, HandlerConfig{}, countingDevices(calls))
+
+    // Single lookups share the cached list with GET /vehicles
+    for _, path := range []string{"/api/vehicles", "/api/vehicles/dev1", "/api/vehicles/dev1", "/api/vehicles/ghost"} {
+        serve(mux, httptest.NewRequest(http.MethodGet, path, nil))
+    }
+    if got := calls["/device"].Load(); got != 1 {
+        t.Errorf("upstream device fetches = %d, want 1", got)
+    }
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles/dev1", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200", w.Code)
+    }
+    var v struct {
+        DeviceID string `json:"device_id"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil || v.DeviceID != "dev1" {
+        t.Errorf("body = %s, want dev1", w.Body)
+    }
+}
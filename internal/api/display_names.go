@@ -0,0 +1,98 @@
+// display_names.go enforces unique display names per client when
+// UNIQUE_DISPLAY_NAMES is enabled. Off by default, duplicates are then allowed.
+
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/database"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// savePreference creates or updates pref, in its own transaction when
+// display names must be unique so the check and the write can't interleave
+func (h *Handler) savePreference(pref *models.PreferenceCreate) (*models.UserPreference, error) {
+    defer h.units.invalidate(pref.ClientID)
+    if !h.config.UniqueDisplayNames {
+        return h.DB.CreatePreference(pref, nil)
+    }
+
+    var saved *models.UserPreference
+    err := h.inTx(func(tx *sql.Tx) error {
+        var err error
+        saved, err = h.savePreferenceTx(pref, tx)
+        return err
+    })
+    return saved, err
+}
+
+// savePreferenceTx creates or updates pref within tx, checking the display name first when enabled.
+// Used by the atomic batch so earlier items in the same batch count as taken names.
+func (h *Handler) savePreferenceTx(pref *models.PreferenceCreate, tx *sql.Tx) (*models.UserPreference, error) {
+    if h.config.UniqueDisplayNames {
+        if err := h.DB.CheckDisplayNameAvailable(pref.ClientID, pref.DeviceID, pref.DisplayName, tx); err != nil {
+            return nil, err
+        }
+    }
+    return h.DB.CreatePreference(pref, tx)
+}
+
+// updatePreferenceChecked applies a partial update, checking a new display name when enabled
+func (h *Handler) updatePreferenceChecked(deviceID, clientID string, updates *models.PreferenceUpdate) (*models.UserPreference, error) {
+    defer h.units.invalidate(clientID)
+    if !h.config.UniqueDisplayNames || updates.DisplayName == nil {
+        return h.DB.UpdatePreferenceByDeviceAndClientID(deviceID, clientID, updates, nil)
+    }
+
+    var updated *models.UserPreference
+    err := h.inTx(func(tx *sql.Tx) error {
+        if err := h.DB.CheckDisplayNameAvailable(clientID, deviceID, *updates.DisplayName, tx); err != nil {
+            return err
+        }
+        var err error
+        updated, err = h.DB.UpdatePreferenceByDeviceAndClientID(deviceID, clientID, updates, tx)
+        return err
+    })
+    return updated, err
+}
+
+// inTx runs fn in a transaction, committing only if it succeeds
+func (h *Handler) inTx(fn func(tx *sql.Tx) error) error {
+    tx, err := h.DB.Begin()
+    if err != nil {
+        return fmt.Errorf("error starting transaction: %w", err)
+    }
+    defer tx.Rollback() // No-op after a successful commit
+
+    if err := fn(tx); err != nil {
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("error committing transaction: %w", err)
+    }
+    return nil
+}
+
+// writeDuplicateDisplayName writes a structured 409 if err is a display name
+// conflict and reports whether it did
+func writeDuplicateDisplayName(w http.ResponseWriter, err error) bool {
+    var conflict *database.DisplayNameConflictError
+    if !errors.As(err, &conflict) {
+        return false
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusConflict)
+    json.NewEncoder(w).Encode(map[string]string{
+        "error":            "duplicate_display_name",
+        "message":          conflict.Error(),
+        "display_name":     conflict.DisplayName,
+        "conflicting_with": conflict.ConflictingWith,
+    })
+    return true
+}
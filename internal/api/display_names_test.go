@@ -0,0 +1,125 @@
+// display_names_test.go covers UNIQUE_DISPLAY_NAMES on preference writes.
+
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// displayNameCheck matches CheckDisplayNameAvailable's locking read
+const displayNameCheck = `SELECT device_id\s+FROM user_preferences\s+WHERE client_id = \? AND display_name = \? AND device_id <> \?[\s\S]*FOR UPDATE`
+
+// conflictBody decodes a 409 duplicate_display_name body
+func conflictBody(t *testing.T, w *httptest.ResponseRecorder) map[string]string {
+    t.Helper()
+    var body map[string]string
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    return body
+}
+
+func TestCreatePreferenceDuplicateDisplayName(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{UniqueDisplayNames: true}, nil)
+    mock := mockDatabase(t, h)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(displayNameCheck).
+        WithArgs("default", "Truck", "dev-1").
+        WillReturnRows(sqlmock.NewRows([]string{"device_id"}).AddRow("dev-2"))
+    mock.ExpectRollback()
+
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/preferences",
+        strings.NewReader(`{"device_id":"dev-1","display_name":"Truck"}`)))
+
+    if w.Code != http.StatusConflict {
+        t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+    }
+    body := conflictBody(t, w)
+    if body["error"] != "duplicate_display_name" || body["display_name"] != "Truck" || body["conflicting_with"] != "dev-2" {
+        t.Errorf("body = %v", body)
+    }
+}
+
+func TestUpdatePreferenceDuplicateDisplayName(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{UniqueDisplayNames: true}, nil)
+    mock := mockDatabase(t, h)
+
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WithArgs("dev-1", "default").
+        WillReturnRows(preferenceRows("dev-1", "default", "Van", 0, nil))
+    mock.ExpectBegin()
+    mock.ExpectQuery(displayNameCheck).
+        WithArgs("default", "Truck", "dev-1").
+        WillReturnRows(sqlmock.NewRows([]string{"device_id"}).AddRow("dev-2"))
+    mock.ExpectRollback()
+
+    w := serve(mux, httptest.NewRequest(http.MethodPut, "/api/preferences/dev-1",
+        strings.NewReader(`{"display_name":"Truck"}`)))
+
+    if w.Code != http.StatusConflict {
+        t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+    }
+    if body := conflictBody(t, w); body["conflicting_with"] != "dev-2" {
+        t.Errorf("body = %v", body)
+    }
+}
+
+func TestCreatePreferenceAvailableDisplayName(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{UniqueDisplayNames: true}, nil)
+    mock := mockDatabase(t, h)
+
+    // The check and the write share one transaction
+    mock.ExpectBegin()
+    mock.ExpectQuery(displayNameCheck).
+        WithArgs("default", "Truck", "dev-1").
+        WillReturnError(sql.ErrNoRows)
+    mock.ExpectExec(`INSERT INTO user_preferences`).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(preferenceRows("dev-1", "default", "Truck", 0, nil))
+    mock.ExpectCommit()
+
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/preferences",
+        strings.NewReader(`{"device_id":"dev-1","display_name":"Truck"}`)))
+
+    if w.Code != http.StatusCreated {
+        t.Fatalf("status = %d, want 201: %s", w.Code, w.Body)
+    }
+}
+
+func TestDuplicateDisplayNamesAllowedByDefault(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+
+    // No transaction and no FOR UPDATE check, sqlmock fails on either
+    mock.ExpectExec(`INSERT INTO user_preferences`).
+        WillReturnResult(sqlmock.NewResult(2, 1))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(preferenceRows("dev-1", "default", "Truck", 1, nil))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(preferenceRows("dev-1", "default", "Truck", 1, nil))
+    mock.ExpectExec(`UPDATE user_preferences SET`).
+        WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(preferenceRows("dev-1", "default", "Truck", 1, nil))
+
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/preferences",
+        strings.NewReader(`{"device_id":"dev-1","display_name":"Truck"}`)))
+    if w.Code != http.StatusCreated {
+        t.Fatalf("create status = %d, want 201: %s", w.Code, w.Body)
+    }
+
+    w = serve(mux, httptest.NewRequest(http.MethodPut, "/api/preferences/dev-1",
+        strings.NewReader(`{"display_name":"Truck"}`)))
+    if w.Code != http.StatusOK {
+        t.Fatalf("update status = %d, want 200: %s", w.Code, w.Body)
+    }
+}
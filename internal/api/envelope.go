@@ -0,0 +1,43 @@
+// envelope.go provides the optional metadata envelope for list endpoints.
+// Bare arrays remain the default so existing frontend calls keep working.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// listEnvelope wraps a list response when ?envelope=true is requested
+type listEnvelope struct {
+    Data interface{}  `json:"data"`
+    Meta listMetadata `json:"meta"`
+}
+
+// listMetadata describes the wrapped list
+type listMetadata struct {
+    Total       int       `json:"total"`
+    GeneratedAt time.Time `json:"generated_at"`
+}
+
+// wantsEnvelope reports whether the client asked for the envelope shape
+func wantsEnvelope(r *http.Request) bool {
+    return r.URL.Query().Get("envelope") == "true"
+}
+
+// writeJSONList encodes a list as a bare array, or wrapped in an envelope
+// with total and generation time when the request asks for it.
+func writeJSONList(w http.ResponseWriter, r *http.Request, data interface{}, total int) error {
+    w.Header().Set("Content-Type", "application/json")
+    if !wantsEnvelope(r) {
+        return json.NewEncoder(w).Encode(data)
+    }
+    return json.NewEncoder(w).Encode(listEnvelope{
+        Data: data,
+        Meta: listMetadata{
+            Total:       total,
+            GeneratedAt: time.Now().UTC(),
+        },
+    })
+}
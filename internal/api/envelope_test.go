@@ -0,0 +1,106 @@
+// envelope_test.go covers the bare and ?envelope=true list shapes.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// envelopeBody is a decoded ?envelope=true response
+type envelopeBody struct {
+    Data []map[string]interface{} `json:"data"`
+    Meta *listMetadata            `json:"meta"`
+}
+
+func TestListEnvelope(t *testing.T) {
+    tests := []struct {
+        name   string
+        target string
+        want   int
+    }{
+        {"vehicles", "/api/vehicles", 4},
+        {"preferences", "/api/preferences", 2},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(sortDevices))
+            setPreferences(t, []models.UserPreference{
+                {ID: 1, DeviceID: "a", ClientID: "default", SortOrder: 0},
+                {ID: 2, DeviceID: "b", ClientID: "default", SortOrder: 1},
+            })
+
+            // Bare arrays stay the default, envelope=false included
+            for _, query := range []string{"", "?envelope=false"} {
+                w := serve(mux, httptest.NewRequest(http.MethodGet, tt.target+query, nil))
+                var bare []map[string]interface{}
+                if err := json.Unmarshal(w.Body.Bytes(), &bare); err != nil {
+                    t.Fatalf("%s%s is not a bare array: %s", tt.target, query, w.Body)
+                }
+                if len(bare) != tt.want {
+                    t.Errorf("%s%s has %d items, want %d", tt.target, query, len(bare), tt.want)
+                }
+            }
+
+            before := time.Now().UTC().Add(-time.Second)
+            w := serve(mux, httptest.NewRequest(http.MethodGet, tt.target+"?envelope=true", nil))
+            if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+                t.Errorf("Content-Type = %q", ct)
+            }
+            var body envelopeBody
+            if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+                t.Fatalf("decoding envelope %s: %v", w.Body, err)
+            }
+            if len(body.Data) != tt.want || body.Meta == nil || body.Meta.Total != tt.want {
+                t.Fatalf("envelope = %s, want %d items and total", w.Body, tt.want)
+            }
+            if body.Meta.GeneratedAt.Before(before) || body.Meta.GeneratedAt.After(time.Now().Add(time.Second)) {
+                t.Errorf("generated_at = %v, want now", body.Meta.GeneratedAt)
+            }
+        })
+    }
+}
+
+func TestListEnvelopeEmpty(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+
+    // An empty list is [] in both shapes, never null
+    for _, target := range []string{"/api/preferences", "/api/vehicles"} {
+        if w := serve(mux, httptest.NewRequest(http.MethodGet, target, nil)); w.Body.String() != "[]\n" {
+            t.Errorf("%s = %q, want []", target, w.Body)
+        }
+        w := serve(mux, httptest.NewRequest(http.MethodGet, target+"?envelope=true", nil))
+        var body struct {
+            Data json.RawMessage `json:"data"`
+            Meta listMetadata    `json:"meta"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+            t.Fatal(err)
+        }
+        if string(body.Data) != "[]" || body.Meta.Total != 0 {
+            t.Errorf("%s envelope = %s, want empty data", target, w.Body)
+        }
+    }
+}
+
+func TestPreferencesPageEnvelopeTotal(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+
+    // A page reports the client's total, not the page length
+    expectClientPage(mock, "default", 7, preferenceRows("b", "default", "", 1, nil), 1, 1)
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/preferences?envelope=true&limit=1&offset=1", nil))
+    var body envelopeBody
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decoding %s: %v", w.Body, err)
+    }
+    if len(body.Data) != 1 || body.Meta == nil || body.Meta.Total != 7 {
+        t.Errorf("envelope = %s, want 1 item of 7", w.Body)
+    }
+}
@@ -0,0 +1,212 @@
+// errors.go defines structured error responses shared by the API handlers.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+)
+
+// AppError is an error carrying how to respond to it: the HTTP status, a
+// machine-readable code for the frontend and a message safe to show users.
+// Handlers return or wrap these and render them with respondError.
+type AppError struct {
+    Status     int
+    Code       string        // e.g. "report_timeout", sent as "error"
+    Message    string
+    Cause      error         // Underlying error, logged but not sent
+    RetryAfter time.Duration // Sent as Retry-After when set
+}
+
+// newAppError creates an AppError, cause may be nil
+func newAppError(status int, code, message string, cause error) *AppError {
+    return &AppError{Status: status, Code: code, Message: message, Cause: cause}
+}
+
+func (e *AppError) Error() string {
+    if e.Cause != nil {
+        return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+    }
+    return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+    return e.Cause
+}
+
+// appErrorResponse is the JSON body respondError writes
+type appErrorResponse struct {
+    Error   string `json:"error"`
+    Message string `json:"message"`
+}
+
+// errMethodNotAllowed is the 405 for a method a route doesn't serve
+var errMethodNotAllowed = newAppError(http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed", nil)
+
+// databaseError is a 500 for a failed preference query, the cause is logged
+// but not sent
+func databaseError(message string, err error) *AppError {
+    return newAppError(http.StatusInternalServerError, "database_error", message, err)
+}
+
+// upstreamPausedRetryAfter is the Retry-After sent while an operator has
+// paused requests to OneStepGPS
+const upstreamPausedRetryAfter = 60 * time.Second
+
+// respondError writes err as a JSON error response.
+// Errors with their own structured bodies (unknown devices, bad pagination,
+// duplicate display names) keep them, even when wrapped in an AppError.
+// Other errors that aren't an AppError become a 502 when upstream is
+// unavailable, a 503 while requests to it are paused and a 500 otherwise,
+// with a generic message. Their cause is only logged.
+func respondError(w http.ResponseWriter, err error) {
+    var notFound *DeviceNotFoundError
+    if errors.As(err, &notFound) {
+        writeDeviceNotFound(w, notFound)
+        return
+    }
+    var pageErr *PaginationError
+    if errors.As(err, &pageErr) {
+        writePaginationError(w, pageErr)
+        return
+    }
+    if writeDuplicateDisplayName(w, err) {
+        return
+    }
+
+    var appErr *AppError
+    if !errors.As(err, &appErr) {
+        appErr = newAppError(http.StatusInternalServerError, "internal_error", "Internal server error", err)
+        switch {
+        case errors.Is(err, onestepgps.ErrUpstreamUnavailable):
+            appErr.Status, appErr.Code = http.StatusBadGateway, "upstream_unavailable"
+            appErr.Message = "OneStepGPS is unavailable"
+        case errors.Is(err, onestepgps.ErrUpstreamPaused):
+            appErr.Status, appErr.Code = http.StatusServiceUnavailable, "upstream_paused"
+            appErr.Message = "Requests to OneStepGPS are paused"
+            appErr.RetryAfter = upstreamPausedRetryAfter
+        }
+    }
+    if appErr.Status >= http.StatusInternalServerError {
+        fmt.Printf("Error %d %s: %v\n", appErr.Status, appErr.Code, err)
+    }
+
+    if appErr.RetryAfter > 0 {
+        w.Header().Set("Retry-After", strconv.Itoa(int(appErr.RetryAfter/time.Second)))
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(appErr.Status)
+    json.NewEncoder(w).Encode(appErrorResponse{Error: appErr.Code, Message: appErr.Message})
+}
+
+// ErrDeviceNotFound is matched (via errors.Is) by every DeviceNotFoundError
+var ErrDeviceNotFound = errors.New("device not found")
+
+// DeviceNotFoundError reports device ids missing from the current OneStepGPS snapshot.
+// Used by single-vehicle lookups and report device resolution.
+type DeviceNotFoundError struct {
+    DeviceIDs []string
+}
+
+func (e *DeviceNotFoundError) Error() string {
+    return fmt.Sprintf("device not found: %s", strings.Join(e.DeviceIDs, ", "))
+}
+
+// Is lets errors.Is(err, ErrDeviceNotFound) match any DeviceNotFoundError
+func (e *DeviceNotFoundError) Is(target error) bool {
+    return target == ErrDeviceNotFound
+}
+
+// deviceNotFoundResponse is the JSON body for a 404 on unknown devices
+type deviceNotFoundResponse struct {
+    Error     string   `json:"error"`
+    Message   string   `json:"message"`
+    DeviceIDs []string `json:"device_ids"`
+}
+
+// writeDeviceNotFound writes the structured 404 for a DeviceNotFoundError
+func writeDeviceNotFound(w http.ResponseWriter, err *DeviceNotFoundError) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusNotFound)
+    json.NewEncoder(w).Encode(deviceNotFoundResponse{
+        Error:     "device_not_found",
+        Message:   err.Error(),
+        DeviceIDs: err.DeviceIDs,
+    })
+}
+
+// findDevices checks that every id exists in the current device snapshot.
+// Returns a DeviceNotFoundError listing all unknown ids, in request order.
+func (h *Handler) findDevices(ctx context.Context, deviceIDs []string) error {
+    vehicles, err := h.devicesFor(ctx)
+    if err != nil {
+        return err
+    }
+
+    known := make(map[string]bool, len(vehicles))
+    for _, v := range vehicles {
+        known[v.DeviceID] = true
+    }
+
+    var missing []string
+    for _, id := range deviceIDs {
+        if !known[id] {
+            missing = append(missing, id)
+        }
+    }
+    if len(missing) > 0 {
+        return &DeviceNotFoundError{DeviceIDs: missing}
+    }
+    return nil
+}
+
+// upstreamErrorStatus maps an error from the OneStepGPS client to a response
+// status: 502 when upstream is serving non-API responses, 503 while requests
+// to it are paused, 500 otherwise
+func upstreamErrorStatus(err error) int {
+    switch {
+    case errors.Is(err, onestepgps.ErrUpstreamUnavailable):
+        return http.StatusBadGateway
+    case errors.Is(err, onestepgps.ErrUpstreamPaused):
+        return http.StatusServiceUnavailable
+    }
+    return http.StatusInternalServerError
+}
+
+// clientIDMismatch is a batch item whose client_id differs from the first item's
+type clientIDMismatch struct {
+    Index    int    `json:"index"`
+    ClientID string `json:"client_id"`
+}
+
+// clientIDMismatches lists batch items whose client_id differs from the first item
+func clientIDMismatches(prefs []models.PreferenceCreate) []clientIDMismatch {
+    var mismatches []clientIDMismatch
+    for i, p := range prefs {
+        if p.ClientID != prefs[0].ClientID {
+            mismatches = append(mismatches, clientIDMismatch{Index: i, ClientID: p.ClientID})
+        }
+    }
+    return mismatches
+}
+
+// writeClientIDMismatch sends a 400 listing the items of a mixed-client batch
+func writeClientIDMismatch(w http.ResponseWriter, expected string, mismatches []clientIDMismatch) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusBadRequest)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "error":      "mixed_client_ids",
+        "message":    fmt.Sprintf("all preferences in a batch must have client_id %q", expected),
+        "client_id":  expected,
+        "mismatches": mismatches,
+    })
+}
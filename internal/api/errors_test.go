@@ -0,0 +1,164 @@
+// errors_test.go covers the status and body of structured error responses.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/database"
+)
+
+// errorBody decodes a respondError body
+func errorBody(t *testing.T, w *httptest.ResponseRecorder) appErrorResponse {
+    t.Helper()
+    if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+        t.Fatalf("Content-Type = %q, want application/json (body %q)", ct, w.Body)
+    }
+    var body appErrorResponse
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    return body
+}
+
+func TestHandlerErrors(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{MetadataFilterKeys: []string{"color"}}, nil)
+
+    tests := []struct {
+        name       string
+        method     string
+        target     string
+        body       string
+        accept     string
+        wantStatus int
+        wantCode   string
+    }{
+        {"method not allowed by route", http.MethodPost, "/api/vehicles", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+        {"method not allowed by handler", http.MethodPatch, "/api/preferences/dev1", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+        {"invalid sort", http.MethodGet, "/api/vehicles?sort=color", "", "", http.StatusBadRequest, "invalid_sort"},
+        {"invalid order", http.MethodGet, "/api/vehicles?sort=name&order=up", "", "", http.StatusBadRequest, "invalid_sort"},
+        {"invalid shape", http.MethodGet, "/api/vehicles?shape=tree", "", "", http.StatusBadRequest, "invalid_shape"},
+        {"invalid filter", http.MethodGet, "/api/vehicles?meta.size=big", "", "", http.StatusBadRequest, "invalid_filter"},
+        {"invalid fields", http.MethodGet, "/api/vehicles?fields=nope", "", "", http.StatusBadRequest, "invalid_fields"},
+        {"fields not acceptable", http.MethodGet, "/api/vehicles?fields=device_id", "", "text/csv", http.StatusNotAcceptable, "not_acceptable"},
+        {"device id required", http.MethodPut, "/api/preferences", `{}`, "", http.StatusBadRequest, "device_id_required"},
+        {"invalid preference body", http.MethodPost, "/api/preferences", `{"device_id":`, "", http.StatusBadRequest, "invalid_body"},
+        {"invalid update body", http.MethodPut, "/api/preferences/dev1", `[]`, "", http.StatusBadRequest, "invalid_body"},
+        {"database error", http.MethodGet, "/api/preferences/dev1", "", "", http.StatusInternalServerError, "database_error"},
+        {"empty batch", http.MethodPost, "/api/preferences/batch", `[]`, "", http.StatusBadRequest, "preferences_required"},
+        {"invalid batch body", http.MethodPost, "/api/preferences/batch", `{}`, "", http.StatusBadRequest, "invalid_body"},
+        {"invalid batch mode", http.MethodPost, "/api/preferences/batch?mode=some", `[{"device_id":"dev1"}]`, "", http.StatusBadRequest, "invalid_mode"},
+        {"invalid batch item", http.MethodPost, "/api/preferences/batch", `[{"device_id":""}]`, "", http.StatusBadRequest, "invalid_preference"},
+        {"invalid zoom", http.MethodGet, "/api/vehicles/clusters?zoom=99", "", "", http.StatusBadRequest, "invalid_zoom"},
+        {"invalid bounds", http.MethodGet, "/api/vehicles/clusters?zoom=3&bounds=x", "", "", http.StatusBadRequest, "invalid_bounds"},
+        {"invalid idle threshold", http.MethodGet, "/api/vehicles/idle?threshold_minutes=abc", "", "", http.StatusBadRequest, "invalid_threshold"},
+        {"invalid stale threshold", http.MethodGet, "/api/vehicles/stale?threshold_minutes=abc", "", "", http.StatusBadRequest, "invalid_threshold"},
+        {"invalid track range", http.MethodGet, "/api/vehicles/dev1/track?from=yesterday", "", "", http.StatusBadRequest, "invalid_range"},
+        {"invalid diff body", http.MethodPost, "/api/report/diff", `{`, "", http.StatusBadRequest, "invalid_body"},
+        {"diff specs required", http.MethodPost, "/api/report/diff", `{}`, "", http.StatusBadRequest, "report_specs_required"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+            if tt.accept != "" {
+                r.Header.Set("Accept", tt.accept)
+            }
+            w := serve(mux, r)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("got %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body)
+            }
+            body := errorBody(t, w)
+            if body.Error != tt.wantCode || body.Message == "" {
+                t.Errorf("body = %+v, want error %q with a message", body, tt.wantCode)
+            }
+        })
+    }
+}
+
+func TestVehiclesUpstreamErrors(t *testing.T) {
+    tests := []struct {
+        name       string
+        upstream   http.HandlerFunc
+        wantStatus int
+        wantCode   string
+    }{
+        {"html error page", func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Set("Content-Type", "text/html")
+            w.WriteHeader(http.StatusBadGateway)
+            w.Write([]byte("<html>down</html>"))
+        }, http.StatusBadGateway, "upstream_unavailable"},
+        {"api error", func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Set("Content-Type", "application/json")
+            w.WriteHeader(http.StatusInternalServerError)
+            w.Write([]byte(`{"message":"boom"}`))
+        }, http.StatusInternalServerError, "internal_error"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, mux := newTestHandler(t, HandlerConfig{}, tt.upstream)
+            for _, target := range []string{"/api/vehicles", "/api/vehicles/dev1", "/api/vehicles/stale", "/api/vehicles/idle", "/api/vehicles/clusters?zoom=3"} {
+                w := serve(mux, httptest.NewRequest(http.MethodGet, target, nil))
+                if w.Code != tt.wantStatus {
+                    t.Fatalf("%s: got %d, want %d", target, w.Code, tt.wantStatus)
+                }
+                if body := errorBody(t, w); body.Error != tt.wantCode {
+                    t.Errorf("%s: error = %q, want %q", target, body.Error, tt.wantCode)
+                }
+            }
+        })
+    }
+}
+
+func TestVehiclesUpstreamPaused(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    h.GPSClient.Pause() // Cache is still cold, so there's nothing to serve
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles", nil))
+    if w.Code != http.StatusServiceUnavailable {
+        t.Fatalf("got %d, want 503", w.Code)
+    }
+    if got := w.Header().Get("Retry-After"); got != "60" {
+        t.Errorf("Retry-After = %q, want 60", got)
+    }
+    if body := errorBody(t, w); body.Error != "upstream_paused" {
+        t.Errorf("error = %q, want upstream_paused", body.Error)
+    }
+}
+
+func TestRespondErrorStructuredBodies(t *testing.T) {
+    conflict := &database.DisplayNameConflictError{DisplayName: "Truck", ConflictingWith: "dev2"}
+    tests := []struct {
+        name       string
+        err        error
+        wantStatus int
+        wantCode   string
+    }{
+        {"app error", newAppError(http.StatusTeapot, "teapot", "short and stout", nil), http.StatusTeapot, "teapot"},
+        {"plain error", errors.New("dial tcp 10.0.0.5:3306: connection refused"), http.StatusInternalServerError, "internal_error"},
+        {"device not found", fmt.Errorf("resolving: %w", &DeviceNotFoundError{DeviceIDs: []string{"x"}}), http.StatusNotFound, "device_not_found"},
+        {"conflict wrapped in an app error", databaseError("Error creating preference", conflict), http.StatusConflict, "duplicate_display_name"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            respondError(w, tt.err)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("got %d, want %d", w.Code, tt.wantStatus)
+            }
+            body := errorBody(t, w)
+            if body.Error != tt.wantCode {
+                t.Errorf("error = %q, want %q", body.Error, tt.wantCode)
+            }
+            // Causes are logged, a 500 doesn't show them to the client
+            if w.Code == http.StatusInternalServerError && body.Message != "Internal server error" {
+                t.Errorf("message = %q, want the generic one", body.Message)
+            }
+        })
+    }
+}
@@ -0,0 +1,193 @@
+// export.go provides serialization of vehicle data into the formats
+// supported by the /vehicles endpoint (JSON, CSV and GeoJSON).
+
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// Media types supported by /vehicles content negotiation
+const (
+    mediaTypeJSON    = "application/json"
+    mediaTypeCSV     = "text/csv"
+    mediaTypeGeoJSON = "application/geo+json"
+)
+
+// vehicleCSVHeader defines the column order for CSV output
+var vehicleCSVHeader = []string{
+    "device_id",
+    "display_name",
+    "active_state",
+    "online",
+    "drive_status",
+    "lat",
+    "lng",
+    "speed",
+    "heading",
+    "dt_tracker",
+}
+
+// negotiateVehicleFormat picks the response media type from the Accept header.
+// Entries are ranked by q-value, highest first, and the first supported one
+// wins; equal q-values keep their header order and q=0 excludes a type.
+// Falls back to JSON for missing or unrecognized types.
+func negotiateVehicleFormat(r *http.Request) string {
+    for _, mediaType := range acceptedMediaTypes(r.Header.Get("Accept")) {
+        switch mediaType {
+        case mediaTypeCSV:
+            return mediaTypeCSV
+        case mediaTypeGeoJSON:
+            return mediaTypeGeoJSON
+        case mediaTypeJSON, "*/*":
+            return mediaTypeJSON
+        }
+    }
+    return mediaTypeJSON
+}
+
+// acceptedMediaTypes parses an Accept header into media types ordered by
+// q-value. Malformed entries are skipped, a malformed q counts as 1.
+func acceptedMediaTypes(header string) []string {
+    type accepted struct {
+        mediaType string
+        q         float64
+    }
+    var entries []accepted
+    for _, part := range strings.Split(header, ",") {
+        mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+        if err != nil {
+            continue
+        }
+        q := 1.0
+        if raw, ok := params["q"]; ok {
+            if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+                q = parsed
+            }
+        }
+        if q <= 0 {
+            continue // Explicitly not acceptable
+        }
+        entries = append(entries, accepted{mediaType: mediaType, q: q})
+    }
+
+    sort.SliceStable(entries, func(i, j int) bool {
+        return entries[i].q > entries[j].q
+    })
+    mediaTypes := make([]string, len(entries))
+    for i, e := range entries {
+        mediaTypes[i] = e.mediaType
+    }
+    return mediaTypes
+}
+
+// writeVehicles serializes vehicles in the given media type.
+// JSON output honors ?envelope=true, see envelope.go.
+func writeVehicles(w http.ResponseWriter, r *http.Request, format string, vehicles []models.Vehicle) error {
+    switch format {
+    case mediaTypeCSV:
+        return writeVehiclesCSV(w, vehicles)
+    case mediaTypeGeoJSON:
+        return writeVehiclesGeoJSON(w, vehicles)
+    default:
+        return writeJSONList(w, r, vehicles, len(vehicles))
+    }
+}
+
+// writeVehiclesCSV writes one row per vehicle, leaving location columns
+// empty for vehicles without a reported position.
+func writeVehiclesCSV(w http.ResponseWriter, vehicles []models.Vehicle) error {
+    w.Header().Set("Content-Type", mediaTypeCSV+"; charset=utf-8")
+
+    writer := csv.NewWriter(w)
+    if err := writer.Write(vehicleCSVHeader); err != nil {
+        return err
+    }
+
+    for _, v := range vehicles {
+        row := []string{
+            v.DeviceID,
+            v.DisplayName,
+            v.ActiveState,
+            strconv.FormatBool(v.Online),
+            v.DriveState.Status,
+            "", "", "", "", "",
+        }
+        if loc := v.LastLocation; loc != nil {
+            row[5] = strconv.FormatFloat(loc.Latitude, 'f', -1, 64)
+            row[6] = strconv.FormatFloat(loc.Longitude, 'f', -1, 64)
+            row[7] = strconv.FormatFloat(loc.Speed, 'f', -1, 64)
+            row[8] = strconv.Itoa(loc.Heading)
+            row[9] = loc.Timestamp.Format(time.RFC3339)
+        }
+        if err := writer.Write(row); err != nil {
+            return err
+        }
+    }
+
+    writer.Flush()
+    return writer.Error()
+}
+
+// geoJSONFeatureCollection is the top-level GeoJSON document
+type geoJSONFeatureCollection struct {
+    Type     string           `json:"type"`
+    Features []geoJSONFeature `json:"features"`
+}
+
+// geoJSONFeature is a single vehicle rendered as a GeoJSON point
+type geoJSONFeature struct {
+    Type       string                 `json:"type"`
+    Geometry   *geoJSONPoint          `json:"geometry"`
+    Properties map[string]interface{} `json:"properties"`
+}
+
+// geoJSONPoint holds coordinates in GeoJSON [lng, lat] order
+type geoJSONPoint struct {
+    Type        string    `json:"type"`
+    Coordinates []float64 `json:"coordinates"`
+}
+
+// writeVehiclesGeoJSON writes vehicles as a FeatureCollection.
+// Vehicles without a position are included with a null geometry.
+func writeVehiclesGeoJSON(w http.ResponseWriter, vehicles []models.Vehicle) error {
+    collection := geoJSONFeatureCollection{
+        Type:     "FeatureCollection",
+        Features: make([]geoJSONFeature, 0, len(vehicles)),
+    }
+
+    for _, v := range vehicles {
+        feature := geoJSONFeature{
+            Type: "Feature",
+            Properties: map[string]interface{}{
+                "device_id":    v.DeviceID,
+                "display_name": v.DisplayName,
+                "active_state": v.ActiveState,
+                "online":       v.Online,
+                "drive_status": v.DriveState.Status,
+            },
+        }
+        if loc := v.LastLocation; loc != nil {
+            feature.Geometry = &geoJSONPoint{
+                Type:        "Point",
+                Coordinates: []float64{loc.Longitude, loc.Latitude},
+            }
+            feature.Properties["speed"] = loc.Speed
+            feature.Properties["heading"] = loc.Heading
+            feature.Properties["dt_tracker"] = loc.Timestamp
+        }
+        collection.Features = append(collection.Features, feature)
+    }
+
+    w.Header().Set("Content-Type", mediaTypeGeoJSON)
+    return json.NewEncoder(w).Encode(collection)
+}
@@ -0,0 +1,105 @@
+// export_test.go covers /vehicles content negotiation and serialization.
+
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+func TestNegotiateVehicleFormat(t *testing.T) {
+    tests := []struct {
+        name   string
+        accept string
+        want   string
+    }{
+        {"default", "", mediaTypeJSON},
+        {"json", "application/json", mediaTypeJSON},
+        {"csv", "text/csv", mediaTypeCSV},
+        {"geojson", "application/geo+json", mediaTypeGeoJSON},
+        {"wildcard", "*/*", mediaTypeJSON},
+        {"unrecognized", "application/xml", mediaTypeJSON},
+        {"first supported wins", "application/xml, text/csv, application/json", mediaTypeCSV},
+        {"low q loses", "text/csv;q=0.1, application/json", mediaTypeJSON},
+        {"higher q later wins", "application/json;q=0.5, application/geo+json;q=0.9", mediaTypeGeoJSON},
+        {"equal q keeps order", "text/csv;q=0.8, application/geo+json;q=0.8", mediaTypeCSV},
+        {"q zero excluded", "text/csv;q=0, application/geo+json;q=0.2", mediaTypeGeoJSON},
+        {"browser style", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", mediaTypeJSON},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodGet, "/api/vehicles", nil)
+            if tt.accept != "" {
+                r.Header.Set("Accept", tt.accept)
+            }
+            if got := negotiateVehicleFormat(r); got != tt.want {
+                t.Errorf("negotiateVehicleFormat(%q) = %q, want %q", tt.accept, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestWriteVehiclesFormats(t *testing.T) {
+    vehicles := []models.Vehicle{{
+        DeviceID:    "dev1",
+        DisplayName: "Truck 1",
+        LastLocation: &models.Location{
+            Latitude:  37.5,
+            Longitude: -122.25,
+            Speed:     42,
+            Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+        },
+    }}
+
+    t.Run("json", func(t *testing.T) {
+        w := httptest.NewRecorder()
+        r := httptest.NewRequest(http.MethodGet, "/api/vehicles", nil)
+        if err := writeVehicles(w, r, mediaTypeJSON, vehicles); err != nil {
+            t.Fatal(err)
+        }
+        var got []models.Vehicle
+        if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != 1 || got[0].DeviceID != "dev1" {
+            t.Fatalf("unexpected JSON body %s (err %v)", w.Body, err)
+        }
+    })
+
+    t.Run("csv", func(t *testing.T) {
+        w := httptest.NewRecorder()
+        r := httptest.NewRequest(http.MethodGet, "/api/vehicles", nil)
+        if err := writeVehicles(w, r, mediaTypeCSV, vehicles); err != nil {
+            t.Fatal(err)
+        }
+        if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, mediaTypeCSV) {
+            t.Errorf("Content-Type = %q, want %s", ct, mediaTypeCSV)
+        }
+        rows, err := csv.NewReader(w.Body).ReadAll()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(rows) != 2 || rows[1][0] != "dev1" || rows[1][5] != "37.5" {
+            t.Errorf("unexpected CSV rows %v", rows)
+        }
+    })
+
+    t.Run("geojson", func(t *testing.T) {
+        w := httptest.NewRecorder()
+        r := httptest.NewRequest(http.MethodGet, "/api/vehicles", nil)
+        if err := writeVehicles(w, r, mediaTypeGeoJSON, vehicles); err != nil {
+            t.Fatal(err)
+        }
+        var got geoJSONFeatureCollection
+        if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+            t.Fatal(err)
+        }
+        if len(got.Features) != 1 || got.Features[0].Geometry == nil || got.Features[0].Geometry.Coordinates[0] != -122.25 {
+            t.Errorf("unexpected GeoJSON %s", w.Body)
+        }
+    })
+}
@@ -3,51 +3,113 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/davidwiese/fleet-tracker-backend/internal/database"
 	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/notify"
 	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+	"github.com/davidwiese/fleet-tracker-backend/internal/webhook"
+	"github.com/davidwiese/fleet-tracker-backend/internal/websocket"
+	"golang.org/x/sync/singleflight"
 )
 
-const (
-    baseURL = "https://track.onestepgps.com/v3/api/public"
-)
-
-
 // Handler manages API endpoints and holds required dependencies.
 // Used throughout the application to handle HTTP requests.
 type Handler struct {
     DB               *database.DB
     BroadcastChannel chan []models.Vehicle
     GPSClient        *onestepgps.Client
+    Hub              *websocket.Hub
     config           HandlerConfig
+    maintenance      atomic.Bool // Blocks mutating requests when true, see maintenance.go
+    origins          atomic.Pointer[originSet] // Allowed CORS origins, swapped by CORSReloadHandler
+    reportGroup      singleflight.Group // Deduplicates identical concurrent report generations
+    reports          *reportTracker     // Recent generations retrievable after a client disconnect
+    reportSlots      chan struct{}      // Semaphore bounding concurrent generations
+    reportDurations  *durationHistogram // Total generation time, see report_metrics.go
+    limiter          *rateLimiter       // Per-address request limit, nil when disabled, see ratelimit.go
+    units            *unitsCache        // Stored unit preferences per client, see units.go
 }
 
 // HandlerConfig holds API configuration settings
 type HandlerConfig struct {
     OneStepGPSAPIKey string
-    BaseURL          string
+    BaseURL          string // OneStepGPS API root, defaults to the one gpsClient was built with
+    AdminAPIKey      string // Required bearer token for admin routes, admin disabled when empty
+    WebhookSecret    string // Shared secret for OneStepGPS webhooks, webhook route disabled when empty
+    WebhookVerifier  webhook.Verifier // Signature algorithm and replay tolerance for webhooks
+    MaintenanceMode  bool   // Start with mutating endpoints disabled
+    ReportOutputFields []string // Output fields this account supports, defaultReportOutputFields when empty
+    DebugEndpoints   bool   // Enables /api/debug routes (still admin-only)
+    MaxConcurrentReports int           // Upstream generations allowed at once, defaults to 4
+    ReportQueueTimeout   time.Duration // How long a report waits for a free slot before 429
+    Notifier         notify.Notifier // Told when a report finishes, notify.Noop when nil
+    PublicBaseURL    string          // Prefix for links in notifications, relative links when empty
+    DefaultPageSize  int             // limit used by paginated endpoints when none is given
+    MaxPageSize      int             // Upper bound requested limits are clamped to
+    TenantBaseDomain string            // Domain whose subdomains name tenants, tenancy disabled when empty
+    Tenants          map[string]string // Subdomain -> client_id
+    UniqueDisplayNames bool            // Reject duplicate display names within a client with 409
+    MaxPollAge       time.Duration     // /readyz fails when the last successful poll is older, 0 disables
+    CORSAllowCredentials bool          // Echo Access-Control-Allow-Credentials to allowed origins
+    CORSMaxAge       int               // Preflight cache lifetime in seconds, omitted when 0
+    RequestTimeout   time.Duration     // Default per-request timeout, 0 for none
+    RouteTimeouts    map[string]time.Duration // Route path -> timeout, overrides RequestTimeout
+    MetadataFilterKeys []string        // Preference metadata keys allowed in /vehicles?meta.<key>=
+    StrictQueryParams bool             // 400 on query params a route doesn't list, see strict_params.go
+    PreferenceDefaults models.PreferenceDefaults // Visibility and order of devices without a preference
+    RateLimitPerMinute int             // Requests allowed per client address per minute, 0 disables
+    RateLimitBurst     int             // Requests a client address may make at once, RateLimitPerMinute when 0
+    TrustedProxyHops   int             // Proxies in front that append to X-Forwarded-For, see clientAddress
 }
 
 // NewHandler creates and initializes a Handler with required dependencies.
 // Called in main.go to set up the application's request handler.
-func NewHandler(db *database.DB, broadcastChannel chan []models.Vehicle, gpsClient *onestepgps.Client, config HandlerConfig) *Handler {
+func NewHandler(db *database.DB, hub *websocket.Hub, gpsClient *onestepgps.Client, config HandlerConfig) *Handler {
     if config.BaseURL == "" {
-        config.BaseURL = baseURL
+        config.BaseURL = gpsClient.BaseURL()
+    }
+    if len(config.ReportOutputFields) == 0 {
+        config.ReportOutputFields = defaultReportOutputFields
+    }
+    if config.MaxConcurrentReports <= 0 {
+        config.MaxConcurrentReports = 4
+    }
+    if config.DefaultPageSize <= 0 {
+        config.DefaultPageSize = defaultPageSize
+    }
+    if config.MaxPageSize <= 0 {
+        config.MaxPageSize = maxPageSize
     }
-    return &Handler{
+    if config.DefaultPageSize > config.MaxPageSize {
+        config.DefaultPageSize = config.MaxPageSize
+    }
+    if config.Notifier == nil {
+        config.Notifier = notify.Noop{}
+    }
+    h := &Handler{
         DB:               db,
-        BroadcastChannel: broadcastChannel,
+        BroadcastChannel: hub.Broadcast,
         GPSClient:        gpsClient,
+        Hub:              hub,
         config:           config,
-    }
+        reports:          newReportTracker(),
+        reportSlots:      make(chan struct{}, config.MaxConcurrentReports),
+        reportDurations:  newDurationHistogram(reportDurationBuckets),
+        limiter:          newRateLimiter(config.RateLimitPerMinute, config.RateLimitBurst),
+        units:            newUnitsCache(),
+    }
+    h.maintenance.Store(config.MaintenanceMode)
+    h.origins.Store(newOriginSet(loadAllowedOrigins()))
+    return h
 }
 
 // VehiclesHandler handles GET requests to "/vehicles" endpoint.
@@ -57,20 +119,172 @@ func (h *Handler) VehiclesHandler(w http.ResponseWriter, r *http.Request) {
     case http.MethodGet:
         h.getVehicles(w, r)
     default:
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        respondError(w, errMethodNotAllowed)
     }
 }
 
+// VehicleHandler handles requests under "/vehicles/{deviceID}".
+// GET returns a single vehicle from the current OneStepGPS snapshot,
+// GET /vehicles/{deviceID}/track returns its point history (see track.go).
+func (h *Handler) VehicleHandler(w http.ResponseWriter, r *http.Request) {
+    deviceID := strings.TrimPrefix(r.URL.Path, "/api/vehicles/")
+    if id, ok := strings.CutSuffix(deviceID, "/track"); ok && id != "" && !strings.Contains(id, "/") {
+        if r.Method != http.MethodGet {
+            respondError(w, errMethodNotAllowed)
+            return
+        }
+        h.getVehicleTrack(w, r, id)
+        return
+    }
+    if deviceID == "" || strings.Contains(deviceID, "/") {
+        http.NotFound(w, r)
+        return
+    }
+
+    switch r.Method {
+    case http.MethodGet:
+        h.getVehicle(w, r, deviceID)
+    default:
+        respondError(w, errMethodNotAllowed)
+    }
+}
+
+// getVehicle returns one vehicle, or a structured 404 if it isn't in the snapshot.
+func (h *Handler) getVehicle(w http.ResponseWriter, r *http.Request, deviceID string) {
+    vehicles, err := h.GPSClient.GetDevicesCached(deviceCacheMaxAge)
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+
+    for _, v := range vehicles {
+        if v.DeviceID == deviceID {
+            units, err := h.resolveUnits(r)
+            if err != nil {
+                respondError(w, err)
+                return
+            }
+            converted := []models.Vehicle{v}
+            units.apply(converted)
+            v = converted[0]
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(v)
+            return
+        }
+    }
+
+    writeDeviceNotFound(w, &DeviceNotFoundError{DeviceIDs: []string{deviceID}})
+}
+
+// deviceCacheMaxAge is how old a cached device list may be when served by
+// GET /api/vehicles and its stale, idle and cluster views, matching the hub's poll interval
+const deviceCacheMaxAge = 5 * time.Second
+
 // getVehicles fetches all vehicles from OneStepGPS API and returns them to the client.
-func (h *Handler) getVehicles(w http.ResponseWriter, _ *http.Request) {
-    vehicles, err := h.GPSClient.GetDevices()
+// The response format is negotiated from the Accept header (JSON, CSV or GeoJSON).
+// Supports ?sort=name|speed|status|last_seen|preference&order=asc|desc.
+// Supports If-Modified-Since against the device list's fetch time, see conditional.go.
+// Supports ?units=metric|imperial, defaulting to each vehicle's stored units, see units.go.
+// Supports ?fields=device_id,lat,lng for a lightweight JSON payload, see models.ParseVehicleFields.
+// Supports ?shape=map for a JSON object keyed by device_id, see vehicle_shape.go.
+func (h *Handler) getVehicles(w http.ResponseWriter, r *http.Request) {
+    // ?meta.<key>=value keeps vehicles whose preference metadata matches
+    filters, err := h.parseMetadataFilters(r)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        respondError(w, err)
         return
     }
 
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(vehicles)
+    shape, err := parseVehicleShape(r)
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    if shape == shapeMap && negotiateVehicleFormat(r) != mediaTypeJSON {
+        respondError(w, newAppError(http.StatusNotAcceptable, "not_acceptable", fmt.Sprintf("shape=map is only supported for %s", mediaTypeJSON), nil))
+        return
+    }
+
+    vehicles, fetchedAt, err := h.GPSClient.GetDevicesCachedAt(deviceCacheMaxAge)
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+
+    units, err := h.resolveUnits(r)
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+
+    // Last-Modified is when this device list was fetched. Responses that also
+    // depend on the client's preferences can change without a new fetch, so
+    // they are never answered with 304.
+    if !preferenceDependent(r, filters, units) && notModified(w, r, fetchedAt) {
+        return
+    }
+
+    if len(filters) > 0 {
+        if vehicles, err = h.filterVehiclesByMetadata(r.Context(), resolveClientID(r), vehicles, filters); err != nil {
+            respondError(w, databaseError("Error fetching preferences", err))
+            return
+        }
+    }
+
+    if err := h.sortVehiclesFromQuery(r, vehicles); err != nil {
+        respondError(w, err)
+        return
+    }
+
+    units.apply(vehicles)
+
+    // ?fields= projects JSON output down to the requested fields
+    if raw := r.URL.Query().Get("fields"); raw != "" {
+        fields, err := models.ParseVehicleFields(raw)
+        if err != nil {
+            respondError(w, newAppError(http.StatusBadRequest, "invalid_fields", err.Error(), err))
+            return
+        }
+        if format := negotiateVehicleFormat(r); format != mediaTypeJSON {
+            respondError(w, newAppError(http.StatusNotAcceptable, "not_acceptable", fmt.Sprintf("fields is only supported for %s", mediaTypeJSON), nil))
+            return
+        }
+        w.Header().Set("Vary", "Accept")
+        projected := models.ProjectVehicles(vehicles, fields)
+        if shape == shapeMap {
+            byID := vehiclesByID(vehicles, func(i int) interface{} { return projected[i] })
+            writeJSONList(w, r, byID, len(byID))
+            return
+        }
+        writeJSONList(w, r, projected, len(vehicles))
+        return
+    }
+
+    w.Header().Set("Vary", "Accept")
+    if shape == shapeMap {
+        byID := vehiclesByID(vehicles, func(i int) interface{} { return vehicles[i] })
+        writeJSONList(w, r, byID, len(byID))
+        return
+    }
+    if err := writeVehicles(w, r, negotiateVehicleFormat(r), vehicles); err != nil {
+        fmt.Printf("Error writing vehicles: %v\n", err)
+    }
+}
+
+// Errors shared by the preference handlers
+var (
+    errDeviceIDRequired   = newAppError(http.StatusBadRequest, "device_id_required", "Device ID required", nil)
+    errPreferenceNotFound = newAppError(http.StatusNotFound, "preference_not_found", "Preference not found", nil)
+)
+
+// invalidPreferenceBody is a 400 for a preference body that isn't valid JSON
+func invalidPreferenceBody(err error) *AppError {
+    return newAppError(http.StatusBadRequest, "invalid_body", fmt.Sprintf("Invalid request body: %v", err), err)
+}
+
+// invalidPreference is a 400 for a preference failing validation
+func invalidPreference(err error) *AppError {
+    return newAppError(http.StatusBadRequest, "invalid_preference", fmt.Sprintf("Invalid preference: %v", err), err)
 }
 
 // PreferencesHandler manages all preference-related requests.
@@ -82,6 +296,16 @@ func (h *Handler) PreferencesHandler(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/preferences")
 	deviceID := strings.TrimPrefix(path, "/")
 
+    // GET /preferences/{deviceID}/effective resolves the shown display name
+    if id, ok := strings.CutSuffix(deviceID, "/effective"); ok && id != "" && !strings.Contains(id, "/") {
+        if r.Method != http.MethodGet {
+            respondError(w, errMethodNotAllowed)
+            return
+        }
+        h.getEffectivePreference(w, r, id)
+        return
+    }
+
     // Route to appropriate handler based on HTTP method
 	switch r.Method {
 	case http.MethodGet:
@@ -94,85 +318,212 @@ func (h *Handler) PreferencesHandler(w http.ResponseWriter, r *http.Request) {
 		h.createPreference(w, r)
 	case http.MethodPut:
 		if deviceID == "" {
-			http.Error(w, "Device ID required", http.StatusBadRequest)
+			respondError(w, errDeviceIDRequired)
 			return
 		}
 		h.updatePreference(w, r, deviceID)
 	case http.MethodDelete:
 		if deviceID == "" {
-			http.Error(w, "Device ID required", http.StatusBadRequest)
+			respondError(w, errDeviceIDRequired)
 			return
 		}
 		h.deletePreference(w, r, deviceID)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, errMethodNotAllowed)
 	}
 }
 
 // BatchUpdatePreferences handles bulk preference updates in a single transaction.
 // Called from VehiclePreferences.vue when performing operations like "Show All" or "Hide All".
+// With ?mode=best_effort valid items are applied even if others fail (see batchUpdateBestEffort).
+// With ?summary=true the atomic response also lists created/updated/unchanged device ids.
 func (h *Handler) BatchUpdatePreferences(w http.ResponseWriter, r *http.Request) {
     var preferences []models.PreferenceCreate
     if err := json.NewDecoder(r.Body).Decode(&preferences); err != nil {
-        http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+        respondError(w, invalidPreferenceBody(err))
         return
     }
 
     // Validate request
     if len(preferences) == 0 {
-        http.Error(w, "No preferences provided", http.StatusBadRequest)
+        respondError(w, newAppError(http.StatusBadRequest, "preferences_required", "No preferences provided", nil))
+        return
+    }
+
+    // Items without a client_id belong to the requesting client
+    for i := range preferences {
+        preferences[i].ClientID = resolveBodyClientID(r, preferences[i].ClientID)
+    }
+
+    // A batch belongs to a single client, in both modes, so it can't write
+    // into another client's preferences
+    if mismatches := clientIDMismatches(preferences); len(mismatches) > 0 {
+        writeClientIDMismatch(w, preferences[0].ClientID, mismatches)
+        return
+    }
+
+    // ?mode=best_effort applies valid items individually instead of all-or-nothing
+    switch mode := r.URL.Query().Get("mode"); mode {
+    case "", "atomic":
+    case "best_effort":
+        h.batchUpdateBestEffort(w, preferences)
+        return
+    default:
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_mode", fmt.Sprintf("Invalid mode %q: must be atomic or best_effort", mode), nil))
         return
     }
 
+    // All-or-nothing: a single invalid item rejects the whole batch
+    for i := range preferences {
+        if err := preferences[i].Validate(); err != nil {
+            respondError(w, newAppError(http.StatusBadRequest, "invalid_preference", fmt.Sprintf("Invalid preference at index %d: %v", i, err), err))
+            return
+        }
+    }
+
     // Start database transaction
     tx, err := h.DB.Begin()
     if err != nil {
-        http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+        respondError(w, databaseError("Error starting transaction", err))
         return
     }
     defer tx.Rollback() // Rollback transaction if error occurs/not committed
 
-    // Process each preference in the transaction
+    // Process each preference in the transaction, comparing against the
+    // stored row first so the summary says what actually changed
+    summary := batchSummary{Created: []string{}, Updated: []string{}, Unchanged: []string{}}
     for _, pref := range preferences {
+        existing, err := h.DB.GetPreferenceByDeviceAndClientID(pref.DeviceID, pref.ClientID, tx)
+        if err != nil {
+            respondError(w, databaseError("Error reading preference", err))
+            return // Rollback will happen from defer
+        }
+        switch {
+        case existing == nil:
+            summary.Created = append(summary.Created, pref.DeviceID)
+        case pref.Matches(existing):
+            summary.Unchanged = append(summary.Unchanged, pref.DeviceID)
+        default:
+            summary.Updated = append(summary.Updated, pref.DeviceID)
+        }
+
         // Use transaction for all operations
-        _, err := h.DB.CreatePreference(&pref, tx)
+        _, err = h.savePreferenceTx(&pref, tx)
         if err != nil {
-            http.Error(w, fmt.Sprintf("Error updating preference: %v", err), http.StatusInternalServerError)
+            respondError(w, databaseError("Error updating preference", err))
             return // Rollback will happen from defer
         }
     }
 
     // Commit transaction if all updates succeeded
     if err := tx.Commit(); err != nil {
-        http.Error(w, fmt.Sprintf("Error committing transaction: %v", err), http.StatusInternalServerError)
+        respondError(w, databaseError("Error committing transaction", err))
         return
     }
+    h.units.invalidate(preferences[0].ClientID)
 
     // Get updated preferences
-    clientID := preferences[0].ClientID // All preferences should have same clientID
+    clientID := preferences[0].ClientID // Checked above, every item has the same client id
     updatedPrefs, err := h.DB.GetAllPreferencesForClient(clientID)
     if err != nil {
-        http.Error(w, fmt.Sprintf("Error fetching updated preferences: %v", err), http.StatusInternalServerError)
+        respondError(w, databaseError("Error fetching updated preferences", err))
         return
     }
 
-    // Return updated preferences
+    // Return updated preferences, with ?summary=true alongside the change summary
     w.Header().Set("Content-Type", "application/json")
+    if r.URL.Query().Get("summary") == "true" {
+        summary.Preferences = updatedPrefs
+        json.NewEncoder(w).Encode(summary)
+        return
+    }
     json.NewEncoder(w).Encode(updatedPrefs)
 }
 
+// batchSummary is the ?summary=true response of an atomic batch update.
+// Device ids are grouped by the effect their item had.
+type batchSummary struct {
+    Created     []string                `json:"created"`
+    Updated     []string                `json:"updated"`
+    Unchanged   []string                `json:"unchanged"`
+    Preferences []models.UserPreference `json:"preferences"` // The client's full list after the batch
+}
+
+// batchItemResult reports the outcome of one item in a best-effort batch
+type batchItemResult struct {
+    Index    int    `json:"index"`
+    DeviceID string `json:"device_id"`
+    Status   int    `json:"status"`
+    Error    string `json:"error,omitempty"`
+}
+
+// batchUpdateBestEffort validates and writes each preference on its own,
+// keeping successful writes even when other items fail.
+// Responds 207 Multi-Status with a per-item result list.
+func (h *Handler) batchUpdateBestEffort(w http.ResponseWriter, preferences []models.PreferenceCreate) {
+    results := make([]batchItemResult, 0, len(preferences))
+    succeeded := 0
+
+    for i := range preferences {
+        pref := preferences[i]
+        result := batchItemResult{Index: i, DeviceID: pref.DeviceID, Status: http.StatusOK}
+
+        if err := pref.Validate(); err != nil {
+            result.Status = http.StatusBadRequest
+            result.Error = err.Error()
+        } else if _, err := h.savePreference(&pref); err != nil {
+            result.Status = http.StatusInternalServerError
+            if errors.Is(err, database.ErrDuplicateDisplayName) {
+                result.Status = http.StatusConflict
+            }
+            result.Error = err.Error()
+        } else {
+            succeeded++
+        }
+        results = append(results, result)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusMultiStatus)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "succeeded": succeeded,
+        "failed":    len(preferences) - succeeded,
+        "results":   results,
+    })
+}
+
 // getAllPreferences fetches all preferences for the current client.
+// Supports ?envelope=true to wrap the list with metadata.
 func (h *Handler) getAllPreferences(w http.ResponseWriter, r *http.Request) {
-    // Get client_id from query parameter
-    clientID := r.URL.Query().Get("client_id")
-    if clientID == "" {
-        clientID = "default"
+    // Resolve client from X-Client-ID or ?client_id=, see client_id.go
+    clientID := resolveClientID(r)
+
+    // ?limit=/?offset= are opt-in, VehiclePreferences.vue still loads every preference.
+    // Bad values are rejected here with a structured 400 instead of reaching SQL.
+    query := r.URL.Query()
+    if query.Has("limit") || query.Has("offset") {
+        page, perr := parsePagination(r, h.config.DefaultPageSize, h.config.MaxPageSize)
+        if perr != nil {
+            writePaginationError(w, perr)
+            return
+        }
+
+        preferences, total, err := h.DB.GetPreferencesPageForClient(clientID, page.Limit, page.Offset)
+        if err != nil {
+            respondError(w, databaseError("Error fetching preferences", err))
+            return
+        }
+        if preferences == nil {
+            preferences = []models.UserPreference{}
+        }
+        writeJSONList(w, r, preferences, total)
+        return
     }
 
     // Fetch preferences from database
     preferences, err := h.DB.GetAllPreferencesForClient(clientID)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        respondError(w, databaseError("Error fetching preferences", err))
         return
     }
 
@@ -180,25 +531,21 @@ func (h *Handler) getAllPreferences(w http.ResponseWriter, r *http.Request) {
         preferences = []models.UserPreference{}
     }
 
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(preferences)
+    writeJSONList(w, r, preferences, len(preferences))
 }
 
 // getPreference fetches a single preference by device ID and client ID.
 func (h *Handler) getPreference(w http.ResponseWriter, r *http.Request, deviceID string) {
-    clientID := r.URL.Query().Get("client_id")
-    if clientID == "" {
-        clientID = "default"
-    }
+    clientID := resolveClientID(r)
 
     pref, err := h.DB.GetPreferenceByDeviceAndClientID(deviceID, clientID, nil)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        respondError(w, databaseError("Error fetching preference", err))
         return
     }
 
     if pref == nil {
-        http.Error(w, "Preference not found", http.StatusNotFound)
+        respondError(w, errPreferenceNotFound)
         return
     }
 
@@ -213,23 +560,26 @@ func (h *Handler) createPreference(w http.ResponseWriter, r *http.Request) {
     var newPref models.PreferenceCreate
     if err := json.NewDecoder(r.Body).Decode(&newPref); err != nil {
         fmt.Printf("Error decoding request body: %v\n", err)
-        http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+        respondError(w, invalidPreferenceBody(err))
         return
     }
 
     fmt.Printf("Received preference create request: %+v\n", newPref)
 
-    // Set default client ID if not provided
-    if newPref.ClientID == "" {
-        newPref.ClientID = "default"
+    // An explicit client_id in the body wins unless a tenant is set
+    newPref.ClientID = resolveBodyClientID(r, newPref.ClientID)
+
+    // Reject oversized fields and metadata before touching the database
+    if err := newPref.Validate(); err != nil {
+        respondError(w, invalidPreference(err))
+        return
     }
 
-    // Create or update preference in database
-    // Pass nil as execer since we're not in a transaction
-    pref, err := h.DB.CreatePreference(&newPref, nil)  // Pass nil as execer
+    // Create or update preference in database, see savePreference
+    pref, err := h.savePreference(&newPref)
     if err != nil {
         fmt.Printf("Error creating preference: %v\n", err)
-        http.Error(w, fmt.Sprintf("Error creating preference: %v", err), http.StatusInternalServerError)
+        respondError(w, databaseError("Error creating preference", err))
         return
     }
 
@@ -244,32 +594,33 @@ func (h *Handler) createPreference(w http.ResponseWriter, r *http.Request) {
 
 // updatePreference updates an existing preference for the current client.
 func (h *Handler) updatePreference(w http.ResponseWriter, r *http.Request, deviceID string) {
-    clientID := r.URL.Query().Get("client_id")
-    if clientID == "" {
-        clientID = "default"
-    }
+    clientID := resolveClientID(r)
 
     var updates models.PreferenceUpdate
     if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        respondError(w, invalidPreferenceBody(err))
+        return
+    }
+    if err := updates.Validate(); err != nil {
+        respondError(w, invalidPreference(err))
         return
     }
 
     // Try to get existing preference first
     existing, err := h.DB.GetPreferenceByDeviceAndClientID(deviceID, clientID, nil)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        respondError(w, databaseError("Error fetching preference", err))
         return
     }
 
     if existing == nil {
-        http.Error(w, "Preference not found", http.StatusNotFound)
+        respondError(w, errPreferenceNotFound)
         return
     }
 
-    pref, err := h.DB.UpdatePreferenceByDeviceAndClientID(deviceID, clientID, &updates, nil)
+    pref, err := h.updatePreferenceChecked(deviceID, clientID, &updates)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        respondError(w, databaseError("Error updating preference", err))
         return
     }
     fmt.Printf("Preference updated: %+v\n", pref)
@@ -281,16 +632,14 @@ func (h *Handler) updatePreference(w http.ResponseWriter, r *http.Request, devic
 
 // deletePreference deletes a preference for the current client.
 func (h *Handler) deletePreference(w http.ResponseWriter, r *http.Request, deviceID string) {
-    clientID := r.URL.Query().Get("client_id")
-    if clientID == "" {
-        clientID = "default"
-    }
+    clientID := resolveClientID(r)
 
     err := h.DB.DeletePreference(deviceID, clientID)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        respondError(w, databaseError("Error deleting preference", err))
         return
     }
+    h.units.invalidate(clientID)
 
     w.WriteHeader(http.StatusNoContent)
 }
@@ -300,11 +649,13 @@ func (h *Handler) deletePreference(w http.ResponseWriter, r *http.Request, devic
 // 1. Initiates report generation with OneStepGPS
 // 2. Polls for completion
 // 3. Downloads and streams the completed report to the client
+// If the request times out first it gets a 202 pointing at /report/status/{id}.
+// See reports.go for the generation pipeline.
 func (h *Handler) GenerateReportHandler(w http.ResponseWriter, r *http.Request) {
     fmt.Println("GenerateReportHandler called")
 
     if r.Method != http.MethodPost {
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        respondError(w, errMethodNotAllowed)
         return
     }
 
@@ -313,205 +664,196 @@ func (h *Handler) GenerateReportHandler(w http.ResponseWriter, r *http.Request)
         ReportSpec models.ReportSpec `json:"report_spec"`
     }
     
-    body, err := io.ReadAll(r.Body)
-    if err != nil {
-        http.Error(w, "Error reading request body", http.StatusBadRequest)
+    if preset := r.URL.Query().Get("preset"); preset != "" {
+        // ?preset=name generates a saved spec, see report_presets.go
+        spec, ok := h.loadPresetSpec(w, r, preset)
+        if !ok {
+            return
+        }
+        fmt.Printf("Generating report from preset %q\n", preset)
+        incomingReq.ReportSpec = spec
+    } else {
+        // Empty bodies get a clear 400 instead of "unexpected end of JSON input"
+        body, ok := readReportBody(w, r)
+        if !ok {
+            return
+        }
+        fmt.Printf("Incoming request body: %s\n", string(body))
+
+        if err := json.Unmarshal(body, &incomingReq); err != nil {
+            respondError(w, invalidReportBody(err))
+            return
+        }
+    }
+
+    // all_devices reports skip the client's hidden vehicles by default
+    clientID := resolveClientID(r)
+    if err := h.expandAllDevices(r.Context(), &incomingReq.ReportSpec, clientID); err != nil {
+        respondError(w, err)
         return
     }
-    fmt.Printf("Incoming request body: %s\n", string(body))
 
-    if err := json.Unmarshal(body, &incomingReq); err != nil {
-        http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+    // Reject empty device ids and drop duplicates before hitting upstream
+    if err := incomingReq.ReportSpec.Validate(); err != nil {
+        respondError(w, invalidReportSpec(err))
         return
     }
 
-    // Construct API request using the incoming spec directly
-    // Some of this is probably redundant or could be cleaned up with defaults
-    apiReq := models.ReportRequest{
-    DateTimeFrom: incomingReq.ReportSpec.DateTimeFrom,
-    DateTimeTo:   incomingReq.ReportSpec.DateTimeTo,
-    DeviceIDList: incomingReq.ReportSpec.DeviceIDList,
-    ReportType:   "general_info",
-    UserReportName: incomingReq.ReportSpec.UserReportName,
-    ReportOutputFieldList: []string{
-        "device_id",
-        "device_name",
-        "groups",
-        "route_length",
-        "move_duration",
-        "stop_duration",
-        "stop_count",
-        "speed_top",
-        "speed_avg",
-        "speed_count",
-        "engine_work",
-        "engine_idle",
-        "engine_time",
-    },
-    ReportOptions: map[string]interface{}{
-        "display_decimal_places": 1,
-        "duration_format": "standard",
-        "min_stop_duration": map[string]interface{}{
-            "value": 5,
-            "unit": "m",
-            "display": "5m",
-        },
-        "use_pdf_landscape": true,
-    },
-    ReportOptionsGeneralInfo: map[string]interface{}{
-        "minimum_speeding_threshold": map[string]interface{}{
-            "value": 50,
-            "unit": "mph",
-            "display": "50 mph",
-        },
-        "use_nonmerged_layout": false,
-    },
-}
+    // Every requested device must exist in the account, unknown ones get a structured 404
+    if err := h.findDevices(r.Context(), incomingReq.ReportSpec.DeviceIDList); err != nil {
+        respondError(w, err)
+        return
+    }
 
-    // Initialize report generation with OneStepGPS API
-    generateURL := fmt.Sprintf("%s/report/generate", h.config.BaseURL)
-    jsonData, err := json.Marshal(apiReq)
+    // Utilization reports can exclude vehicles that were idle all period
+    deviceIDs, err := h.filterActiveDevices(r.Context(), incomingReq.ReportSpec)
     if err != nil {
-        http.Error(w, "Error preparing request", http.StatusInternalServerError)
+        respondError(w, err)
         return
     }
+    incomingReq.ReportSpec.DeviceIDList = deviceIDs
 
-    fmt.Printf("Sending request to OneStepGPS: %s\n", string(jsonData))
-
-    // Send report generation request to OneStepGPS API
-    generateReq, _ := http.NewRequest("POST", generateURL, bytes.NewBuffer(jsonData))
-    generateReq.Header.Set("Content-Type", "application/json")
-    generateReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", h.config.OneStepGPSAPIKey))
-
-    resp, err := http.DefaultClient.Do(generateReq)
+    // Requested output fields must be supported by this deployment
+    fields, err := h.resolveOutputFields(incomingReq.ReportSpec.ReportOutputFieldList)
     if err != nil {
-        fmt.Printf("Error making request: %v\n", err)
-        http.Error(w, fmt.Sprintf("Error generating report: %v", err), http.StatusInternalServerError)
+        respondError(w, invalidReportSpec(err))
         return
     }
-    defer resp.Body.Close()
 
-    // Parse initial response to get report ID
-    respBody, err := io.ReadAll(resp.Body)
+    // So must the export formats, checked now rather than after generating
+    fileTypes, err := h.resolveReportFormats(incomingReq.ReportSpec)
     if err != nil {
-        http.Error(w, "Error reading response", http.StatusInternalServerError)
+        respondError(w, invalidReportSpec(err))
         return
     }
-    fmt.Printf("Initial response: %s\n", string(respBody))
 
-    // Define a local struct to match the JSON response structure from OneStepGPS
-    // Get report ID for polling status
-    var generateResponse struct {
-        ReportGeneratedID string `json:"report_generated_id"`
-        Status           string `json:"status"`
-        Error            string `json:"error"`
-    }
+    // Construct API request using the incoming spec directly
+    apiReq := buildReportRequest(incomingReq.ReportSpec, fields)
 
-    // Unmarshal (parse) the JSON response into our struct
-    if err := json.Unmarshal(respBody, &generateResponse); err != nil {
-        http.Error(w, "Error parsing response", http.StatusInternalServerError)
+    // Identical concurrent requests share a single upstream generation
+    key, err := reportKey(&apiReq)
+    if err != nil {
+        respondError(w, newAppError(http.StatusInternalServerError, "internal_error", "Error preparing request", err))
         return
     }
 
-    // Check if the API returned an error message
-    if generateResponse.Error != "" {
-        fmt.Printf("Error from API: %s\n", generateResponse.Error)
-        http.Error(w, generateResponse.Error, http.StatusInternalServerError)
-        return
+    // Track the generation under the client's request id so it can be
+    // fetched from /report/status/{id} if the client disconnects mid-poll,
+    // only by the same client
+    requestID := r.Header.Get("X-Request-ID")
+    if requestID == "" {
+        requestID = newRequestID()
+    }
+    w.Header().Set("X-Request-ID", requestID)
+    tracked := h.reports.start(clientID, requestID, key)
+
+    // Generation runs detached from the request so a disconnect doesn't cancel it
+    go func() {
+        result, shared, err := h.generateReportDeduped(&apiReq, key)
+        if err == nil {
+            // Shared generations can still be exported in different formats
+            own := *result
+            own.FileTypes = fileTypes
+            result = &own
+            h.reports.alias(clientID, result.ReportID, tracked)
+            if shared {
+                fmt.Printf("Report %s shared with a concurrent identical request\n", result.ReportID)
+            }
+        }
+        tracked.finish(result, err)
+        h.notifyReport(requestID, incomingReq.ReportSpec.UserReportName, result, err)
+    }()
+
+    select {
+    case <-tracked.done:
+        h.writeReportResult(w, tracked.result, tracked.err)
+    case <-r.Context().Done():
+        if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+            fmt.Printf("Request timed out, report still tracked under request id %s\n", requestID)
+        } else {
+            fmt.Printf("Client disconnected, report still tracked under request id %s\n", requestID)
+        }
+        // Point the client at the status route. After a disconnect the write
+        // usually goes nowhere, but a client behind a proxy that cancelled the
+        // upstream request may still receive it.
+        h.writeReportPending(w, requestID, tracked)
     }
+}
 
-    // Store the report ID for polling
-    // Reports are generated asynchronously, so we need to poll for completion
-    reportID := generateResponse.ReportGeneratedID
-    maxAttempts := 60 // Will try for 60 seconds before (1 attempt per second)
-    
-    // Start polling loop - similar to setInterval in JavaScript
-    // but using a for loop with sleep instead
-    for attempt := 0; attempt < maxAttempts; attempt++ {
-        fmt.Printf("Checking status attempt %d/%d\n", attempt+1, maxAttempts)
-        
-        // Construct URL for status check endpoint
-        statusURL := fmt.Sprintf("%s/report-generated/%s", h.config.BaseURL, reportID)
-
-        // Create new GET request with authorization header to check status
-        statusReq, _ := http.NewRequest("GET", statusURL, nil)
-        statusReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", h.config.OneStepGPSAPIKey))
-
-        // Send the request and get the response to check status
-        statusResp, err := http.DefaultClient.Do(statusReq)
-        if err != nil {
-            http.Error(w, "Error checking status", http.StatusInternalServerError)
-            return
-        }
+// pendingWriteGrace is how long the 202 for a timed-out generation may take
+// to write, the request's own write deadline may have already passed
+const pendingWriteGrace = 5 * time.Second
 
-        // Read response body into []byte
-        statusBody, err := io.ReadAll(statusResp.Body)
-        statusResp.Body.Close()
-        if err != nil {
-            http.Error(w, "Error reading status", http.StatusInternalServerError)
-            return
-        }
-        
-        fmt.Printf("Status response: %s\n", string(statusBody))
-
-        // Define a local struct to match the JSON response structure from OneStepGPS
-        var statusResponse struct {
-            Status     string `json:"status"`
-            Error      string `json:"error"`
-            OutputPath string `json:"OutputFilePath"`
-        }
+// writeReportPending responds 202 for a generation still running when the
+// request timed out or was cancelled, with Location pointing at /report/status/{requestID}
+func (h *Handler) writeReportPending(w http.ResponseWriter, requestID string, tracked *trackedReport) {
+    _ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(pendingWriteGrace))
 
-        // Parse status response JSON into struct
-        if err := json.Unmarshal(statusBody, &statusResponse); err != nil {
-            http.Error(w, "Error parsing status", http.StatusInternalServerError)
-            return
-        }
+    statusURL := "/api/report/status/" + requestID
+    w.Header().Set("Location", statusURL)
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusAccepted)
+    json.NewEncoder(w).Encode(reportStatusResponse{
+        Status:    "processing",
+        StatusURL: statusURL,
+        Progress:  h.reports.progressOf(tracked),
+    })
+}
 
-        fmt.Printf("Report status: %s\n", statusResponse.Status)
+// reportStatusResponse is the 202 body of /report/status/{id} while generating,
+// and of /report/generate when it times out first
+type reportStatusResponse struct {
+    Status    string                 `json:"status"`
+    StatusURL string                 `json:"status_url,omitempty"` // Where to poll, set when /report/generate timed out
+    Progress  *models.ReportProgress `json:"progress,omitempty"`   // Omitted until upstream reports any
+}
 
-        // Check for API errors in status response
-        if statusResponse.Error != "" {
-            http.Error(w, fmt.Sprintf("Report failed: %s", statusResponse.Error), http.StatusInternalServerError)
-            return
-        }
+// ReportStatusHandler handles GET /report/status/{id} where id is the
+// X-Request-ID of the original generate call or the upstream report id.
+// Reports started by another client are not found.
+// Returns 202 with the status and upstream progress while generating,
+// then the finished report.
+func (h *Handler) ReportStatusHandler(w http.ResponseWriter, r *http.Request) {
+    id := strings.TrimPrefix(r.URL.Path, "/api/report/status/")
+    tracked, ok := h.reports.get(resolveClientID(r), id)
+    if id == "" || !ok {
+        respondError(w, newAppError(http.StatusNotFound, "report_not_found", "Report not found", nil))
+        return
+    }
 
-        // If report is complete, download and send to client
-        if statusResponse.Status == "done" {
-            // Add a small delay to ensure PDF is fully generated
-            time.Sleep(2 * time.Second)
-            
-            // Construct download URL with report ID and PDF format
-            exportURL := fmt.Sprintf("%s/report-generated/export/%s?file_type=pdf&api-key=%s", 
-                h.config.BaseURL, reportID, h.config.OneStepGPSAPIKey)
-            fmt.Printf("Downloading report from: %s\n", exportURL)
-
-            // Create GET request for PDF download
-            exportReq, _ := http.NewRequest("GET", exportURL, nil)
-            exportReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", h.config.OneStepGPSAPIKey))
-
-            // Download the PDF
-            exportResp, err := http.DefaultClient.Do(exportReq)
-            if err != nil {
-                http.Error(w, "Error downloading report", http.StatusInternalServerError)
-                return
-            }
-            defer exportResp.Body.Close()
+    if !tracked.isDone() {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusAccepted)
+        json.NewEncoder(w).Encode(reportStatusResponse{
+            Status:   "processing",
+            Progress: h.reports.progressOf(tracked),
+        })
+        return
+    }
 
-            // Stream PDF to client
-            w.Header().Set("Content-Type", "application/pdf")
-            w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=report_%s.pdf", reportID))
-            
-            _, err = io.Copy(w, exportResp.Body)
-            if err != nil {
-                http.Error(w, "Error streaming report", http.StatusInternalServerError)
-                return
-            }
-            return
-        }
+    h.writeReportResult(w, tracked.result, tracked.err)
+}
+
+// writeReportResult streams a finished report from upstream, or sends its
+// error with the matching status
+func (h *Handler) writeReportResult(w http.ResponseWriter, result *reportResult, err error) {
+    if err != nil {
+        fmt.Printf("Error generating report: %v\n", err)
+        respondError(w, err)
+        return
+    }
 
-        time.Sleep(1 * time.Second) // Wait before next polling attempt
+    start := time.Now()
+    defer func() {
+        logReportPhase("download", result.ReportID, result.Devices, start, err)
+    }()
+
+    // Several formats are bundled into a single ZIP
+    if len(result.FileTypes) > 1 {
+        err = h.writeReportZip(w, result)
+        return
     }
 
-    // Timeout if report takes too long
-    http.Error(w, "Report generation timed out", http.StatusGatewayTimeout)
-}
\ No newline at end of file
+    // Stream the export to client without buffering it in memory
+    err = h.writeReportFile(w, result)
+}
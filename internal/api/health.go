@@ -0,0 +1,46 @@
+// health.go provides the readiness probe used by the load balancer.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ReadyzHandler handles GET /readyz.
+// Responds 503 while the database is unreachable, the device cache hasn't
+// been warmed yet or the last successful poll is older than MaxPollAge
+// (upstream likely broken), so new instances only get traffic once they
+// have data. Paused polling is deliberate and the last device list is still
+// served, so it stays ready with status "polling_paused" and no poll age check.
+func (h *Handler) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+    state := h.Hub.State()
+
+    // Age of the last successful poll, unknown before the first one
+    var pollAge *float64
+    if !state.LastPollTime.IsZero() {
+        age := time.Since(state.LastPollTime).Seconds()
+        pollAge = &age
+    }
+
+    status, code := "ready", http.StatusOK
+    switch {
+    case h.DB.PingContext(r.Context()) != nil:
+        status, code = "database_unavailable", http.StatusServiceUnavailable
+    case !h.GPSClient.CacheWarm():
+        status, code = "cache_cold", http.StatusServiceUnavailable
+    case state.PollingPaused:
+        status = "polling_paused"
+    case h.config.MaxPollAge > 0 && pollAge != nil && *pollAge > h.config.MaxPollAge.Seconds():
+        status, code = "poll_data_stale", http.StatusServiceUnavailable
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status":                status,
+        "last_poll_age_seconds": pollAge,
+    })
+}
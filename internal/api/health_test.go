@@ -0,0 +1,244 @@
+// health_test.go covers the readiness probe and pausing OneStepGPS requests.
+
+package api
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/davidwiese/fleet-tracker-backend/internal/database"
+	"github.com/davidwiese/fleet-tracker-backend/internal/websocket"
+)
+
+func init() {
+    sql.Register("pingdb", pingDriver{})
+}
+
+// pingDriver is a database that only needs to answer pings
+type pingDriver struct{}
+
+func (pingDriver) Open(name string) (driver.Conn, error) { return pingConn{}, nil }
+
+type pingConn struct{}
+
+func (pingConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (pingConn) Close() error                              { return nil }
+func (pingConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+// countingDevices serves a one-device list and fails report generation,
+// counting requests per path
+func countingDevices(calls map[string]*atomic.Int32) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if c, ok := calls[r.URL.Path]; ok {
+            c.Add(1)
+        }
+        w.Header().Set("Content-Type", "application/json")
+        if r.URL.Path == "/device" {
+            w.Write([]byte(oneDevice))
+            return
+        }
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"message":"not stubbed"}`))
+    }
+}
+
+// readyz returns the /readyz status code and status field
+func readyz(t *testing.T, mux http.Handler) (int, string) {
+    t.Helper()
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+    var body struct {
+        Status string `json:"status"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    return w.Code, body.Status
+}
+
+func TestReadyzPollingPaused(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    db, err := sql.Open("pingdb", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    h.DB = &database.DB{DB: db}
+
+    h.Hub.PausePolling()
+    if code, status := readyz(t, mux); code != http.StatusServiceUnavailable || status != "cache_cold" {
+        t.Errorf("paused before warm-up: %d %q, want 503 cache_cold", code, status)
+    }
+
+    h.Hub.ResumePolling()
+    if err := h.GPSClient.WarmCache(); err != nil {
+        t.Fatal(err)
+    }
+    if code, status := readyz(t, mux); code != http.StatusOK || status != "ready" {
+        t.Errorf("warm: %d %q, want 200 ready", code, status)
+    }
+
+    h.Hub.PausePolling()
+    if code, status := readyz(t, mux); code != http.StatusOK || status != "polling_paused" {
+        t.Errorf("paused: %d %q, want 200 polling_paused", code, status)
+    }
+}
+
+func TestPauseStopsUpstreamRequests(t *testing.T) {
+    calls := map[string]*atomic.Int32{
+        "/device":          new(atomic.Int32),
+        "/report/generate": new(atomic.Int32),
+    }
+    h, mux := newTestHandler(t, HandlerConfig{}, countingDevices(calls))
+    if err := h.GPSClient.WarmCache(); err != nil {
+        t.Fatal(err)
+    }
+    h.Hub.PausePolling()
+    calls["/device"].Store(0)
+
+    t.Run("idle vehicles served from the last list", func(t *testing.T) {
+        w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles/idle", nil))
+        if w.Code != http.StatusOK {
+            t.Errorf("status = %d, want 200 (body %s)", w.Code, w.Body)
+        }
+    })
+
+    t.Run("report generation refused", func(t *testing.T) {
+        body := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}`
+        w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body)))
+        if w.Code != http.StatusServiceUnavailable {
+            t.Fatalf("status = %d, want 503 (body %s)", w.Code, w.Body)
+        }
+    })
+
+    t.Run("smoke report refused", func(t *testing.T) {
+        body := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}`
+        w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/smoke", strings.NewReader(body)))
+        if w.Code != http.StatusServiceUnavailable {
+            t.Fatalf("status = %d, want 503 (body %s)", w.Code, w.Body)
+        }
+    })
+
+    for path, c := range calls {
+        if n := c.Load(); n != 0 {
+            t.Errorf("%d requests to %s while paused, want 0", n, path)
+        }
+    }
+}
+
+func TestReadyzAfterCacheWarm(t *testing.T) {
+    calls := map[string]*atomic.Int32{"/device": new(atomic.Int32)}
+    h, mux := newTestHandler(t, HandlerConfig{}, countingDevices(calls))
+    db, err := sql.Open("pingdb", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    h.DB = &database.DB{DB: db}
+
+    if code, status := readyz(t, mux); code != http.StatusServiceUnavailable || status != "cache_cold" {
+        t.Fatalf("before warm-up: %d %q, want 503 cache_cold", code, status)
+    }
+    if err := h.GPSClient.WarmCache(); err != nil {
+        t.Fatal(err)
+    }
+    if code, status := readyz(t, mux); code != http.StatusOK || status != "ready" {
+        t.Fatalf("after warm-up: %d %q, want 200 ready", code, status)
+    }
+
+    // Once ready, the first vehicles request doesn't wait on upstream
+    if ids := vehicleIDs(t, mux, "/api/vehicles"); len(ids) != 1 || ids[0] != "dev1" {
+        t.Errorf("vehicles = %v, want [dev1]", ids)
+    }
+    if n := calls["/device"].Load(); n != 1 {
+        t.Errorf("%d upstream device fetches, want only the warm-up", n)
+    }
+}
+
+// readyzBody returns the /readyz status code, status and last poll age
+func readyzBody(t *testing.T, mux http.Handler) (int, string, *float64) {
+    t.Helper()
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+    var body struct {
+        Status  string   `json:"status"`
+        PollAge *float64 `json:"last_poll_age_seconds"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    return w.Code, body.Status, body.PollAge
+}
+
+// waitReadyz polls /readyz until it answers code, returning the poll age it reported
+func waitReadyz(t *testing.T, mux http.Handler, code int, status string) *float64 {
+    t.Helper()
+    deadline := time.Now().Add(3 * time.Second)
+    for {
+        gotCode, gotStatus, age := readyzBody(t, mux)
+        if gotCode == code && gotStatus == status && age != nil {
+            return age
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("/readyz = %d %q (poll age %v), want %d %q", gotCode, gotStatus, age, code, status)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+func TestReadyzPollAge(t *testing.T) {
+    const maxPollAge = 200 * time.Millisecond
+    var failing atomic.Bool
+    h, mux := newTestHandler(t, HandlerConfig{MaxPollAge: maxPollAge}, func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        if failing.Load() {
+            w.WriteHeader(http.StatusBadGateway)
+            w.Write([]byte(`{"message":"upstream down"}`))
+            return
+        }
+        w.Write([]byte(oneDevice))
+    })
+    db, err := sql.Open("pingdb", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    h.DB = &database.DB{DB: db}
+    if err := h.GPSClient.WarmCache(); err != nil {
+        t.Fatal(err)
+    }
+
+    // A hub polling every 20ms, so poll age moves within the test
+    hub, err := websocket.NewHub(h.GPSClient, 20*time.Millisecond, config.WebSocketConfig{PingInterval: 54, PongWait: 60, WriteWait: 10})
+    if err != nil {
+        t.Fatal(err)
+    }
+    h.Hub = hub
+    go hub.Run()
+    t.Cleanup(func() {
+        hub.PausePolling() // The poll loop outlives Run, keep it quiet
+        close(hub.Broadcast)
+    })
+
+    if age := waitReadyz(t, mux, http.StatusOK, "ready"); *age > maxPollAge.Seconds() {
+        t.Errorf("fresh poll age = %vs, want under %v", *age, maxPollAge)
+    }
+
+    // Upstream breaks, polls fail and the last success ages past the limit
+    failing.Store(true)
+    if age := waitReadyz(t, mux, http.StatusServiceUnavailable, "poll_data_stale"); *age <= maxPollAge.Seconds() {
+        t.Errorf("stale poll age = %vs, want over %v", *age, maxPollAge)
+    }
+
+    // Without a limit the same age doesn't fail readiness
+    h.config.MaxPollAge = 0
+    waitReadyz(t, mux, http.StatusOK, "ready")
+    h.config.MaxPollAge = maxPollAge
+
+    // Recovery flips it back on the next successful poll
+    failing.Store(false)
+    waitReadyz(t, mux, http.StatusOK, "ready")
+}
@@ -0,0 +1,239 @@
+// helpers_test.go builds Handlers against a stubbed OneStepGPS and a fake
+// preferences database for tests.
+
+package api
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/davidwiese/fleet-tracker-backend/internal/database"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+	"github.com/davidwiese/fleet-tracker-backend/internal/websocket"
+)
+
+// emptyDevices is an upstream reply with no devices
+const emptyDevices = `{"result_list":[]}`
+
+// newTestHandler returns a Handler whose OneStepGPS client talks to
+// upstream, an empty device list when nil, and a mux with every route
+// registered. Its database only answers preference reads, see setPreferences.
+func newTestHandler(t *testing.T, cfg HandlerConfig, upstream http.HandlerFunc) (*Handler, *http.ServeMux) {
+    t.Helper()
+    if upstream == nil {
+        upstream = func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Set("Content-Type", "application/json")
+            w.Write([]byte(emptyDevices))
+        }
+    }
+    srv := httptest.NewServer(upstream)
+    t.Cleanup(srv.Close)
+
+    gpsClient := onestepgps.NewClient("test-key", srv.URL, nil)
+    // Production default timings, so streaming clients can connect
+    hub, err := websocket.NewHub(gpsClient, 0, config.WebSocketConfig{PingInterval: 54, PongWait: 60, WriteWait: 10})
+    if err != nil {
+        t.Fatal(err)
+    }
+    db, err := sql.Open("prefsdb", t.Name())
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        db.Close()
+        testPreferences.Delete(t.Name())
+        testPreferenceQueries.Delete(t.Name())
+    })
+    h := NewHandler(&database.DB{DB: db}, hub, gpsClient, cfg)
+    mux := http.NewServeMux()
+    if err := h.SetupRoutes(mux); err != nil {
+        t.Fatal(err)
+    }
+    return h, mux
+}
+
+// mockDatabase swaps h's database for sqlmock, for handlers whose queries
+// (transactions, upserts) the preferences fake doesn't answer. Unmet
+// expectations fail the test.
+func mockDatabase(t *testing.T, h *Handler) sqlmock.Sqlmock {
+    t.Helper()
+    db, mock, err := sqlmock.New()
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        if err := mock.ExpectationsWereMet(); err != nil {
+            t.Error(err)
+        }
+        db.Close()
+    })
+    h.DB = &database.DB{DB: db}
+    return mock
+}
+
+// preferenceColumns are the columns of a user_preferences read
+var preferenceColumns = []string{"id", "device_id", "client_id", "display_name", "is_hidden", "sort_order", "metadata", "created_at", "updated_at"}
+
+// preferenceRows is a single stored preference as the database returns it
+func preferenceRows(deviceID, clientID, displayName string, sortOrder int, metadata interface{}) *sqlmock.Rows {
+    now := time.Now()
+    return sqlmock.NewRows(preferenceColumns).
+        AddRow(1, deviceID, clientID, displayName, false, sortOrder, metadata, now, now)
+}
+
+// devicesReply is an upstream that answers every request with body
+func devicesReply(body string) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(body))
+    }
+}
+
+// serve sends r through mux and returns the recorded response
+func serve(mux http.Handler, r *http.Request) *httptest.ResponseRecorder {
+    w := httptest.NewRecorder()
+    mux.ServeHTTP(w, r)
+    return w
+}
+
+// vehicleIDs GETs target and returns the device ids of the listed vehicles in order
+func vehicleIDs(t *testing.T, mux http.Handler, target string) []string {
+    t.Helper()
+    w := serve(mux, httptest.NewRequest(http.MethodGet, target, nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("GET %s = %d: %s", target, w.Code, w.Body)
+    }
+    var vehicles []struct {
+        DeviceID string `json:"device_id"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &vehicles); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    ids := make([]string, 0, len(vehicles))
+    for _, v := range vehicles {
+        ids = append(ids, v.DeviceID)
+    }
+    return ids
+}
+
+func init() {
+    sql.Register("prefsdb", prefsDriver{})
+}
+
+// testPreferences holds each test's stored preferences, keyed by test name
+var testPreferences sync.Map
+
+// testPreferenceQueries counts each test's preference list queries, keyed by test name
+var testPreferenceQueries sync.Map
+
+// preferenceQueries returns how many times t's database listed preferences
+func preferenceQueries(t *testing.T) int64 {
+    n, _ := testPreferenceQueries.LoadOrStore(t.Name(), new(atomic.Int64))
+    return n.(*atomic.Int64).Load()
+}
+
+// setPreferences stores the preferences newTestHandler's database returns for t
+func setPreferences(t *testing.T, prefs []models.UserPreference) {
+    testPreferences.Store(t.Name(), prefs)
+}
+
+// prefsDriver is a database that only answers the preference list queries
+// and single deletes, on testPreferences for the test named by the DSN
+type prefsDriver struct{}
+
+func (prefsDriver) Open(name string) (driver.Conn, error) { return prefsConn{test: name}, nil }
+
+type prefsConn struct{ test string }
+
+func (c prefsConn) Prepare(query string) (driver.Stmt, error) {
+    if strings.HasPrefix(query, "DELETE FROM user_preferences WHERE device_id = ? AND client_id = ?") {
+        return prefsStmt{test: c.test, delete: true}, nil
+    }
+    if !strings.Contains(query, "FROM user_preferences") || !strings.Contains(query, "WHERE client_id = ?") {
+        return nil, errors.New("query not stubbed")
+    }
+    return prefsStmt{test: c.test}, nil
+}
+func (prefsConn) Close() error              { return nil }
+func (prefsConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not stubbed") }
+
+type prefsStmt struct {
+    test   string
+    delete bool
+}
+
+func (prefsStmt) Close() error  { return nil }
+func (prefsStmt) NumInput() int { return -1 }
+
+// Exec deletes the preference of device args[0] and client args[1]
+func (s prefsStmt) Exec(args []driver.Value) (driver.Result, error) {
+    if !s.delete {
+        return nil, errors.New("exec not stubbed")
+    }
+    stored, _ := testPreferences.Load(s.test)
+    prefs, _ := stored.([]models.UserPreference)
+    kept := make([]models.UserPreference, 0, len(prefs))
+    for _, p := range prefs {
+        if p.DeviceID != args[0] || p.ClientID != args[1] {
+            kept = append(kept, p)
+        }
+    }
+    testPreferences.Store(s.test, kept)
+    return driver.RowsAffected(len(prefs) - len(kept)), nil
+}
+
+// Query returns the stored preferences of the client in args[0]
+func (s prefsStmt) Query(args []driver.Value) (driver.Rows, error) {
+    n, _ := testPreferenceQueries.LoadOrStore(s.test, new(atomic.Int64))
+    n.(*atomic.Int64).Add(1)
+    stored, _ := testPreferences.Load(s.test)
+    prefs, _ := stored.([]models.UserPreference)
+    rows := &prefsRows{}
+    for _, p := range prefs {
+        if len(args) > 0 && p.ClientID != args[0] {
+            continue
+        }
+        var metadata driver.Value
+        if p.Metadata != nil {
+            encoded, err := json.Marshal(p.Metadata)
+            if err != nil {
+                return nil, err
+            }
+            metadata = string(encoded)
+        }
+        now := time.Now()
+        rows.values = append(rows.values, []driver.Value{
+            int64(p.ID), p.DeviceID, p.ClientID, p.DisplayName, p.IsHidden, int64(p.SortOrder), metadata, now, now,
+        })
+    }
+    return rows, nil
+}
+
+type prefsRows struct{ values [][]driver.Value }
+
+func (*prefsRows) Columns() []string {
+    return preferenceColumns
+}
+func (*prefsRows) Close() error { return nil }
+func (r *prefsRows) Next(dest []driver.Value) error {
+    if len(r.values) == 0 {
+        return io.EOF
+    }
+    copy(dest, r.values[0])
+    r.values = r.values[1:]
+    return nil
+}
@@ -0,0 +1,46 @@
+// https.go provides HTTPS enforcement for production deployments.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ForceHTTPS redirects plain HTTP requests to HTTPS and sets
+// Strict-Transport-Security on secure responses.
+// TLS terminates at the load balancer in production, so the original
+// scheme comes from X-Forwarded-Proto when the request itself isn't TLS.
+// Wraps the whole server in main.go so /ws is covered too.
+func ForceHTTPS(next http.Handler, hstsMaxAge int) http.Handler {
+    hsts := fmt.Sprintf("max-age=%d; includeSubDomains", hstsMaxAge)
+
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        // Load balancer and orchestrator probes arrive over plain HTTP
+        if !isHTTPS(r) && !isProbePath(r.URL.Path) {
+            target := "https://" + r.Host + r.URL.RequestURI()
+            // 308 keeps the method and body for POST/PUT, unlike 301
+            http.Redirect(w, r, target, http.StatusPermanentRedirect)
+            return
+        }
+
+        w.Header().Set("Strict-Transport-Security", hsts)
+        next.ServeHTTP(w, r)
+    })
+}
+
+// isProbePath reports whether path is a health probe, /readyz or /livez
+func isProbePath(path string) bool {
+    return path == "/readyz" || path == "/livez"
+}
+
+// isHTTPS reports whether the client connected over TLS, directly or via a proxy.
+// Only the first X-Forwarded-Proto value is used, as set by the outermost proxy.
+func isHTTPS(r *http.Request) bool {
+    if r.TLS != nil {
+        return true
+    }
+    proto := strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0]
+    return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
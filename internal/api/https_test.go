@@ -0,0 +1,85 @@
+// https_test.go covers the FORCE_HTTPS redirect and HSTS header.
+
+package api
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// okHandler answers 200 to anything that reaches it
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.WriteHeader(http.StatusOK)
+})
+
+func TestForceHTTPSRedirects(t *testing.T) {
+    handler := ForceHTTPS(okHandler, 3600)
+
+    tests := []struct {
+        name   string
+        method string
+        proto  string
+    }{
+        {"plain GET", http.MethodGet, ""},
+        {"POST keeps its method", http.MethodPost, ""},
+        {"proxied over http", http.MethodGet, "http"},
+        {"only the outermost proxy counts", http.MethodGet, "http, https"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(tt.method, "http://fleet.example.com/api/vehicles?fields=lat", strings.NewReader("{}"))
+            if tt.proto != "" {
+                r.Header.Set("X-Forwarded-Proto", tt.proto)
+            }
+            w := serve(handler, r)
+
+            if w.Code != http.StatusPermanentRedirect {
+                t.Fatalf("status = %d, want 308", w.Code)
+            }
+            if got := w.Header().Get("Location"); got != "https://fleet.example.com/api/vehicles?fields=lat" {
+                t.Errorf("Location = %q", got)
+            }
+            if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+                t.Errorf("HSTS sent over plain HTTP: %q", got)
+            }
+        })
+    }
+}
+
+func TestForceHTTPSSetsHSTS(t *testing.T) {
+    handler := ForceHTTPS(okHandler, 3600)
+
+    forwarded := httptest.NewRequest(http.MethodGet, "/api/vehicles", nil)
+    forwarded.Header.Set("X-Forwarded-Proto", "HTTPS")
+    direct := httptest.NewRequest(http.MethodGet, "/api/vehicles", nil)
+    direct.TLS = &tls.ConnectionState{}
+
+    for name, r := range map[string]*http.Request{"forwarded": forwarded, "direct TLS": direct} {
+        w := serve(handler, r)
+        if w.Code != http.StatusOK {
+            t.Errorf("%s: status = %d, want 200", name, w.Code)
+        }
+        if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=3600; includeSubDomains" {
+            t.Errorf("%s: Strict-Transport-Security = %q", name, got)
+        }
+    }
+}
+
+func TestForceHTTPSAllowsPlainReadyz(t *testing.T) {
+    // Load balancer health checks don't follow redirects
+    w := serve(ForceHTTPS(okHandler, 3600), httptest.NewRequest(http.MethodGet, "http://10.0.0.5/readyz", nil))
+    if w.Code != http.StatusOK {
+        t.Errorf("status = %d, want 200", w.Code)
+    }
+}
+
+func TestForceHTTPSAllowsPlainLivez(t *testing.T) {
+    // A redirected liveness probe would count as a failure and restart the process
+    w := serve(ForceHTTPS(okHandler, 3600), httptest.NewRequest(http.MethodGet, "http://10.0.0.5/livez", nil))
+    if w.Code != http.StatusOK {
+        t.Errorf("status = %d, want 200", w.Code)
+    }
+}
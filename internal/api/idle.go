@@ -0,0 +1,59 @@
+// idle.go lists vehicles that have been idling (engine on, not moving) too long.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// defaultIdleThreshold applies when ?threshold_minutes= is omitted
+const defaultIdleThreshold = 10 * time.Minute
+
+// idleVehicles returns vehicles idling for longer than threshold at now,
+// longest idle first
+func idleVehicles(vehicles []models.Vehicle, threshold time.Duration, now time.Time) []models.Vehicle {
+    idle := make([]models.Vehicle, 0)
+    durations := make(map[string]time.Duration)
+    for i := range vehicles {
+        if vehicles[i].DriveState.Status != "idle" {
+            continue
+        }
+        d, ok := vehicles[i].CurrentStateDuration(now)
+        if ok && d > threshold {
+            idle = append(idle, vehicles[i])
+            durations[vehicles[i].DeviceID] = d
+        }
+    }
+    sort.SliceStable(idle, func(i, j int) bool {
+        return durations[idle[i].DeviceID] > durations[idle[j].DeviceID]
+    })
+    return idle
+}
+
+// IdleVehiclesHandler handles GET /vehicles/idle?threshold_minutes=N,
+// listing vehicles idling longer than the threshold (default 10).
+// Supports ?envelope=true like /vehicles.
+func (h *Handler) IdleVehiclesHandler(w http.ResponseWriter, r *http.Request) {
+    threshold, err := parseThresholdMinutes(r, defaultIdleThreshold)
+    if err != nil {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_threshold", err.Error(), err))
+        return
+    }
+
+    // Polled every few seconds by dashboards, served from the device cache like /vehicles
+    vehicles, err := h.GPSClient.GetDevicesCached(deviceCacheMaxAge)
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+
+    idle := idleVehicles(vehicles, threshold, time.Now())
+    if err := writeJSONList(w, r, idle, len(idle)); err != nil {
+        fmt.Printf("Error writing idle vehicles: %v\n", err)
+    }
+}
@@ -0,0 +1,109 @@
+// idle_test.go covers current_state_seconds and listing idling vehicles.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// inState is a vehicle whose drive status began at begin, zero for unknown
+func inState(id, status string, begin time.Time) models.Vehicle {
+    return models.Vehicle{DeviceID: id, DriveState: models.DriveState{Status: status, BeginTime: begin}}
+}
+
+func TestIdleVehicles(t *testing.T) {
+    now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+    vehicles := []models.Vehicle{
+        inState("short", "idle", now.Add(-5*time.Minute)),
+        inState("driving", "driving", now.Add(-2*time.Hour)),
+        inState("hour", "idle", now.Add(-time.Hour)),
+        inState("unknown-begin", "idle", time.Time{}),
+        inState("at-threshold", "idle", now.Add(-10*time.Minute)),
+        inState("just-over", "idle", now.Add(-10*time.Minute-time.Second)),
+        inState("off", "off", now.Add(-3*time.Hour)),
+        inState("future", "idle", now.Add(time.Minute)), // Tracker clock ahead of ours
+    }
+
+    var ids []string
+    for _, v := range idleVehicles(vehicles, 10*time.Minute, now) {
+        ids = append(ids, v.DeviceID)
+    }
+    // Longest idle first, exactly the threshold isn't idle too long yet
+    want := []string{"hour", "just-over"}
+    if !reflect.DeepEqual(ids, want) {
+        t.Errorf("idle = %v, want %v", ids, want)
+    }
+
+    if got := idleVehicles(vehicles[:2], 10*time.Minute, now); got == nil || len(got) != 0 {
+        t.Errorf("no idle vehicles = %#v, want an empty list", got)
+    }
+}
+
+func TestIdleVehiclesHandler(t *testing.T) {
+    now := time.Now().UTC()
+    device := func(id, status string, age time.Duration) string {
+        return fmt.Sprintf(`{"device_id":%q,"device_state":{"drive_status":%q,"drive_status_begin_time":%q}}`,
+            id, status, now.Add(-age).Format(time.RFC3339))
+    }
+    upstream := fmt.Sprintf(`{"result_list":[%s,%s,%s,%s]}`,
+        device("quick-stop", "idle", 5*time.Minute), device("long-idle", "idle", 90*time.Minute),
+        device("driving", "driving", 3*time.Hour), device("half-hour", "idle", 30*time.Minute))
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(upstream))
+
+    tests := []struct {
+        target string
+        want   []string
+    }{
+        {"/api/vehicles/idle", []string{"long-idle", "half-hour"}},
+        {"/api/vehicles/idle?threshold_minutes=60", []string{"long-idle"}},
+        {"/api/vehicles/idle?threshold_minutes=1", []string{"long-idle", "half-hour", "quick-stop"}},
+        {"/api/vehicles/idle?threshold_minutes=1000", []string{}},
+    }
+    for _, tt := range tests {
+        if got := vehicleIDs(t, mux, tt.target); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s = %v, want %v", tt.target, got, tt.want)
+        }
+    }
+
+    if w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles/idle?threshold_minutes=0", nil)); w.Code != http.StatusBadRequest {
+        t.Errorf("threshold_minutes=0: status = %d, want 400", w.Code)
+    }
+}
+
+func TestVehiclesCurrentStateSeconds(t *testing.T) {
+    begin := time.Now().UTC().Add(-2 * time.Hour)
+    upstream := fmt.Sprintf(`{"result_list":[{"device_id":"dev1","device_state":{"drive_status":"off","drive_status_begin_time":%q}},{"device_id":"dev2"}]}`,
+        begin.Format(time.RFC3339))
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(upstream))
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d: %s", w.Code, w.Body)
+    }
+    var vehicles []struct {
+        DeviceID            string `json:"device_id"`
+        CurrentStateSeconds *int64 `json:"current_state_seconds"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &vehicles); err != nil {
+        t.Fatal(err)
+    }
+    got := make(map[string]*int64)
+    for _, v := range vehicles {
+        got[v.DeviceID] = v.CurrentStateSeconds
+    }
+    // Allow for the time between formatting begin and mapping the device
+    if s := got["dev1"]; s == nil || *s < 7200 || *s > 7205 {
+        t.Errorf("dev1 current_state_seconds = %v, want about 7200", s)
+    }
+    if s := got["dev2"]; s != nil {
+        t.Errorf("dev2 current_state_seconds = %d, want omitted without a begin time", *s)
+    }
+}
@@ -0,0 +1,103 @@
+// liveness.go provides the liveness probe and process self-metrics.
+// Unlike /readyz it doesn't depend on the database or OneStepGPS, a failing
+// /livez means this process is hung (e.g. a deadlocked hub) and should be
+// restarted rather than just taken out of rotation.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// processStart is when the process started serving, for uptime
+var processStart = time.Now()
+
+// livenessTimeout bounds how long the hub has to answer a heartbeat.
+// A broadcast normally finishes in milliseconds, writes are bounded by WS_WRITE_WAIT.
+const livenessTimeout = 5 * time.Second
+
+// processStats is a snapshot of the process for /livez and /metrics
+type processStats struct {
+    UptimeSeconds  float64 `json:"uptime_seconds"`
+    Goroutines     int     `json:"goroutines"`
+    HeapAllocBytes uint64  `json:"heap_alloc_bytes"`
+    SysBytes       uint64  `json:"sys_bytes"` // Memory obtained from the OS
+}
+
+// readProcessStats reads the current process stats
+func readProcessStats() processStats {
+    var mem runtime.MemStats
+    runtime.ReadMemStats(&mem)
+    return processStats{
+        UptimeSeconds:  time.Since(processStart).Seconds(),
+        Goroutines:     runtime.NumGoroutine(),
+        HeapAllocBytes: mem.HeapAlloc,
+        SysBytes:       mem.Sys,
+    }
+}
+
+// livezResponse is the /livez body
+type livezResponse struct {
+    Status string `json:"status"`          // "alive" or "hub_unresponsive"
+    Error  string `json:"error,omitempty"` // Why the heartbeat failed
+    processStats
+}
+
+// LivezHandler handles GET /livez.
+// Sends the hub a heartbeat and responds 503 if it isn't answered within
+// livenessTimeout, with process stats either way.
+func (h *Handler) LivezHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), livenessTimeout)
+    defer cancel()
+
+    resp := livezResponse{Status: "alive"}
+    code := http.StatusOK
+    if err := h.Hub.Alive(ctx); err != nil {
+        fmt.Printf("Liveness check failed: %v\n", err)
+        resp.Status, resp.Error = "hub_unresponsive", err.Error()
+        code = http.StatusServiceUnavailable
+    }
+    resp.processStats = readProcessStats()
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(resp)
+}
+
+// writeProcessMetrics writes the process stats as Prometheus gauges, and
+// whether the hub answered a heartbeat
+func (h *Handler) writeProcessMetrics(ctx context.Context, w io.Writer) {
+    stats := readProcessStats()
+    fmt.Fprintln(w, "# HELP fleet_process_uptime_seconds Seconds since the process started.")
+    fmt.Fprintln(w, "# TYPE fleet_process_uptime_seconds gauge")
+    fmt.Fprintf(w, "fleet_process_uptime_seconds %g\n", stats.UptimeSeconds)
+
+    fmt.Fprintln(w, "# HELP fleet_process_goroutines Running goroutines.")
+    fmt.Fprintln(w, "# TYPE fleet_process_goroutines gauge")
+    fmt.Fprintf(w, "fleet_process_goroutines %d\n", stats.Goroutines)
+
+    fmt.Fprintln(w, "# HELP fleet_process_heap_alloc_bytes Bytes of allocated heap objects.")
+    fmt.Fprintln(w, "# TYPE fleet_process_heap_alloc_bytes gauge")
+    fmt.Fprintf(w, "fleet_process_heap_alloc_bytes %d\n", stats.HeapAllocBytes)
+
+    fmt.Fprintln(w, "# HELP fleet_process_sys_bytes Bytes of memory obtained from the OS.")
+    fmt.Fprintln(w, "# TYPE fleet_process_sys_bytes gauge")
+    fmt.Fprintf(w, "fleet_process_sys_bytes %d\n", stats.SysBytes)
+
+    ctx, cancel := context.WithTimeout(ctx, livenessTimeout)
+    defer cancel()
+    alive := 0
+    if h.Hub.Alive(ctx) == nil {
+        alive = 1
+    }
+    fmt.Fprintln(w, "# HELP fleet_hub_alive Whether the hub answered a liveness heartbeat, see /livez.")
+    fmt.Fprintln(w, "# TYPE fleet_hub_alive gauge")
+    fmt.Fprintf(w, "fleet_hub_alive %d\n", alive)
+}
@@ -0,0 +1,124 @@
+// liveness_test.go covers the /livez probe and the process metrics.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// livez requests /livez, giving up on the hub's heartbeat after timeout
+func livez(t *testing.T, mux *http.ServeMux, timeout time.Duration) (int, livezResponse) {
+    t.Helper()
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/livez", nil).WithContext(ctx))
+    var body livezResponse
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    return w.Code, body
+}
+
+func TestLivezAlive(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    go h.Hub.Run()
+    t.Cleanup(func() { close(h.Hub.Broadcast) })
+
+    code, body := livez(t, mux, time.Second)
+    if code != http.StatusOK || body.Status != "alive" || body.Error != "" {
+        t.Errorf("status = %d, body = %+v, want 200 alive", code, body)
+    }
+    if body.Goroutines <= 0 || body.HeapAllocBytes == 0 || body.SysBytes == 0 || body.UptimeSeconds <= 0 {
+        t.Errorf("process stats = %+v, want them filled in", body.processStats)
+    }
+}
+
+func TestLivezHungHub(t *testing.T) {
+    // The hub's Run loop never started, like one stuck in a broadcast
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+
+    start := time.Now()
+    code, body := livez(t, mux, 50*time.Millisecond)
+    if code != http.StatusServiceUnavailable || body.Status != "hub_unresponsive" || !strings.Contains(body.Error, "heartbeat") {
+        t.Errorf("status = %d, body = %+v, want 503 hub_unresponsive", code, body)
+    }
+    if elapsed := time.Since(start); elapsed > time.Second {
+        t.Errorf("took %v, want the request's deadline to bound the heartbeat", elapsed)
+    }
+    // Stats are still reported to help diagnose the hang
+    if body.Goroutines <= 0 {
+        t.Errorf("goroutines = %d", body.Goroutines)
+    }
+}
+
+func TestProcessMetrics(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+
+    // metrics fetches /metrics, with a short deadline for the hub heartbeat
+    metrics := func() string {
+        ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+        defer cancel()
+        return serve(mux, adminRequest(http.MethodGet, "/metrics").WithContext(ctx)).Body.String()
+    }
+
+    body := metrics()
+    for _, line := range []string{
+        "# TYPE fleet_process_uptime_seconds gauge",
+        "# TYPE fleet_process_goroutines gauge",
+        "# TYPE fleet_process_heap_alloc_bytes gauge",
+        "# TYPE fleet_process_sys_bytes gauge",
+        "fleet_hub_alive 0",
+    } {
+        if !strings.Contains(body, line+"\n") {
+            t.Errorf("missing %q in:\n%s", line, body)
+        }
+    }
+
+    go h.Hub.Run()
+    t.Cleanup(func() { close(h.Hub.Broadcast) })
+    if body := metrics(); !strings.Contains(body, "fleet_hub_alive 1\n") {
+        t.Errorf("running hub not reported alive:\n%s", body)
+    }
+}
+
+func TestProbesSkipRateLimitAndTenant(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{
+        RateLimitPerMinute: 1,
+        TenantBaseDomain:   "fleet.example.com",
+        Tenants:            map[string]string{"acme": "client-acme"},
+        MaintenanceMode:    true,
+    }, nil)
+    go h.Hub.Run()
+    t.Cleanup(func() { close(h.Hub.Broadcast) })
+
+    // Probes hit the instance directly, by IP or an unknown host, and
+    // repeatedly from the same address
+    for _, host := range []string{"10.0.0.5", "ghost.fleet.example.com", "10.0.0.5"} {
+        r := httptest.NewRequest(http.MethodGet, "/livez", nil)
+        r.Host = host
+        if w := serve(mux, r); w.Code != http.StatusOK {
+            t.Errorf("/livez on %s: status = %d, want 200: %s", host, w.Code, w.Body)
+        }
+
+        // The device cache is cold, so 503, but from the probe itself
+        r = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+        r.Host = host
+        w := serve(mux, r)
+        if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "cache_cold") {
+            t.Errorf("/readyz on %s: status = %d, body %s, want the probe's cache_cold", host, w.Code, w.Body)
+        }
+    }
+
+    // Other routes are still limited and tenant-checked
+    r := httptest.NewRequest(http.MethodGet, "/api/version", nil)
+    r.Host = "ghost.fleet.example.com"
+    if w := serve(mux, r); w.Code != http.StatusNotFound && w.Code != http.StatusTooManyRequests {
+        t.Errorf("/api/version on an unknown tenant: status = %d, want it rejected", w.Code)
+    }
+}
@@ -0,0 +1,73 @@
+// maintenance.go provides a maintenance mode that freezes writes while
+// keeping read endpoints available, e.g. during migrations or upstream outages.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// withMaintenance rejects mutating requests with 503 while maintenance mode is on.
+// Routes marked writableInMaintenance are allowed through: read-only POSTs like
+// /report/validate, the OneStepGPS webhook, and the admin controls operators
+// need to turn maintenance mode off.
+func (h *Handler) withMaintenance(writable bool) Middleware {
+    return func(next http.Handler) http.Handler {
+        if writable {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if h.maintenance.Load() && isMutatingMethod(r.Method) {
+                w.Header().Set("Content-Type", "application/json")
+                w.Header().Set("Retry-After", "60")
+                w.WriteHeader(http.StatusServiceUnavailable)
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "error":            "Service is in maintenance mode, write operations are temporarily disabled",
+                    "maintenance_mode": true,
+                })
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// isMutatingMethod reports whether the HTTP method changes server state
+func isMutatingMethod(method string) bool {
+    switch method {
+    case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+        return true
+    }
+    return false
+}
+
+// MaintenanceHandler handles GET/POST /api/admin/maintenance.
+// GET returns the current state, POST ?enabled=true|false toggles it.
+func (h *Handler) MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+    case http.MethodPost:
+        enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+        if err != nil {
+            respondError(w, newAppError(http.StatusBadRequest, "invalid_enabled", "enabled query parameter must be true or false", err))
+            return
+        }
+        h.maintenance.Store(enabled)
+        if enabled {
+            fmt.Println("Maintenance mode enabled")
+        } else {
+            fmt.Println("Maintenance mode disabled")
+        }
+    default:
+        respondError(w, errMethodNotAllowed)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]bool{
+        "maintenance_mode": h.maintenance.Load(),
+    })
+}
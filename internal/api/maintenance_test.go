@@ -0,0 +1,57 @@
+// maintenance_test.go covers which routes maintenance mode blocks.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{MaintenanceMode: true, AdminAPIKey: "secret"}, nil)
+
+    tests := []struct {
+        name    string
+        method  string
+        path    string
+        blocked bool
+    }{
+        {"reads pass", http.MethodGet, "/api/vehicles", false},
+        {"preference save blocked", http.MethodPost, "/api/preferences", true},
+        {"preference update blocked", http.MethodPut, "/api/preferences/dev1", true},
+        {"preference delete blocked", http.MethodDelete, "/api/preferences/dev1", true},
+        {"batch blocked", http.MethodPost, "/api/preferences/batch", true},
+        {"report generation blocked", http.MethodPost, "/api/report/generate", true},
+        {"preference cleanup blocked", http.MethodPost, "/api/admin/preferences/cleanup?days=30", true},
+        {"validate allowed", http.MethodPost, "/api/report/validate", false},
+        {"diff allowed", http.MethodPost, "/api/report/diff", false},
+        {"smoke allowed", http.MethodPost, "/api/report/smoke", false},
+        {"webhook allowed", http.MethodPost, "/api/webhooks/onestepgps", false},
+        {"maintenance toggle allowed", http.MethodPost, "/api/admin/maintenance?enabled=true", false},
+        {"poll pause allowed", http.MethodPost, "/api/admin/poll/pause", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(tt.method, tt.path, strings.NewReader("not json"))
+            r.Header.Set("Authorization", "Bearer secret")
+            w := serve(mux, r)
+            blocked := w.Code == http.StatusServiceUnavailable && strings.Contains(w.Body.String(), `"maintenance_mode":true`)
+            if blocked != tt.blocked {
+                t.Errorf("%s %s: status %d body %s, blocked = %v, want %v", tt.method, tt.path, w.Code, w.Body, blocked, tt.blocked)
+            }
+            if blocked && w.Header().Get("Retry-After") == "" {
+                t.Error("blocked response is missing Retry-After")
+            }
+        })
+    }
+}
+
+func TestMaintenanceModeOff(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader("{")))
+    if w.Code == http.StatusServiceUnavailable {
+        t.Fatalf("write blocked with maintenance mode off: %s", w.Body)
+    }
+}
@@ -0,0 +1,104 @@
+// metadata_filter.go filters /vehicles by the client's preference metadata,
+// e.g. ?meta.color=red, so VehicleList.vue can show one color or group.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// metadataFilterPrefix marks query params that filter on metadata keys
+const metadataFilterPrefix = "meta."
+
+// parseMetadataFilters collects ?meta.<key>=value params as key -> accepted
+// values. Repeating a param accepts any of its values, different keys must
+// all match. Keys must be in METADATA_FILTER_KEYS.
+func (h *Handler) parseMetadataFilters(r *http.Request) (map[string][]string, error) {
+    var filters map[string][]string
+    for param, values := range r.URL.Query() {
+        if !strings.HasPrefix(param, metadataFilterPrefix) {
+            continue
+        }
+        key := strings.TrimPrefix(param, metadataFilterPrefix)
+        if !h.metadataFilterAllowed(key) {
+            allowed := append([]string(nil), h.config.MetadataFilterKeys...)
+            sort.Strings(allowed)
+            return nil, newAppError(http.StatusBadRequest, "invalid_filter", fmt.Sprintf("cannot filter on metadata key %q, allowed keys: %s", key, strings.Join(allowed, ", ")), nil)
+        }
+        if filters == nil {
+            filters = make(map[string][]string)
+        }
+        filters[key] = append(filters[key], values...)
+    }
+    return filters, nil
+}
+
+// metadataFilterAllowed reports whether key is in METADATA_FILTER_KEYS
+func (h *Handler) metadataFilterAllowed(key string) bool {
+    for _, allowed := range h.config.MetadataFilterKeys {
+        if key == allowed {
+            return true
+        }
+    }
+    return false
+}
+
+// filterVehiclesByMetadata returns the vehicles whose preference metadata
+// matches every filter. Vehicles without a preference, or without one of the
+// keys, don't match. vehicles is not modified.
+func (h *Handler) filterVehiclesByMetadata(ctx context.Context, clientID string, vehicles []models.Vehicle, filters map[string][]string) ([]models.Vehicle, error) {
+    prefs, err := h.preferencesFor(ctx, clientID)
+    if err != nil {
+        return nil, fmt.Errorf("error fetching preferences: %w", err)
+    }
+    metadata := make(map[string]map[string]interface{}, len(prefs))
+    for _, pref := range prefs {
+        if pref.Metadata != nil {
+            metadata[pref.DeviceID] = pref.Metadata
+        }
+    }
+
+    filtered := make([]models.Vehicle, 0, len(vehicles))
+    for _, v := range vehicles {
+        if metadataMatches(metadata[v.DeviceID], filters) {
+            filtered = append(filtered, v)
+        }
+    }
+    return filtered, nil
+}
+
+// metadataMatches reports whether every filter key is present in metadata
+// with one of its accepted values. Numbers and booleans are compared in
+// their query string form, e.g. ?meta.priority=2 matches 2.
+func metadataMatches(metadata map[string]interface{}, filters map[string][]string) bool {
+    for key, accepted := range filters {
+        value, ok := metadata[key]
+        if !ok || value == nil {
+            return false
+        }
+        var s string
+        switch v := value.(type) {
+        case string, float64, bool:
+            s = fmt.Sprint(v)
+        default:
+            return false // Objects and arrays can't be matched from a query string
+        }
+        found := false
+        for _, want := range accepted {
+            if s == want {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,80 @@
+// metadata_filter_test.go covers filtering /api/vehicles by preference metadata.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// fourDevices is an account with dev1 to dev4
+const fourDevices = `{"result_list":[{"device_id":"dev1"},{"device_id":"dev2"},{"device_id":"dev3"},{"device_id":"dev4"}]}`
+
+func TestVehiclesMetadataFilter(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{MetadataFilterKeys: []string{"color", "group", "priority"}}, devicesReply(fourDevices))
+    // dev3 has metadata without a color, dev4 has no preference at all
+    setPreferences(t, []models.UserPreference{
+        {DeviceID: "dev1", ClientID: "default", Metadata: map[string]interface{}{"color": "red", "group": "north", "priority": 2}},
+        {DeviceID: "dev2", ClientID: "default", Metadata: map[string]interface{}{"color": "blue", "group": "north"}},
+        {DeviceID: "dev3", ClientID: "default", Metadata: map[string]interface{}{"group": "south"}},
+        {DeviceID: "other-client", ClientID: "someone-else", Metadata: map[string]interface{}{"color": "red"}},
+    })
+
+    tests := []struct {
+        query string
+        want  []string
+    }{
+        {"", []string{"dev1", "dev2", "dev3", "dev4"}},
+        {"?meta.color=red", []string{"dev1"}},
+        {"?meta.color=red&meta.color=blue", []string{"dev1", "dev2"}},
+        {"?meta.group=north&meta.color=blue", []string{"dev2"}},
+        {"?meta.priority=2", []string{"dev1"}},
+        {"?meta.color=green", []string{}},
+    }
+    for _, tt := range tests {
+        if got := vehicleIDs(t, mux, "/api/vehicles"+tt.query); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+        }
+    }
+}
+
+func TestVehiclesMetadataFilterUnknownKey(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{MetadataFilterKeys: []string{"color", "group"}}, devicesReply(fourDevices))
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles?meta.vin=123", nil))
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+    }
+    if body := errorBody(t, w); body.Error != "invalid_filter" || !strings.Contains(body.Message, "color, group") {
+        t.Errorf("body = %+v, want the allowed keys listed", body)
+    }
+}
+
+func TestMetadataMatches(t *testing.T) {
+    filters := map[string][]string{"color": {"red"}}
+    tests := []struct {
+        name     string
+        metadata map[string]interface{}
+        want     bool
+    }{
+        {"match", map[string]interface{}{"color": "red"}, true},
+        {"other value", map[string]interface{}{"color": "blue"}, false},
+        {"key missing", map[string]interface{}{"icon": "truck"}, false},
+        {"null value", map[string]interface{}{"color": nil}, false},
+        {"object value", map[string]interface{}{"color": map[string]interface{}{"name": "red"}}, false},
+        {"no metadata", nil, false},
+    }
+    for _, tt := range tests {
+        if got := metadataMatches(tt.metadata, filters); got != tt.want {
+            t.Errorf("%s: metadataMatches = %v, want %v", tt.name, got, tt.want)
+        }
+    }
+    if !metadataMatches(map[string]interface{}{"active": true}, map[string][]string{"active": {"true"}}) {
+        t.Error("boolean true doesn't match ?meta.active=true")
+    }
+}
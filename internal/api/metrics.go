@@ -0,0 +1,36 @@
+// metrics.go exposes hub counters in the Prometheus text exposition format,
+// for scraping with the admin bearer token.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// MetricsHandler handles GET /metrics.
+// Written by hand since there are only a few counters, see websocket.HubState,
+// report_metrics.go and liveness.go.
+func (h *Handler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+    state := h.Hub.State()
+
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    fmt.Fprintln(w, "# HELP fleet_ws_clients Connected WebSocket clients.")
+    fmt.Fprintln(w, "# TYPE fleet_ws_clients gauge")
+    fmt.Fprintf(w, "fleet_ws_clients %d\n", state.ClientCount)
+
+    fmt.Fprintln(w, "# HELP fleet_ws_messages_dropped_total Broadcasts dropped because a client's send buffer was full.")
+    fmt.Fprintln(w, "# TYPE fleet_ws_messages_dropped_total counter")
+    fmt.Fprintf(w, "fleet_ws_messages_dropped_total %d\n", state.DroppedMessages)
+
+    // Per connection, labelled with the anonymized id shown in /api/debug/hub
+    fmt.Fprintln(w, "# HELP fleet_ws_client_messages_dropped_total Broadcasts dropped per connected client.")
+    fmt.Fprintln(w, "# TYPE fleet_ws_client_messages_dropped_total counter")
+    for _, c := range state.Clients {
+        fmt.Fprintf(w, "fleet_ws_client_messages_dropped_total{client=%q} %d\n", c.ID, c.Dropped)
+    }
+
+    h.reportDurations.write(w, "fleet_report_generation_seconds", "Time from starting a report generation until it is ready to download.")
+
+    h.writeProcessMetrics(r.Context(), w)
+}
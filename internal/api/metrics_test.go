@@ -0,0 +1,40 @@
+// metrics_test.go covers the Prometheus /metrics endpoint.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+
+    w := serve(mux, adminRequest(http.MethodGet, "/metrics"))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+        t.Errorf("Content-Type = %q", ct)
+    }
+    for _, line := range []string{
+        "fleet_ws_clients 0",
+        "# TYPE fleet_ws_messages_dropped_total counter",
+        "fleet_ws_messages_dropped_total 0",
+        "# TYPE fleet_ws_client_messages_dropped_total counter",
+    } {
+        if !strings.Contains(w.Body.String(), line+"\n") {
+            t.Errorf("missing %q in:\n%s", line, w.Body)
+        }
+    }
+}
+
+func TestMetricsRequiresAdminToken(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+
+    if w := serve(mux, httptest.NewRequest(http.MethodGet, "/metrics", nil)); w.Code != http.StatusUnauthorized {
+        t.Errorf("status = %d, want 401", w.Code)
+    }
+}
@@ -0,0 +1,138 @@
+// middleware.go provides the middleware chain applied to every API route
+// and the generic middlewares (panic recovery, request logging, request
+// decompression, timeouts) in it.
+
+package api
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Middleware wraps a handler with cross-cutting behavior
+type Middleware func(http.Handler) http.Handler
+
+// chain composes middlewares so the first one listed runs first (outermost):
+// chain(a, b)(h) is a(b(h)).
+func chain(middlewares ...Middleware) Middleware {
+    return func(final http.Handler) http.Handler {
+        for i := len(middlewares) - 1; i >= 0; i-- {
+            final = middlewares[i](final)
+        }
+        return final
+    }
+}
+
+// withRecover turns a panicking handler into a 500 instead of dropping the
+// connection, logging the stack trace
+func withRecover(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        defer func() {
+            if err := recover(); err != nil {
+                if err == http.ErrAbortHandler {
+                    panic(err) // Deliberate abort, let net/http handle it
+                }
+                fmt.Printf("Panic handling %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+                respondError(w, newAppError(http.StatusInternalServerError, "internal_error", "Internal server error", nil))
+            }
+        }()
+        next.ServeHTTP(w, r)
+    })
+}
+
+// withLogging logs one line per request with its status and duration
+func withLogging(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+        next.ServeHTTP(rec, r)
+        fmt.Printf("%s %s %d %s\n", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+    })
+}
+
+// withTimeout bounds a request to timeout: its context is cancelled and the
+// response write deadline set, so handlers honoring r.Context() stop and a
+// stalled response can't hold the connection. A timeout <= 0 adds no limit.
+func withTimeout(timeout time.Duration) Middleware {
+    return func(next http.Handler) http.Handler {
+        if timeout <= 0 {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            ctx, cancel := context.WithTimeout(r.Context(), timeout)
+            defer cancel()
+            // Not every writer supports deadlines, the context still applies
+            _ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout))
+            next.ServeHTTP(w, r.WithContext(ctx))
+        })
+    }
+}
+
+// maxDecompressedBodyBytes bounds a gzip request body after decompression,
+// so a small compressed payload can't expand without limit
+const maxDecompressedBodyBytes = 20 << 20 // 20 MB
+
+// withGzipRequest transparently decompresses bodies sent with
+// Content-Encoding: gzip (e.g. large batch preference imports), so handlers
+// decode them like plaintext. Other encodings are rejected with 415.
+func withGzipRequest(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+        case "", "identity":
+        case "gzip":
+            gz, err := gzip.NewReader(r.Body)
+            if err != nil {
+                respondError(w, newAppError(http.StatusBadRequest, "invalid_body", "Invalid gzip request body", err))
+                return
+            }
+            defer gz.Close()
+            r.Body = http.MaxBytesReader(w, gzipBody{Reader: gz, orig: r.Body}, maxDecompressedBodyBytes)
+            r.Header.Del("Content-Encoding")
+            r.Header.Del("Content-Length")
+            r.ContentLength = -1
+        default:
+            respondError(w, newAppError(http.StatusUnsupportedMediaType, "unsupported_encoding", fmt.Sprintf("Unsupported Content-Encoding %q", encoding), nil))
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// gzipBody reads decompressed data but closes the original request body
+type gzipBody struct {
+    *gzip.Reader
+    orig io.ReadCloser
+}
+
+func (b gzipBody) Close() error {
+    return b.orig.Close()
+}
+
+// statusRecorder captures the response status for logging.
+// Flush is passed through so streamed reports still flush per chunk.
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+    s.status = code
+    s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Flush() {
+    if f, ok := s.ResponseWriter.(http.Flusher); ok {
+        f.Flush()
+    }
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+    return s.ResponseWriter
+}
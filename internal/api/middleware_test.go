@@ -0,0 +1,224 @@
+// middleware_test.go covers middleware composition, the order of the
+// per-route stack and gzip request bodies.
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// recording returns a middleware appending name to calls when it runs
+func recording(name string, calls *[]string) Middleware {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            *calls = append(*calls, name)
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+func TestChainOrder(t *testing.T) {
+    var calls []string
+    names := []string{"recover", "log", "cors", "auth", "ratelimit"}
+    var middlewares []Middleware
+    for _, name := range names {
+        middlewares = append(middlewares, recording(name, &calls))
+    }
+    final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls = append(calls, "handler")
+    })
+
+    chain(middlewares...)(final).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+    want := append(names, "handler")
+    if !reflect.DeepEqual(calls, want) {
+        t.Errorf("execution order = %v, want %v", calls, want)
+    }
+}
+
+// newStackHandler is a Handler configured so every middleware in the route
+// stack can reject a request
+func newStackHandler(t *testing.T) *Handler {
+    h, _ := newTestHandler(t, HandlerConfig{
+        AdminAPIKey:        "secret",
+        MaintenanceMode:    true,
+        RateLimitPerMinute: 1,
+    }, nil)
+    h.origins.Store(newOriginSet([]string{"http://localhost:5173"}))
+    return h
+}
+
+func TestRouteStackOrder(t *testing.T) {
+    ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusNoContent)
+    })
+    request := func(method, token string) *http.Request {
+        r := httptest.NewRequest(method, "/api/admin/preferences/cleanup", nil)
+        r.Header.Set("Origin", "http://localhost:5173")
+        if token != "" {
+            r.Header.Set("Authorization", "Bearer "+token)
+        }
+        return r
+    }
+
+    t.Run("cors before auth", func(t *testing.T) {
+        h := newStackHandler(t)
+        stack := h.routeStack(Route{admin: true}, 0)(ok)
+        w := serve(stack, request(http.MethodPost, ""))
+        if w.Code != http.StatusUnauthorized {
+            t.Fatalf("status = %d, want 401", w.Code)
+        }
+        if w.Header().Get("Access-Control-Allow-Origin") == "" {
+            t.Error("401 is missing CORS headers, the browser would hide it")
+        }
+        if w := serve(stack, request(http.MethodOptions, "")); w.Code != http.StatusOK {
+            t.Errorf("preflight status = %d, want 200 without a token", w.Code)
+        }
+    })
+
+    t.Run("auth before rate limit", func(t *testing.T) {
+        h := newStackHandler(t)
+        stack := h.routeStack(Route{admin: true, writableInMaintenance: true}, 0)(ok)
+        for i := 0; i < 3; i++ {
+            if w := serve(stack, request(http.MethodPost, "wrong")); w.Code != http.StatusUnauthorized {
+                t.Fatalf("unauthenticated request %d: status = %d, want 401", i, w.Code)
+            }
+        }
+        // Rejected requests didn't use up the limit
+        if w := serve(stack, request(http.MethodPost, "secret")); w.Code != http.StatusNoContent {
+            t.Fatalf("first authenticated request: status = %d, want 204", w.Code)
+        }
+        if w := serve(stack, request(http.MethodPost, "secret")); w.Code != http.StatusTooManyRequests {
+            t.Fatalf("second authenticated request: status = %d, want 429", w.Code)
+        }
+    })
+
+    t.Run("rate limit before maintenance", func(t *testing.T) {
+        h := newStackHandler(t)
+        stack := h.routeStack(Route{}, 0)(ok)
+        if w := serve(stack, request(http.MethodPost, "")); w.Code != http.StatusServiceUnavailable {
+            t.Fatalf("first request: status = %d, want 503", w.Code)
+        }
+        w := serve(stack, request(http.MethodPost, ""))
+        if w.Code != http.StatusTooManyRequests {
+            t.Fatalf("second request: status = %d, want 429", w.Code)
+        }
+        if w.Header().Get("Retry-After") == "" {
+            t.Error("429 is missing Retry-After")
+        }
+    })
+
+    t.Run("recover outermost", func(t *testing.T) {
+        h := newStackHandler(t)
+        panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            panic("boom")
+        })
+        w := serve(h.routeStack(Route{}, time.Second)(panicking), request(http.MethodGet, ""))
+        if w.Code != http.StatusInternalServerError {
+            t.Errorf("status = %d, want 500", w.Code)
+        }
+    })
+}
+
+// gzipped compresses body
+func gzipped(t *testing.T, body string) *bytes.Buffer {
+    t.Helper()
+    var buf bytes.Buffer
+    zw := gzip.NewWriter(&buf)
+    if _, err := zw.Write([]byte(body)); err != nil {
+        t.Fatal(err)
+    }
+    if err := zw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return &buf
+}
+
+func TestGzipRequest(t *testing.T) {
+    echo := withGzipRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, err := io.ReadAll(r.Body)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+            return
+        }
+        if r.Header.Get("Content-Encoding") != "" {
+            http.Error(w, "Content-Encoding still set", http.StatusInternalServerError)
+            return
+        }
+        w.Write(body)
+    }))
+    post := func(body io.Reader, encoding string) *httptest.ResponseRecorder {
+        r := httptest.NewRequest(http.MethodPost, "/", body)
+        if encoding != "" {
+            r.Header.Set("Content-Encoding", encoding)
+        }
+        return serve(echo, r)
+    }
+
+    tests := []struct {
+        name     string
+        body     io.Reader
+        encoding string
+        wantCode int
+        wantBody string
+    }{
+        {"plaintext", strings.NewReader(`{"a":1}`), "", http.StatusOK, `{"a":1}`},
+        {"gzip", gzipped(t, `{"a":1}`), "gzip", http.StatusOK, `{"a":1}`},
+        {"gzip any case", gzipped(t, `{"a":1}`), " GZip ", http.StatusOK, `{"a":1}`},
+        {"not gzip", strings.NewReader(`{"a":1}`), "gzip", http.StatusBadRequest, ""},
+        {"unsupported", strings.NewReader(`{"a":1}`), "br", http.StatusUnsupportedMediaType, ""},
+        // Compresses to a few KB but expands past the limit
+        {"expands too far", gzipped(t, strings.Repeat("a", maxDecompressedBodyBytes+1)), "gzip", http.StatusRequestEntityTooLarge, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := post(tt.body, tt.encoding)
+            if w.Code != tt.wantCode {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+            }
+            if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+                t.Errorf("body = %q, want %q", w.Body, tt.wantBody)
+            }
+        })
+    }
+}
+
+func TestGzipBatchPreferences(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+    mock.ExpectExec(`INSERT INTO user_preferences`).
+        WithArgs("dev-1", "default", "Truck", false, nil, "default").
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(preferenceRows("dev-1", "default", "Truck", 0, nil))
+
+    r := httptest.NewRequest(http.MethodPost, "/api/preferences/batch?mode=best_effort",
+        gzipped(t, `[{"device_id":"dev-1","display_name":"Truck"}]`))
+    r.Header.Set("Content-Type", "application/json")
+    r.Header.Set("Content-Encoding", "gzip")
+    w := serve(mux, r)
+    if w.Code != http.StatusMultiStatus {
+        t.Fatalf("status = %d, want 207: %s", w.Code, w.Body)
+    }
+    var body struct {
+        Succeeded int `json:"succeeded"`
+        Failed    int `json:"failed"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    if body.Succeeded != 1 || body.Failed != 0 {
+        t.Errorf("succeeded = %d, failed = %d, want 1 and 0", body.Succeeded, body.Failed)
+    }
+}
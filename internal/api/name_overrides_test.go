@@ -0,0 +1,85 @@
+// name_overrides_test.go covers DEVICE_NAME_OVERRIDES in vehicle lists and
+// their precedence below stored preferences.
+
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// overriddenHandler returns a handler whose upstream names dev1 and dev2
+// "Upstream 1" and "Upstream 2", with dev1 overridden to "Front Loader"
+func overriddenHandler(t *testing.T) (*Handler, *http.ServeMux) {
+    t.Helper()
+    h, mux := newTestHandler(t, HandlerConfig{}, devicesReply(`{"result_list":[
+        {"device_id":"dev1","display_name":"Upstream 1"},
+        {"device_id":"dev2","display_name":"Upstream 2"}
+    ]}`))
+    h.GPSClient.SetNameOverrides(map[string]string{"dev1": "Front Loader"})
+    return h, mux
+}
+
+func TestVehiclesNameOverrides(t *testing.T) {
+    _, mux := overriddenHandler(t)
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d: %s", w.Code, w.Body)
+    }
+    var vehicles []struct {
+        DeviceID    string `json:"device_id"`
+        DisplayName string `json:"display_name"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &vehicles); err != nil {
+        t.Fatal(err)
+    }
+    got := make(map[string]string)
+    for _, v := range vehicles {
+        got[v.DeviceID] = v.DisplayName
+    }
+    if got["dev1"] != "Front Loader" || got["dev2"] != "Upstream 2" {
+        t.Errorf("display names = %v, want dev1 overridden and dev2 from upstream", got)
+    }
+}
+
+func TestEffectivePreferenceOverridePrecedence(t *testing.T) {
+    preferenceQuery := regexp.QuoteMeta("WHERE device_id = ? AND client_id = ?")
+    tests := []struct {
+        name       string
+        stored     string // Stored display name, none when empty
+        wantName   string
+        wantSource string
+    }{
+        {"override without preference", "", "Front Loader", nameSourceDefault},
+        {"preference over override", "My Loader", "My Loader", nameSourcePreference},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h, mux := overriddenHandler(t)
+            mock := mockDatabase(t, h)
+            if tt.stored == "" {
+                mock.ExpectQuery(preferenceQuery).WithArgs("dev1", defaultClientID).WillReturnError(sql.ErrNoRows)
+            } else {
+                mock.ExpectQuery(preferenceQuery).WithArgs("dev1", defaultClientID).
+                    WillReturnRows(preferenceRows("dev1", defaultClientID, tt.stored, 1, nil))
+            }
+
+            w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/preferences/dev1/effective", nil))
+            if w.Code != http.StatusOK {
+                t.Fatalf("status = %d: %s", w.Code, w.Body)
+            }
+            var got effectivePreference
+            if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+                t.Fatal(err)
+            }
+            if got.DisplayName != tt.wantName || got.NameSource != tt.wantSource || got.DefaultDisplayName != "Front Loader" {
+                t.Errorf("effective = %+v, want %q from %s over default Front Loader", got, tt.wantName, tt.wantSource)
+            }
+        })
+    }
+}
@@ -0,0 +1,70 @@
+// pagination.go provides limit/offset parsing shared by paginated endpoints.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Fallback page sizes when PAGE_SIZE_DEFAULT / PAGE_SIZE_MAX aren't set
+const (
+    defaultPageSize = 50
+    maxPageSize     = 500
+)
+
+// pagination is a parsed ?limit=&offset= pair
+type pagination struct {
+    Limit  int `json:"limit"`
+    Offset int `json:"offset"`
+}
+
+// PaginationError describes an invalid limit or offset parameter
+type PaginationError struct {
+    Param   string
+    Message string
+}
+
+func (e *PaginationError) Error() string {
+    return fmt.Sprintf("invalid %s: %s", e.Param, e.Message)
+}
+
+// parsePagination reads ?limit= and ?offset=. A missing limit uses
+// defaultLimit and larger limits are clamped to maxLimit rather than rejected.
+// Non-numeric values, limit <= 0 and negative offsets return a *PaginationError.
+func parsePagination(r *http.Request, defaultLimit, maxLimit int) (pagination, *PaginationError) {
+    p := pagination{Limit: defaultLimit}
+
+    if v := r.URL.Query().Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 {
+            return p, &PaginationError{Param: "limit", Message: "must be a positive integer"}
+        }
+        p.Limit = n
+    }
+    if p.Limit > maxLimit {
+        p.Limit = maxLimit
+    }
+
+    if v := r.URL.Query().Get("offset"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 0 {
+            return p, &PaginationError{Param: "offset", Message: "must be a non-negative integer"}
+        }
+        p.Offset = n
+    }
+    return p, nil
+}
+
+// writePaginationError sends a structured 400 for invalid pagination params
+func writePaginationError(w http.ResponseWriter, err *PaginationError) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusBadRequest)
+    json.NewEncoder(w).Encode(map[string]string{
+        "error":   "invalid_pagination",
+        "param":   err.Param,
+        "message": err.Error(),
+    })
+}
@@ -0,0 +1,112 @@
+// pagination_test.go covers limit/offset parsing and its use by paginated endpoints.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePagination(t *testing.T) {
+    tests := []struct {
+        query     string
+        want      pagination
+        wantParam string
+    }{
+        {"", pagination{Limit: 20}, ""},
+        {"limit=5", pagination{Limit: 5}, ""},
+        {"limit=100", pagination{Limit: 100}, ""},
+        {"limit=101", pagination{Limit: 100}, ""}, // Clamped, not rejected
+        {"limit=100000&offset=30", pagination{Limit: 100, Offset: 30}, ""},
+        {"offset=0", pagination{Limit: 20}, ""},
+        {"limit=0", pagination{}, "limit"},
+        {"limit=-1", pagination{}, "limit"},
+        {"limit=ten", pagination{}, "limit"},
+        {"offset=-1", pagination{}, "offset"},
+        {"offset=1.5", pagination{}, "offset"},
+    }
+    for _, tt := range tests {
+        r := httptest.NewRequest(http.MethodGet, "/api/preferences?"+tt.query, nil)
+        got, err := parsePagination(r, 20, 100)
+        if tt.wantParam != "" {
+            if err == nil || err.Param != tt.wantParam {
+                t.Errorf("%q: error = %v, want one for %s", tt.query, err, tt.wantParam)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%q: error = %v", tt.query, err)
+            continue
+        }
+        if got != tt.want {
+            t.Errorf("%q = %+v, want %+v", tt.query, got, tt.want)
+        }
+    }
+}
+
+func TestPageSizeDefaults(t *testing.T) {
+    tests := []struct {
+        cfg                  HandlerConfig
+        wantDefault, wantMax int
+    }{
+        {HandlerConfig{}, 50, 500},
+        {HandlerConfig{DefaultPageSize: 10, MaxPageSize: 40}, 10, 40},
+        {HandlerConfig{DefaultPageSize: 80, MaxPageSize: 40}, 40, 40}, // The default can't exceed the max
+    }
+    for _, tt := range tests {
+        h, _ := newTestHandler(t, tt.cfg, nil)
+        if h.config.DefaultPageSize != tt.wantDefault || h.config.MaxPageSize != tt.wantMax {
+            t.Errorf("%+v: page sizes = %d/%d, want %d/%d", tt.cfg, h.config.DefaultPageSize, h.config.MaxPageSize, tt.wantDefault, tt.wantMax)
+        }
+    }
+}
+
+func TestPaginatedEndpointsClampLimit(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey, DefaultPageSize: 10, MaxPageSize: 25}, nil)
+    mock := mockDatabase(t, h)
+
+    expectClientPage(mock, "default", 1, preferenceRows("dev-1", "default", "", 0, nil), 25, 5)
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/preferences?limit=1000&offset=5", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("preferences status = %d: %s", w.Code, w.Body)
+    }
+
+    // The admin endpoint shares the same limits, and applies the default
+    expectClientPage(mock, "client-a", 1, preferenceRows("dev-1", "client-a", "", 0, nil), 10, 0)
+    w = serve(mux, adminRequest(http.MethodGet, "/api/admin/preferences?client_ids=client-a"))
+    if w.Code != http.StatusOK {
+        t.Fatalf("admin status = %d: %s", w.Code, w.Body)
+    }
+}
+
+func TestPaginatedEndpointsRejectInvalid(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+    mockDatabase(t, h) // Nothing reaches SQL
+
+    requests := []*http.Request{
+        httptest.NewRequest(http.MethodGet, "/api/preferences?limit=0", nil),
+        httptest.NewRequest(http.MethodGet, "/api/preferences?limit=-10", nil),
+        httptest.NewRequest(http.MethodGet, "/api/preferences?limit=abc", nil),
+        httptest.NewRequest(http.MethodGet, "/api/preferences?limit=2.5", nil),
+        httptest.NewRequest(http.MethodGet, "/api/preferences?offset=-3", nil),
+        httptest.NewRequest(http.MethodGet, "/api/preferences?limit=10&offset=ten", nil),
+        adminRequest(http.MethodGet, "/api/admin/preferences?client_ids=client-a&limit=abc"),
+    }
+    wantParams := []string{"limit", "limit", "limit", "limit", "offset", "offset", "limit"}
+    for i, r := range requests {
+        w := serve(mux, r)
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", r.URL, w.Code)
+            continue
+        }
+        var body map[string]string
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+            t.Fatalf("decoding %q: %v", w.Body, err)
+        }
+        if body["error"] != "invalid_pagination" || body["param"] != wantParams[i] || body["message"] == "" {
+            t.Errorf("%s: body = %v", r.URL, body)
+        }
+    }
+}
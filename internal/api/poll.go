@@ -0,0 +1,34 @@
+// poll.go provides operator controls for the hub's OneStepGPS polling.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// PollPauseHandler handles POST /api/admin/poll/pause
+func (h *Handler) PollPauseHandler(w http.ResponseWriter, r *http.Request) {
+    h.Hub.PausePolling()
+    fmt.Println("OneStepGPS polling paused")
+    h.writePollState(w)
+}
+
+// PollResumeHandler handles POST /api/admin/poll/resume
+func (h *Handler) PollResumeHandler(w http.ResponseWriter, r *http.Request) {
+    h.Hub.ResumePolling()
+    fmt.Println("OneStepGPS polling resumed")
+    h.writePollState(w)
+}
+
+// writePollState responds with the current polling state
+func (h *Handler) writePollState(w http.ResponseWriter) {
+    state := h.Hub.State()
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "polling_enabled": state.PollingEnabled,
+        "polling_paused":  state.PollingPaused,
+        "last_poll_time":  state.LastPollTime,
+    })
+}
@@ -0,0 +1,71 @@
+// preference_defaults_test.go covers UNPREFERENCED_VISIBILITY and
+// UNPREFERENCED_ORDER for devices the client has no preference for.
+
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// unpreferredDevices is an account where only dev1 and dev3 have preferences
+const unpreferredDevices = `{"result_list":[{"device_id":"dev1"},{"device_id":"dev2"},{"device_id":"dev3"},{"device_id":"dev4"}]}`
+
+// sortedPreferences puts dev3 before dev1
+var sortedPreferences = []models.UserPreference{
+    {DeviceID: "dev1", ClientID: "default", SortOrder: 1},
+    {DeviceID: "dev3", ClientID: "default", SortOrder: 0},
+}
+
+func TestSortByPreferenceDefaults(t *testing.T) {
+    tests := []struct {
+        name     string
+        defaults models.PreferenceDefaults
+        target   string
+        want     []string
+    }{
+        {"last", models.PreferenceDefaults{}, "/api/vehicles?sort=preference", []string{"dev3", "dev1", "dev2", "dev4"}},
+        {"first", models.PreferenceDefaults{First: true}, "/api/vehicles?sort=preference", []string{"dev2", "dev4", "dev3", "dev1"}},
+        // desc reverses the preferred order but keeps upstream order among the rest
+        {"last desc", models.PreferenceDefaults{}, "/api/vehicles?sort=preference&order=desc", []string{"dev2", "dev4", "dev1", "dev3"}},
+        {"first desc", models.PreferenceDefaults{First: true}, "/api/vehicles?sort=preference&order=desc", []string{"dev1", "dev3", "dev2", "dev4"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, mux := newTestHandler(t, HandlerConfig{PreferenceDefaults: tt.defaults}, devicesReply(unpreferredDevices))
+            setPreferences(t, sortedPreferences)
+            if got := vehicleIDs(t, mux, tt.target); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("%s = %v, want %v", tt.target, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestUnpreferencedVisibility(t *testing.T) {
+    tests := []struct {
+        name     string
+        defaults models.PreferenceDefaults
+        want     []string
+    }{
+        {"visible", models.PreferenceDefaults{}, []string{"dev1", "dev2", "dev3", "dev4"}},
+        // Only devices the client has acknowledged with a preference are reported
+        {"hidden", models.PreferenceDefaults{Hidden: true}, []string{"dev1", "dev3"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h, _ := newTestHandler(t, HandlerConfig{PreferenceDefaults: tt.defaults}, devicesReply(unpreferredDevices))
+            setPreferences(t, sortedPreferences)
+
+            spec := models.ReportSpec{AllDevices: true}
+            if err := h.expandAllDevices(context.Background(), &spec, "default"); err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(spec.DeviceIDList, tt.want) {
+                t.Errorf("devices = %v, want %v", spec.DeviceIDList, tt.want)
+            }
+        })
+    }
+}
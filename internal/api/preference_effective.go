@@ -0,0 +1,77 @@
+// preference_effective.go resolves the name a device is actually shown with,
+// the client's custom display name or the upstream default, so
+// VehiclePreferences.vue doesn't have to merge the two itself.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// Where an effective display name came from
+const (
+    nameSourcePreference = "preference" // The client's stored display_name
+    nameSourceDefault    = "default"    // Upstream, after DEVICE_NAME_OVERRIDES
+)
+
+// effectivePreference is the /preferences/{deviceID}/effective response
+type effectivePreference struct {
+    DeviceID           string                 `json:"device_id"`
+    ClientID           string                 `json:"client_id"`
+    DisplayName        string                 `json:"display_name"`         // What the UI should show
+    DefaultDisplayName string                 `json:"default_display_name"` // Upstream name, shown without a custom one
+    NameSource         string                 `json:"name_source"`          // "preference" or "default"
+    IsHidden           bool                   `json:"is_hidden"`            // Stored, or UNPREFERENCED_VISIBILITY without a preference
+    Preference         *models.UserPreference `json:"preference"`           // Stored row, null when the client has none
+}
+
+// getEffectivePreference handles GET /preferences/{deviceID}/effective.
+// Without a stored preference, or with an empty display name, the upstream
+// name is used. Devices upstream doesn't know get the structured 404 of
+// /vehicles/{deviceID} even if a preference is still stored for them.
+func (h *Handler) getEffectivePreference(w http.ResponseWriter, r *http.Request, deviceID string) {
+    clientID := resolveClientID(r)
+
+    vehicles, err := h.devicesFor(r.Context())
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    var device *models.Vehicle
+    for i := range vehicles {
+        if vehicles[i].DeviceID == deviceID {
+            device = &vehicles[i]
+            break
+        }
+    }
+    if device == nil {
+        writeDeviceNotFound(w, &DeviceNotFoundError{DeviceIDs: []string{deviceID}})
+        return
+    }
+
+    pref, err := h.DB.GetPreferenceByDeviceAndClientID(deviceID, clientID, nil)
+    if err != nil {
+        respondError(w, databaseError("Failed to load preference", err))
+        return
+    }
+
+    effective := effectivePreference{
+        DeviceID:           deviceID,
+        ClientID:           clientID,
+        DisplayName:        device.DisplayName,
+        DefaultDisplayName: device.DisplayName,
+        NameSource:         nameSourceDefault,
+        IsHidden:           h.config.PreferenceDefaults.IsHidden(pref),
+        Preference:         pref,
+    }
+    if pref != nil && pref.DisplayName != "" {
+        effective.DisplayName = pref.DisplayName
+        effective.NameSource = nameSourcePreference
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(effective)
+}
@@ -0,0 +1,132 @@
+// preference_effective_test.go covers GET /api/preferences/{deviceID}/effective.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// getEffective requests target and decodes the effective preference
+func getEffective(t *testing.T, mux *http.ServeMux, target string) effectivePreference {
+    t.Helper()
+    w := serve(mux, httptest.NewRequest(http.MethodGet, target, nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    var got effectivePreference
+    if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    return got
+}
+
+func TestEffectivePreferenceOverride(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, devicesReply(oneDevice))
+    mock := mockDatabase(t, h)
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WithArgs("dev1", "client-a").
+        WillReturnRows(preferenceRows("dev1", "client-a", "Delivery van", 2, nil))
+
+    got := getEffective(t, mux, "/api/preferences/dev1/effective?client_id=client-a")
+    if got.DisplayName != "Delivery van" || got.DefaultDisplayName != "Truck 1" || got.NameSource != nameSourcePreference {
+        t.Errorf("effective = %+v, want the custom name over Truck 1", got)
+    }
+    if got.ClientID != "client-a" || got.Preference == nil || got.Preference.SortOrder != 2 {
+        t.Errorf("preference = %+v, want the stored row", got.Preference)
+    }
+}
+
+func TestEffectivePreferenceAbsent(t *testing.T) {
+    tests := []struct {
+        name string
+        rows *sqlmock.Rows
+    }{
+        {"no preference", sqlmock.NewRows(preferenceColumns)},
+        {"empty display name", preferenceRows("dev1", "default", "", 0, nil)},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h, mux := newTestHandler(t, HandlerConfig{}, devicesReply(oneDevice))
+            mock := mockDatabase(t, h)
+            mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+                WithArgs("dev1", "default").
+                WillReturnRows(tt.rows)
+
+            got := getEffective(t, mux, "/api/preferences/dev1/effective")
+            if got.DisplayName != "Truck 1" || got.NameSource != nameSourceDefault || got.IsHidden {
+                t.Errorf("effective = %+v, want the visible upstream name", got)
+            }
+        })
+    }
+}
+
+func TestEffectivePreferenceUnknownDevice(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, devicesReply(oneDevice))
+    mockDatabase(t, h) // Not queried for a device upstream doesn't have
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/preferences/ghost/effective", nil))
+    if w.Code != http.StatusNotFound {
+        t.Fatalf("status = %d, want 404: %s", w.Code, w.Body)
+    }
+    if body := errorBody(t, w); body.Error != "device_not_found" {
+        t.Errorf("error = %q, want device_not_found", body.Error)
+    }
+}
+
+func TestEffectivePreferenceHiddenDefault(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{PreferenceDefaults: models.PreferenceDefaults{Hidden: true}}, devicesReply(oneDevice))
+    mock := mockDatabase(t, h)
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(sqlmock.NewRows(preferenceColumns))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(preferenceRows("dev1", "default", "", 0, nil))
+
+    // Hidden until the client saves a preference, which then decides
+    if got := getEffective(t, mux, "/api/preferences/dev1/effective"); !got.IsHidden {
+        t.Errorf("without a preference: is_hidden = false, want UNPREFERENCED_VISIBILITY=hidden")
+    }
+    if got := getEffective(t, mux, "/api/preferences/dev1/effective"); got.IsHidden {
+        t.Errorf("with a visible preference: is_hidden = true")
+    }
+}
+
+func TestEffectivePreferenceErrors(t *testing.T) {
+    t.Run("upstream down", func(t *testing.T) {
+        _, mux := newTestHandler(t, HandlerConfig{}, func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Set("Content-Type", "text/html")
+            w.WriteHeader(http.StatusBadGateway)
+            w.Write([]byte("<html>down</html>"))
+        })
+        w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/preferences/dev1/effective", nil))
+        if w.Code != http.StatusBadGateway {
+            t.Fatalf("status = %d, want 502: %s", w.Code, w.Body)
+        }
+        if body := errorBody(t, w); body.Error != "upstream_unavailable" || strings.Contains(body.Message, "html") {
+            t.Errorf("body = %+v, want upstream_unavailable without the upstream page", body)
+        }
+    })
+
+    t.Run("database down", func(t *testing.T) {
+        h, mux := newTestHandler(t, HandlerConfig{}, devicesReply(oneDevice))
+        mock := mockDatabase(t, h)
+        mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+            WillReturnError(errors.New("dial tcp 10.0.0.5:3306: connection refused"))
+
+        w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/preferences/dev1/effective", nil))
+        if w.Code != http.StatusInternalServerError {
+            t.Fatalf("status = %d, want 500: %s", w.Code, w.Body)
+        }
+        if body := errorBody(t, w); body.Error != "database_error" || body.Message != "Failed to load preference" {
+            t.Errorf("body = %+v, want database_error without the cause", body)
+        }
+    })
+}
@@ -0,0 +1,67 @@
+// preferences_test.go covers the preference handlers' request handling.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+func TestPreferenceMetadataRoundTrip(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+
+    stored := `{"color":"#ff0000","icon":"truck"}`
+    mock.ExpectExec(`INSERT INTO user_preferences`).
+        WithArgs("dev-1", "default", "", false, stored, "default").
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectQuery(`WHERE device_id = \? AND client_id = \?`).
+        WillReturnRows(preferenceRows("dev-1", "default", "", 0, stored))
+
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/preferences",
+        strings.NewReader(`{"device_id":"dev-1","metadata":{"icon":"truck","color":"#ff0000"}}`)))
+    if w.Code != http.StatusCreated {
+        t.Fatalf("status = %d, want 201: %s", w.Code, w.Body)
+    }
+    var pref models.UserPreference
+    if err := json.Unmarshal(w.Body.Bytes(), &pref); err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]interface{}{"color": "#ff0000", "icon": "truck"}
+    if !reflect.DeepEqual(pref.Metadata, want) {
+        t.Errorf("metadata = %v, want %v", pref.Metadata, want)
+    }
+}
+
+func TestPreferenceOversizedMetadata(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mockDatabase(t, h) // No expectations, the database must not be touched
+
+    blob := `{"notes":"` + strings.Repeat("a", 5000) + `"}`
+    tests := []struct {
+        method, path, body string
+    }{
+        {http.MethodPost, "/api/preferences", `{"device_id":"dev-1","metadata":` + blob + `}`},
+        {http.MethodPut, "/api/preferences/dev-1", `{"metadata":` + blob + `}`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.method, func(t *testing.T) {
+            w := serve(mux, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+            if w.Code != http.StatusBadRequest {
+                t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+            }
+            body := errorBody(t, w)
+            if body.Error != "invalid_preference" || !strings.Contains(body.Message, "metadata exceeds") {
+                t.Errorf("body = %+v", body)
+            }
+        })
+    }
+}
@@ -0,0 +1,57 @@
+// projection_test.go covers GET /api/vehicles?fields=.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// projectedDevices has one vehicle with a position and one without
+const projectedDevices = `{"result_list":[
+    {"device_id":"dev1","display_name":"Truck","latest_device_point":{"lat":39.7,"lng":-104.9,"speed":42}},
+    {"device_id":"dev2","display_name":"Van"}
+]}`
+
+func TestVehiclesFields(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(projectedDevices))
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles?fields=device_id,lat,lng,speed", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    var got []map[string]interface{}
+    if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    want := []map[string]interface{}{
+        {"device_id": "dev1", "lat": 39.7, "lng": -104.9, "speed": 42.0},
+        {"device_id": "dev2", "lat": nil, "lng": nil, "speed": nil},
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("body = %v, want %v", got, want)
+    }
+}
+
+func TestVehiclesFieldsRejected(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(projectedDevices))
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles?fields=device_id,api_key", nil))
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+    }
+    if !strings.Contains(w.Body.String(), "api_key") {
+        t.Errorf("body = %q, want the unknown field named", w.Body)
+    }
+
+    // Projections are JSON only
+    r := httptest.NewRequest(http.MethodGet, "/api/vehicles?fields=device_id", nil)
+    r.Header.Set("Accept", "application/geo+json")
+    if w := serve(mux, r); w.Code != http.StatusNotAcceptable {
+        t.Errorf("GeoJSON projection = %d, want 406", w.Code)
+    }
+}
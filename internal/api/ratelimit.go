@@ -0,0 +1,142 @@
+// ratelimit.go limits how many requests a single client address can make,
+// so one misbehaving dashboard can't exhaust report slots or the upstream
+// OneStepGPS quota for everyone else. Behind a load balancer the address
+// comes from X-Forwarded-For, see TRUSTED_PROXY_HOPS.
+
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRateLimitBuckets bounds the per-address state kept between prunes
+const maxRateLimitBuckets = 10000
+
+// rateLimiter is a token bucket per client address
+type rateLimiter struct {
+    mu      sync.Mutex
+    rate    float64 // Tokens added per second
+    burst   float64 // Bucket capacity
+    buckets map[string]*tokenBucket
+    now     func() time.Time // Replaced in tests
+}
+
+// tokenBucket is one address's remaining tokens as of last
+type tokenBucket struct {
+    tokens float64
+    last   time.Time
+}
+
+// newRateLimiter allows perMinute requests per address on average with
+// bursts of up to burst, burst <= 0 means perMinute. Returns nil, no
+// limiting, when perMinute <= 0.
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+    if perMinute <= 0 {
+        return nil
+    }
+    if burst <= 0 {
+        burst = perMinute
+    }
+    return &rateLimiter{
+        rate:    float64(perMinute) / 60,
+        burst:   float64(burst),
+        buckets: make(map[string]*tokenBucket),
+        now:     time.Now,
+    }
+}
+
+// allow takes a token for key. When none is left it returns false and how
+// long until the next one.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := l.now()
+    b, ok := l.buckets[key]
+    if !ok {
+        if len(l.buckets) >= maxRateLimitBuckets {
+            l.prune(now)
+        }
+        b = &tokenBucket{tokens: l.burst, last: now}
+        l.buckets[key] = b
+    }
+
+    b.tokens += now.Sub(b.last).Seconds() * l.rate
+    if b.tokens > l.burst {
+        b.tokens = l.burst
+    }
+    b.last = now
+
+    if b.tokens < 1 {
+        wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+        return false, wait
+    }
+    b.tokens--
+    return true, 0
+}
+
+// prune drops buckets that have refilled, they're the same as a new one
+func (l *rateLimiter) prune(now time.Time) {
+    for key, b := range l.buckets {
+        if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+            delete(l.buckets, key)
+        }
+    }
+}
+
+// clientAddress is the rate limit key for r, the remote IP without its port.
+// With trustedHops proxies in front (1 for the Elastic Beanstalk load
+// balancer) it is the address the outermost trusted proxy appended to
+// X-Forwarded-For instead, otherwise every user would share the proxy's
+// bucket. Entries left of it are client-supplied and ignored, so a spoofed
+// header can't pick another client's bucket.
+func clientAddress(r *http.Request, trustedHops int) string {
+    if trustedHops > 0 {
+        var hops []string
+        for _, header := range r.Header.Values("X-Forwarded-For") {
+            hops = append(hops, strings.Split(header, ",")...)
+        }
+        if i := len(hops) - trustedHops; len(hops) > 0 {
+            if i < 0 {
+                i = 0 // Fewer hops than proxies, the first is the closest to the client
+            }
+            if ip := net.ParseIP(strings.TrimSpace(hops[i])); ip != nil {
+                return ip.String()
+            }
+        }
+    }
+
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
+
+// withRateLimit responds 429 with Retry-After once a client address
+// exceeds RATE_LIMIT_PER_MINUTE. Disabled when no limit is configured or
+// for routes marked unlimited, like the /metrics scrape.
+func (h *Handler) withRateLimit(unlimited bool) Middleware {
+    return func(next http.Handler) http.Handler {
+        if h.limiter == nil || unlimited {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            ok, wait := h.limiter.allow(clientAddress(r, h.config.TrustedProxyHops))
+            if !ok {
+                appErr := newAppError(http.StatusTooManyRequests, "rate_limited", "Too many requests, try again later", nil)
+                appErr.RetryAfter = wait.Round(time.Second)
+                if appErr.RetryAfter < time.Second {
+                    appErr.RetryAfter = time.Second
+                }
+                respondError(w, appErr)
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
@@ -0,0 +1,108 @@
+// ratelimit_test.go covers the per-address token bucket and which address a
+// request is counted against.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+    now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+    l := newRateLimiter(60, 2) // One token per second, bursts of 2
+    l.now = func() time.Time { return now }
+
+    for i := 0; i < 2; i++ {
+        if ok, _ := l.allow("a"); !ok {
+            t.Fatalf("burst request %d rejected", i)
+        }
+    }
+    ok, wait := l.allow("a")
+    if ok {
+        t.Fatal("request over the burst allowed")
+    }
+    if wait != time.Second {
+        t.Errorf("wait = %s, want 1s", wait)
+    }
+    if ok, _ := l.allow("b"); !ok {
+        t.Error("other address limited")
+    }
+
+    now = now.Add(time.Second)
+    if ok, _ := l.allow("a"); !ok {
+        t.Error("request after refill rejected")
+    }
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+    if l := newRateLimiter(0, 10); l != nil {
+        t.Error("limiter created without a limit")
+    }
+}
+
+func TestClientAddress(t *testing.T) {
+    tests := []struct {
+        name      string
+        forwarded []string // X-Forwarded-For header values
+        hops      int
+        want      string
+    }{
+        {"connection address", nil, 0, "10.0.0.5"},
+        {"forwarded ignored without trusted proxies", []string{"203.0.113.7"}, 0, "10.0.0.5"},
+        {"behind the load balancer", []string{"203.0.113.7"}, 1, "203.0.113.7"},
+        // The client prepended a fake entry, the load balancer appended the real one
+        {"spoofed entry ignored", []string{"198.51.100.1, 203.0.113.7"}, 1, "203.0.113.7"},
+        {"two proxies", []string{"203.0.113.7, 172.16.0.2"}, 2, "203.0.113.7"},
+        {"split across headers", []string{"203.0.113.7", "172.16.0.2"}, 2, "203.0.113.7"},
+        {"fewer entries than proxies", []string{"203.0.113.7"}, 3, "203.0.113.7"},
+        {"ipv6", []string{"2001:db8::1"}, 1, "2001:db8::1"},
+        {"garbage falls back", []string{"not-an-ip"}, 1, "10.0.0.5"},
+        {"missing header falls back", nil, 1, "10.0.0.5"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodGet, "/api/vehicles", nil)
+            r.RemoteAddr = "10.0.0.5:41234"
+            for _, v := range tt.forwarded {
+                r.Header.Add("X-Forwarded-For", v)
+            }
+            if got := clientAddress(r, tt.hops); got != tt.want {
+                t.Errorf("clientAddress = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRateLimitPerForwardedClient(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{RateLimitPerMinute: 1, TrustedProxyHops: 1, AdminAPIKey: testAdminKey}, nil)
+    go h.Hub.Run() // Answers the /metrics liveness heartbeat
+    t.Cleanup(func() { close(h.Hub.Broadcast) })
+
+    // get sends a request through the load balancer for client
+    get := func(target, client string) int {
+        r := adminRequest(http.MethodGet, target)
+        r.RemoteAddr = "10.0.0.5:41234" // The load balancer
+        r.Header.Set("X-Forwarded-For", client)
+        return serve(mux, r).Code
+    }
+
+    if code := get("/api/version", "203.0.113.7"); code != http.StatusOK {
+        t.Fatalf("first request: status = %d, want 200", code)
+    }
+    if code := get("/api/version", "203.0.113.7"); code != http.StatusTooManyRequests {
+        t.Errorf("second request from the same client: status = %d, want 429", code)
+    }
+    // A busy client doesn't use up everyone else's requests
+    if code := get("/api/version", "198.51.100.1"); code != http.StatusOK {
+        t.Errorf("another client: status = %d, want 200", code)
+    }
+    // Scrapes aren't limited
+    for i := 0; i < 3; i++ {
+        if code := get("/metrics", "203.0.113.7"); code != http.StatusOK {
+            t.Errorf("scrape %d: status = %d, want 200", i, code)
+        }
+    }
+}
@@ -0,0 +1,230 @@
+// report_activity_test.go covers the only_active / min_engine_time report filters.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// activityDevices is a fleet relative to now:
+//   - driving has been driving for 2 hours
+//   - idle started idling 10 minutes ago
+//   - parked has been off for 3 days and last reported then
+//   - late is off but reported 5 minutes ago
+func activityDevices(now time.Time) string {
+    device := func(id, status string, began, seen time.Time) string {
+        return fmt.Sprintf(`{"device_id":%q,"latest_device_point":{"lat":1,"lng":1,"dt_tracker":%q},`+
+            `"device_state":{"drive_status":%q,"drive_status_begin_time":%q}}`,
+            id, seen.Format(time.RFC3339), status, began.Format(time.RFC3339))
+    }
+    return `{"result_list":[` + strings.Join([]string{
+        device("driving", "driving", now.Add(-2*time.Hour), now.Add(-time.Minute)),
+        device("idle", "idle", now.Add(-10*time.Minute), now.Add(-10*time.Minute)),
+        device("parked", "off", now.Add(-72*time.Hour), now.Add(-72*time.Hour)),
+        device("late", "off", now.Add(-5*time.Minute), now.Add(-5*time.Minute)),
+    }, ",") + `]}`
+}
+
+func TestFilterActiveDevices(t *testing.T) {
+    now := time.Now()
+    h, _ := newTestHandler(t, HandlerConfig{}, devicesReply(activityDevices(now)))
+    all := []string{"driving", "idle", "parked", "late"}
+
+    tests := []struct {
+        name          string
+        from, to      time.Time
+        onlyActive    bool
+        minEngineTime int
+        want          []string
+    }{
+        {"no filter", now.Add(-3 * time.Hour), now, false, 0, all},
+        {"only active", now.Add(-3 * time.Hour), now, true, 0, []string{"driving", "idle", "late"}},
+        {"min engine time", now.Add(-3 * time.Hour), now, false, 60, []string{"driving"}},
+        {"min engine time short", now.Add(-3 * time.Hour), now, false, 5, []string{"driving", "idle"}},
+        // late reported after the period ended, that isn't activity in it
+        {"reported after the period", now.Add(-3 * time.Hour), now.Add(-30 * time.Minute), true, 0, []string{"driving"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            spec := models.ReportSpec{
+                DeviceIDList:  all,
+                DateTimeFrom:  tt.from.Format(time.RFC3339),
+                DateTimeTo:    tt.to.Format(time.RFC3339),
+                OnlyActive:    tt.onlyActive,
+                MinEngineTime: tt.minEngineTime,
+            }
+            got, err := h.filterActiveDevices(context.Background(), spec)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("got %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestFilterActiveDevicesRejects(t *testing.T) {
+    now := time.Now()
+    h, mux := newTestHandler(t, HandlerConfig{}, devicesReply(activityDevices(now)))
+
+    tests := []struct {
+        name     string
+        from, to time.Time
+        minutes  int
+        want     string
+    }{
+        {"no device ran long enough", now.Add(-3 * time.Hour), now, 600, "no vehicles had activity"},
+        {"negative", now.Add(-3 * time.Hour), now, -1, "must not be negative"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            spec := models.ReportSpec{
+                DeviceIDList:  []string{"driving", "idle"},
+                DateTimeFrom:  tt.from.Format(time.RFC3339),
+                DateTimeTo:    tt.to.Format(time.RFC3339),
+                MinEngineTime: tt.minutes,
+            }
+            if _, err := h.filterActiveDevices(context.Background(), spec); err == nil || !strings.Contains(err.Error(), tt.want) {
+                t.Errorf("got %v, want an error containing %q", err, tt.want)
+            }
+        })
+    }
+
+    // Over HTTP the rejection is a 400 before a report is requested upstream
+    body := fmt.Sprintf(`{"report_spec":{"report_type":"general_info","device_id_list":["driving"],"datetime_from":%q,"datetime_to":%q,"min_engine_time":600}}`,
+        now.Add(-3*time.Hour).Format(time.RFC3339), now.Format(time.RFC3339))
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body)))
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("generate: got %d, want 400: %s", w.Code, w.Body)
+    }
+    if got := errorBody(t, w); got.Error != "invalid_report_spec" || !strings.Contains(got.Message, "no vehicles had activity") {
+        t.Errorf("generate: got %+v, want invalid_report_spec", got)
+    }
+}
+
+// historyPoint is one device-point entry, engineOn nil leaves out vbus_engine_on
+type historyPoint struct {
+    at       time.Time
+    speed    float64
+    engineOn *bool
+}
+
+// historyUpstream serves activityDevices(now) and, from /device-point, the
+// points of each device within the requested range
+func historyUpstream(now time.Time, points map[string][]historyPoint) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        if !strings.HasPrefix(r.URL.Path, "/device-point") {
+            w.Write([]byte(activityDevices(now)))
+            return
+        }
+        q := r.URL.Query()
+        from, _ := time.Parse(time.RFC3339, q.Get("dt_tracker_from"))
+        to, _ := time.Parse(time.RFC3339, q.Get("dt_tracker_to"))
+        var list []models.APIDevicePoint
+        for _, p := range points[q.Get("device_id")] {
+            if q.Get("offset") != "0" || p.at.Before(from) || p.at.After(to) {
+                continue
+            }
+            at, lat, speed := p.at, 1.0, p.speed
+            list = append(list, models.APIDevicePoint{DtTracker: &at, Lat: &lat, Lng: &lat, Speed: &speed,
+                Detail: &models.APIDevicePointDetail{VbusEngineOn: p.engineOn}})
+        }
+        json.NewEncoder(w).Encode(models.APIDevicePointResponse{ResultList: list})
+    }
+}
+
+func TestFilterActiveDevicesHistory(t *testing.T) {
+    now := time.Now().Truncate(time.Second)
+    from, to := now.Add(-20*24*time.Hour), now.Add(-2*24*time.Hour)
+    on, off := true, false
+    // driving runs for 2 hours across the first 7 day history window,
+    // late reports twice with the engine on but 3 hours apart
+    run := from.Add(7*24*time.Hour - time.Hour)
+    var driving, idle []historyPoint
+    for i := 0; i < 24; i++ {
+        driving = append(driving, historyPoint{run.Add(time.Duration(i) * 5 * time.Minute), 30, &on})
+    }
+    driving = append(driving, historyPoint{run.Add(2 * time.Hour), 0, &off})
+    for i := 0; i < 12; i++ {
+        idle = append(idle, historyPoint{from.Add(time.Duration(i) * 5 * time.Minute), 0, nil})
+    }
+    points := map[string][]historyPoint{
+        "driving": driving,
+        "idle":    idle,
+        "late":    {{from.Add(time.Hour), 0, &on}, {from.Add(4 * time.Hour), 0, &on}},
+    }
+    h, _ := newTestHandler(t, HandlerConfig{}, historyUpstream(now, points))
+    all := []string{"driving", "idle", "parked", "late"}
+
+    tests := []struct {
+        name          string
+        onlyActive    bool
+        minEngineTime int
+        want          []string
+    }{
+        {"only active", true, 0, []string{"driving", "idle", "late"}},
+        {"min engine time", false, 120, []string{"driving"}},
+        {"min engine time too long", false, 121, nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            spec := models.ReportSpec{
+                DeviceIDList:  all,
+                DateTimeFrom:  from.Format(time.RFC3339),
+                DateTimeTo:    to.Format(time.RFC3339),
+                OnlyActive:    tt.onlyActive,
+                MinEngineTime: tt.minEngineTime,
+            }
+            got, err := h.filterActiveDevices(context.Background(), spec)
+            if tt.want == nil {
+                if err == nil || !strings.Contains(err.Error(), "no vehicles had activity") {
+                    t.Errorf("got %v, %v, want no vehicles", got, err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("got %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestFilterActiveDevicesUpstreamDown(t *testing.T) {
+    now := time.Now()
+    _, mux := newTestHandler(t, HandlerConfig{}, func(w http.ResponseWriter, r *http.Request) {
+        if strings.HasPrefix(r.URL.Path, "/device-point") {
+            w.Header().Set("Content-Type", "text/html")
+            w.WriteHeader(http.StatusBadGateway)
+            w.Write([]byte("<html>down</html>"))
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(activityDevices(now)))
+    })
+
+    // A failed history lookup is upstream's fault, not a bad spec
+    body := fmt.Sprintf(`{"report_spec":{"report_type":"general_info","device_id_list":["driving"],"datetime_from":%q,"datetime_to":%q,"only_active":true}}`,
+        now.Add(-50*time.Hour).Format(time.RFC3339), now.Add(-48*time.Hour).Format(time.RFC3339))
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body)))
+    if w.Code != http.StatusBadGateway {
+        t.Fatalf("generate: got %d, want 502: %s", w.Code, w.Body)
+    }
+    if got := errorBody(t, w); got.Error != "upstream_unavailable" {
+        t.Errorf("generate: got %+v, want upstream_unavailable", got)
+    }
+}
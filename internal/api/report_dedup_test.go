@@ -0,0 +1,101 @@
+// report_dedup_test.go covers sharing one upstream generation between
+// concurrent identical report requests.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+func TestConcurrentIdenticalReportsShareGeneration(t *testing.T) {
+    done := make(chan struct{})
+    var generates atomic.Int32
+    base := reportUpstream(done, "%PDF-1.4 shared")
+    upstream := func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/device":
+            w.Header().Set("Content-Type", "application/json")
+            w.Write([]byte(`{"result_list":[{"device_id":"dev1"},{"device_id":"dev2"}]}`))
+            return
+        case "/report/generate":
+            generates.Add(1)
+        }
+        base(w, r)
+    }
+    _, mux := newTestHandler(t, HandlerConfig{}, upstream)
+
+    // The same spec with devices listed in either order, plus a different one
+    specs := []string{
+        `{"report_type":"general_info","device_id_list":["dev1","dev2"]}`,
+        `{"report_type":"general_info","device_id_list":["dev2","dev1"]}`,
+        `{"report_type":"general_info","device_id_list":["dev1","dev2"]}`,
+        `{"report_type":"general_info","device_id_list":["dev2","dev1","dev1"]}`,
+        `{"report_type":"general_info","device_id_list":["dev1","dev2"],"user_report_name":"Weekly"}`,
+    }
+    responses := make([]*httptest.ResponseRecorder, len(specs))
+    var wg sync.WaitGroup
+    for i, spec := range specs {
+        wg.Add(1)
+        go func(i int, spec string) {
+            defer wg.Done()
+            r := httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(`{"report_spec":`+spec+`}`))
+            r.Header.Set("X-Request-ID", fmt.Sprintf("req-%d", i))
+            responses[i] = serve(mux, r)
+        }(i, spec)
+    }
+
+    // Let every request reach upstream before any generation finishes
+    deadline := time.Now().Add(5 * time.Second)
+    for generates.Load() < 2 && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+    time.Sleep(200 * time.Millisecond)
+    close(done)
+    wg.Wait()
+
+    if got := generates.Load(); got != 2 {
+        t.Errorf("upstream generate calls = %d, want 2 (one per distinct spec)", got)
+    }
+    for i, w := range responses {
+        if w.Code != http.StatusOK || w.Body.String() != "%PDF-1.4 shared" {
+            t.Errorf("request %d = %d %q, want the report", i, w.Code, w.Body)
+        }
+    }
+}
+
+func TestReportKey(t *testing.T) {
+    key := func(spec models.ReportSpec) string {
+        t.Helper()
+        req := buildReportRequest(spec, nil)
+        k, err := reportKey(&req)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return k
+    }
+
+    base := models.ReportSpec{DeviceIDList: []string{"dev1", "dev2"}, DateTimeFrom: "2026-01-01T00:00:00Z"}
+    reordered := base
+    reordered.DeviceIDList = []string{"dev2", "dev1"}
+    if key(base) != key(reordered) {
+        t.Error("device order changed the key")
+    }
+    if reordered.DeviceIDList[0] != "dev2" {
+        t.Error("reportKey reordered the request's device list")
+    }
+
+    later := base
+    later.DateTimeFrom = "2026-01-02T00:00:00Z"
+    if key(base) == key(later) {
+        t.Error("different periods share a key")
+    }
+}
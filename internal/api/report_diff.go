@@ -0,0 +1,36 @@
+// report_diff.go compares a saved report spec with a new one for auditing.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// ReportDiffHandler handles POST /report/diff.
+// Takes {"from": spec, "to": spec} and returns the field-by-field
+// difference, see models.DiffReportSpecs. Nothing is validated or generated.
+func (h *Handler) ReportDiffHandler(w http.ResponseWriter, r *http.Request) {
+    body, ok := readReportBody(w, r)
+    if !ok {
+        return
+    }
+
+    var req struct {
+        From *models.ReportSpec `json:"from"`
+        To   *models.ReportSpec `json:"to"`
+    }
+    if err := json.Unmarshal(body, &req); err != nil {
+        respondError(w, invalidReportBody(err))
+        return
+    }
+    if req.From == nil || req.To == nil {
+        respondError(w, newAppError(http.StatusBadRequest, "report_specs_required", "Both from and to report specs are required", nil))
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(models.DiffReportSpecs(*req.From, *req.To))
+}
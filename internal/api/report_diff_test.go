@@ -0,0 +1,52 @@
+// report_diff_test.go covers POST /api/report/diff.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+func TestReportDiff(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+
+    body := `{
+        "from": {"report_type":"general_info","device_id_list":["dev1","dev2"],"datetime_from":"2024-05-01T00:00:00Z","report_options":{"group_by":"day"}},
+        "to":   {"report_type":"trips","device_id_list":["dev2","dev3"],"datetime_from":"2024-04-01T00:00:00Z","report_options":{"group_by":"day"}}
+    }`
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/diff", strings.NewReader(body)))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    var diff models.ReportSpecDiff
+    if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    if diff.Identical || !reflect.DeepEqual(diff.DevicesAdded, []string{"dev3"}) || !reflect.DeepEqual(diff.DevicesRemoved, []string{"dev1"}) {
+        t.Errorf("diff = %+v", diff)
+    }
+    var fields []string
+    for _, c := range diff.Changes {
+        fields = append(fields, c.Field)
+    }
+    if want := []string{"report_type", "datetime_from"}; !reflect.DeepEqual(fields, want) {
+        t.Errorf("changed fields = %v, want %v", fields, want)
+    }
+}
+
+func TestReportDiffRequiresBothSpecs(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+
+    for _, body := range []string{`{"from":{"report_type":"trips"}}`, `{"to":{"report_type":"trips"}}`, `{"from":`, ""} {
+        w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/diff", strings.NewReader(body)))
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("body %q: status = %d, want 400", body, w.Code)
+        }
+    }
+}
@@ -0,0 +1,68 @@
+// report_fields_test.go covers the REPORT_OUTPUT_FIELDS allowlist.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReportOutputFieldAllowlist(t *testing.T) {
+    calls := map[string]*atomic.Int32{"/report/generate": new(atomic.Int32)}
+    _, mux := newTestHandler(t, HandlerConfig{
+        ReportOutputFields: []string{"display_name", "drive_time"},
+    }, countingDevices(calls))
+
+    body := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"],` +
+        `"report_output_field_list":["display_name","fuel_used","idle_time"]}}`
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body)))
+
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400 (body %s)", w.Code, w.Body)
+    }
+    resp := errorBody(t, w)
+    if resp.Error != "invalid_report_spec" || !strings.Contains(resp.Message, "fuel_used, idle_time") {
+        t.Errorf("body = %+v, want both unsupported fields listed", resp)
+    }
+    if strings.Contains(resp.Message, "display_name") {
+        t.Errorf("message %q lists an allowed field", resp.Message)
+    }
+    if n := calls["/report/generate"].Load(); n != 0 {
+        t.Errorf("upstream generate called %d times for a rejected spec", n)
+    }
+}
+
+func TestResolveOutputFields(t *testing.T) {
+    restricted, _ := newTestHandler(t, HandlerConfig{ReportOutputFields: []string{"display_name", "drive_time"}}, nil)
+    defaults, _ := newTestHandler(t, HandlerConfig{}, nil)
+
+    tests := []struct {
+        name      string
+        h         *Handler
+        requested []string
+        want      []string
+        wantErr   bool
+    }{
+        {"none requested uses the allowlist", restricted, nil, []string{"display_name", "drive_time"}, false},
+        {"allowed subset", restricted, []string{"drive_time"}, []string{"drive_time"}, false},
+        {"disallowed field", restricted, []string{"drive_time", "fuel_used"}, nil, true},
+        {"defaults when unconfigured", defaults, nil, defaultReportOutputFields, false},
+        {"default field allowed", defaults, []string{defaultReportOutputFields[0]}, []string{defaultReportOutputFields[0]}, false},
+        {"unknown against defaults", defaults, []string{"not_a_field"}, nil, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := tt.h.resolveOutputFields(tt.requested)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("fields = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
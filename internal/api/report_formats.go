@@ -0,0 +1,118 @@
+// report_formats.go resolves the export formats of a report request and
+// bundles multiple formats into a single ZIP download.
+
+package api
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+)
+
+// resolveReportFormats returns the export formats for spec: formats when
+// given (lowercased, duplicates dropped), otherwise file_type or pdf.
+// Every format must pass the client's file type allowlist.
+func (h *Handler) resolveReportFormats(spec models.ReportSpec) ([]string, error) {
+    requested := spec.Formats
+    if len(requested) == 0 {
+        requested = []string{spec.FileType}
+    }
+
+    seen := make(map[string]bool, len(requested))
+    formats := make([]string, 0, len(requested))
+    for _, f := range requested {
+        f = strings.ToLower(strings.TrimSpace(f))
+        if f == "" {
+            if len(spec.Formats) > 0 {
+                return nil, fmt.Errorf("formats must not contain empty entries")
+            }
+            f = onestepgps.DefaultFileType
+        }
+        if seen[f] {
+            continue
+        }
+        if err := h.GPSClient.CheckFileType(f); err != nil {
+            return nil, err
+        }
+        seen[f] = true
+        formats = append(formats, f)
+    }
+    return formats, nil
+}
+
+// writeReportFile streams a single-format report from the export endpoint,
+// flushing as chunks arrive so the response goes out chunked. The export is
+// opened before the response starts so an upstream failure can still be
+// reported with a proper status. Returns the error that ended the download, if any.
+func (h *Handler) writeReportFile(w http.ResponseWriter, result *reportResult) error {
+    fileType := result.FileTypes[0]
+    body, contentType, err := h.GPSClient.OpenReport(result.ReportID, fileType)
+    if err != nil {
+        fmt.Printf("Error opening %s export of report %s: %v\n", fileType, result.ReportID, err)
+        respondError(w, newAppError(upstreamErrorStatus(err), "report_download_failed", "Error downloading report", err))
+        return err
+    }
+    defer body.Close()
+
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=report_%s.%s", result.ReportID, fileType))
+    w.WriteHeader(http.StatusOK)
+
+    n, err := io.Copy(onestepgps.FlushWriter{W: w}, body)
+    if err != nil {
+        // Headers are already sent, the client sees a truncated file
+        fmt.Printf("Error streaming report %s after %d bytes: %v\n", result.ReportID, n, err)
+        return err
+    }
+    return nil
+}
+
+// writeReportZip streams each export format into one ZIP entry, reading from
+// upstream as it writes so no export is held in memory.
+// Every export is opened before the response starts so an upstream failure
+// can still be reported with a proper status. Returns the error that ended
+// the download, if any.
+func (h *Handler) writeReportZip(w http.ResponseWriter, result *reportResult) error {
+    bodies := make([]io.ReadCloser, 0, len(result.FileTypes))
+    defer func() {
+        for _, b := range bodies {
+            b.Close()
+        }
+    }()
+    for _, fileType := range result.FileTypes {
+        body, _, err := h.GPSClient.OpenReport(result.ReportID, fileType)
+        if err != nil {
+            fmt.Printf("Error opening %s export of report %s: %v\n", fileType, result.ReportID, err)
+            respondError(w, newAppError(upstreamErrorStatus(err), "report_download_failed", "Error downloading report", err))
+            return err
+        }
+        bodies = append(bodies, body)
+    }
+
+    w.Header().Set("Content-Type", "application/zip")
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=report_%s.zip", result.ReportID))
+    w.WriteHeader(http.StatusOK)
+
+    zw := zip.NewWriter(onestepgps.FlushWriter{W: w})
+    for i, fileType := range result.FileTypes {
+        entry, err := zw.Create(fmt.Sprintf("report_%s.%s", result.ReportID, fileType))
+        if err == nil {
+            _, err = io.Copy(entry, bodies[i])
+        }
+        if err != nil {
+            // Headers are already sent, the client sees a truncated archive
+            fmt.Printf("Error writing %s export of report %s to zip: %v\n", fileType, result.ReportID, err)
+            return err
+        }
+    }
+    if err := zw.Close(); err != nil {
+        fmt.Printf("Error finishing zip for report %s: %v\n", result.ReportID, err)
+        return err
+    }
+    return nil
+}
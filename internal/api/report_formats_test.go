@@ -0,0 +1,168 @@
+// report_formats_test.go covers resolving export formats against the
+// REPORT_FILE_TYPES allowlist and bundling several formats into a ZIP.
+
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+)
+
+func TestResolveReportFormats(t *testing.T) {
+    h, _ := newTestHandler(t, HandlerConfig{}, nil)
+    h.GPSClient = onestepgps.NewClient("test-key", "", []string{"pdf", "xlsx"})
+
+    tests := []struct {
+        name       string
+        spec       models.ReportSpec
+        want       []string
+        notAllowed bool
+    }{
+        {"default", models.ReportSpec{}, []string{"pdf"}, false},
+        {"file_type", models.ReportSpec{FileType: "XLSX"}, []string{"xlsx"}, false},
+        {"formats deduped", models.ReportSpec{Formats: []string{"pdf", "xlsx", "PDF"}}, []string{"pdf", "xlsx"}, false},
+        {"disallowed file_type", models.ReportSpec{FileType: "csv"}, nil, true},
+        {"one disallowed format", models.ReportSpec{Formats: []string{"pdf", "csv"}}, nil, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := h.resolveReportFormats(tt.spec)
+            if tt.notAllowed {
+                if !errors.Is(err, onestepgps.ErrFileTypeNotAllowed) {
+                    t.Errorf("error = %v, want ErrFileTypeNotAllowed", err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("error = %v", err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("formats = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestGenerateReportDisallowedFileType(t *testing.T) {
+    var generates atomic.Int32
+    _, mux := newTestHandler(t, HandlerConfig{}, func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/report/generate" {
+            generates.Add(1)
+        }
+        devicesReply(oneDevice)(w, r)
+    })
+
+    // Only pdf is allowed by default
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate",
+        strings.NewReader(`{"report_spec":{"report_type":"general_info","device_id_list":["dev1"],"file_type":"xlsx"}}`)))
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+    }
+    if body := errorBody(t, w); body.Error != "invalid_report_spec" || !strings.Contains(body.Message, `"xlsx"`) {
+        t.Errorf("body = %+v", body)
+    }
+    if n := generates.Load(); n != 0 {
+        t.Errorf("upstream generate calls = %d, want 0", n)
+    }
+}
+
+// formatsHandler returns a mux whose OneStepGPS client allows pdf and csv and
+// finishes every generation at once, exporting "<file_type> export"
+func formatsHandler(t *testing.T) *http.ServeMux {
+    t.Helper()
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        switch {
+        case strings.HasPrefix(r.URL.Path, "/device"):
+            w.Write([]byte(oneDevice))
+        case r.URL.Path == "/report/generate":
+            w.Write([]byte(`{"report_generated_id":"rep-1","status":"pending"}`))
+        case strings.HasPrefix(r.URL.Path, "/report-generated/export/"):
+            fileType := r.URL.Query().Get("file_type")
+            w.Header().Set("Content-Type", "application/"+fileType)
+            w.Write([]byte(fileType + " export"))
+        case strings.HasPrefix(r.URL.Path, "/report-generated/"):
+            w.Write([]byte(`{"status":"done"}`))
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    t.Cleanup(upstream.Close)
+
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    h.GPSClient = onestepgps.NewClient("test-key", upstream.URL, []string{"pdf", "csv"})
+    return mux
+}
+
+// generateFormats POSTs a report for dev1 with the given formats field
+func generateFormats(t *testing.T, mux http.Handler, formats string) *httptest.ResponseRecorder {
+    t.Helper()
+    body := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"],"formats":` + formats + `}}`
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body)))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    return w
+}
+
+func TestGenerateReportSingleFormat(t *testing.T) {
+    w := generateFormats(t, formatsHandler(t), `["CSV"]`)
+
+    if got := w.Body.String(); got != "csv export" {
+        t.Errorf("body = %q, want the csv export as is", got)
+    }
+    if ct := w.Header().Get("Content-Type"); ct != "application/csv" {
+        t.Errorf("Content-Type = %q, want application/csv", ct)
+    }
+    if cd := w.Header().Get("Content-Disposition"); cd != "attachment; filename=report_rep-1.csv" {
+        t.Errorf("Content-Disposition = %q", cd)
+    }
+}
+
+func TestGenerateReportMultipleFormatsZip(t *testing.T) {
+    w := generateFormats(t, formatsHandler(t), `["pdf", "csv", "pdf"]`)
+
+    if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+        t.Fatalf("Content-Type = %q, want application/zip", ct)
+    }
+    if cd := w.Header().Get("Content-Disposition"); cd != "attachment; filename=report_rep-1.zip" {
+        t.Errorf("Content-Disposition = %q", cd)
+    }
+    zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+    if err != nil {
+        t.Fatalf("reading zip: %v", err)
+    }
+    got := make(map[string]string, len(zr.File))
+    var names []string
+    for _, f := range zr.File {
+        rc, err := f.Open()
+        if err != nil {
+            t.Fatal(err)
+        }
+        content, err := io.ReadAll(rc)
+        rc.Close()
+        if err != nil {
+            t.Fatal(err)
+        }
+        names = append(names, f.Name)
+        got[f.Name] = string(content)
+    }
+    want := map[string]string{"report_rep-1.pdf": "pdf export", "report_rep-1.csv": "csv export"}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("entries = %v, want %v", got, want)
+    }
+    if wantNames := []string{"report_rep-1.pdf", "report_rep-1.csv"}; !reflect.DeepEqual(names, wantNames) {
+        t.Errorf("entry order = %v, want %v", names, wantNames)
+    }
+}
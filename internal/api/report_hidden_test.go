@@ -0,0 +1,70 @@
+// report_hidden_test.go covers leaving hidden vehicles out of all_devices reports.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// threeDevices is an account where the client has hidden dev2
+const threeDevices = `{"result_list":[{"device_id":"dev1"},{"device_id":"dev2"},{"device_id":"dev3"}]}`
+
+func TestExpandAllDevices(t *testing.T) {
+    h, _ := newTestHandler(t, HandlerConfig{}, devicesReply(threeDevices))
+    setPreferences(t, []models.UserPreference{
+        {DeviceID: "dev2", ClientID: "default", IsHidden: true},
+        {DeviceID: "dev3", ClientID: "default", DisplayName: "Shown"},
+    })
+
+    tests := []struct {
+        name string
+        spec models.ReportSpec
+        want []string
+    }{
+        {"hidden excluded by default", models.ReportSpec{AllDevices: true}, []string{"dev1", "dev3"}},
+        {"include_hidden", models.ReportSpec{AllDevices: true, IncludeHidden: true}, []string{"dev1", "dev2", "dev3"}},
+        // An explicit list is the user's choice, hidden or not
+        {"explicit list", models.ReportSpec{DeviceIDList: []string{"dev2"}}, []string{"dev2"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            spec := tt.spec
+            if err := h.expandAllDevices(context.Background(), &spec, "default"); err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(spec.DeviceIDList, tt.want) {
+                t.Errorf("devices = %v, want %v", spec.DeviceIDList, tt.want)
+            }
+        })
+    }
+}
+
+func TestExpandAllDevicesRejected(t *testing.T) {
+    h, _ := newTestHandler(t, HandlerConfig{}, devicesReply(`{"result_list":[{"device_id":"dev2"}]}`))
+    setPreferences(t, []models.UserPreference{{DeviceID: "dev2", ClientID: "default", IsHidden: true}})
+
+    tests := []struct {
+        name      string
+        spec      models.ReportSpec
+        wantError string
+    }{
+        {"with a device list", models.ReportSpec{AllDevices: true, DeviceIDList: []string{"dev1"}}, "invalid_report_spec"},
+        {"everything hidden", models.ReportSpec{AllDevices: true}, "no_visible_devices"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            spec := tt.spec
+            err := h.expandAllDevices(context.Background(), &spec, "default")
+            var appErr *AppError
+            if !errors.As(err, &appErr) || appErr.Status != http.StatusBadRequest || appErr.Code != tt.wantError {
+                t.Errorf("error = %v, want a 400 %s", err, tt.wantError)
+            }
+        })
+    }
+}
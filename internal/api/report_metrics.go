@@ -0,0 +1,80 @@
+// report_metrics.go times the phases of report generation (generate, poll,
+// download) for the logs, and keeps a histogram of total generation time
+// for /metrics.
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// reportDurationBuckets are the upper bounds, in seconds, of
+// fleet_report_generation_seconds. Most reports finish in under a minute,
+// multi-day ones can take several.
+var reportDurationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600}
+
+// durationHistogram is a fixed-bucket histogram written by hand in the
+// Prometheus text format, like the hub counters in metrics.go
+type durationHistogram struct {
+    mu      sync.Mutex
+    buckets []float64 // Upper bounds in seconds, ascending
+    counts  []uint64  // Observations per bucket, not cumulative, last is +Inf
+    sum     float64   // Seconds
+    count   uint64
+}
+
+// newDurationHistogram creates an empty histogram over buckets
+func newDurationHistogram(buckets []float64) *durationHistogram {
+    return &durationHistogram{
+        buckets: buckets,
+        counts:  make([]uint64, len(buckets)+1),
+    }
+}
+
+// observe records one duration
+func (d *durationHistogram) observe(dur time.Duration) {
+    seconds := dur.Seconds()
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    i := 0
+    for i < len(d.buckets) && seconds > d.buckets[i] {
+        i++
+    }
+    d.counts[i]++
+    d.sum += seconds
+    d.count++
+}
+
+// write writes the histogram as name, with cumulative le buckets
+func (d *durationHistogram) write(w io.Writer, name, help string) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+    fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+    var cumulative uint64
+    for i, bound := range d.buckets {
+        cumulative += d.counts[i]
+        fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, bound, cumulative)
+    }
+    fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, d.count)
+    fmt.Fprintf(w, "%s_sum %g\n", name, d.sum)
+    fmt.Fprintf(w, "%s_count %d\n", name, d.count)
+}
+
+// logReportPhase logs one phase of a generation as key=value pairs, e.g.
+// report phase=poll report_id=123 devices=4 outcome=ok duration=8.2s.
+// reportID is "-" until upstream has assigned one.
+func logReportPhase(phase, reportID string, devices int, start time.Time, err error) {
+    if reportID == "" {
+        reportID = "-"
+    }
+    duration := time.Since(start).Round(time.Millisecond)
+    if err != nil {
+        fmt.Printf("report phase=%s report_id=%s devices=%d outcome=error duration=%s error=%q\n", phase, reportID, devices, duration, err.Error())
+        return
+    }
+    fmt.Printf("report phase=%s report_id=%s devices=%d outcome=ok duration=%s\n", phase, reportID, devices, duration)
+}
@@ -0,0 +1,125 @@
+// report_metrics_test.go covers report phase logging and the generation time histogram.
+
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureStdout returns what fn prints, the phase logs go to stdout
+func captureStdout(t *testing.T, fn func()) string {
+    t.Helper()
+    r, w, err := os.Pipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    stdout := os.Stdout
+    os.Stdout = w
+    out := make(chan string)
+    go func() {
+        var buf bytes.Buffer
+        io.Copy(&buf, r)
+        out <- buf.String()
+    }()
+
+    defer func() {
+        os.Stdout = stdout
+    }()
+    fn()
+    w.Close()
+    return <-out
+}
+
+func TestReportLifecycleLogged(t *testing.T) {
+    done := make(chan struct{})
+    close(done)
+    _, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, reportUpstream(done, "%PDF-1.4 report"))
+
+    body := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}`
+    logs := captureStdout(t, func() {
+        w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body)))
+        if w.Code != http.StatusOK {
+            t.Errorf("status = %d, want 200: %s", w.Code, w.Body)
+        }
+    })
+
+    for _, phase := range []string{"generate", "poll", "total", "download"} {
+        pattern := regexp.MustCompile(`report phase=` + phase + ` report_id=rep-1 devices=1 outcome=ok duration=\S+\n`)
+        if !pattern.MatchString(logs) {
+            t.Errorf("no %s phase line in:\n%s", phase, logs)
+        }
+    }
+
+    w := serve(mux, adminRequest(http.MethodGet, "/metrics"))
+    for _, line := range []string{
+        "# TYPE fleet_report_generation_seconds histogram",
+        `fleet_report_generation_seconds_bucket{le="600"} 1`,
+        `fleet_report_generation_seconds_bucket{le="+Inf"} 1`,
+        "fleet_report_generation_seconds_count 1",
+    } {
+        if !strings.Contains(w.Body.String(), line+"\n") {
+            t.Errorf("missing %q in:\n%s", line, w.Body)
+        }
+    }
+}
+
+func TestReportLifecycleLogsFailure(t *testing.T) {
+    upstream := func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        if strings.HasPrefix(r.URL.Path, "/device") {
+            w.Write([]byte(oneDevice))
+            return
+        }
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"message":"generator down"}`))
+    }
+    h, mux := newTestHandler(t, HandlerConfig{}, upstream)
+
+    body := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}`
+    logs := captureStdout(t, func() {
+        serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body)))
+    })
+
+    // No report id was assigned, and failures are timed too
+    for _, phase := range []string{"generate", "total"} {
+        if !strings.Contains(logs, "report phase="+phase+" report_id=- devices=1 outcome=error") {
+            t.Errorf("no failed %s phase line in:\n%s", phase, logs)
+        }
+    }
+    if strings.Contains(logs, "report phase=poll") {
+        t.Errorf("poll logged after generate failed:\n%s", logs)
+    }
+    if h.reportDurations.count != 1 {
+        t.Errorf("histogram count = %d, want 1", h.reportDurations.count)
+    }
+}
+
+func TestDurationHistogram(t *testing.T) {
+    d := newDurationHistogram([]float64{1, 5})
+    for _, dur := range []time.Duration{500 * time.Millisecond, time.Second, 3 * time.Second, time.Minute} {
+        d.observe(dur)
+    }
+
+    var buf bytes.Buffer
+    d.write(&buf, "test_seconds", "Test durations.")
+    // Buckets are cumulative, a duration on a bound falls in that bucket
+    want := `# HELP test_seconds Test durations.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="5"} 3
+test_seconds_bucket{le="+Inf"} 4
+test_seconds_sum 64.5
+test_seconds_count 4
+`
+    if buf.String() != want {
+        t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+    }
+}
@@ -0,0 +1,95 @@
+// report_notify_test.go covers notifying the configured Notifier when a
+// report generation finishes.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/notify"
+)
+
+// fakeNotifier records notifications on a channel
+type fakeNotifier chan notify.ReportNotification
+
+func (f fakeNotifier) NotifyReport(ctx context.Context, n notify.ReportNotification) error {
+    f <- n
+    return nil
+}
+
+// nextNotification waits for one notification
+func nextNotification(t *testing.T, f fakeNotifier) notify.ReportNotification {
+    t.Helper()
+    select {
+    case n := <-f:
+        return n
+    case <-time.After(10 * time.Second):
+        t.Fatal("no notification sent")
+        return notify.ReportNotification{}
+    }
+}
+
+func TestReportNotifiedOnCompletion(t *testing.T) {
+    notifier := make(fakeNotifier, 1)
+    done := make(chan struct{})
+    close(done)
+    _, mux := newTestHandler(t, HandlerConfig{Notifier: notifier, PublicBaseURL: "https://fleet.example.com"},
+        reportUpstream(done, "%PDF-1.4 report"))
+
+    start := time.Now()
+    r := httptest.NewRequest(http.MethodPost, "/api/report/generate",
+        strings.NewReader(`{"report_spec":{"report_type":"general_info","device_id_list":["dev1"],"user_report_name":"Weekly"}}`))
+    r.Header.Set("X-Request-ID", "req-notify")
+    if w := serve(mux, r); w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+
+    n := nextNotification(t, notifier)
+    want := notify.ReportNotification{
+        RequestID:  "req-notify",
+        ReportID:   "rep-1",
+        ReportName: "Weekly",
+        Status:     "done",
+        Link:       "https://fleet.example.com/api/report/status/req-notify",
+    }
+    completedAt := n.CompletedAt
+    n.CompletedAt = time.Time{}
+    if n != want {
+        t.Errorf("notification = %+v, want %+v", n, want)
+    }
+    if completedAt.Before(start) {
+        t.Errorf("completed_at = %v, before the request", completedAt)
+    }
+}
+
+func TestReportNotifiedOnFailure(t *testing.T) {
+    notifier := make(fakeNotifier, 1)
+    _, mux := newTestHandler(t, HandlerConfig{Notifier: notifier}, func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/report/generate" {
+            http.Error(w, `{"error":"quota exceeded"}`, http.StatusInternalServerError)
+            return
+        }
+        devicesReply(oneDevice)(w, r)
+    })
+
+    r := httptest.NewRequest(http.MethodPost, "/api/report/generate",
+        strings.NewReader(`{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}`))
+    r.Header.Set("X-Request-ID", "req-fail")
+    if w := serve(mux, r); w.Code < 500 {
+        t.Fatalf("status = %d, want a 5xx: %s", w.Code, w.Body)
+    }
+
+    n := nextNotification(t, notifier)
+    if n.Status != "failed" || n.Error == "" || n.ReportID != "" {
+        t.Errorf("notification = %+v, want a failure without a report id", n)
+    }
+    // Without PUBLIC_BASE_URL the link is relative
+    if n.RequestID != "req-fail" || n.Link != "/api/report/status/req-fail" {
+        t.Errorf("request id %q, link %q", n.RequestID, n.Link)
+    }
+}
@@ -0,0 +1,149 @@
+// report_presets.go provides CRUD endpoints for named report presets, so
+// ReportDialog.vue can save a ReportSpec once and regenerate it later with
+// /report/generate?preset=name.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// errPresetNotFound is the 404 for a preset the client hasn't saved
+func errPresetNotFound(name string) *AppError {
+    return newAppError(http.StatusNotFound, "preset_not_found", fmt.Sprintf("report preset %q not found", name), nil)
+}
+
+// ReportPresetsHandler manages the current client's report presets.
+// GET /report/presets lists them, POST saves one (replacing a preset with the
+// same name), GET and DELETE /report/presets/{name} act on a single preset.
+func (h *Handler) ReportPresetsHandler(w http.ResponseWriter, r *http.Request) {
+    name, err := url.PathUnescape(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/report/presets"), "/"))
+    if err != nil {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_preset", "Invalid preset name", err))
+        return
+    }
+
+    switch r.Method {
+    case http.MethodGet:
+        if name == "" {
+            h.listReportPresets(w, r)
+        } else {
+            h.getReportPreset(w, r, name)
+        }
+    case http.MethodPost:
+        if name != "" {
+            respondError(w, newAppError(http.StatusMethodNotAllowed, "method_not_allowed", "POST to /api/report/presets, the name goes in the body", nil))
+            return
+        }
+        h.saveReportPreset(w, r)
+    case http.MethodDelete:
+        if name == "" {
+            respondError(w, newAppError(http.StatusBadRequest, "invalid_preset", "Preset name required", nil))
+            return
+        }
+        h.deleteReportPreset(w, r, name)
+    default:
+        respondError(w, newAppError(http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed", nil))
+    }
+}
+
+// listReportPresets returns every preset for the current client, by name
+func (h *Handler) listReportPresets(w http.ResponseWriter, r *http.Request) {
+    presets, err := h.DB.ListReportPresets(resolveClientID(r))
+    if err != nil {
+        respondError(w, newAppError(http.StatusInternalServerError, "database_error", "Error fetching report presets", err))
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(presets)
+}
+
+// getReportPreset returns a single preset or a structured 404
+func (h *Handler) getReportPreset(w http.ResponseWriter, r *http.Request, name string) {
+    preset, err := h.DB.GetReportPreset(resolveClientID(r), name)
+    if err != nil {
+        respondError(w, newAppError(http.StatusInternalServerError, "database_error", "Error fetching report preset", err))
+        return
+    }
+    if preset == nil {
+        respondError(w, errPresetNotFound(name))
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(preset)
+}
+
+// saveReportPreset creates or replaces a preset.
+// Only the spec's own shape is checked here, devices and fields are checked
+// when the preset is generated since they can change in the meantime.
+func (h *Handler) saveReportPreset(w http.ResponseWriter, r *http.Request) {
+    body, ok := readReportBody(w, r)
+    if !ok {
+        return
+    }
+    var newPreset models.ReportPresetCreate
+    if err := json.Unmarshal(body, &newPreset); err != nil {
+        respondError(w, invalidReportBody(err))
+        return
+    }
+
+    // An explicit client_id in the body wins unless a tenant is set
+    newPreset.ClientID = resolveBodyClientID(r, newPreset.ClientID)
+
+    if err := newPreset.Validate(); err != nil {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_preset", fmt.Sprintf("Invalid preset: %v", err), err))
+        return
+    }
+    if err := newPreset.Spec.Validate(); err != nil {
+        respondError(w, invalidReportSpec(err))
+        return
+    }
+
+    preset, err := h.DB.SaveReportPreset(&newPreset)
+    if err != nil {
+        respondError(w, newAppError(http.StatusInternalServerError, "database_error", "Error saving report preset", err))
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(preset)
+}
+
+// deleteReportPreset removes a preset, 404 if the client has none by that name
+func (h *Handler) deleteReportPreset(w http.ResponseWriter, r *http.Request, name string) {
+    deleted, err := h.DB.DeleteReportPreset(resolveClientID(r), name)
+    if err != nil {
+        respondError(w, newAppError(http.StatusInternalServerError, "database_error", "Error deleting report preset", err))
+        return
+    }
+    if !deleted {
+        respondError(w, errPresetNotFound(name))
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// loadPresetSpec returns the spec saved under name for the current client.
+// Writes the response and returns false when it can't be loaded.
+func (h *Handler) loadPresetSpec(w http.ResponseWriter, r *http.Request, name string) (models.ReportSpec, bool) {
+    preset, err := h.DB.GetReportPreset(resolveClientID(r), name)
+    if err != nil {
+        respondError(w, newAppError(http.StatusInternalServerError, "database_error", "Error fetching report preset", err))
+        return models.ReportSpec{}, false
+    }
+    if preset == nil {
+        respondError(w, errPresetNotFound(name))
+        return models.ReportSpec{}, false
+    }
+    return preset.Spec, true
+}
@@ -0,0 +1,150 @@
+// report_presets_test.go covers saving and listing report presets and
+// generating a report from one.
+
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// presetColumns are the columns of a report_presets read
+var presetColumns = []string{"id", "client_id", "name", "spec", "created_at", "updated_at"}
+
+// weeklySpec is the spec saved in the test presets
+var weeklySpec = models.ReportSpec{ReportType: "general_info", DeviceIDList: []string{"dev1"}}
+
+// presetRow is a stored preset holding spec as the database returns it
+func presetRow(rows *sqlmock.Rows, id int, name string, spec models.ReportSpec) *sqlmock.Rows {
+    data, _ := json.Marshal(spec)
+    now := time.Now()
+    return rows.AddRow(id, "default", name, data, now, now)
+}
+
+// specArg is spec as SaveReportPreset writes it
+func specArg(spec models.ReportSpec) driver.Value {
+    data, _ := json.Marshal(spec)
+    return string(data)
+}
+
+func TestSaveReportPreset(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+    mock.ExpectExec(`INSERT INTO report_presets`).
+        WithArgs("default", "weekly", specArg(weeklySpec)).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectQuery(`FROM report_presets\s+WHERE client_id = \? AND name = \?`).
+        WithArgs("default", "weekly").
+        WillReturnRows(presetRow(sqlmock.NewRows(presetColumns), 1, "weekly", weeklySpec))
+
+    body := `{"name":" weekly ","report_spec":{"report_type":"general_info","device_id_list":["dev1","dev1"]}}`
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/presets", strings.NewReader(body)))
+    if w.Code != http.StatusCreated {
+        t.Fatalf("status = %d, want 201: %s", w.Code, w.Body)
+    }
+    var preset models.ReportPreset
+    if err := json.Unmarshal(w.Body.Bytes(), &preset); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    if preset.Name != "weekly" || preset.Spec.ReportType != "general_info" || len(preset.Spec.DeviceIDList) != 1 {
+        t.Errorf("preset = %+v", preset)
+    }
+}
+
+func TestSaveReportPresetInvalid(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mockDatabase(t, h) // Nothing is saved
+
+    tests := []struct {
+        body      string
+        wantError string
+    }{
+        {`{"name":"  ","report_spec":{"device_id_list":["dev1"]}}`, "invalid_preset"},
+        {`{"name":"a/b","report_spec":{"device_id_list":["dev1"]}}`, "invalid_preset"},
+        {`{"name":"weekly","report_spec":{"device_id_list":["dev1",""]}}`, "invalid_report_spec"},
+        {"", "body_required"},
+    }
+    for _, tt := range tests {
+        w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/presets", strings.NewReader(tt.body)))
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("body %q: status = %d, want 400", tt.body, w.Code)
+            continue
+        }
+        if body := errorBody(t, w); body.Error != tt.wantError {
+            t.Errorf("body %q: error = %q, want %s", tt.body, body.Error, tt.wantError)
+        }
+    }
+}
+
+func TestListReportPresets(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+    rows := presetRow(sqlmock.NewRows(presetColumns), 2, "daily", weeklySpec)
+    mock.ExpectQuery(`FROM report_presets\s+WHERE client_id = \?\s+ORDER BY name ASC`).
+        WithArgs("default").
+        WillReturnRows(presetRow(rows, 1, "weekly", weeklySpec))
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/report/presets", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    var presets []models.ReportPreset
+    if err := json.Unmarshal(w.Body.Bytes(), &presets); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    if len(presets) != 2 || presets[0].Name != "daily" || presets[1].Name != "weekly" {
+        t.Errorf("presets = %+v, want daily and weekly", presets)
+    }
+}
+
+func TestGenerateReportFromPreset(t *testing.T) {
+    done := make(chan struct{})
+    close(done)
+    h, mux := newTestHandler(t, HandlerConfig{}, reportUpstream(done, "%PDF-1.4 report"))
+    mock := mockDatabase(t, h)
+    mock.ExpectQuery(`FROM report_presets\s+WHERE client_id = \? AND name = \?`).
+        WithArgs("default", "weekly").
+        WillReturnRows(presetRow(sqlmock.NewRows(presetColumns), 1, "weekly", weeklySpec))
+
+    // No body, the spec comes from the preset
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate?preset=weekly", nil))
+    if w.Code != http.StatusOK || w.Body.String() != "%PDF-1.4 report" {
+        t.Errorf("status = %d, body %q, want the report", w.Code, w.Body)
+    }
+}
+
+func TestReportPresetNotFound(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    mock := mockDatabase(t, h)
+    for i := 0; i < 2; i++ {
+        mock.ExpectQuery(`FROM report_presets\s+WHERE client_id = \? AND name = \?`).
+            WithArgs("default", "missing").
+            WillReturnRows(sqlmock.NewRows(presetColumns))
+    }
+    mock.ExpectExec(`DELETE FROM report_presets`).
+        WithArgs("default", "missing").
+        WillReturnResult(sqlmock.NewResult(0, 0))
+
+    for _, r := range []*http.Request{
+        httptest.NewRequest(http.MethodPost, "/api/report/generate?preset=missing", nil),
+        httptest.NewRequest(http.MethodGet, "/api/report/presets/missing", nil),
+        httptest.NewRequest(http.MethodDelete, "/api/report/presets/missing", nil),
+    } {
+        w := serve(mux, r)
+        if w.Code != http.StatusNotFound {
+            t.Errorf("%s %s = %d, want 404", r.Method, r.URL, w.Code)
+            continue
+        }
+        if body := errorBody(t, w); body.Error != "preset_not_found" {
+            t.Errorf("%s %s: error = %q, want preset_not_found", r.Method, r.URL, body.Error)
+        }
+    }
+}
@@ -0,0 +1,121 @@
+// report_slots_test.go covers the REPORT_MAX_CONCURRENT generation limit.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReportSlotsSaturated(t *testing.T) {
+    h, _ := newTestHandler(t, HandlerConfig{MaxConcurrentReports: 2}, nil)
+
+    // Without a queue timeout a full pool rejects right away
+    if !h.acquireReportSlot() || !h.acquireReportSlot() {
+        t.Fatal("could not take both slots")
+    }
+    start := time.Now()
+    if h.acquireReportSlot() {
+        t.Fatal("took a third slot of 2")
+    }
+    if waited := time.Since(start); waited > 100*time.Millisecond {
+        t.Errorf("rejection took %v, want immediate", waited)
+    }
+
+    h.releaseReportSlot()
+    if !h.acquireReportSlot() {
+        t.Error("released slot could not be taken again")
+    }
+}
+
+func TestReportSlotsDefaultLimit(t *testing.T) {
+    h, _ := newTestHandler(t, HandlerConfig{}, nil)
+
+    if cap(h.reportSlots) != 4 {
+        t.Errorf("slots = %d, want the default 4", cap(h.reportSlots))
+    }
+}
+
+func TestReportSlotsQueueUntilReleased(t *testing.T) {
+    h, _ := newTestHandler(t, HandlerConfig{MaxConcurrentReports: 1, ReportQueueTimeout: 2 * time.Second}, nil)
+    h.acquireReportSlot()
+
+    // A queued request takes the slot as soon as it frees up
+    time.AfterFunc(50*time.Millisecond, h.releaseReportSlot)
+    start := time.Now()
+    if !h.acquireReportSlot() {
+        t.Fatal("queued request was rejected")
+    }
+    if waited := time.Since(start); waited < 50*time.Millisecond || waited > time.Second {
+        t.Errorf("waited %v, want until the release", waited)
+    }
+}
+
+func TestReportSlotsQueueTimeout(t *testing.T) {
+    h, _ := newTestHandler(t, HandlerConfig{MaxConcurrentReports: 1, ReportQueueTimeout: 50 * time.Millisecond}, nil)
+    h.acquireReportSlot()
+
+    start := time.Now()
+    if h.acquireReportSlot() {
+        t.Fatal("took a slot from a full pool")
+    }
+    if waited := time.Since(start); waited < 50*time.Millisecond {
+        t.Errorf("gave up after %v, want the queue timeout", waited)
+    }
+}
+
+func TestGenerateReportRejectedWhenSaturated(t *testing.T) {
+    done := make(chan struct{})
+    var generates atomic.Int32
+    base := reportUpstream(done, "%PDF-1.4 report")
+    upstream := func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/report/generate" {
+            generates.Add(1)
+        }
+        base(w, r)
+    }
+    _, mux := newTestHandler(t, HandlerConfig{MaxConcurrentReports: 1}, upstream)
+
+    // The first report holds the only slot until upstream finishes it
+    var first *httptest.ResponseRecorder
+    var wg sync.WaitGroup
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        r := httptest.NewRequest(http.MethodPost, "/api/report/generate",
+            strings.NewReader(`{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}`))
+        first = serve(mux, r)
+    }()
+    deadline := time.Now().Add(5 * time.Second)
+    for generates.Load() < 1 && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    // A different report can't share that generation, so it's turned away
+    r := httptest.NewRequest(http.MethodPost, "/api/report/generate",
+        strings.NewReader(`{"report_spec":{"report_type":"general_info","device_id_list":["dev1"],"user_report_name":"Weekly"}}`))
+    w := serve(mux, r)
+    if w.Code != http.StatusTooManyRequests {
+        t.Fatalf("status = %d, want 429: %s", w.Code, w.Body)
+    }
+    if got := w.Header().Get("Retry-After"); got != "30" {
+        t.Errorf("Retry-After = %q, want 30", got)
+    }
+    if body := errorBody(t, w); body.Error != "too_many_reports" {
+        t.Errorf("error = %q, want too_many_reports", body.Error)
+    }
+
+    close(done)
+    wg.Wait()
+    if first.Code != http.StatusOK {
+        t.Errorf("first report = %d, want 200: %s", first.Code, first.Body)
+    }
+    if got := generates.Load(); got != 1 {
+        t.Errorf("upstream generate calls = %d, want 1", got)
+    }
+}
@@ -0,0 +1,117 @@
+// report_smoke.go runs a report spec end to end over a tiny date window, so
+// ReportDialog.vue can confirm a spec works before starting a multi-day
+// report that takes minutes to generate.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// Smoke test limits, small enough that a failing spec is reported in seconds
+const (
+    smokeWindow      = 5 * time.Minute // Generated period, ending now
+    smokeMaxAttempts = 10              // Status checks before giving up, one per reportPollInterval
+)
+
+// reportSmokeResult is the /report/smoke response
+type reportSmokeResult struct {
+    OK           bool   `json:"ok"`
+    ReportID     string `json:"report_id,omitempty"`
+    Error        string `json:"error,omitempty"`
+    DateTimeFrom string `json:"datetime_from"`
+    DateTimeTo   string `json:"datetime_to"`
+    DurationMs   int64  `json:"duration_ms"`
+}
+
+// SmokeReportHandler handles POST /report/smoke.
+// Takes the same body as /report/generate (or ?preset=name) and generates it
+// upstream for the last five minutes only, with a short timeout. Nothing is
+// downloaded, the response only says whether generation succeeded.
+// Unknown devices get the same structured 404 as /report/generate.
+func (h *Handler) SmokeReportHandler(w http.ResponseWriter, r *http.Request) {
+    var incomingReq struct {
+        ReportSpec models.ReportSpec `json:"report_spec"`
+    }
+    if preset := r.URL.Query().Get("preset"); preset != "" {
+        spec, ok := h.loadPresetSpec(w, r, preset)
+        if !ok {
+            return
+        }
+        incomingReq.ReportSpec = spec
+    } else {
+        body, ok := readReportBody(w, r)
+        if !ok {
+            return
+        }
+        if err := json.Unmarshal(body, &incomingReq); err != nil {
+            respondError(w, invalidReportBody(err))
+            return
+        }
+    }
+    spec := incomingReq.ReportSpec
+
+    if err := h.expandAllDevices(r.Context(), &spec, resolveClientID(r)); err != nil {
+        respondError(w, err)
+        return
+    }
+    if err := spec.Validate(); err != nil {
+        respondError(w, invalidReportSpec(err))
+        return
+    }
+    if err := h.findDevices(r.Context(), spec.DeviceIDList); err != nil {
+        respondError(w, err)
+        return
+    }
+    fields, err := h.resolveOutputFields(spec.ReportOutputFieldList)
+    if err != nil {
+        respondError(w, invalidReportSpec(err))
+        return
+    }
+    if _, err := h.resolveReportFormats(spec); err != nil {
+        respondError(w, invalidReportSpec(err))
+        return
+    }
+
+    // The spec's own period is replaced, activity filters don't apply to it
+    to := time.Now().UTC().Truncate(time.Second)
+    spec.DateTimeFrom = to.Add(-smokeWindow).Format(time.RFC3339)
+    spec.DateTimeTo = to.Format(time.RFC3339)
+    apiReq := buildReportRequest(spec, fields)
+
+    // Smoke tests still count against MaxConcurrentReports
+    if !h.acquireReportSlot() {
+        respondError(w, errTooManyReports())
+        return
+    }
+    defer h.releaseReportSlot()
+
+    start := time.Now()
+    result, err := h.runReport(&apiReq, "smoke:"+newRequestID(), smokeMaxAttempts)
+    resp := reportSmokeResult{
+        OK:           err == nil,
+        DateTimeFrom: spec.DateTimeFrom,
+        DateTimeTo:   spec.DateTimeTo,
+        DurationMs:   time.Since(start).Milliseconds(),
+    }
+    status := http.StatusOK
+    if err != nil {
+        resp.Error = err.Error()
+        status = http.StatusInternalServerError
+        var appErr *AppError
+        if errors.As(err, &appErr) {
+            resp.Error, status = appErr.Message, appErr.Status
+        }
+    } else {
+        resp.ReportID = result.ReportID
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(resp)
+}
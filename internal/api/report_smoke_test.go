@@ -0,0 +1,107 @@
+// report_smoke_test.go covers POST /api/report/smoke.
+
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// smokeBody is a week-long spec for dev1
+const smokeBody = `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"],
+    "datetime_from":"2024-05-01T00:00:00Z","datetime_to":"2024-05-08T00:00:00Z"}}`
+
+// decodeSmoke decodes a smoke test response
+func decodeSmoke(t *testing.T, w *httptest.ResponseRecorder) reportSmokeResult {
+    t.Helper()
+    var resp reportSmokeResult
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    return resp
+}
+
+func TestSmokeReportPasses(t *testing.T) {
+    done := make(chan struct{})
+    close(done)
+    var mu sync.Mutex
+    var generated models.ReportRequest
+    ready := reportUpstream(done, "%PDF-1.4 report")
+    _, mux := newTestHandler(t, HandlerConfig{}, func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/report/generate" {
+            body, _ := io.ReadAll(r.Body)
+            mu.Lock()
+            json.Unmarshal(body, &generated)
+            mu.Unlock()
+        }
+        ready(w, r)
+    })
+
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/smoke", strings.NewReader(smokeBody)))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    resp := decodeSmoke(t, w)
+    if !resp.OK || resp.ReportID != "rep-1" || resp.Error != "" {
+        t.Errorf("response = %+v, want ok for rep-1", resp)
+    }
+
+    // The week is replaced by the last five minutes
+    from, errFrom := time.Parse(time.RFC3339, resp.DateTimeFrom)
+    to, errTo := time.Parse(time.RFC3339, resp.DateTimeTo)
+    if errFrom != nil || errTo != nil || to.Sub(from) != smokeWindow || time.Since(to) > time.Minute {
+        t.Errorf("window = %s to %s, want the last five minutes", resp.DateTimeFrom, resp.DateTimeTo)
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    if generated.DateTimeFrom != resp.DateTimeFrom || generated.DateTimeTo != resp.DateTimeTo {
+        t.Errorf("upstream generated %s to %s, want the smoke window", generated.DateTimeFrom, generated.DateTimeTo)
+    }
+}
+
+func TestSmokeReportUnknownDevice(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(oneDevice))
+
+    body := strings.Replace(smokeBody, `["dev1"]`, `["dev1","ghost"]`, 1)
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/smoke", strings.NewReader(body)))
+    if w.Code != http.StatusNotFound {
+        t.Fatalf("status = %d, want 404: %s", w.Code, w.Body)
+    }
+    var resp deviceNotFoundResponse
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+        t.Fatal(err)
+    }
+    if resp.Error != "device_not_found" || len(resp.DeviceIDs) != 1 || resp.DeviceIDs[0] != "ghost" {
+        t.Errorf("body = %+v, want ghost not found", resp)
+    }
+}
+
+func TestSmokeReportUpstreamFailure(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        switch {
+        case strings.HasPrefix(r.URL.Path, "/device"):
+            w.Write([]byte(oneDevice))
+        case r.URL.Path == "/report/generate":
+            w.Write([]byte(`{"report_generated_id":"rep-1","status":"pending"}`))
+        default:
+            w.Write([]byte(`{"status":"error","error":{"message":"device has no data source"}}`))
+        }
+    })
+
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/smoke", strings.NewReader(smokeBody)))
+    if w.Code == http.StatusOK {
+        t.Fatalf("status = 200, want a failure: %s", w.Body)
+    }
+    if resp := decodeSmoke(t, w); resp.OK || !strings.Contains(resp.Error, "no data source") {
+        t.Errorf("response = %+v, want the upstream failure", resp)
+    }
+}
@@ -0,0 +1,136 @@
+// report_tracker.go keeps in-flight and recently completed reports in memory
+// so a client that disconnects mid-generation can reconnect and fetch the result.
+
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// reportRetention is how long a finished report stays retrievable
+const reportRetention = 10 * time.Minute
+
+// trackedReport is a single report generation followed by the tracker
+type trackedReport struct {
+    key      string        // Deduplication key, shared with identical concurrent generations
+    done     chan struct{} // Closed once result or err is set
+    result   *reportResult
+    err      error
+    finished time.Time
+}
+
+// finish records the outcome and wakes up anyone waiting on the report
+func (t *trackedReport) finish(result *reportResult, err error) {
+    t.result = result
+    t.err = err
+    t.finished = time.Now()
+    close(t.done)
+}
+
+// isDone reports whether the generation has finished, without blocking
+func (t *trackedReport) isDone() bool {
+    select {
+    case <-t.done:
+        return true
+    default:
+        return false
+    }
+}
+
+// reportTracker maps tracking ids (client request ids and upstream report ids)
+// to their generations. Ids are scoped to the client that started the
+// generation, X-Request-ID is client-supplied and must not let one client
+// read or overwrite another's report. Finished entries expire after reportRetention.
+// Upstream progress is kept per deduplication key, since one upstream
+// generation can serve several tracked reports.
+type reportTracker struct {
+    mu       sync.Mutex
+    reports  map[string]*trackedReport
+    progress map[string]*models.ReportProgress
+}
+
+// newReportTracker creates an empty tracker
+func newReportTracker() *reportTracker {
+    return &reportTracker{
+        reports:  make(map[string]*trackedReport),
+        progress: make(map[string]*models.ReportProgress),
+    }
+}
+
+// trackingKey scopes a tracking id to a client
+func trackingKey(clientID, id string) string {
+    return clientID + "\x00" + id
+}
+
+// start registers a new generation of clientID under the given tracking id,
+// key is its deduplication key (see reportKey)
+func (rt *reportTracker) start(clientID, id, key string) *trackedReport {
+    rt.mu.Lock()
+    defer rt.mu.Unlock()
+    rt.pruneLocked()
+
+    t := &trackedReport{key: key, done: make(chan struct{})}
+    rt.reports[trackingKey(clientID, id)] = t
+    return t
+}
+
+// alias makes a tracked report also retrievable by clientID under another
+// id, e.g. the upstream report id once it is known
+func (rt *reportTracker) alias(clientID, id string, t *trackedReport) {
+    rt.mu.Lock()
+    defer rt.mu.Unlock()
+    rt.reports[trackingKey(clientID, id)] = t
+}
+
+// get looks up a report of clientID by any of its tracking ids
+func (rt *reportTracker) get(clientID, id string) (*trackedReport, bool) {
+    rt.mu.Lock()
+    defer rt.mu.Unlock()
+    rt.pruneLocked()
+
+    t, ok := rt.reports[trackingKey(clientID, id)]
+    return t, ok
+}
+
+// setProgress records the latest upstream progress for a generation,
+// nil clears it once the generation ends
+func (rt *reportTracker) setProgress(key string, progress *models.ReportProgress) {
+    rt.mu.Lock()
+    defer rt.mu.Unlock()
+    if progress == nil {
+        delete(rt.progress, key)
+        return
+    }
+    rt.progress[key] = progress
+}
+
+// progressOf returns the latest upstream progress of t, nil if none was reported
+func (rt *reportTracker) progressOf(t *trackedReport) *models.ReportProgress {
+    rt.mu.Lock()
+    defer rt.mu.Unlock()
+    return rt.progress[t.key]
+}
+
+// pruneLocked drops finished reports older than reportRetention, caller holds mu
+func (rt *reportTracker) pruneLocked() {
+    cutoff := time.Now().Add(-reportRetention)
+    for id, t := range rt.reports {
+        if t.isDone() && t.finished.Before(cutoff) {
+            delete(rt.reports, id)
+        }
+    }
+}
+
+// newRequestID generates a random id for requests that don't supply X-Request-ID
+func newRequestID() string {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return time.Now().Format("20060102150405.000000000")
+    }
+    return hex.EncodeToString(b)
+}
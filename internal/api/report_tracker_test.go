@@ -0,0 +1,54 @@
+// report_tracker_test.go covers client scoping of tracked reports.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReportTrackerScopedByClient(t *testing.T) {
+    rt := newReportTracker()
+    a := rt.start("client-a", "req-1", "key")
+    rt.alias("client-a", "report-9", a)
+
+    if got, ok := rt.get("client-a", "req-1"); !ok || got != a {
+        t.Fatal("client-a can't find its own report by request id")
+    }
+    if got, ok := rt.get("client-a", "report-9"); !ok || got != a {
+        t.Fatal("client-a can't find its own report by report id")
+    }
+    if _, ok := rt.get("client-b", "req-1"); ok {
+        t.Error("client-b found client-a's report by request id")
+    }
+    if _, ok := rt.get("client-b", "report-9"); ok {
+        t.Error("client-b found client-a's report by report id")
+    }
+
+    // Reusing the id from another client doesn't replace the original
+    b := rt.start("client-b", "req-1", "key")
+    if got, _ := rt.get("client-a", "req-1"); got != a {
+        t.Error("client-b's generation replaced client-a's")
+    }
+    if got, _ := rt.get("client-b", "req-1"); got != b {
+        t.Error("client-b can't find its own report")
+    }
+}
+
+func TestReportStatusOtherClient(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{}, nil)
+    h.reports.start("client-a", "req-1", "key")
+
+    status := func(clientID string) int {
+        r := httptest.NewRequest(http.MethodGet, "/api/report/status/req-1", nil)
+        r.Header.Set("X-Client-ID", clientID)
+        return serve(mux, r).Code
+    }
+    if code := status("client-a"); code != http.StatusAccepted {
+        t.Errorf("owner status = %d, want 202", code)
+    }
+    if code := status("client-b"); code != http.StatusNotFound {
+        t.Errorf("other client status = %d, want 404", code)
+    }
+}
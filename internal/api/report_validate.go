@@ -0,0 +1,114 @@
+// report_validate.go provides a dry run of report generation checks so
+// ReportDialog.vue can flag problems before starting a (slow) generation.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// reportProblem is one reason a spec would be rejected
+type reportProblem struct {
+    Field   string   `json:"field"`
+    Message string   `json:"message"`
+    Values  []string `json:"values,omitempty"` // Offending entries, e.g. unknown device ids
+}
+
+// reportValidation is the /report/validate response
+type reportValidation struct {
+    Valid    bool            `json:"valid"`
+    Problems []reportProblem `json:"problems"`
+}
+
+// ValidateReportHandler handles POST /report/validate.
+// Takes the same body as /report/generate and returns every problem found
+// (unknown devices, unsupported fields or file type, bad date range)
+// without generating anything. Responds 200 whether or not the spec is valid.
+func (h *Handler) ValidateReportHandler(w http.ResponseWriter, r *http.Request) {
+    var incomingReq struct {
+        ReportSpec models.ReportSpec `json:"report_spec"`
+    }
+    body, ok := readReportBody(w, r)
+    if !ok {
+        return
+    }
+    if err := json.Unmarshal(body, &incomingReq); err != nil {
+        respondError(w, invalidReportBody(err))
+        return
+    }
+
+    problems, err := h.validateReportSpec(r.Context(), incomingReq.ReportSpec, resolveClientID(r))
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(reportValidation{
+        Valid:    len(problems) == 0,
+        Problems: problems,
+    })
+}
+
+// validateReportSpec collects every problem with spec instead of stopping at
+// the first. all_devices specs are checked as expanded for clientID.
+// err is only set when the devices or preferences couldn't be fetched.
+func (h *Handler) validateReportSpec(ctx context.Context, spec models.ReportSpec, clientID string) ([]reportProblem, error) {
+    problems := make([]reportProblem, 0)
+
+    if err := h.expandAllDevices(ctx, &spec, clientID); err != nil {
+        var appErr *AppError
+        if !errors.As(err, &appErr) || appErr.Status != http.StatusBadRequest {
+            return nil, err
+        }
+        problems = append(problems, reportProblem{Field: "all_devices", Message: appErr.Message})
+    } else if len(spec.DeviceIDList) == 0 {
+        problems = append(problems, reportProblem{Field: "device_id_list", Message: "at least one device is required"})
+    } else if err := spec.Validate(); err != nil {
+        problems = append(problems, reportProblem{Field: "device_id_list", Message: err.Error()})
+    } else if err := h.findDevices(ctx, spec.DeviceIDList); err != nil {
+        notFound, ok := err.(*DeviceNotFoundError)
+        if !ok {
+            return nil, err
+        }
+        problems = append(problems, reportProblem{Field: "device_id_list", Message: "devices not found in this account", Values: notFound.DeviceIDs})
+    }
+
+    if _, err := h.resolveOutputFields(spec.ReportOutputFieldList); err != nil {
+        problems = append(problems, reportProblem{Field: "report_output_field_list", Message: err.Error()})
+    }
+
+    if _, err := h.resolveReportFormats(spec); err != nil {
+        field := "file_type"
+        if len(spec.Formats) > 0 {
+            field = "formats"
+        }
+        problems = append(problems, reportProblem{Field: field, Message: err.Error()})
+    }
+
+    problems = append(problems, validateReportRange(spec.DateTimeFrom, spec.DateTimeTo)...)
+    return problems, nil
+}
+
+// validateReportRange checks both ends parse as RFC 3339 and from is before to
+func validateReportRange(fromStr, toStr string) []reportProblem {
+    var problems []reportProblem
+    from, fromErr := time.Parse(time.RFC3339, fromStr)
+    if fromErr != nil {
+        problems = append(problems, reportProblem{Field: "datetime_from", Message: "must be an RFC 3339 time"})
+    }
+    to, toErr := time.Parse(time.RFC3339, toStr)
+    if toErr != nil {
+        problems = append(problems, reportProblem{Field: "datetime_to", Message: "must be an RFC 3339 time"})
+    }
+    if fromErr == nil && toErr == nil && !from.Before(to) {
+        problems = append(problems, reportProblem{Field: "datetime_to", Message: "must be after datetime_from"})
+    }
+    return problems
+}
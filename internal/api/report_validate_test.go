@@ -0,0 +1,107 @@
+// report_validate_test.go covers the POST /api/report/validate dry run.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// validateReport POSTs spec to /api/report/validate and decodes the result,
+// failing if anything was generated upstream
+func validateReport(t *testing.T, spec string) reportValidation {
+    t.Helper()
+    var generates atomic.Int32
+    _, mux := newTestHandler(t, HandlerConfig{}, func(w http.ResponseWriter, r *http.Request) {
+        if strings.HasPrefix(r.URL.Path, "/report") {
+            generates.Add(1)
+        }
+        devicesReply(`{"result_list":[{"device_id":"dev1"},{"device_id":"dev2"}]}`)(w, r)
+    })
+
+    w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/validate", strings.NewReader(`{"report_spec":`+spec+`}`)))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    if n := generates.Load(); n != 0 {
+        t.Errorf("upstream report calls = %d, want 0 for a dry run", n)
+    }
+    var result reportValidation
+    if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    return result
+}
+
+func TestValidateReportAllValid(t *testing.T) {
+    result := validateReport(t, `{
+        "report_type": "general_info",
+        "device_id_list": ["dev1", "dev2", "dev1"],
+        "datetime_from": "2024-05-01T00:00:00Z",
+        "datetime_to": "2024-05-02T00:00:00Z"
+    }`)
+
+    if !result.Valid || result.Problems == nil || len(result.Problems) != 0 {
+        t.Errorf("result = %+v, want valid with an empty problem list", result)
+    }
+}
+
+func TestValidateReportUnknownDevices(t *testing.T) {
+    result := validateReport(t, `{
+        "report_type": "general_info",
+        "device_id_list": ["dev1", "ghost-1", "ghost-2"],
+        "datetime_from": "2024-05-01T00:00:00Z",
+        "datetime_to": "2024-05-02T00:00:00Z"
+    }`)
+
+    want := []reportProblem{{Field: "device_id_list", Message: "devices not found in this account", Values: []string{"ghost-1", "ghost-2"}}}
+    if result.Valid || !reflect.DeepEqual(result.Problems, want) {
+        t.Errorf("result = %+v, want %+v", result, want)
+    }
+}
+
+func TestValidateReportCollectsEveryProblem(t *testing.T) {
+    result := validateReport(t, `{
+        "report_type": "general_info",
+        "device_id_list": ["dev1", ""],
+        "report_output_field_list": ["display_name", "fuel_used"],
+        "file_type": "xlsx",
+        "datetime_from": "2024-05-02T00:00:00Z",
+        "datetime_to": "2024-05-01T00:00:00Z"
+    }`)
+
+    var fields []string
+    for _, p := range result.Problems {
+        fields = append(fields, p.Field)
+    }
+    want := []string{"device_id_list", "report_output_field_list", "file_type", "datetime_to"}
+    if result.Valid || !reflect.DeepEqual(fields, want) {
+        t.Errorf("problem fields = %v, want %v (%+v)", fields, want, result.Problems)
+    }
+}
+
+func TestValidateReportRange(t *testing.T) {
+    tests := []struct {
+        from, to string
+        want     []string
+    }{
+        {"2024-05-01T00:00:00Z", "2024-05-02T00:00:00Z", nil},
+        {"2024-05-01T00:00:00Z", "2024-05-01T00:00:00Z", []string{"datetime_to"}},
+        {"yesterday", "2024-05-02T00:00:00Z", []string{"datetime_from"}},
+        {"", "", []string{"datetime_from", "datetime_to"}},
+    }
+    for _, tt := range tests {
+        var got []string
+        for _, p := range validateReportRange(tt.from, tt.to) {
+            got = append(got, p.Field)
+        }
+        if !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("validateReportRange(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+        }
+    }
+}
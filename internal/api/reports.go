@@ -0,0 +1,510 @@
+// reports.go runs the OneStepGPS report generation pipeline
+// (generate, poll for completion, then stream the export) used by GenerateReportHandler.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/notify"
+)
+
+const (
+    reportMaxAttempts  = 60              // Will try for 60 seconds before giving up (1 attempt per second)
+    reportPollInterval = 1 * time.Second // Wait between status checks
+    reportExportDelay  = 2 * time.Second // Small delay to ensure PDF is fully generated
+    maxReportBodyBytes = 1 << 20         // 1 MB, a spec with thousands of device ids fits easily
+)
+
+// readReportBody reads a /report/generate or /report/validate body.
+// Also used for saving report presets.
+// On failure it has already written a 400 (empty or unreadable) or 413 (too large).
+func readReportBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+    body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxReportBodyBytes))
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            respondError(w, newAppError(http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("Request body too large, limit is %d bytes", tooLarge.Limit), err))
+            return nil, false
+        }
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_body", "Error reading request body", err))
+        return nil, false
+    }
+    if len(bytes.TrimSpace(body)) == 0 {
+        respondError(w, newAppError(http.StatusBadRequest, "body_required", "Request body required", nil))
+        return nil, false
+    }
+    return body, true
+}
+
+// reportResult is a completed report ready to export to the client.
+// The PDF itself isn't kept, it is streamed from upstream when sent.
+type reportResult struct {
+    ReportID  string
+    FileTypes []string // Export formats requested by the caller, zipped when more than one
+    Devices   int      // Devices in the generated report, for logging
+}
+
+// defaultReportOutputFields is the general_info field list used when the
+// deployment doesn't configure REPORT_OUTPUT_FIELDS
+var defaultReportOutputFields = []string{
+    "device_id",
+    "device_name",
+    "groups",
+    "route_length",
+    "move_duration",
+    "stop_duration",
+    "stop_count",
+    "speed_top",
+    "speed_avg",
+    "speed_count",
+    "engine_work",
+    "engine_idle",
+    "engine_time",
+}
+
+// resolveOutputFields validates requested fields against the configured allowlist.
+// An empty request uses every allowed field.
+func (h *Handler) resolveOutputFields(requested []string) ([]string, error) {
+    if len(requested) == 0 {
+        return h.config.ReportOutputFields, nil
+    }
+
+    allowed := make(map[string]bool, len(h.config.ReportOutputFields))
+    for _, field := range h.config.ReportOutputFields {
+        allowed[field] = true
+    }
+
+    var unsupported []string
+    for _, field := range requested {
+        if !allowed[field] {
+            unsupported = append(unsupported, field)
+        }
+    }
+    if len(unsupported) > 0 {
+        return nil, fmt.Errorf("unsupported report output fields: %s", strings.Join(unsupported, ", "))
+    }
+    return requested, nil
+}
+
+// buildReportRequest converts the frontend spec into the OneStepGPS request
+// Some of this is probably redundant or could be cleaned up with defaults
+func buildReportRequest(spec models.ReportSpec, outputFields []string) models.ReportRequest {
+    return models.ReportRequest{
+        DateTimeFrom:          spec.DateTimeFrom,
+        DateTimeTo:            spec.DateTimeTo,
+        DeviceIDList:          spec.DeviceIDList,
+        ReportType:            "general_info",
+        UserReportName:        spec.UserReportName,
+        ReportOutputFieldList: outputFields,
+        ReportOptions: map[string]interface{}{
+            "display_decimal_places": 1,
+            "duration_format": "standard",
+            "min_stop_duration": map[string]interface{}{
+                "value": 5,
+                "unit": "m",
+                "display": "5m",
+            },
+            "use_pdf_landscape": true,
+        },
+        ReportOptionsGeneralInfo: map[string]interface{}{
+            "minimum_speeding_threshold": map[string]interface{}{
+                "value": 50,
+                "unit": "mph",
+                "display": "50 mph",
+            },
+            "use_nonmerged_layout": false,
+        },
+    }
+}
+
+// reportKey normalizes a request into a deduplication key.
+// Device order doesn't change the report, so the list is sorted first.
+func reportKey(apiReq *models.ReportRequest) (string, error) {
+    normalized := *apiReq
+    normalized.DeviceIDList = append([]string(nil), apiReq.DeviceIDList...)
+    sort.Strings(normalized.DeviceIDList)
+
+    key, err := json.Marshal(normalized) // Map keys marshal in sorted order
+    if err != nil {
+        return "", err
+    }
+    return string(key), nil
+}
+
+// generateReportDeduped runs generateReport, sharing one upstream generation
+// between concurrent identical requests (same key, see reportKey). shared
+// reports whether the result was produced for another caller.
+func (h *Handler) generateReportDeduped(apiReq *models.ReportRequest, key string) (*reportResult, bool, error) {
+    v, err, shared := h.reportGroup.Do(key, func() (interface{}, error) {
+        // Shared requests only take one slot since they run one generation
+        if !h.acquireReportSlot() {
+            return nil, errTooManyReports()
+        }
+        defer h.releaseReportSlot()
+        return h.generateReport(apiReq, key)
+    })
+    if err != nil {
+        return nil, shared, err
+    }
+    return v.(*reportResult), shared, nil
+}
+
+// acquireReportSlot takes one of the MaxConcurrentReports slots, waiting up to
+// ReportQueueTimeout for one to free up. Returns false if none became available.
+func (h *Handler) acquireReportSlot() bool {
+    select {
+    case h.reportSlots <- struct{}{}:
+        return true
+    default:
+    }
+    if h.config.ReportQueueTimeout <= 0 {
+        return false
+    }
+
+    timer := time.NewTimer(h.config.ReportQueueTimeout)
+    defer timer.Stop()
+    select {
+    case h.reportSlots <- struct{}{}:
+        return true
+    case <-timer.C:
+        return false
+    }
+}
+
+// errTooManyReports is returned when no report slot frees up in time
+func errTooManyReports() *AppError {
+    err := newAppError(http.StatusTooManyRequests, "too_many_reports", "Too many reports are being generated, please try again shortly", nil)
+    err.RetryAfter = 30 * time.Second
+    return err
+}
+
+// invalidReportBody is a 400 for a body that isn't valid JSON
+func invalidReportBody(err error) *AppError {
+    return newAppError(http.StatusBadRequest, "invalid_body", fmt.Sprintf("Invalid request body: %v", err), err)
+}
+
+// invalidReportSpec wraps a spec validation failure as a 400
+func invalidReportSpec(err error) *AppError {
+    return newAppError(http.StatusBadRequest, "invalid_report_spec", err.Error(), err)
+}
+
+// releaseReportSlot frees a slot taken by acquireReportSlot
+func (h *Handler) releaseReportSlot() {
+    <-h.reportSlots
+}
+
+// generateReport initiates a report and polls until it is ready to export.
+// Upstream progress is recorded under key while polling, for /report/status.
+// Total time, failures included, goes to fleet_report_generation_seconds.
+func (h *Handler) generateReport(apiReq *models.ReportRequest, key string) (result *reportResult, err error) {
+    start := time.Now()
+    defer func() {
+        h.reportDurations.observe(time.Since(start))
+        reportID := ""
+        if result != nil {
+            reportID = result.ReportID
+        }
+        logReportPhase("total", reportID, len(apiReq.DeviceIDList), start, err)
+    }()
+
+    result, err = h.runReport(apiReq, key, reportMaxAttempts)
+    if err != nil {
+        return nil, err
+    }
+    time.Sleep(reportExportDelay)
+    return result, nil
+}
+
+// runReport initiates a report and polls its status up to maxAttempts times,
+// returning as soon as upstream reports it done
+func (h *Handler) runReport(apiReq *models.ReportRequest, key string, maxAttempts int) (*reportResult, error) {
+    defer h.reports.setProgress(key, nil)
+    devices := len(apiReq.DeviceIDList)
+
+    // Initialize report generation with OneStepGPS API
+    start := time.Now()
+    generateResponse, err := h.GPSClient.GenerateReport(apiReq)
+    if err != nil {
+        logReportPhase("generate", "", devices, start, err)
+        return nil, newAppError(upstreamErrorStatus(err), "report_generation_failed", fmt.Sprintf("Error generating report: %v", err), err)
+    }
+    reportID := generateResponse.ReportGeneratedID
+    logReportPhase("generate", reportID, devices, start, nil)
+
+    // Reports are generated asynchronously, so we need to poll for completion
+    start = time.Now()
+    result, err := h.pollReport(reportID, key, maxAttempts)
+    if result != nil {
+        result.Devices = devices
+    }
+    logReportPhase("poll", reportID, devices, start, err)
+    return result, err
+}
+
+// pollReport checks a generated report's status up to maxAttempts times,
+// recording upstream progress under key
+func (h *Handler) pollReport(reportID, key string, maxAttempts int) (*reportResult, error) {
+    for attempt := 0; attempt < maxAttempts; attempt++ {
+        fmt.Printf("Checking status attempt %d/%d\n", attempt+1, maxAttempts)
+
+        // Check status, upstream errors are returned as *models.APIError
+        statusResponse, err := h.GPSClient.GetReportStatus(reportID)
+        if err != nil {
+            var apiErr *models.APIError
+            if errors.As(err, &apiErr) {
+                return nil, newAppError(http.StatusInternalServerError, "report_failed", fmt.Sprintf("Report failed: %s", apiErr.Message), err)
+            }
+            return nil, newAppError(upstreamErrorStatus(err), "report_status_failed", "Error checking status", err)
+        }
+
+        fmt.Printf("Report status: %s\n", statusResponse.Status)
+        if progress := statusResponse.ParsedProgress(); progress != nil {
+            h.reports.setProgress(key, progress)
+        }
+
+        // If report is complete it can be exported
+        if statusResponse.Status == "done" {
+            return &reportResult{ReportID: reportID}, nil
+        }
+
+        time.Sleep(reportPollInterval) // Wait before next polling attempt
+    }
+
+    // Timeout if report takes too long
+    return nil, newAppError(http.StatusGatewayTimeout, "report_timeout", "Report generation timed out", nil)
+}
+
+// reportNotifyTimeout bounds how long a completion notification may take
+const reportNotifyTimeout = 30 * time.Second
+
+// notifyReport tells the configured Notifier a generation finished.
+// The link points at /report/status/{requestID}, which serves the report
+// for reportRetention after completion.
+func (h *Handler) notifyReport(requestID, reportName string, result *reportResult, err error) {
+    n := notify.ReportNotification{
+        RequestID:   requestID,
+        ReportName:  reportName,
+        Status:      "done",
+        Link:        h.config.PublicBaseURL + "/api/report/status/" + requestID,
+        CompletedAt: time.Now(),
+    }
+    if err != nil {
+        n.Status = "failed"
+        n.Error = err.Error()
+    } else {
+        n.ReportID = result.ReportID
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), reportNotifyTimeout)
+    defer cancel()
+    if err := h.config.Notifier.NotifyReport(ctx, n); err != nil {
+        fmt.Printf("Error sending report notification for %s: %v\n", requestID, err)
+    }
+}
+
+// expandAllDevices fills the device list of an all_devices spec with every
+// device in the account. Devices the client hid in VehiclePreferences.vue
+// (usually decommissioned ones) are left out unless include_hidden is set.
+// Specs listing their own devices are left unchanged, hidden or not.
+func (h *Handler) expandAllDevices(ctx context.Context, spec *models.ReportSpec, clientID string) error {
+    if !spec.AllDevices {
+        return nil
+    }
+    if len(spec.DeviceIDList) > 0 {
+        return newAppError(http.StatusBadRequest, "invalid_report_spec", "all_devices and device_id_list can't be used together", nil)
+    }
+
+    vehicles, err := h.devicesFor(ctx)
+    if err != nil {
+        return newAppError(upstreamErrorStatus(err), "devices_unavailable", fmt.Sprintf("Error fetching devices: %v", err), err)
+    }
+
+    // Devices without a preference follow UNPREFERENCED_VISIBILITY
+    var prefs map[string]*models.UserPreference
+    if !spec.IncludeHidden {
+        list, err := h.preferencesFor(ctx, clientID)
+        if err != nil {
+            return newAppError(http.StatusInternalServerError, "preferences_unavailable", "Error fetching preferences", err)
+        }
+        prefs = make(map[string]*models.UserPreference, len(list))
+        for i := range list {
+            prefs[list[i].DeviceID] = &list[i]
+        }
+    }
+
+    deviceIDs := make([]string, 0, len(vehicles))
+    for _, v := range vehicles {
+        if spec.IncludeHidden || !h.config.PreferenceDefaults.IsHidden(prefs[v.DeviceID]) {
+            deviceIDs = append(deviceIDs, v.DeviceID)
+        }
+    }
+    if len(deviceIDs) == 0 {
+        return newAppError(http.StatusBadRequest, "no_visible_devices", "no visible devices to report on, set include_hidden to include hidden ones", nil)
+    }
+    spec.DeviceIDList = deviceIDs
+    return nil
+}
+
+// activityPeriodMaxAge is how long before now a period may end and still be
+// judged from the device snapshot, whose drive state describes current
+// activity. Older periods are judged from point history instead.
+const activityPeriodMaxAge = time.Hour
+
+// activityMaxPointGap is the longest gap between two history points that
+// still counts as engine time. Trackers report every minute or so while
+// running, a longer silence is taken as the engine being off.
+const activityMaxPointGap = 15 * time.Minute
+
+// filterActiveDevices applies only_active / min_engine_time to the spec's
+// device list. Periods ending within activityPeriodMaxAge use the latest
+// device snapshot:
+//   - a device is active if it reported a position in the period, or its
+//     current drive state (driving/idle) overlaps the period
+//   - engine time is the overlap of the current engine-on drive state with
+//     the period
+// Older periods, e.g. last month's utilization report, use each device's
+// point history, see historyActivity.
+// Bad filters get a 400 *AppError, failed upstream lookups are returned as is.
+// Returns the list unchanged when neither filter is set.
+func (h *Handler) filterActiveDevices(ctx context.Context, spec models.ReportSpec) ([]string, error) {
+    if spec.MinEngineTime < 0 {
+        return nil, invalidReportSpec(fmt.Errorf("min_engine_time must not be negative"))
+    }
+    if !spec.OnlyActive && spec.MinEngineTime == 0 {
+        return spec.DeviceIDList, nil
+    }
+
+    from, err := time.Parse(time.RFC3339, spec.DateTimeFrom)
+    if err != nil {
+        return nil, invalidReportSpec(fmt.Errorf("invalid datetime_from %q: activity filters need an RFC 3339 time", spec.DateTimeFrom))
+    }
+    to, err := time.Parse(time.RFC3339, spec.DateTimeTo)
+    if err != nil {
+        return nil, invalidReportSpec(fmt.Errorf("invalid datetime_to %q: activity filters need an RFC 3339 time", spec.DateTimeTo))
+    }
+
+    minEngine := time.Duration(spec.MinEngineTime) * time.Minute
+    active := make([]string, 0, len(spec.DeviceIDList))
+    if time.Since(to) > activityPeriodMaxAge {
+        for _, id := range spec.DeviceIDList {
+            reported, engine, err := h.historyActivity(id, from, to)
+            if err != nil {
+                return nil, fmt.Errorf("error fetching history for %s: %w", id, err)
+            }
+            if (minEngine > 0 && engine >= minEngine) || (minEngine == 0 && (reported || engine > 0)) {
+                active = append(active, id)
+            }
+        }
+    } else {
+        vehicles, err := h.devicesFor(ctx)
+        if err != nil {
+            return nil, fmt.Errorf("error fetching activity data: %w", err)
+        }
+        byID := make(map[string]*models.Vehicle, len(vehicles))
+        for i := range vehicles {
+            byID[vehicles[i].DeviceID] = &vehicles[i]
+        }
+        for _, id := range spec.DeviceIDList {
+            v, ok := byID[id]
+            if !ok {
+                continue
+            }
+            if minEngine > 0 {
+                if engineTimeInPeriod(v, from, to) >= minEngine {
+                    active = append(active, id)
+                }
+                continue
+            }
+            if wasActiveInPeriod(v, from, to) {
+                active = append(active, id)
+            }
+        }
+    }
+
+    if len(active) == 0 {
+        return nil, invalidReportSpec(fmt.Errorf("no vehicles had activity between %s and %s", spec.DateTimeFrom, spec.DateTimeTo))
+    }
+    return active, nil
+}
+
+// historyActivity reads a device's points in [from, to], in maxTrackRange
+// windows so long periods aren't cut off by the per-request point cap.
+// reported is whether any point fell in the period. Engine time adds up the
+// time from each engine-on point to the next one, skipping gaps longer than
+// activityMaxPointGap. Points without vbus_engine_on count as on while moving.
+func (h *Handler) historyActivity(deviceID string, from, to time.Time) (reported bool, engine time.Duration, err error) {
+    var last *models.Location
+    for start := from; start.Before(to); start = start.Add(maxTrackRange) {
+        end := start.Add(maxTrackRange)
+        if end.After(to) {
+            end = to
+        }
+        points, err := h.GPSClient.GetDeviceHistory(deviceID, start, end)
+        if err != nil {
+            return false, 0, err
+        }
+        for i := range points {
+            p := &points[i]
+            if p.Timestamp.Before(from) || p.Timestamp.After(to) {
+                continue
+            }
+            reported = true
+            if last != nil && pointEngineOn(last) {
+                if gap := p.Timestamp.Sub(last.Timestamp); gap > 0 && gap <= activityMaxPointGap {
+                    engine += gap
+                }
+            }
+            last = p
+        }
+    }
+    return reported, engine, nil
+}
+
+// pointEngineOn reports whether the engine was running at a history point
+func pointEngineOn(p *models.Location) bool {
+    if p.Detail.EngineOn != nil {
+        return *p.Detail.EngineOn
+    }
+    return p.Speed > 0
+}
+
+// wasActiveInPeriod reports whether the vehicle moved or reported in [from, to]
+func wasActiveInPeriod(v *models.Vehicle, from, to time.Time) bool {
+    if lastSeen := vehicleLastSeen(v); !lastSeen.Before(from) && !lastSeen.After(to) {
+        return true
+    }
+    return engineTimeInPeriod(v, from, to) > 0
+}
+
+// engineTimeInPeriod returns how much of the current engine-on drive state
+// (driving or idle) falls inside [from, to], zero when the engine is off
+func engineTimeInPeriod(v *models.Vehicle, from, to time.Time) time.Duration {
+    switch v.DriveState.Status {
+    case "driving", "idle":
+    default:
+        return 0
+    }
+
+    start, end := v.DriveState.BeginTime, time.Now()
+    if start.Before(from) {
+        start = from
+    }
+    if end.After(to) {
+        end = to
+    }
+    if !end.After(start) {
+        return 0
+    }
+    return end.Sub(start)
+}
@@ -0,0 +1,309 @@
+// reports_test.go covers /report/generate responses.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// oneDevice is an upstream device list with device dev1
+const oneDevice = `{"result_list":[{"device_id":"dev1","display_name":"Truck 1"}]}`
+
+func TestGenerateReportTimeout(t *testing.T) {
+    release := make(chan struct{})
+    upstream := func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        if strings.HasPrefix(r.URL.Path, "/device") {
+            w.Write([]byte(oneDevice))
+            return
+        }
+        <-release // Generation outlasts the request timeout
+        w.WriteHeader(http.StatusServiceUnavailable)
+        w.Write([]byte(`{"message":"unavailable"}`))
+    }
+    _, mux := newTestHandler(t, HandlerConfig{
+        RouteTimeouts: map[string]time.Duration{"/api/report/generate": 50 * time.Millisecond},
+    }, upstream)
+    t.Cleanup(func() { close(release) }) // Runs before the upstream server closes
+
+    body := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}`
+    r := httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body))
+    r.Header.Set("X-Request-ID", "req-1")
+    w := serve(mux, r)
+
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202 (body %s)", w.Code, w.Body)
+    }
+    if got := w.Header().Get("X-Request-ID"); got != "req-1" {
+        t.Errorf("X-Request-ID = %q, want req-1", got)
+    }
+    if got := w.Header().Get("Location"); got != "/api/report/status/req-1" {
+        t.Errorf("Location = %q, want /api/report/status/req-1", got)
+    }
+    var resp reportStatusResponse
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+        t.Fatal(err)
+    }
+    if resp.Status != "processing" || resp.StatusURL != "/api/report/status/req-1" {
+        t.Errorf("body = %+v", resp)
+    }
+
+    // The generation is still tracked and reachable at the status URL
+    status := serve(mux, httptest.NewRequest(http.MethodGet, "/api/report/status/req-1", nil))
+    if status.Code != http.StatusAccepted {
+        t.Errorf("status route = %d, want 202", status.Code)
+    }
+}
+
+// reportUpstream serves a generation that stays processing until done is
+// closed, then exports body as a PDF
+func reportUpstream(done <-chan struct{}, body string) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        switch {
+        case strings.HasPrefix(r.URL.Path, "/device"):
+            w.Write([]byte(oneDevice))
+        case r.URL.Path == "/report/generate":
+            w.Write([]byte(`{"report_generated_id":"rep-1","status":"pending"}`))
+        case strings.HasPrefix(r.URL.Path, "/report-generated/export/"):
+            w.Header().Set("Content-Type", "application/pdf")
+            w.Write([]byte(body))
+        case strings.HasPrefix(r.URL.Path, "/report-generated/"):
+            select {
+            case <-done:
+                w.Write([]byte(`{"status":"done"}`))
+            default:
+                w.Write([]byte(`{"status":"processing"}`))
+            }
+        default:
+            http.NotFound(w, r)
+        }
+    }
+}
+
+func TestGenerateReportDisconnectThenReconnect(t *testing.T) {
+    done := make(chan struct{})
+    _, mux := newTestHandler(t, HandlerConfig{}, reportUpstream(done, "%PDF-1.4 report"))
+
+    // The client goes away while upstream is still generating
+    ctx, cancel := context.WithCancel(context.Background())
+    body := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}`
+    r := httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body)).WithContext(ctx)
+    r.Header.Set("X-Request-ID", "req-dc")
+    time.AfterFunc(100*time.Millisecond, cancel)
+    w := serve(mux, r)
+
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202 (body %s)", w.Code, w.Body)
+    }
+    var resp reportStatusResponse
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusURL != "/api/report/status/req-dc" {
+        t.Fatalf("status_url = %q, want /api/report/status/req-dc", resp.StatusURL)
+    }
+
+    // Reconnecting before upstream finishes still reports processing
+    if status := serve(mux, httptest.NewRequest(http.MethodGet, resp.StatusURL, nil)); status.Code != http.StatusAccepted {
+        t.Fatalf("status before done = %d, want 202", status.Code)
+    }
+
+    // Generation carried on without the client, the report is served once done
+    close(done)
+    deadline := time.Now().Add(10 * time.Second)
+    for {
+        status := serve(mux, httptest.NewRequest(http.MethodGet, resp.StatusURL, nil))
+        if status.Code == http.StatusOK {
+            if got := status.Body.String(); got != "%PDF-1.4 report" {
+                t.Errorf("report = %q", got)
+            }
+            if ct := status.Header().Get("Content-Type"); ct != "application/pdf" {
+                t.Errorf("Content-Type = %q, want application/pdf", ct)
+            }
+            break
+        }
+        if status.Code != http.StatusAccepted || time.Now().After(deadline) {
+            t.Fatalf("status = %d (body %s), want the finished report", status.Code, status.Body)
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+
+    // Another client can't retrieve it
+    other := httptest.NewRequest(http.MethodGet, resp.StatusURL, nil)
+    other.Header.Set("X-Client-ID", "someone-else")
+    if status := serve(mux, other); status.Code != http.StatusNotFound {
+        t.Errorf("other client status = %d, want 404", status.Code)
+    }
+}
+
+// headerCountingRecorder counts WriteHeader calls, httptest.ResponseRecorder
+// silently ignores the superfluous ones
+type headerCountingRecorder struct {
+    *httptest.ResponseRecorder
+    headers int
+}
+
+func (r *headerCountingRecorder) WriteHeader(code int) {
+    r.headers++
+    r.ResponseRecorder.WriteHeader(code)
+}
+
+func TestWriteReportResultDownloadFailures(t *testing.T) {
+    tests := []struct {
+        name     string
+        export   http.HandlerFunc
+        wantCode int
+    }{
+        {
+            // Upstream rejects the export before anything is sent
+            name: "export rejected",
+            export: func(w http.ResponseWriter, r *http.Request) {
+                w.WriteHeader(http.StatusInternalServerError)
+                w.Write([]byte(`{"message":"export failed"}`))
+            },
+            wantCode: http.StatusInternalServerError,
+        },
+        {
+            // Upstream promises a body and hangs up before sending any of it
+            name: "empty truncated body",
+            export: func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set("Content-Type", "application/pdf")
+                w.Header().Set("Content-Length", "100")
+                w.WriteHeader(http.StatusOK)
+            },
+            wantCode: http.StatusOK,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h, _ := newTestHandler(t, HandlerConfig{}, tt.export)
+
+            w := &headerCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+            h.writeReportResult(w, &reportResult{ReportID: "rep-1", FileTypes: []string{"pdf"}}, nil)
+
+            if w.Code != tt.wantCode {
+                t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+            }
+            if w.headers != 1 {
+                t.Errorf("WriteHeader called %d times, want 1", w.headers)
+            }
+            if tt.wantCode == http.StatusOK && w.Body.Len() != 0 {
+                t.Errorf("truncated download wrote an error body after the headers: %q", w.Body)
+            }
+            if tt.wantCode != http.StatusOK {
+                if body := errorBody(t, w.ResponseRecorder); body.Error != "report_download_failed" {
+                    t.Errorf("error = %q, want report_download_failed", body.Error)
+                }
+            }
+        })
+    }
+}
+
+func TestGenerateReportEmptyDeviceID(t *testing.T) {
+    var generates atomic.Int32
+    _, mux := newTestHandler(t, HandlerConfig{}, func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/report/generate" {
+            generates.Add(1)
+        }
+        devicesReply(oneDevice)(w, r)
+    })
+
+    r := httptest.NewRequest(http.MethodPost, "/api/report/generate",
+        strings.NewReader(`{"report_spec":{"report_type":"general_info","device_id_list":["dev1",""]}}`))
+    w := serve(mux, r)
+
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+    }
+    if body := errorBody(t, w); body.Error != "invalid_report_spec" || !strings.Contains(body.Message, "index 1") {
+        t.Errorf("body = %+v", body)
+    }
+    if got := generates.Load(); got != 0 {
+        t.Errorf("upstream generate calls = %d, want 0", got)
+    }
+}
+
+func TestGenerateReportBody(t *testing.T) {
+    done := make(chan struct{})
+    close(done)
+    _, mux := newTestHandler(t, HandlerConfig{}, reportUpstream(done, "%PDF-1.4 report"))
+
+    // Valid JSON padded past the limit, so only the size is at fault
+    oversized := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}` + strings.Repeat(" ", maxReportBodyBytes)
+    tests := []struct {
+        name      string
+        body      string
+        wantCode  int
+        wantError string
+    }{
+        {"empty", "", http.StatusBadRequest, "body_required"},
+        {"whitespace", " \n\t", http.StatusBadRequest, "body_required"},
+        {"oversized", oversized, http.StatusRequestEntityTooLarge, "body_too_large"},
+        {"malformed", `{"report_spec":`, http.StatusBadRequest, "invalid_body"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(tt.body)))
+            if w.Code != tt.wantCode {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+            }
+            if body := errorBody(t, w); body.Error != tt.wantError || body.Message == "" {
+                t.Errorf("body = %+v, want error %s", body, tt.wantError)
+            }
+        })
+    }
+
+    t.Run("valid", func(t *testing.T) {
+        body := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}`
+        w := serve(mux, httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body)))
+        if w.Code != http.StatusOK || w.Body.String() != "%PDF-1.4 report" {
+            t.Errorf("status = %d, body %q, want the report", w.Code, w.Body)
+        }
+    })
+}
+
+func TestReportStatusProgress(t *testing.T) {
+    upstream := func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        switch {
+        case strings.HasPrefix(r.URL.Path, "/device"):
+            w.Write([]byte(oneDevice))
+        case r.URL.Path == "/report/generate":
+            w.Write([]byte(`{"report_generated_id":"rep-1","status":"pending"}`))
+        default:
+            // Stays processing with partial progress for the rest of the test
+            w.Write([]byte(`{"status":"processing","progress":{"done":3,"total":4,"step":"collecting data"}}`))
+        }
+    }
+    _, mux := newTestHandler(t, HandlerConfig{
+        RouteTimeouts: map[string]time.Duration{"/api/report/generate": 50 * time.Millisecond},
+    }, upstream)
+
+    body := `{"report_spec":{"report_type":"general_info","device_id_list":["dev1"]}}`
+    r := httptest.NewRequest(http.MethodPost, "/api/report/generate", strings.NewReader(body))
+    r.Header.Set("X-Request-ID", "req-progress")
+    if w := serve(mux, r); w.Code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202 (body %s)", w.Code, w.Body)
+    }
+
+    status := serve(mux, httptest.NewRequest(http.MethodGet, "/api/report/status/req-progress", nil))
+    if status.Code != http.StatusAccepted {
+        t.Fatalf("status route = %d, want 202", status.Code)
+    }
+    var resp reportStatusResponse
+    if err := json.Unmarshal(status.Body.Bytes(), &resp); err != nil {
+        t.Fatal(err)
+    }
+    p := resp.Progress
+    if p == nil || p.Percent == nil || *p.Percent != 75 || p.CurrentStep != "collecting data" || *p.ItemsDone != 3 || *p.ItemsTotal != 4 {
+        t.Errorf("progress = %+v, want 3 of 4 at 75%% collecting data", p)
+    }
+}
@@ -0,0 +1,91 @@
+// request_cache.go memoizes device and preference lookups for the length of
+// one request, so composite handlers (e.g. report generation resolving,
+// expanding and filtering devices) fetch each at most once.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// requestCacheKey is the context key for a request's requestCache
+type requestCacheKey struct{}
+
+// requestCache holds the results fetched so far in one request.
+// Errors are cached too, a failed upstream call isn't retried within a request.
+type requestCache struct {
+    mu          sync.Mutex
+    devices     []models.Vehicle
+    devicesErr  error
+    devicesDone bool
+    preferences map[string]cachedPreferences // By client id
+}
+
+// cachedPreferences is one client's preferences lookup
+type cachedPreferences struct {
+    prefs []models.UserPreference
+    err   error
+}
+
+// withRequestCache gives each request an empty requestCache
+func withRequestCache(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ctx := context.WithValue(r.Context(), requestCacheKey{}, &requestCache{})
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
+
+// requestCacheFrom returns the request's cache, nil outside withRequestCache
+func requestCacheFrom(ctx context.Context) *requestCache {
+    cache, _ := ctx.Value(requestCacheKey{}).(*requestCache)
+    return cache
+}
+
+// devicesFor returns GetDevices, fetched once per request.
+// Callers get their own copy of the slice and may reorder it.
+func (h *Handler) devicesFor(ctx context.Context) ([]models.Vehicle, error) {
+    cache := requestCacheFrom(ctx)
+    if cache == nil {
+        return h.GPSClient.GetDevices()
+    }
+
+    cache.mu.Lock()
+    defer cache.mu.Unlock()
+    if !cache.devicesDone {
+        cache.devices, cache.devicesErr = h.GPSClient.GetDevices()
+        cache.devicesDone = true
+    }
+    if cache.devicesErr != nil {
+        return nil, cache.devicesErr
+    }
+    return append(make([]models.Vehicle, 0, len(cache.devices)), cache.devices...), nil
+}
+
+// preferencesFor returns GetAllPreferencesForClient, fetched once per request
+// and client. Handlers that write preferences must read them back directly,
+// a cached copy would predate the write.
+func (h *Handler) preferencesFor(ctx context.Context, clientID string) ([]models.UserPreference, error) {
+    cache := requestCacheFrom(ctx)
+    if cache == nil {
+        return h.DB.GetAllPreferencesForClient(clientID)
+    }
+
+    cache.mu.Lock()
+    defer cache.mu.Unlock()
+    entry, ok := cache.preferences[clientID]
+    if !ok {
+        entry.prefs, entry.err = h.DB.GetAllPreferencesForClient(clientID)
+        if cache.preferences == nil {
+            cache.preferences = make(map[string]cachedPreferences)
+        }
+        cache.preferences[clientID] = entry
+    }
+    if entry.err != nil {
+        return nil, entry.err
+    }
+    return append([]models.UserPreference(nil), entry.prefs...), nil
+}
@@ -0,0 +1,104 @@
+// request_cache_test.go covers memoizing devices and preferences within one request.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// inRequest runs fn with the context of one request through withRequestCache
+func inRequest(fn func(ctx context.Context)) {
+    withRequestCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fn(r.Context())
+    })).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestRequestCacheFetchesOnce(t *testing.T) {
+    calls := map[string]*atomic.Int32{"/device": new(atomic.Int32)}
+    h, _ := newTestHandler(t, HandlerConfig{}, countingDevices(calls))
+    setPreferences(t, []models.UserPreference{{DeviceID: "dev1", ClientID: "client-a", DisplayName: "Truck"}})
+
+    inRequest(func(ctx context.Context) {
+        first, err := h.devicesFor(ctx)
+        if err != nil || len(first) != 1 {
+            t.Fatalf("devicesFor = %v, %v", first, err)
+        }
+        // Callers get their own copy, changing it doesn't reach the next caller
+        first[0].DeviceID = "changed"
+        second, err := h.devicesFor(ctx)
+        if err != nil || len(second) != 1 || second[0].DeviceID != "dev1" {
+            t.Errorf("second devicesFor = %v, %v", second, err)
+        }
+
+        for i := 0; i < 2; i++ {
+            prefs, err := h.preferencesFor(ctx, "client-a")
+            if err != nil || len(prefs) != 1 || prefs[0].DisplayName != "Truck" {
+                t.Errorf("preferencesFor client-a = %+v, %v", prefs, err)
+            }
+        }
+        // Another client is its own lookup
+        if _, err := h.preferencesFor(ctx, "client-b"); err != nil {
+            t.Fatal(err)
+        }
+    })
+
+    if n := calls["/device"].Load(); n != 1 {
+        t.Errorf("upstream fetched %d times, want 1", n)
+    }
+    if n := preferenceQueries(t); n != 2 {
+        t.Errorf("preferences read %d times, want once per client", n)
+    }
+}
+
+func TestRequestCacheScopedToRequest(t *testing.T) {
+    calls := map[string]*atomic.Int32{"/device": new(atomic.Int32)}
+    h, _ := newTestHandler(t, HandlerConfig{}, countingDevices(calls))
+
+    // Each request starts empty
+    for i := 0; i < 2; i++ {
+        inRequest(func(ctx context.Context) {
+            if _, err := h.devicesFor(ctx); err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+    if n := calls["/device"].Load(); n != 2 {
+        t.Errorf("2 requests fetched %d times, want 2", n)
+    }
+
+    // Outside a request nothing is memoized
+    for i := 0; i < 2; i++ {
+        if _, err := h.devicesFor(context.Background()); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if n := calls["/device"].Load(); n != 4 {
+        t.Errorf("uncached calls fetched %d times in total, want 4", n)
+    }
+}
+
+func TestRequestCacheKeepsErrors(t *testing.T) {
+    var calls atomic.Int32
+    h, _ := newTestHandler(t, HandlerConfig{}, func(w http.ResponseWriter, r *http.Request) {
+        calls.Add(1)
+        w.WriteHeader(http.StatusBadGateway)
+    })
+
+    // A failed fetch isn't retried within the same request
+    inRequest(func(ctx context.Context) {
+        for i := 0; i < 2; i++ {
+            if _, err := h.devicesFor(ctx); err == nil {
+                t.Errorf("call %d: devicesFor succeeded, want the upstream error", i)
+            }
+        }
+    })
+    if n := calls.Load(); n != 1 {
+        t.Errorf("upstream called %d times, want 1", n)
+    }
+}
@@ -7,8 +7,9 @@ package api
 import (
 	"fmt"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // RouteGroup represents a group of related routes
@@ -20,14 +21,21 @@ type RouteGroup struct {
 
 // Route represents a single endpoint configuration
 type Route struct {
-    path    string
-    method  string
-    handler http.HandlerFunc
+    path                  string
+    method                string
+    handler               http.HandlerFunc
+    stream                bool     // Long-lived response, only ROUTE_TIMEOUTS applies, not REQUEST_TIMEOUT
+    params                []string // Recognized query params, others get a 400 with STRICT_QUERY_PARAMS; nil accepts any
+    writableInMaintenance bool     // POST/PUT/DELETE still served in maintenance mode, see maintenance.go
+    admin                 bool     // Requires the ADMIN_API_KEY bearer token, see auth.go
+    unlimited             bool     // Not counted against RATE_LIMIT_PER_MINUTE, see ratelimit.go
+    probe                 bool     // Health probe, skips the rate limit, tenant and maintenance layers, see routeStack
 }
 
-// SetupRoutes configures all API endpoints for the application
+// SetupRoutes registers all API endpoints for the application on mux
 // Called in main.go during server initialization
-func (h *Handler) SetupRoutes() {
+// Returns an error if ROUTE_TIMEOUTS names a path that isn't a route.
+func (h *Handler) SetupRoutes(mux *http.ServeMux) error {
     // Define route groups with their respective endpoints
     groups := []RouteGroup{
         {
@@ -40,6 +48,43 @@ func (h *Handler) SetupRoutes() {
                     path:    "",
                     method:  http.MethodGet,
                     handler: h.VehiclesHandler,
+                    params:  []string{"fields", "sort", "order", "units", "envelope", "shape", "meta.*"},
+                },
+                {
+                    // GET /vehicles/stale?threshold_minutes=N - Vehicles that stopped reporting, oldest first
+                    path:    "/stale",
+                    method:  http.MethodGet,
+                    handler: h.StaleVehiclesHandler,
+                    params:  []string{"threshold_minutes", "envelope"},
+                },
+                {
+                    // GET /vehicles/idle?threshold_minutes=N - Vehicles idling longer than N minutes, longest first
+                    path:    "/idle",
+                    method:  http.MethodGet,
+                    handler: h.IdleVehiclesHandler,
+                    params:  []string{"threshold_minutes", "envelope"},
+                },
+                {
+                    // GET /vehicles/clusters?zoom=Z&bounds=s,w,n,e - Grid-clustered markers for MapView.vue
+                    path:    "/clusters",
+                    method:  http.MethodGet,
+                    handler: h.VehicleClustersHandler,
+                    params:  []string{"zoom", "bounds"},
+                },
+                {
+                    // Fallback for HomeView.vue when proxies block WebSockets
+                    // GET /vehicles/stream?device_ids=a,b&fields=...&sort=preference - Server-Sent Events, same messages as /ws
+                    path:    "/stream",
+                    method:  http.MethodGet,
+                    handler: withStreamTenant(h.Hub.HandleSSE),
+                    stream:  true,
+                    params:  []string{"device_ids", "fields", "sort"},
+                },
+                {
+                    // GET /vehicles/{deviceID} - Returns a single vehicle or a structured 404
+                    path:    "/",
+                    method:  http.MethodGet,
+                    handler: h.VehicleHandler,
                 },
             },
         },
@@ -53,6 +98,7 @@ func (h *Handler) SetupRoutes() {
                     path:    "/batch",
                     method:  http.MethodPost,
                     handler: h.BatchUpdatePreferences,
+                    params:  []string{"mode", "summary"},
                 },
                 {
                     // Used in VehiclePreferences.vue for CRUD operations
@@ -62,10 +108,12 @@ func (h *Handler) SetupRoutes() {
                     path:    "",
                     method:  "*", // Allows multiple HTTP methods
                     handler: h.PreferencesHandler,
+                    params:  []string{"limit", "offset", "envelope"},
                 },
                 {
                     // Handles operations on specific preferences by ID
                     // Used for PUT/DELETE operations in VehiclePreferences.vue
+                    // GET /preferences/{deviceID}/effective - Stored preference with the display name to show
                     path:    "/",
                     method:  "*", // Handles requests with IDs
                     handler: h.PreferencesHandler,
@@ -79,25 +127,266 @@ func (h *Handler) SetupRoutes() {
                 {
                     // Used in ReportDialog.vue: generateReport()
                     // POST /report/generate - Generates and returns PDF report
+                    // POST /report/generate?preset=name - Generates a saved preset, no body needed
                     path:    "/generate",
                     method:  http.MethodPost,
                     handler: h.GenerateReportHandler,
+                    params:  []string{"preset"},
+                },
+                {
+                    // POST /report/validate - Dry run of /report/generate checks, lists every problem
+                    path:    "/validate",
+                    method:  http.MethodPost,
+                    handler: h.ValidateReportHandler,
+                    writableInMaintenance: true, // Read-only, POST only to carry the spec
+                },
+                {
+                    // POST /report/smoke - Generates the spec over the last 5 minutes to check it works
+                    path:    "/smoke",
+                    method:  http.MethodPost,
+                    handler: h.SmokeReportHandler,
+                    params:  []string{"preset"},
+                    writableInMaintenance: true, // Read-only, POST only to carry the spec
+                },
+                {
+                    // POST /report/diff - Field-by-field difference between two report specs
+                    path:    "/diff",
+                    method:  http.MethodPost,
+                    handler: h.ReportDiffHandler,
+                    writableInMaintenance: true, // Read-only, POST only to carry the specs
+                },
+                {
+                    // Used in ReportDialog.vue to save and reuse report settings
+                    // GET lists presets, POST saves one by name (replacing any existing)
+                    path:    "/presets",
+                    method:  "*",
+                    handler: h.ReportPresetsHandler,
+                },
+                {
+                    // GET/DELETE /report/presets/{name} - A single saved preset
+                    path:    "/presets/",
+                    method:  "*",
+                    handler: h.ReportPresetsHandler,
+                },
+                {
+                    // GET /report/status/{id} - Resume a report after a dropped connection
+                    // id is the X-Request-ID sent with /report/generate or the report id
+                    path:    "/status/",
+                    method:  http.MethodGet,
+                    handler: h.ReportStatusHandler,
+                },
+            },
+        },
+        {
+            prefix: "/livez",
+            handler: h,
+            routes: []Route{
+                {
+                    // GET /livez - Liveness probe, 503 when the hub stops answering heartbeats
+                    path:    "",
+                    method:  http.MethodGet,
+                    handler: h.LivezHandler,
+                    probe:   true,
+                },
+            },
+        },
+        {
+            prefix: "/readyz",
+            handler: h,
+            routes: []Route{
+                {
+                    // GET /readyz - Readiness probe for the load balancer, 503 when not ready
+                    path:    "",
+                    method:  http.MethodGet,
+                    handler: h.ReadyzHandler,
+                    probe:   true,
+                },
+            },
+        },
+        {
+            prefix: "/api/version",
+            handler: h,
+            routes: []Route{
+                {
+                    // GET /version - Build version, commit and build time of the running server
+                    path:    "",
+                    method:  http.MethodGet,
+                    handler: h.VersionHandler,
+                },
+            },
+        },
+        {
+            prefix: "/api/webhooks",
+            handler: h,
+            routes: []Route{
+                {
+                    // Called by OneStepGPS when WEBHOOK_SECRET is configured
+                    // POST /webhooks/onestepgps - Pushed device updates, signed with HMAC-SHA256
+                    path:    "/onestepgps",
+                    method:  http.MethodPost,
+                    handler: h.OneStepGPSWebhookHandler,
+                    writableInMaintenance: true, // Upstream pushes, only update the in-memory snapshot
+                },
+            },
+        },
+        {
+            prefix: "/api/admin",
+            handler: h,
+            routes: []Route{
+                {
+                    // Operator tooling, requires ADMIN_API_KEY bearer token
+                    // GET /admin/preferences?client_ids=a,b - Preferences grouped by client
+                    path:    "/preferences",
+                    method:  http.MethodGet,
+                    handler: h.AdminPreferencesHandler,
+                    admin:   true,
+                    params:  []string{"client_ids", "limit", "offset"},
+                },
+                {
+                    // POST /admin/preferences/cleanup?days=N - Delete preferences not updated in N days
+                    path:    "/preferences/cleanup",
+                    method:  http.MethodPost,
+                    handler: h.AdminPreferencesCleanupHandler,
+                    admin:   true,
+                    params:  []string{"days"},
+                },
+                {
+                    // GET returns maintenance state, POST ?enabled=true|false toggles it
+                    path:    "/maintenance",
+                    method:  "*",
+                    handler: h.MaintenanceHandler,
+                    admin:   true,
+                    params:  []string{"enabled"},
+                    writableInMaintenance: true, // Operators must be able to turn maintenance mode off
+                },
+                {
+                    // POST /admin/poll/pause - Stop all requests to OneStepGPS, /readyz reports polling_paused
+                    path:    "/poll/pause",
+                    method:  http.MethodPost,
+                    handler: h.PollPauseHandler,
+                    admin:   true,
+                    writableInMaintenance: true, // Operator controls
+                },
+                {
+                    // POST /admin/poll/resume - Resume polling OneStepGPS
+                    path:    "/poll/resume",
+                    method:  http.MethodPost,
+                    handler: h.PollResumeHandler,
+                    admin:   true,
+                    writableInMaintenance: true, // Operator controls
+                },
+                {
+                    // POST /admin/cors/reload - Re-read ALLOWED_ORIGINS without a restart
+                    path:    "/cors/reload",
+                    method:  http.MethodPost,
+                    handler: h.CORSReloadHandler,
+                    admin:   true,
+                    writableInMaintenance: true, // Operator controls
+                },
+            },
+        },
+        {
+            prefix: "/ws/subscribers",
+            handler: h,
+            routes: []Route{
+                {
+                    // Support tooling, requires ADMIN_API_KEY bearer token
+                    // GET /ws/subscribers/{deviceID} - Connected dashboards watching a device
+                    path:    "/",
+                    method:  http.MethodGet,
+                    handler: h.SubscribersHandler,
+                    admin:   true,
+                },
+            },
+        },
+        {
+            prefix: "/metrics",
+            handler: h,
+            routes: []Route{
+                {
+                    // Prometheus scrape target, requires the admin bearer token
+                    // GET /metrics - WebSocket client and dropped message counters
+                    path:    "",
+                    method:  http.MethodGet,
+                    handler: h.MetricsHandler,
+                    admin:   true,
+                    unlimited: true, // Scraped on a fixed interval, often from the same address as users
+                },
+            },
+        },
+        {
+            prefix: "/api/debug",
+            handler: h,
+            routes: []Route{
+                {
+                    // Requires DEBUG_ENDPOINTS=true and the admin bearer token
+                    // GET /debug/hub - Connected clients and last poll/broadcast state
+                    path:    "/hub",
+                    method:  http.MethodGet,
+                    handler: h.DebugHubHandler,
+                    admin:   true,
                 },
             },
         },
     }
 
-    // Registers each route with middleware
+    // Registers each route with middleware, timed out per ROUTE_TIMEOUTS
+    // or the REQUEST_TIMEOUT default, and with STRICT_QUERY_PARAMS
+    // rejecting query params the route doesn't list
+    registered := make(map[string]bool)
     for _, group := range groups {
         for _, route := range group.routes {
             fullPath := group.prefix + route.path
             fmt.Printf("Registering route: %s\n", fullPath)
-            // Apply CORS and method checking middleware to each route
-            http.Handle(fullPath, withCORS(methodHandler(route.method, route.handler)))
+            registered[fullPath] = true
+            timeout, ok := h.config.RouteTimeouts[fullPath]
+            if !ok && !route.stream {
+                timeout = h.config.RequestTimeout
+            }
+            handler := methodHandler(route.method, route.handler)
+            if h.config.StrictQueryParams && route.params != nil {
+                handler = withKnownParams(route.params)(handler)
+            }
+            mux.Handle(fullPath, h.routeStack(route, timeout)(handler))
+        }
+    }
+
+    // Catch typos in ROUTE_TIMEOUTS, an unmatched path would silently use the default
+    for path := range h.config.RouteTimeouts {
+        if !registered[path] {
+            return fmt.Errorf("ROUTE_TIMEOUTS path %s does not match a registered route", path)
         }
     }
 
     fmt.Println("Routes setup completed")
+    return nil
+}
+
+// routeStack is the middleware wrapped around a route's handler, in the
+// canonical order, outermost first:
+// recover -> log -> cors -> auth -> rate limit -> gzip request -> tenant ->
+// maintenance -> request cache -> timeout.
+// Preflights are answered by cors, so they never need the admin token or
+// count against the rate limit.
+// Probes only get recover -> log -> timeout: a throttled or tenant-rejected
+// /livez would get a healthy process restarted, and a /readyz one would
+// take it out of rotation.
+func (h *Handler) routeStack(route Route, timeout time.Duration) Middleware {
+    if route.probe {
+        return chain(withRecover, withLogging, withTimeout(timeout))
+    }
+    return chain(
+        withRecover,
+        withLogging,
+        h.withCORS,
+        h.withAuth(route.admin),
+        h.withRateLimit(route.unlimited),
+        withGzipRequest,
+        h.withTenant,
+        h.withMaintenance(route.writableInMaintenance),
+        withRequestCache,
+        withTimeout(timeout),
+    )
 }
 
 // methodHandler ensures requests use the allowed HTTP method
@@ -105,24 +394,32 @@ func methodHandler(allowedMethod string, handler http.HandlerFunc) http.Handler
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         // Allow all methods if "*" is specified, otherwise check for match
         if allowedMethod != "*" && r.Method != allowedMethod {
-            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            respondError(w, errMethodNotAllowed)
             return
         }
         handler(w, r)
     })
 }
 
-// withCORS adds CORS headers to responses
-func withCORS(next http.Handler) http.Handler {
+// withCORS adds CORS headers to responses.
+// Allow-Credentials is only sent when CORS_ALLOW_CREDENTIALS is enabled, and
+// preflights are cached by the browser for CORS_MAX_AGE seconds.
+func (h *Handler) withCORS(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         origin := r.Header.Get("Origin")
         
-        // Set CORS headers if origin is allowed
-        if isAllowedOrigin(origin) {
+        // Set CORS headers if origin is allowed, see cors_reload.go
+        if h.isAllowedOrigin(origin) {
             w.Header().Set("Access-Control-Allow-Origin", origin)
             w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-            w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-            w.Header().Set("Access-Control-Allow-Credentials", "true")
+            w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Encoding, Authorization, X-Request-ID, X-Client-ID")
+            w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+            if h.config.CORSAllowCredentials {
+                w.Header().Set("Access-Control-Allow-Credentials", "true")
+            }
+            if r.Method == http.MethodOptions && h.config.CORSMaxAge > 0 {
+                w.Header().Set("Access-Control-Max-Age", strconv.Itoa(h.config.CORSMaxAge))
+            }
         }
 
         // Handle preflight requests (OPTIONS method)
@@ -135,15 +432,15 @@ func withCORS(next http.Handler) http.Handler {
     })
 }
 
-// getAllowedOrigins retrieves allowed CORS origins from environment
+// getAllowedOrigins builds the CORS origin list from an ALLOWED_ORIGINS value
 // Development: localhost:5173
 // Production: S3 bucket URL
-func getAllowedOrigins() []string {
+func getAllowedOrigins(additionalOrigins string) []string {
 	// Default development origin
 	origins := []string{"http://localhost:5173"}
 	
 	// Add production origins from environment variable
-	if additionalOrigins := os.Getenv("ALLOWED_ORIGINS"); additionalOrigins != "" {
+	if additionalOrigins != "" {
 		// Split comma-separated origins and clean them
 		for _, origin := range strings.Split(additionalOrigins, ",") {
 			origin = strings.TrimSpace(origin)
@@ -155,15 +452,3 @@ func getAllowedOrigins() []string {
 	
 	return origins
 }
-
-// isAllowedOrigin checks if an origin is allowed for CORS
-// Used by withCORS middleware to validate request origins
-func isAllowedOrigin(origin string) bool {
-	allowedOrigins := getAllowedOrigins()
-	for _, allowed := range allowedOrigins {
-		if allowed == origin {
-			return true
-		}
-	}
-	return false
-}
\ No newline at end of file
@@ -0,0 +1,103 @@
+// sorting.go provides server-side sorting for the /vehicles endpoint.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// vehicleLess compares two vehicles for a single sort key
+type vehicleLess func(a, b *models.Vehicle) bool
+
+// vehicleSortKeys maps the ?sort= values to their comparison functions
+var vehicleSortKeys = map[string]vehicleLess{
+    "name": func(a, b *models.Vehicle) bool {
+        return strings.ToLower(a.DisplayName) < strings.ToLower(b.DisplayName)
+    },
+    "speed": func(a, b *models.Vehicle) bool {
+        return vehicleSpeed(a) < vehicleSpeed(b)
+    },
+    "status": func(a, b *models.Vehicle) bool {
+        return a.DriveState.Status < b.DriveState.Status
+    },
+    "last_seen": func(a, b *models.Vehicle) bool {
+        return vehicleLastSeen(a).Before(vehicleLastSeen(b))
+    },
+}
+
+// sortVehiclesFromQuery applies ?sort= and ?order= to the vehicle list in place.
+// Returns an error describing the invalid parameter if validation fails.
+func (h *Handler) sortVehiclesFromQuery(r *http.Request, vehicles []models.Vehicle) error {
+    key := r.URL.Query().Get("sort")
+    if key == "" {
+        return nil // Keep upstream order when no sort requested
+    }
+
+    less, ok := vehicleSortKeys[key]
+    if key == "preference" {
+        var err error
+        if less, err = h.preferenceLess(r); err != nil {
+            return err
+        }
+        ok = true
+    }
+    if !ok {
+        return newAppError(http.StatusBadRequest, "invalid_sort", fmt.Sprintf("invalid sort key %q: must be one of name, speed, status, last_seen, preference", key), nil)
+    }
+
+    order := r.URL.Query().Get("order")
+    switch order {
+    case "", "asc":
+    case "desc":
+        asc := less
+        less = func(a, b *models.Vehicle) bool { return asc(b, a) }
+    default:
+        return newAppError(http.StatusBadRequest, "invalid_sort", fmt.Sprintf("invalid order %q: must be asc or desc", order), nil)
+    }
+
+    // Stable sort so vehicles with equal keys keep their relative order
+    sort.SliceStable(vehicles, func(i, j int) bool {
+        return less(&vehicles[i], &vehicles[j])
+    })
+    return nil
+}
+
+// preferenceLess orders vehicles by the client's sort_order, the order
+// VehiclePreferences.vue shows them in. Vehicles without a preference go
+// first or last per UNPREFERENCED_ORDER, in upstream order among themselves.
+// order=desc reverses the whole list, those vehicles included.
+// A failed preference lookup is returned as an *AppError, not a bad request.
+func (h *Handler) preferenceLess(r *http.Request) (vehicleLess, error) {
+    prefs, err := h.preferencesFor(r.Context(), resolveClientID(r))
+    if err != nil {
+        return nil, newAppError(http.StatusInternalServerError, "preferences_unavailable", "Error fetching preferences", err)
+    }
+    sortOrder := make(map[string]int, len(prefs))
+    for _, pref := range prefs {
+        sortOrder[pref.DeviceID] = pref.SortOrder
+    }
+
+    return h.config.PreferenceDefaults.Less(sortOrder), nil
+}
+
+// vehicleSpeed returns the last reported speed, treating missing positions as 0
+func vehicleSpeed(v *models.Vehicle) float64 {
+    if v.LastLocation == nil {
+        return 0
+    }
+    return v.LastLocation.Speed
+}
+
+// vehicleLastSeen returns the last position time, zero if never reported
+func vehicleLastSeen(v *models.Vehicle) time.Time {
+    if v.LastLocation == nil {
+        return time.Time{}
+    }
+    return v.LastLocation.Timestamp
+}
@@ -0,0 +1,75 @@
+// sorting_test.go covers ?sort= and ?order= on /vehicles.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// sortDevices differ on every sort key. Upstream order is by device id:
+//   - a: "Charlie", 30 km/h, driving, seen 10:00
+//   - b: "alpha", stopped, off, seen 12:00
+//   - c: "Bravo", 55 km/h, idle, seen 09:00
+//   - d: "Delta", driving, never reported a position
+const sortDevices = `{"result_list":[
+    {"device_id":"c","display_name":"Bravo","latest_device_point":{"lat":1,"lng":1,"speed":55,"dt_tracker":"2026-01-02T09:00:00Z"},"device_state":{"drive_status":"idle"}},
+    {"device_id":"a","display_name":"Charlie","latest_device_point":{"lat":1,"lng":1,"speed":30,"dt_tracker":"2026-01-02T10:00:00Z"},"device_state":{"drive_status":"driving"}},
+    {"device_id":"d","display_name":"Delta","device_state":{"drive_status":"driving"}},
+    {"device_id":"b","display_name":"alpha","latest_device_point":{"lat":1,"lng":1,"speed":0,"dt_tracker":"2026-01-02T12:00:00Z"},"device_state":{"drive_status":"off"}}
+]}`
+
+func TestVehiclesSort(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(sortDevices))
+
+    tests := []struct {
+        query string
+        want  []string
+    }{
+        {"", []string{"a", "b", "c", "d"}},
+        {"?sort=name", []string{"b", "c", "a", "d"}}, // Case-insensitive
+        {"?sort=name&order=desc", []string{"d", "a", "c", "b"}},
+        {"?sort=speed", []string{"b", "d", "a", "c"}}, // b and d both 0, kept in upstream order
+        {"?sort=speed&order=desc", []string{"c", "a", "b", "d"}},
+        {"?sort=status", []string{"a", "d", "c", "b"}},
+        {"?sort=status&order=desc", []string{"b", "c", "a", "d"}},
+        {"?sort=last_seen", []string{"d", "c", "a", "b"}}, // Never seen sorts first
+        {"?sort=last_seen&order=desc", []string{"b", "a", "c", "d"}},
+        {"?sort=name&order=asc", []string{"b", "c", "a", "d"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.query, func(t *testing.T) {
+            if got := vehicleIDs(t, mux, "/api/vehicles"+tt.query); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("order = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestVehiclesSortInvalid(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(sortDevices))
+
+    for _, query := range []string{"?sort=colour", "?sort=NAME", "?sort=name&order=up", "?order=sideways&sort=speed"} {
+        t.Run(query, func(t *testing.T) {
+            w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles"+query, nil))
+            if w.Code != http.StatusBadRequest {
+                t.Fatalf("status = %d, want 400", w.Code)
+            }
+            if body := errorBody(t, w); body.Error != "invalid_sort" {
+                t.Errorf("error = %q, want invalid_sort", body.Error)
+            }
+        })
+    }
+}
+
+func TestVehiclesSortWithFields(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(sortDevices))
+
+    // Sorting happens before projection, so it can use fields left out of the output
+    got := vehicleIDs(t, mux, "/api/vehicles?sort=speed&order=desc&fields=device_id")
+    if want := []string{"c", "a", "b", "d"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("order = %v, want %v", got, want)
+    }
+}
@@ -0,0 +1,77 @@
+// stale.go provides detection of vehicles that have stopped reporting,
+// which usually points at a failed or unplugged tracker.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// defaultStaleThreshold applies when ?threshold_minutes= is omitted
+const defaultStaleThreshold = 60 * time.Minute
+
+// parseThresholdMinutes reads ?threshold_minutes=, using fallback when absent
+func parseThresholdMinutes(r *http.Request, fallback time.Duration) (time.Duration, error) {
+    raw := r.URL.Query().Get("threshold_minutes")
+    if raw == "" {
+        return fallback, nil
+    }
+    minutes, err := strconv.Atoi(raw)
+    if err != nil || minutes <= 0 {
+        return 0, fmt.Errorf("Invalid threshold_minutes %q: must be a positive integer", raw)
+    }
+    return time.Duration(minutes) * time.Minute, nil
+}
+
+// isStale reports whether a vehicle's last position is older than threshold.
+// Vehicles that never reported a position are always stale.
+func isStale(v *models.Vehicle, threshold time.Duration, now time.Time) bool {
+    if v.LastLocation == nil {
+        return true
+    }
+    return now.Sub(v.LastLocation.Timestamp) > threshold
+}
+
+// staleVehicles returns the stale vehicles sorted oldest position first,
+// with never-reported vehicles at the front
+func staleVehicles(vehicles []models.Vehicle, threshold time.Duration, now time.Time) []models.Vehicle {
+    stale := make([]models.Vehicle, 0)
+    for i := range vehicles {
+        if isStale(&vehicles[i], threshold, now) {
+            stale = append(stale, vehicles[i])
+        }
+    }
+    sort.SliceStable(stale, func(i, j int) bool {
+        return vehicleLastSeen(&stale[i]).Before(vehicleLastSeen(&stale[j]))
+    })
+    return stale
+}
+
+// StaleVehiclesHandler handles GET /vehicles/stale?threshold_minutes=N,
+// listing vehicles that haven't reported within the threshold (default 60).
+// Supports ?envelope=true like /vehicles.
+func (h *Handler) StaleVehiclesHandler(w http.ResponseWriter, r *http.Request) {
+    threshold, err := parseThresholdMinutes(r, defaultStaleThreshold)
+    if err != nil {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_threshold", err.Error(), err))
+        return
+    }
+
+    // Polled every few seconds by dashboards, served from the device cache like /vehicles
+    vehicles, err := h.GPSClient.GetDevicesCached(deviceCacheMaxAge)
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+
+    stale := staleVehicles(vehicles, threshold, time.Now())
+    if err := writeJSONList(w, r, stale, len(stale)); err != nil {
+        fmt.Printf("Error writing stale vehicles: %v\n", err)
+    }
+}
@@ -0,0 +1,83 @@
+// stale_test.go covers listing vehicles that stopped reporting.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// seenAt is a vehicle whose last position is at ts
+func seenAt(id string, ts time.Time) models.Vehicle {
+    return models.Vehicle{DeviceID: id, LastLocation: &models.Location{Timestamp: ts}}
+}
+
+func TestStaleVehicles(t *testing.T) {
+    now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+    vehicles := []models.Vehicle{
+        seenAt("fresh", now.Add(-5*time.Minute)),
+        seenAt("day-old", now.Add(-24*time.Hour)),
+        {DeviceID: "never"},
+        seenAt("at-threshold", now.Add(-time.Hour)),
+        seenAt("just-over", now.Add(-time.Hour-time.Second)),
+        seenAt("two-hours", now.Add(-2*time.Hour)),
+        seenAt("future", now.Add(time.Minute)), // Tracker clock ahead of ours
+    }
+
+    var ids []string
+    for _, v := range staleVehicles(vehicles, time.Hour, now) {
+        ids = append(ids, v.DeviceID)
+    }
+    // Oldest first, never-reported at the front, exactly the threshold isn't stale yet
+    want := []string{"never", "day-old", "two-hours", "just-over"}
+    if !reflect.DeepEqual(ids, want) {
+        t.Errorf("stale = %v, want %v", ids, want)
+    }
+
+    if got := staleVehicles(vehicles[:1], time.Hour, now); got == nil || len(got) != 0 {
+        t.Errorf("no stale vehicles = %#v, want an empty list", got)
+    }
+}
+
+func TestStaleVehiclesHandler(t *testing.T) {
+    now := time.Now().UTC()
+    point := func(id string, age time.Duration) string {
+        return fmt.Sprintf(`{"device_id":%q,"latest_device_point":{"lat":39.7,"lng":-104.9,"dt_tracker":%q}}`,
+            id, now.Add(-age).Format(time.RFC3339))
+    }
+    upstream := fmt.Sprintf(`{"result_list":[%s,%s,%s,{"device_id":"never"}]}`,
+        point("fresh", 5*time.Minute), point("hour-and-half", 90*time.Minute), point("three-hours", 3*time.Hour))
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(upstream))
+
+    tests := []struct {
+        target string
+        want   []string
+    }{
+        {"/api/vehicles/stale", []string{"never", "three-hours", "hour-and-half"}},
+        {"/api/vehicles/stale?threshold_minutes=120", []string{"never", "three-hours"}},
+        {"/api/vehicles/stale?threshold_minutes=1", []string{"never", "three-hours", "hour-and-half", "fresh"}},
+        {"/api/vehicles/stale?threshold_minutes=1000", []string{"never"}},
+    }
+    for _, tt := range tests {
+        if got := vehicleIDs(t, mux, tt.target); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s = %v, want %v", tt.target, got, tt.want)
+        }
+    }
+}
+
+func TestStaleVehiclesInvalidThreshold(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+
+    for _, raw := range []string{"0", "-5", "abc", "1.5"} {
+        w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles/stale?threshold_minutes="+raw, nil))
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("threshold_minutes=%s: status = %d, want 400", raw, w.Code)
+        }
+    }
+}
@@ -0,0 +1,74 @@
+// strict_params.go rejects unrecognized query parameters on routes that list
+// their parameters, so a typo like ?clientid= fails loudly instead of
+// silently falling back to a default. Enabled with STRICT_QUERY_PARAMS.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// globalQueryParams are accepted on every strict route, see resolveClientID
+var globalQueryParams = []string{"client_id"}
+
+// unknownParamsResponse is the JSON body for a 400 on unrecognized params
+type unknownParamsResponse struct {
+    Error   string   `json:"error"`
+    Message string   `json:"message"`
+    Params  []string `json:"params"`  // Unrecognized, sorted
+    Allowed []string `json:"allowed"` // What the route accepts, sorted
+}
+
+// withKnownParams rejects requests carrying query params not in known or
+// globalQueryParams with a 400 listing them. An entry ending in "*" accepts
+// any param with that prefix, e.g. "meta.*".
+func withKnownParams(known []string) Middleware {
+    allowed := append(append([]string(nil), globalQueryParams...), known...)
+    sort.Strings(allowed)
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            var unknown []string
+            for param := range r.URL.Query() {
+                if !paramAllowed(param, allowed) {
+                    unknown = append(unknown, param)
+                }
+            }
+            if len(unknown) > 0 {
+                sort.Strings(unknown)
+                writeUnknownParams(w, unknown, allowed)
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// paramAllowed reports whether param matches an allowed name or prefix
+func paramAllowed(param string, allowed []string) bool {
+    for _, a := range allowed {
+        if prefix, ok := strings.CutSuffix(a, "*"); ok {
+            if strings.HasPrefix(param, prefix) {
+                return true
+            }
+        } else if param == a {
+            return true
+        }
+    }
+    return false
+}
+
+// writeUnknownParams writes the structured 400 for unrecognized params
+func writeUnknownParams(w http.ResponseWriter, unknown, allowed []string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusBadRequest)
+    json.NewEncoder(w).Encode(unknownParamsResponse{
+        Error:   "unknown_query_params",
+        Message: fmt.Sprintf("unrecognized query parameters: %s", strings.Join(unknown, ", ")),
+        Params:  unknown,
+        Allowed: allowed,
+    })
+}
@@ -0,0 +1,79 @@
+// strict_params_test.go covers rejecting unrecognized query params with STRICT_QUERY_PARAMS.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestStrictParamsAccepted(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{StrictQueryParams: true, MetadataFilterKeys: []string{"color"}}, devicesReply(oneDevice))
+
+    // Listed params, the global client_id and meta.* prefixes all pass
+    for _, target := range []string{
+        "/api/vehicles",
+        "/api/vehicles?sort=name&order=desc",
+        "/api/vehicles?client_id=client-a&fields=device_id",
+        "/api/vehicles?meta.color=red",
+        "/api/vehicles/idle?threshold_minutes=5",
+    } {
+        if w := serve(mux, httptest.NewRequest(http.MethodGet, target, nil)); w.Code != http.StatusOK {
+            t.Errorf("GET %s = %d, want 200: %s", target, w.Code, w.Body)
+        }
+    }
+}
+
+func TestStrictParamsRejected(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{StrictQueryParams: true}, devicesReply(oneDevice))
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles?clientid=a&sort=name&zoom=3", nil))
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+    }
+    var body unknownParamsResponse
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    if body.Error != "unknown_query_params" || !reflect.DeepEqual(body.Params, []string{"clientid", "zoom"}) {
+        t.Errorf("body = %+v, want clientid and zoom rejected", body)
+    }
+    want := []string{"client_id", "envelope", "fields", "meta.*", "order", "shape", "sort", "units"}
+    if !reflect.DeepEqual(body.Allowed, want) {
+        t.Errorf("allowed = %v, want %v", body.Allowed, want)
+    }
+}
+
+func TestStrictParamsDisabled(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(oneDevice))
+
+    // Without STRICT_QUERY_PARAMS unknown params are ignored as before
+    if w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles?clientid=a", nil)); w.Code != http.StatusOK {
+        t.Errorf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+}
+
+func TestParamAllowed(t *testing.T) {
+    allowed := []string{"client_id", "meta.*", "sort"}
+    tests := []struct {
+        param string
+        want  bool
+    }{
+        {"sort", true},
+        {"client_id", true},
+        {"meta.color", true},
+        {"meta.", true},
+        {"meta", false},
+        {"sorted", false},
+        {"Sort", false},
+        {"", false},
+    }
+    for _, tt := range tests {
+        if got := paramAllowed(tt.param, allowed); got != tt.want {
+            t.Errorf("paramAllowed(%q) = %v, want %v", tt.param, got, tt.want)
+        }
+    }
+}
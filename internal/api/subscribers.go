@@ -0,0 +1,31 @@
+// subscribers.go reports which WebSocket dashboards are watching a device,
+// for support staff.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// SubscribersHandler handles GET /ws/subscribers/{device_id}.
+// Counts connected clients receiving the device, either subscribed to it
+// by id or receiving all devices (clients that never sent "subscribe").
+func (h *Handler) SubscribersHandler(w http.ResponseWriter, r *http.Request) {
+    deviceID := strings.TrimPrefix(r.URL.Path, "/ws/subscribers/")
+    if deviceID == "" || strings.Contains(deviceID, "/") {
+        respondError(w, errDeviceIDRequired)
+        return
+    }
+
+    explicit, all := h.Hub.SubscriberCounts(deviceID)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "device_id":   deviceID,
+        "subscribers": explicit + all,
+        "subscribed":  explicit, // Subscribed to this device by id
+        "all_devices": all,      // Receiving every device
+    })
+}
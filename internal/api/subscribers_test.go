@@ -0,0 +1,102 @@
+// subscribers_test.go covers counting the dashboards watching a device.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialSubscribed connects a dashboard to srv and, unless deviceIDs is nil,
+// subscribes it to them, waiting for the hub's confirmation
+func dialSubscribed(t *testing.T, srv *httptest.Server, deviceIDs []string) {
+    t.Helper()
+    conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    if deviceIDs == nil {
+        return
+    }
+
+    if err := conn.WriteJSON(map[string]interface{}{"action": "subscribe", "device_ids": deviceIDs}); err != nil {
+        t.Fatal(err)
+    }
+    conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+    for {
+        var msg struct {
+            Type string `json:"type"`
+        }
+        if err := conn.ReadJSON(&msg); err != nil {
+            t.Fatalf("waiting for subscription to %v: %v", deviceIDs, err)
+        }
+        if msg.Type == "subscribed" {
+            return
+        }
+    }
+}
+
+// subscriberCounts GETs /ws/subscribers/{deviceID} as an admin
+func subscriberCounts(t *testing.T, mux http.Handler, deviceID string) map[string]interface{} {
+    t.Helper()
+    w := serve(mux, adminRequest(http.MethodGet, "/ws/subscribers/"+deviceID))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    var body map[string]interface{}
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    return body
+}
+
+func TestSubscribers(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+    mux.HandleFunc("/ws", h.Hub.HandleWebSocket)
+    srv := httptest.NewServer(mux)
+    defer srv.Close()
+
+    dialSubscribed(t, srv, nil) // Never subscribes, receives every device
+    dialSubscribed(t, srv, []string{"dev1"})
+    dialSubscribed(t, srv, []string{"dev1", "dev2"})
+    dialSubscribed(t, srv, []string{"dev2"})
+
+    // The silent dashboard registers asynchronously
+    deadline := time.Now().Add(2 * time.Second)
+    for len(h.Hub.State().Clients) < 4 && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    tests := []struct {
+        deviceID                    string
+        subscribers, subscribed, all float64
+    }{
+        {"dev1", 3, 2, 1},
+        {"dev2", 3, 2, 1},
+        {"dev3", 1, 0, 1},
+    }
+    for _, tt := range tests {
+        got := subscriberCounts(t, mux, tt.deviceID)
+        if got["device_id"] != tt.deviceID || got["subscribers"] != tt.subscribers || got["subscribed"] != tt.subscribed || got["all_devices"] != tt.all {
+            t.Errorf("%s: counts = %v, want %v subscribers (%v by id, %v all)", tt.deviceID, got, tt.subscribers, tt.subscribed, tt.all)
+        }
+    }
+}
+
+func TestSubscribersRequiresAdmin(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{AdminAPIKey: testAdminKey}, nil)
+
+    if w := serve(mux, httptest.NewRequest(http.MethodGet, "/ws/subscribers/dev1", nil)); w.Code != http.StatusUnauthorized {
+        t.Errorf("without token = %d, want 401", w.Code)
+    }
+    if w := serve(mux, adminRequest(http.MethodGet, "/ws/subscribers/")); w.Code != http.StatusBadRequest {
+        t.Errorf("without a device id = %d, want 400", w.Code)
+    }
+}
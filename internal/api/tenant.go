@@ -0,0 +1,84 @@
+// tenant.go derives the client id from the request subdomain for
+// multi-tenant hosting, e.g. acme.fleet.example.com -> client "acme-fleet".
+
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/websocket"
+)
+
+// tenantContextKey is the context key holding the resolved tenant client id
+type tenantContextKey struct{}
+
+// tenantFromHost returns the subdomain label of host under baseDomain.
+// ok is false for the apex domain and for hosts outside baseDomain.
+func tenantFromHost(host, baseDomain string) (tenant string, ok bool) {
+    if h, _, err := net.SplitHostPort(host); err == nil {
+        host = h
+    }
+    host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+    suffix := "." + baseDomain
+    if !strings.HasSuffix(host, suffix) {
+        return "", false
+    }
+    tenant = strings.TrimSuffix(host, suffix)
+    if tenant == "" || strings.Contains(tenant, ".") {
+        return "", false // Only a single label in front of the base domain names a tenant
+    }
+    return tenant, true
+}
+
+// withTenant maps the request's subdomain to a client id and stores it in the
+// request context, where resolveClientID prefers it over headers and query.
+// Disabled unless TENANT_BASE_DOMAIN is set. Requests to the apex domain pass
+// through unchanged; unknown tenants get a 404.
+func (h *Handler) withTenant(next http.Handler) http.Handler {
+    baseDomain := strings.ToLower(strings.Trim(h.config.TenantBaseDomain, "."))
+    if baseDomain == "" {
+        return next
+    }
+
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        tenant, ok := tenantFromHost(r.Host, baseDomain)
+        if !ok {
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        clientID, known := h.config.Tenants[tenant]
+        if !known {
+            http.NotFound(w, r)
+            return
+        }
+        next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, clientID)))
+    })
+}
+
+// tenantClientID returns the client id injected by withTenant, if any
+func tenantClientID(r *http.Request) (string, bool) {
+    id, ok := r.Context().Value(tenantContextKey{}).(string)
+    return id, ok && id != ""
+}
+
+// withStreamTenant hands the tenant client id to the hub, which can't read
+// tenantContextKey, so streams pick the same preference owner as resolveClientID
+func withStreamTenant(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if id, ok := tenantClientID(r); ok {
+            r = r.WithContext(websocket.WithClientID(r.Context(), id))
+        }
+        next(w, r)
+    }
+}
+
+// WebSocketHandler returns the /ws handler with the tenant resolved like
+// the API routes. Mounted in main.go, outside the API middleware stack.
+func (h *Handler) WebSocketHandler() http.Handler {
+    return h.withTenant(withStreamTenant(h.Hub.HandleWebSocket))
+}
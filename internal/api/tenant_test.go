@@ -0,0 +1,97 @@
+// tenant_test.go covers resolving the tenant client id from the request host.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+func TestTenantFromHost(t *testing.T) {
+    tests := []struct {
+        host   string
+        want   string
+        wantOK bool
+    }{
+        {"acme.fleet.example.com", "acme", true},
+        {"acme.fleet.example.com:8080", "acme", true},
+        {"ACME.Fleet.Example.com.", "acme", true},
+        {"fleet.example.com", "", false},      // Apex
+        {"a.b.fleet.example.com", "", false},  // More than one label
+        {"acme.other.example.com", "", false}, // Outside the base domain
+        {"evilfleet.example.com", "", false},  // Suffix without the dot
+        {"localhost:8080", "", false},
+    }
+    for _, tt := range tests {
+        got, ok := tenantFromHost(tt.host, "fleet.example.com")
+        if got != tt.want || ok != tt.wantOK {
+            t.Errorf("tenantFromHost(%q) = %q, %v, want %q, %v", tt.host, got, ok, tt.want, tt.wantOK)
+        }
+    }
+}
+
+func TestWithTenant(t *testing.T) {
+    h, _ := newTestHandler(t, HandlerConfig{
+        TenantBaseDomain: ".Fleet.Example.com.",
+        Tenants:          map[string]string{"acme": "client-acme"},
+    }, nil)
+
+    var resolved string
+    handler := h.withTenant(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        resolved = resolveClientID(r)
+    }))
+
+    tests := []struct {
+        name       string
+        host       string
+        wantStatus int
+        want       string
+    }{
+        {"known tenant", "acme.fleet.example.com", http.StatusOK, "client-acme"},
+        {"unknown tenant", "globex.fleet.example.com", http.StatusNotFound, ""},
+        {"apex domain", "fleet.example.com", http.StatusOK, "client-q"},
+        {"other host", "127.0.0.1:8080", http.StatusOK, "client-q"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            resolved = ""
+            r := httptest.NewRequest(http.MethodGet, "/api/preferences?client_id=client-q", nil)
+            r.Host = tt.host
+            w := serve(handler, r)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+            }
+            if resolved != tt.want {
+                t.Errorf("client id = %q, want %q", resolved, tt.want)
+            }
+        })
+    }
+}
+
+func TestWithTenantDisabled(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+    setPreferences(t, []models.UserPreference{{DeviceID: "dev-1", ClientID: "default"}})
+
+    // Without TENANT_BASE_DOMAIN every host is served as before
+    r := httptest.NewRequest(http.MethodGet, "/api/preferences", nil)
+    r.Host = "globex.fleet.example.com"
+    if w := serve(mux, r); w.Code != http.StatusOK {
+        t.Errorf("status = %d, want 200", w.Code)
+    }
+}
+
+func TestUnknownTenantThroughRoutes(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{
+        TenantBaseDomain: "fleet.example.com",
+        Tenants:          map[string]string{"acme": "client-acme"},
+    }, nil)
+
+    r := httptest.NewRequest(http.MethodGet, "/api/preferences", nil)
+    r.Host = "globex.fleet.example.com"
+    if w := serve(mux, r); w.Code != http.StatusNotFound {
+        t.Errorf("status = %d, want 404", w.Code)
+    }
+}
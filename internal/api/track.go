@@ -0,0 +1,54 @@
+// track.go proxies OneStepGPS point history so the map can draw a trail
+// without the backend storing positions itself.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxTrackRange bounds one track request, longer ranges should be paged by the client
+const maxTrackRange = 7 * 24 * time.Hour
+
+// getVehicleTrack handles GET /vehicles/{deviceID}/track?from=&to=.
+// from is required, to defaults to now; both are RFC 3339.
+// Returns the points oldest first, an empty list when none were recorded.
+func (h *Handler) getVehicleTrack(w http.ResponseWriter, r *http.Request, deviceID string) {
+    from, err := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+    if err != nil {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_range", "from must be an RFC 3339 time", err))
+        return
+    }
+    to := time.Now()
+    if raw := r.URL.Query().Get("to"); raw != "" {
+        if to, err = time.Parse(time.RFC3339, raw); err != nil {
+            respondError(w, newAppError(http.StatusBadRequest, "invalid_range", "to must be an RFC 3339 time", err))
+            return
+        }
+    }
+    if !from.Before(to) {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_range", "from must be before to", nil))
+        return
+    }
+    if to.Sub(from) > maxTrackRange {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_range", fmt.Sprintf("range must not exceed %s", maxTrackRange), nil))
+        return
+    }
+
+    // Unknown devices get the same structured 404 as /vehicles/{deviceID}
+    if err := h.findDevices(r.Context(), []string{deviceID}); err != nil {
+        respondError(w, err)
+        return
+    }
+
+    points, err := h.GPSClient.GetDeviceHistory(deviceID, from, to)
+    if err != nil {
+        respondError(w, err)
+        return
+    }
+    if err := writeJSONList(w, r, points, len(points)); err != nil {
+        fmt.Printf("Error writing track: %v\n", err)
+    }
+}
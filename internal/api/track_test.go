@@ -0,0 +1,93 @@
+// track_test.go covers proxying device point history at /vehicles/{id}/track.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// trackUpstream knows device dev1 and returns a three point series for it,
+// newest first, and no points for any other range
+func trackUpstream(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    if r.URL.Path != "/device-point" {
+        w.Write([]byte(oneDevice))
+        return
+    }
+    if r.URL.Query().Get("dt_tracker_from") != "2024-05-01T08:00:00Z" {
+        w.Write([]byte(emptyDevices))
+        return
+    }
+    w.Write([]byte(`{"result_list":[
+        {"dt_tracker":"2024-05-01T08:02:00Z","lat":39.72,"lng":-104.9},
+        {"dt_tracker":"2024-05-01T08:01:00Z","lat":39.71,"lng":-104.9},
+        {"dt_tracker":"2024-05-01T08:00:00Z","lat":39.70,"lng":-104.9}
+    ]}`))
+}
+
+// getTrack GETs the track of deviceID with query and decodes the points
+func getTrack(t *testing.T, mux http.Handler, deviceID, query string) []models.Location {
+    t.Helper()
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles/"+deviceID+"/track?"+query, nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    var points []models.Location
+    if err := json.Unmarshal(w.Body.Bytes(), &points); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    return points
+}
+
+func TestVehicleTrack(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, trackUpstream)
+
+    points := getTrack(t, mux, "dev1", "from=2024-05-01T08:00:00Z&to=2024-05-01T09:00:00Z")
+    if len(points) != 3 {
+        t.Fatalf("got %d points, want 3", len(points))
+    }
+    for i, lat := range []float64{39.70, 39.71, 39.72} {
+        if points[i].Latitude != lat {
+            t.Errorf("point %d lat = %v, want %v (oldest first)", i, points[i].Latitude, lat)
+        }
+    }
+
+    // A range without points is an empty list, not null
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles/dev1/track?from=2024-06-01T08:00:00Z&to=2024-06-01T09:00:00Z", nil))
+    if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+        t.Errorf("empty range = %d %q, want 200 []", w.Code, w.Body)
+    }
+}
+
+func TestVehicleTrackInvalidRange(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, trackUpstream)
+
+    for _, query := range []string{
+        "",
+        "from=yesterday",
+        "from=2024-05-01T08:00:00Z&to=soon",
+        "from=2024-05-01T09:00:00Z&to=2024-05-01T08:00:00Z",
+        "from=2024-05-01T08:00:00Z&to=2024-05-01T08:00:00Z",
+        "from=2024-05-01T08:00:00Z&to=2024-05-09T08:00:00Z", // Over maxTrackRange
+    } {
+        w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles/dev1/track?"+query, nil))
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("%q: status = %d, want 400", query, w.Code)
+        }
+    }
+}
+
+func TestVehicleTrackUnknownDevice(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, trackUpstream)
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles/ghost/track?from=2024-05-01T08:00:00Z&to=2024-05-01T09:00:00Z", nil))
+    if ids := notFoundIDs(t, w); len(ids) != 1 || ids[0] != "ghost" {
+        t.Errorf("device_ids = %v, want [ghost]", ids)
+    }
+}
@@ -0,0 +1,145 @@
+// units.go applies the client's unit preference (metric/imperial) to vehicle
+// responses, from ?units= or the units stored in VehiclePreferences.vue.
+// Only REST responses are converted: WebSocket and SSE broadcasts are shared
+// by every client and stay in the units OneStepGPS sends.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// unitsMetadataKey is the preference metadata key holding a vehicle's
+// stored unit system, "metric" or "imperial"
+const unitsMetadataKey = "units"
+
+// unitsCacheTTL is how long a client's stored units are reused before being
+// read again. Preference writes through this instance invalidate them right
+// away, the TTL bounds staleness from writes elsewhere (other instances, the
+// daily cleanup).
+const unitsCacheTTL = 30 * time.Second
+
+// unitsCache holds each client's stored units, so /vehicles reads served
+// from the device cache don't query MySQL every time
+type unitsCache struct {
+    mu      sync.Mutex
+    clients map[string]cachedUnits
+}
+
+// cachedUnits is one client's stored units, nil when it has none
+type cachedUnits struct {
+    stored   map[string]string
+    loadedAt time.Time
+}
+
+func newUnitsCache() *unitsCache {
+    return &unitsCache{clients: make(map[string]cachedUnits)}
+}
+
+// get returns the client's stored units if loaded within unitsCacheTTL
+func (c *unitsCache) get(clientID string) (map[string]string, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    entry, ok := c.clients[clientID]
+    if !ok || time.Since(entry.loadedAt) >= unitsCacheTTL {
+        return nil, false
+    }
+    return entry.stored, true
+}
+
+func (c *unitsCache) put(clientID string, stored map[string]string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.clients[clientID] = cachedUnits{stored: stored, loadedAt: time.Now()}
+}
+
+// invalidate drops the client's cached units after a preference write,
+// every client's when clientID is empty
+func (c *unitsCache) invalidate(clientID string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if clientID == "" {
+        c.clients = make(map[string]cachedUnits)
+        return
+    }
+    delete(c.clients, clientID)
+}
+
+// vehicleUnits is the unit system each vehicle in a response is shown in
+type vehicleUnits struct {
+    system string            // From ?units=, applies to every vehicle
+    stored map[string]string // Device id -> stored units, used when system is empty
+}
+
+// preferenceBased reports whether the units come from stored preferences
+func (u vehicleUnits) preferenceBased() bool {
+    return u.system == "" && len(u.stored) > 0
+}
+
+// resolveUnits reads ?units=metric|imperial. Without the parameter each
+// vehicle uses the units stored in its preference metadata, and vehicles
+// without one keep upstream units. If stored units can't be read the
+// response keeps upstream units rather than failing.
+func (h *Handler) resolveUnits(r *http.Request) (vehicleUnits, error) {
+    system := r.URL.Query().Get("units")
+    if system != "" {
+        if !models.ValidUnits(system) {
+            return vehicleUnits{}, newAppError(http.StatusBadRequest, "invalid_units",
+                fmt.Sprintf("invalid units %q: must be metric or imperial", system), nil)
+        }
+        return vehicleUnits{system: system}, nil
+    }
+
+    clientID := resolveClientID(r)
+    if stored, ok := h.units.get(clientID); ok {
+        return vehicleUnits{stored: stored}, nil
+    }
+    stored, err := h.storedUnits(r.Context(), clientID)
+    if err != nil {
+        fmt.Printf("Error reading stored units for %s, keeping upstream units: %v\n", clientID, err)
+        return vehicleUnits{}, nil
+    }
+    h.units.put(clientID, stored)
+    return vehicleUnits{stored: stored}, nil
+}
+
+// storedUnits returns the client's stored unit system per device.
+// Values other than metric or imperial are ignored.
+func (h *Handler) storedUnits(ctx context.Context, clientID string) (map[string]string, error) {
+    prefs, err := h.preferencesFor(ctx, clientID)
+    if err != nil {
+        return nil, fmt.Errorf("error fetching preferences: %w", err)
+    }
+
+    var stored map[string]string
+    for _, pref := range prefs {
+        system, _ := pref.Metadata[unitsMetadataKey].(string)
+        if !models.ValidUnits(system) {
+            continue
+        }
+        if stored == nil {
+            stored = make(map[string]string)
+        }
+        stored[pref.DeviceID] = system
+    }
+    return stored, nil
+}
+
+// apply converts speed and distance measurements in place
+func (u vehicleUnits) apply(vehicles []models.Vehicle) {
+    for i := range vehicles {
+        system := u.system
+        if system == "" {
+            system = u.stored[vehicles[i].DeviceID]
+        }
+        if system != "" {
+            vehicles[i] = vehicles[i].WithUnits(system)
+        }
+    }
+}
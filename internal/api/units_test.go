@@ -0,0 +1,171 @@
+// units_test.go covers ?units= and stored unit preferences on /vehicles.
+
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/database"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// twoImperialDevices is an upstream reply with two devices reporting in mph and miles
+const twoImperialDevices = `{"result_list":[
+    {"device_id":"dev1","display_name":"Truck 1",
+     "latest_device_point":{"lat":1,"lng":1,"speed":50,"device_point_detail":{"speed":{"value":50,"unit":"mph","display":"50 mph"}}},
+     "device_state":{"drive_status":"driving","drive_status_distance":{"value":10,"unit":"mi","display":"10 mi"}}},
+    {"device_id":"dev2","display_name":"Truck 2",
+     "latest_device_point":{"lat":2,"lng":2,"speed":30,"device_point_detail":{"speed":{"value":30,"unit":"mph","display":"30 mph"}}},
+     "device_state":{"drive_status":"driving","drive_status_distance":{"value":5,"unit":"mi","display":"5 mi"}}}
+]}`
+
+// unitsHandler returns a mux whose upstream serves twoImperialDevices
+func unitsHandler(t *testing.T) (*Handler, *http.ServeMux) {
+    return newTestHandler(t, HandlerConfig{}, func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(twoImperialDevices))
+    })
+}
+
+// speedDisplays requests target and returns each device's detail speed and
+// distance display strings
+func speedDisplays(t *testing.T, mux http.Handler, target string) map[string][2]string {
+    t.Helper()
+    w := serve(mux, httptest.NewRequest(http.MethodGet, target, nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("%s: got %d: %s", target, w.Code, w.Body)
+    }
+    var vehicles []models.Vehicle
+    if err := json.Unmarshal(w.Body.Bytes(), &vehicles); err != nil {
+        t.Fatal(err)
+    }
+    displays := make(map[string][2]string, len(vehicles))
+    for _, v := range vehicles {
+        displays[v.DeviceID] = [2]string{v.LastLocation.Detail.Speed.Display, v.DriveState.Distance.Display}
+    }
+    return displays
+}
+
+func TestVehiclesUnits(t *testing.T) {
+    _, mux := unitsHandler(t)
+
+    tests := []struct {
+        target string
+        want   map[string][2]string
+    }{
+        {"/api/vehicles", map[string][2]string{"dev1": {"50 mph", "10 mi"}, "dev2": {"30 mph", "5 mi"}}},
+        {"/api/vehicles?units=metric", map[string][2]string{"dev1": {"80.5 km/h", "16.1 km"}, "dev2": {"48.3 km/h", "8.0 km"}}},
+        {"/api/vehicles?units=imperial", map[string][2]string{"dev1": {"50 mph", "10 mi"}, "dev2": {"30 mph", "5 mi"}}},
+    }
+    for _, tt := range tests {
+        got := speedDisplays(t, mux, tt.target)
+        for id, want := range tt.want {
+            if got[id] != want {
+                t.Errorf("%s %s: got %v, want %v", tt.target, id, got[id], want)
+            }
+        }
+    }
+}
+
+func TestVehiclesStoredUnits(t *testing.T) {
+    _, mux := unitsHandler(t)
+    setPreferences(t, []models.UserPreference{
+        {DeviceID: "dev1", ClientID: defaultClientID, Metadata: map[string]interface{}{"units": "metric"}},
+        {DeviceID: "dev2", ClientID: defaultClientID, Metadata: map[string]interface{}{"units": "bogus"}},
+        {DeviceID: "dev2", ClientID: "other", Metadata: map[string]interface{}{"units": "metric"}},
+    })
+
+    got := speedDisplays(t, mux, "/api/vehicles")
+    if want := [2]string{"80.5 km/h", "16.1 km"}; got["dev1"] != want {
+        t.Errorf("dev1 with stored metric: got %v, want %v", got["dev1"], want)
+    }
+    if want := [2]string{"30 mph", "5 mi"}; got["dev2"] != want {
+        t.Errorf("dev2 without valid stored units: got %v, want %v", got["dev2"], want)
+    }
+
+    // ?units= overrides the stored preference
+    got = speedDisplays(t, mux, "/api/vehicles?units=imperial")
+    if want := [2]string{"50 mph", "10 mi"}; got["dev1"] != want {
+        t.Errorf("dev1 with ?units=imperial: got %v, want %v", got["dev1"], want)
+    }
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles/dev1", nil))
+    var v models.Vehicle
+    if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+        t.Fatal(err)
+    }
+    if got := v.LastLocation.Detail.Speed.Display; got != "80.5 km/h" {
+        t.Errorf("single vehicle with stored metric: got %q, want 80.5 km/h", got)
+    }
+}
+
+func TestVehiclesInvalidUnits(t *testing.T) {
+    _, mux := unitsHandler(t)
+
+    for _, target := range []string{"/api/vehicles?units=nautical", "/api/vehicles/dev1?units=nautical"} {
+        w := serve(mux, httptest.NewRequest(http.MethodGet, target, nil))
+        if w.Code != http.StatusBadRequest {
+            t.Fatalf("%s: got %d, want 400", target, w.Code)
+        }
+        var body appErrorResponse
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+            t.Fatal(err)
+        }
+        if body.Error != "invalid_units" {
+            t.Errorf("%s: error = %q, want invalid_units", target, body.Error)
+        }
+    }
+}
+
+func TestStoredUnitsCached(t *testing.T) {
+    _, mux := unitsHandler(t)
+    setPreferences(t, []models.UserPreference{
+        {DeviceID: "dev1", ClientID: defaultClientID, Metadata: map[string]interface{}{"units": "metric"}},
+    })
+
+    for i := 0; i < 3; i++ {
+        speedDisplays(t, mux, "/api/vehicles")
+    }
+    if n := preferenceQueries(t); n != 1 {
+        t.Fatalf("3 requests read preferences %d times, want 1", n)
+    }
+
+    // ?units= doesn't need stored units at all
+    speedDisplays(t, mux, "/api/vehicles?units=imperial")
+    if n := preferenceQueries(t); n != 1 {
+        t.Errorf("?units= read preferences, %d reads", n)
+    }
+
+    // Deleting the preference through the API drops the cached units
+    w := serve(mux, httptest.NewRequest(http.MethodDelete, "/api/preferences/dev1", nil))
+    if w.Code != http.StatusNoContent {
+        t.Fatalf("delete: got %d: %s", w.Code, w.Body)
+    }
+    got := speedDisplays(t, mux, "/api/vehicles")
+    if want := [2]string{"50 mph", "10 mi"}; got["dev1"] != want {
+        t.Errorf("after delete: got %v, want upstream %v", got["dev1"], want)
+    }
+    if n := preferenceQueries(t); n != 2 {
+        t.Errorf("after delete: %d reads, want 2", n)
+    }
+}
+
+func TestStoredUnitsDatabaseDown(t *testing.T) {
+    h, mux := unitsHandler(t)
+    db, err := sql.Open("pingdb", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { db.Close() })
+    h.DB = &database.DB{DB: db} // Every query fails
+
+    got := speedDisplays(t, mux, "/api/vehicles")
+    if want := [2]string{"50 mph", "10 mi"}; got["dev1"] != want {
+        t.Errorf("got %v, want upstream %v", got["dev1"], want)
+    }
+}
@@ -0,0 +1,46 @@
+// vehicle_shape.go lets /vehicles return an object keyed by device_id with
+// ?shape=map, so HomeView.vue can look vehicles up without indexing the
+// array itself. The array stays the default.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// Supported ?shape= values
+const (
+    shapeArray = "array"
+    shapeMap   = "map"
+)
+
+// parseVehicleShape reads ?shape=, defaulting to shapeArray
+func parseVehicleShape(r *http.Request) (string, error) {
+    switch shape := r.URL.Query().Get("shape"); shape {
+    case "", shapeArray:
+        return shapeArray, nil
+    case shapeMap:
+        return shapeMap, nil
+    default:
+        return "", newAppError(http.StatusBadRequest, "invalid_shape", fmt.Sprintf("invalid shape %q, must be %s or %s", shape, shapeArray, shapeMap), nil)
+    }
+}
+
+// vehiclesByID keys item(i) by vehicles[i].DeviceID, item returning the
+// full vehicle or its ?fields= projection. Upstream shouldn't repeat ids,
+// but if it does the first occurrence wins so the result matches the
+// first match in the array shape.
+func vehiclesByID(vehicles []models.Vehicle, item func(i int) interface{}) map[string]interface{} {
+    byID := make(map[string]interface{}, len(vehicles))
+    for i, v := range vehicles {
+        if _, dup := byID[v.DeviceID]; dup {
+            fmt.Printf("Duplicate device id %s in vehicle list, keeping the first\n", v.DeviceID)
+            continue
+        }
+        byID[v.DeviceID] = item(i)
+    }
+    return byID
+}
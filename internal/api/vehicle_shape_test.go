@@ -0,0 +1,93 @@
+// vehicle_shape_test.go covers /vehicles as an array or, with ?shape=map, keyed by device_id.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// duplicateDevices repeats dev1, as a misbehaving upstream might
+const duplicateDevices = `{"result_list":[
+    {"device_id":"dev1","display_name":"First"},
+    {"device_id":"dev2","display_name":"Van"},
+    {"device_id":"dev1","display_name":"Second"}
+]}`
+
+// namedVehicle is the part of a vehicle these tests check
+type namedVehicle struct {
+    DeviceID    string `json:"device_id"`
+    DisplayName string `json:"display_name"`
+}
+
+func TestVehiclesShapeArray(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(duplicateDevices))
+
+    // The default and ?shape=array are the same list, duplicates included
+    for _, target := range []string{"/api/vehicles", "/api/vehicles?shape=array"} {
+        w := serve(mux, httptest.NewRequest(http.MethodGet, target, nil))
+        if w.Code != http.StatusOK {
+            t.Fatalf("%s: status = %d: %s", target, w.Code, w.Body)
+        }
+        var vehicles []namedVehicle
+        if err := json.Unmarshal(w.Body.Bytes(), &vehicles); err != nil {
+            t.Fatalf("%s: decoding %q: %v", target, w.Body, err)
+        }
+        if len(vehicles) != 3 {
+            t.Errorf("%s: got %d vehicles, want 3", target, len(vehicles))
+        }
+    }
+}
+
+func TestVehiclesShapeMap(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(duplicateDevices))
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles?shape=map", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d: %s", w.Code, w.Body)
+    }
+    var byID map[string]namedVehicle
+    if err := json.Unmarshal(w.Body.Bytes(), &byID); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    // The first dev1 wins, matching the first match in the array
+    want := map[string]namedVehicle{
+        "dev1": {"dev1", "First"},
+        "dev2": {"dev2", "Van"},
+    }
+    if !reflect.DeepEqual(byID, want) {
+        t.Errorf("vehicles = %+v, want %+v", byID, want)
+    }
+
+    // ?fields= projects each entry
+    w = serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles?shape=map&fields=device_id", nil))
+    var projected map[string]map[string]interface{}
+    if err := json.Unmarshal(w.Body.Bytes(), &projected); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    if len(projected) != 2 || !reflect.DeepEqual(projected["dev2"], map[string]interface{}{"device_id": "dev2"}) {
+        t.Errorf("projected = %v", projected)
+    }
+}
+
+func TestVehiclesShapeRejected(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, devicesReply(oneDevice))
+
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/vehicles?shape=list", nil))
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+    }
+    if body := errorBody(t, w); body.Error != "invalid_shape" {
+        t.Errorf("error = %q, want invalid_shape", body.Error)
+    }
+
+    // A map only makes sense as JSON
+    r := httptest.NewRequest(http.MethodGet, "/api/vehicles?shape=map", nil)
+    r.Header.Set("Accept", "text/csv")
+    if w := serve(mux, r); w.Code != http.StatusNotAcceptable {
+        t.Errorf("CSV map: status = %d, want 406", w.Code)
+    }
+}
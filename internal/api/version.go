@@ -0,0 +1,18 @@
+// version.go exposes build metadata so operators can confirm which build is running.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/version"
+)
+
+// VersionHandler handles GET /version, returning the version, commit and
+// build time injected at link time ("dev" for local builds)
+func (h *Handler) VersionHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    json.NewEncoder(w).Encode(version.Get())
+}
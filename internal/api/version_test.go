@@ -0,0 +1,50 @@
+// version_test.go covers GET /api/version.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/version"
+)
+
+// getVersion GETs /api/version and decodes the body
+func getVersion(t *testing.T, mux http.Handler) version.Info {
+    t.Helper()
+    w := serve(mux, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d: %s", w.Code, w.Body)
+    }
+    if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+        t.Errorf("Cache-Control = %q, want no-store", cc)
+    }
+    var info version.Info
+    if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    return info
+}
+
+func TestVersionDefaultsToDev(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+
+    info := getVersion(t, mux)
+    if info.Version != "dev" || info.Commit != "dev" || info.BuildTime != "dev" || info.GoVersion == "" {
+        t.Errorf("version = %+v, want dev values for a test build", info)
+    }
+}
+
+func TestVersionReturnsInjectedValues(t *testing.T) {
+    // As set by -ldflags -X at link time
+    version.Version, version.Commit, version.BuildTime = "v1.2.0", "abc1234", "2024-05-01T12:00:00Z"
+    t.Cleanup(func() { version.Version, version.Commit, version.BuildTime = "dev", "dev", "dev" })
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+
+    info := getVersion(t, mux)
+    if info.Version != "v1.2.0" || info.Commit != "abc1234" || info.BuildTime != "2024-05-01T12:00:00Z" {
+        t.Errorf("version = %+v, want the injected values", info)
+    }
+}
@@ -0,0 +1,75 @@
+// webhooks.go handles push updates sent by OneStepGPS as an alternative to polling.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+const (
+    // webhookSignatureHeader carries the hex HMAC of the raw body, either
+    // "<algorithm>=<hex>" or timestamped as "t=<unix>,v1=<hex>"
+    webhookSignatureHeader = "X-OneStepGPS-Signature"
+    maxWebhookBodyBytes    = 5 << 20 // 5 MB, large fleets push every device at once
+)
+
+// OneStepGPSWebhookHandler handles POST /api/webhooks/onestepgps.
+// Validates the shared-secret signature (see webhook.Verifier), parses the pushed device events and
+// feeds them into the hub so connected clients receive them like a poll result.
+func (h *Handler) OneStepGPSWebhookHandler(w http.ResponseWriter, r *http.Request) {
+    if h.config.WebhookSecret == "" {
+        http.NotFound(w, r)
+        return
+    }
+
+    body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+    if err != nil {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_body", "Error reading request body", err))
+        return
+    }
+
+    // Reject anything not signed with our shared secret
+    if err := h.config.WebhookVerifier.VerifyHMAC(h.config.WebhookSecret, body, r.Header.Get(webhookSignatureHeader)); err != nil {
+        fmt.Printf("Rejected webhook: %v\n", err)
+        respondError(w, newAppError(http.StatusUnauthorized, "invalid_signature", "Invalid signature", err))
+        return
+    }
+
+    vehicles, err := parseWebhookVehicles(body)
+    if err != nil {
+        respondError(w, newAppError(http.StatusBadRequest, "invalid_payload", fmt.Sprintf("Invalid webhook payload: %v", err), err))
+        return
+    }
+
+    fmt.Printf("Received webhook with %d device updates\n", len(vehicles))
+    h.GPSClient.ApplyNameOverrides(vehicles)
+    h.GPSClient.ApplyFixPolicy(vehicles)
+    h.Hub.IngestVehicles(vehicles)
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// parseWebhookVehicles accepts either the device list envelope used by
+// GET /device ({"result_list": [...]}) or a bare array of devices.
+func parseWebhookVehicles(body []byte) ([]models.Vehicle, error) {
+    trimmed := strings.TrimSpace(string(body))
+    if strings.HasPrefix(trimmed, "[") {
+        var devices []models.APIDevice
+        if err := json.Unmarshal(body, &devices); err != nil {
+            return nil, err
+        }
+        return models.VehiclesFromAPI(devices), nil
+    }
+
+    var apiResp models.APIResponse
+    if err := json.Unmarshal(body, &apiResp); err != nil {
+        return nil, err
+    }
+    return apiResp.Vehicles(), nil
+}
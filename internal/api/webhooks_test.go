@@ -0,0 +1,101 @@
+// webhooks_test.go covers signed OneStepGPS webhook ingestion.
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+// webhookPayload pushes one device in the GET /device envelope
+const webhookPayload = `{"result_list":[{"device_id":"dev-1","display_name":"Truck","latest_device_point":{"lat":40.1,"lng":-105.2}}]}`
+
+// signWebhook returns the X-OneStepGPS-Signature value for body
+func signWebhook(secret, body string) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(body))
+    return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(mux http.Handler, body, signature string) *httptest.ResponseRecorder {
+    r := httptest.NewRequest(http.MethodPost, "/api/webhooks/onestepgps", strings.NewReader(body))
+    if signature != "" {
+        r.Header.Set(webhookSignatureHeader, signature)
+    }
+    return serve(mux, r)
+}
+
+func TestWebhookValidSignature(t *testing.T) {
+    h, mux := newTestHandler(t, HandlerConfig{WebhookSecret: testWebhookSecret}, nil)
+
+    w := postWebhook(mux, webhookPayload, signWebhook(testWebhookSecret, webhookPayload))
+    if w.Code != http.StatusNoContent {
+        t.Fatalf("status = %d, want 204: %s", w.Code, w.Body)
+    }
+
+    // The pushed devices go out on the hub's broadcast path like a poll result
+    select {
+    case vehicles := <-h.Hub.Broadcast:
+        if len(vehicles) != 1 || vehicles[0].DeviceID != "dev-1" || vehicles[0].DisplayName != "Truck" {
+            t.Errorf("broadcast = %+v, want dev-1", vehicles)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("webhook was not broadcast")
+    }
+}
+
+func TestWebhookRejectsBadSignatures(t *testing.T) {
+    tampered := strings.Replace(webhookPayload, "40.1", "41.1", 1)
+    tests := []struct {
+        name      string
+        body      string
+        signature string
+    }{
+        {"tampered body", tampered, signWebhook(testWebhookSecret, webhookPayload)},
+        {"wrong secret", webhookPayload, signWebhook("other-secret", webhookPayload)},
+        {"missing signature", webhookPayload, ""},
+        {"malformed signature", webhookPayload, "sha256=not-hex"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h, mux := newTestHandler(t, HandlerConfig{WebhookSecret: testWebhookSecret}, nil)
+
+            w := postWebhook(mux, tt.body, tt.signature)
+            if w.Code != http.StatusUnauthorized {
+                t.Fatalf("status = %d, want 401: %s", w.Code, w.Body)
+            }
+            select {
+            case vehicles := <-h.Hub.Broadcast:
+                t.Errorf("rejected webhook was broadcast: %+v", vehicles)
+            default:
+            }
+        })
+    }
+}
+
+func TestWebhookDisabledWithoutSecret(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{}, nil)
+
+    w := postWebhook(mux, webhookPayload, signWebhook("", webhookPayload))
+    if w.Code != http.StatusNotFound {
+        t.Errorf("status = %d, want 404", w.Code)
+    }
+}
+
+func TestWebhookInvalidPayload(t *testing.T) {
+    _, mux := newTestHandler(t, HandlerConfig{WebhookSecret: testWebhookSecret}, nil)
+
+    body := `{"result_list":`
+    w := postWebhook(mux, body, signWebhook(testWebhookSecret, body))
+    if w.Code != http.StatusBadRequest {
+        t.Errorf("status = %d, want 400", w.Code)
+    }
+}
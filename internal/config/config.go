@@ -4,9 +4,12 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all application configuration settings
@@ -14,6 +17,9 @@ type Config struct {
     DBConfig    DatabaseConfig    // Database connection settings
     APIConfig   APIConfig         // API and server settings
     WebSocket   WebSocketConfig   // WebSocket connection settings
+    Webhook     WebhookConfig     // OneStepGPS webhook ingestion settings
+    Notifier    NotifierConfig    // Report completion notification settings
+    TLS         TLSConfig         // Direct TLS termination, see tls.go
 }
 
 // DatabaseConfig holds MySQL database connection settings
@@ -31,6 +37,39 @@ type APIConfig struct {
     ReadTimeout     int         // Timeout for reading requests
     WriteTimeout    int         // Timeout for writing responses
     GPSApiKey       string      // OneStepGPS API authentication key
+    GPSBaseURL      string      // OneStepGPS API root for the account's region/tenant
+    AdminAPIKey     string      // Bearer token for /api/admin endpoints, disabled when empty
+    MaintenanceMode bool        // Start with write endpoints returning 503
+    ReportOutputFields []string // Report output fields supported by this OneStepGPS account, defaults when empty
+    DebugEndpoints  bool        // Expose /api/debug endpoints (admin auth still required)
+    MaxConcurrentReports int    // Report generations running at once
+    ReportQueueTimeout int      // Seconds a report waits for a free slot before 429
+    ReportFileTypes []string    // Report export types this account may download, e.g. pdf,xlsx
+    DeviceNameOverrides map[string]string // device_id -> display name from DEVICE_NAME_OVERRIDES file
+    ForceHTTPS      bool        // Redirect HTTP to HTTPS and send HSTS, for production behind a proxy
+    HSTSMaxAge      int         // Strict-Transport-Security max-age in seconds
+    DefaultPageSize int         // Page size for paginated endpoints when ?limit= is absent
+    MaxPageSize     int         // Largest ?limit= honored, larger values are clamped
+    TenantBaseDomain string     // e.g. fleet.example.com, subdomains map to tenants when set
+    Tenants         map[string]string // Subdomain -> client_id, from TENANTS="acme=client1,..."
+    UniqueDisplayNames bool     // Reject preference writes that reuse a display_name within a client
+    ReadyzStalePolls int        // /readyz fails once the last successful poll is this many intervals old, 0 disables
+    CORSAllowCredentials bool   // Send Access-Control-Allow-Credentials: true to allowed origins
+    CORSMaxAge      int         // Seconds browsers may cache a preflight, 0 omits Access-Control-Max-Age
+    RequestTimeout  int         // Default seconds a request may take, 0 for no limit
+    RouteTimeouts   map[string]time.Duration // Per-path overrides of RequestTimeout, from ROUTE_TIMEOUTS="/api/report/generate=5m,..."
+    InvalidFixMode  string      // "flag" (has_fix:false) or "drop" for positions at 0,0 or out of range
+    MetadataFilterKeys []string // Preference metadata keys /vehicles can filter on with ?meta.<key>=
+    StrictQueryParams bool      // Reject unrecognized query params with 400 on routes that list theirs
+    UpstreamMaxIdleConns int    // Idle connections kept to OneStepGPS across hosts
+    UpstreamMaxIdleConnsPerHost int // Idle connections kept to the OneStepGPS host
+    UpstreamIdleConnTimeout int // Seconds an idle OneStepGPS connection stays open
+    UpstreamKeepAlive int       // Seconds between TCP keep-alive probes, negative disables
+    UnpreferencedVisibility string // "visible" or "hidden" for devices without a stored preference
+    UnpreferencedOrder string   // "last" or "first", where devices without a preference sort
+    RateLimitPerMinute int      // Requests allowed per client address per minute, 0 disables
+    RateLimitBurst  int         // Requests a client address may make at once, RateLimitPerMinute when 0
+    TrustedProxyHops int        // Proxies in front appending to X-Forwarded-For, 1 behind the Elastic Beanstalk load balancer
 }
 
 // WebSocketConfig holds WebSocket server settings
@@ -39,6 +78,42 @@ type WebSocketConfig struct {
     ReadBufferSize  int         // Size of read buffer for WebSocket connections
     WriteBufferSize int         // Size of write buffer for WebSocket connections
     AllowedOrigins  []string    // Origins allowed to connect via WebSocket
+    PingInterval    int         // Seconds between server pings, must be shorter than PongWait
+    PongWait        int         // Seconds to wait for a pong (or any message) before dropping a client
+    WriteWait       int         // Seconds allowed to write a single message
+    MaxMessageSize  int64       // Max size in bytes of a message read from a client
+    MaxClients      int         // Max concurrent connections, 0 for unlimited
+    AdmitGraceMs    int         // Milliseconds a connection waits for a free slot when full before rejection (close code 4001 on /ws, 503 on SSE), 0 rejects at once
+    BatchWindowMs   int         // Milliseconds to coalesce bursts of updates into one broadcast, 0 disables
+    SnapshotDir     string      // Directory for hourly NDJSON snapshot files, disabled when empty
+    WriteWorkers    int         // Clients written to concurrently per broadcast, 1 writes sequentially
+    SingleSession   bool        // Keep one connection per client id, closing the older one on reconnect
+    SendBuffer      int         // Broadcasts queued per client before new ones are dropped, 0 writes synchronously
+    BroadcastBuffer int         // Snapshots queued for the broadcast loop, oldest dropped when full, see Hub.publish
+    SendOverflow    string      // What a full send buffer does: drop-newest, drop-oldest or disconnect
+}
+
+// WebhookConfig holds settings for OneStepGPS push updates
+// Used by api/webhooks.go and main.go to decide whether to keep polling
+type WebhookConfig struct {
+    Secret          string      // Shared secret for signature validation, webhooks disabled when empty
+    DisablePolling  bool        // Stop polling OneStepGPS when webhooks deliver updates
+    Algorithm       string      // HMAC algorithm for signatures (sha256, sha1, sha512)
+    Tolerance       int         // Max age in seconds of timestamped signatures, 0 disables the check
+}
+
+// NotifierConfig selects how users are told a report finished
+// Used by notify.New in main.go
+type NotifierConfig struct {
+    Type            string      // "noop" (default), "webhook" or "smtp"
+    PublicBaseURL   string      // Prefix for report links, links are relative when empty
+    WebhookURL      string      // Target for the webhook notifier
+    SMTPHost        string
+    SMTPPort        int
+    SMTPUsername    string
+    SMTPPassword    string
+    SMTPFrom        string
+    SMTPTo          []string    // Recipients for the smtp notifier
 }
 
 // LoadConfig loads all configuration from environment variables
@@ -66,10 +141,154 @@ func LoadConfig() (*Config, error) {
         return nil, fmt.Errorf("GPS_API_KEY environment variable is not set")
     }
 
+    // Accounts outside the default region use a different API root
+    gpsBaseURL := getEnvStr("GPS_BASE_URL", "https://track.onestepgps.com/v3/api/public")
+
+    // Admin endpoints stay disabled unless a key is configured
+    adminApiKey := getEnvStr("ADMIN_API_KEY", "")
+    maintenanceMode := getEnvBool("MAINTENANCE_MODE", false)
+    debugEndpoints := getEnvBool("DEBUG_ENDPOINTS", false)
+    maxConcurrentReports := getEnvInt("REPORT_MAX_CONCURRENT", 4)
+    reportQueueTimeout := getEnvInt("REPORT_QUEUE_TIMEOUT", 10)
+    reportFileTypes := getEnvSlice("REPORT_FILE_TYPES", []string{"pdf"})
+    forceHTTPS := getEnvBool("FORCE_HTTPS", false)
+    uniqueDisplayNames := getEnvBool("UNIQUE_DISPLAY_NAMES", false)
+    metadataFilterKeys := getEnvSlice("METADATA_FILTER_KEYS", []string{"color", "icon", "group"})
+    strictQueryParams := getEnvBool("STRICT_QUERY_PARAMS", false)
+
+    // Per-address request limit, off unless RATE_LIMIT_PER_MINUTE is set
+    rateLimitPerMinute := getEnvInt("RATE_LIMIT_PER_MINUTE", 0)
+    rateLimitBurst := getEnvInt("RATE_LIMIT_BURST", 0)
+    if rateLimitPerMinute < 0 || rateLimitBurst < 0 {
+        return nil, fmt.Errorf("RATE_LIMIT_PER_MINUTE and RATE_LIMIT_BURST must not be negative")
+    }
+    // Without trusted proxies the limit keys on the connection's address
+    trustedProxyHops := getEnvInt("TRUSTED_PROXY_HOPS", 0)
+    if trustedProxyHops < 0 {
+        return nil, fmt.Errorf("TRUSTED_PROXY_HOPS must not be negative")
+    }
+
+    // Connection pooling for OneStepGPS requests, see onestepgps/transport.go
+    upstreamMaxIdleConns := getEnvInt("UPSTREAM_MAX_IDLE_CONNS", 100)
+    upstreamMaxIdleConnsPerHost := getEnvInt("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 10)
+    upstreamIdleConnTimeout := getEnvInt("UPSTREAM_IDLE_CONN_TIMEOUT", 90)
+    upstreamKeepAlive := getEnvInt("UPSTREAM_KEEP_ALIVE", 30)
+    if upstreamMaxIdleConns < 0 || upstreamMaxIdleConnsPerHost < 0 || upstreamIdleConnTimeout < 0 {
+        return nil, fmt.Errorf("UPSTREAM_MAX_IDLE_CONNS, UPSTREAM_MAX_IDLE_CONNS_PER_HOST and UPSTREAM_IDLE_CONN_TIMEOUT must not be negative")
+    }
+    invalidFixMode := strings.ToLower(getEnvStr("INVALID_FIX_MODE", "flag"))
+    if invalidFixMode != "flag" && invalidFixMode != "drop" {
+        return nil, fmt.Errorf("INVALID_FIX_MODE must be flag or drop, got %q", invalidFixMode)
+    }
+    // Defaults for devices the client has no preference row for, e.g. newly added ones
+    unpreferencedVisibility := strings.ToLower(getEnvStr("UNPREFERENCED_VISIBILITY", "visible"))
+    if unpreferencedVisibility != "visible" && unpreferencedVisibility != "hidden" {
+        return nil, fmt.Errorf("UNPREFERENCED_VISIBILITY must be visible or hidden, got %q", unpreferencedVisibility)
+    }
+    unpreferencedOrder := strings.ToLower(getEnvStr("UNPREFERENCED_ORDER", "last"))
+    if unpreferencedOrder != "last" && unpreferencedOrder != "first" {
+        return nil, fmt.Errorf("UNPREFERENCED_ORDER must be last or first, got %q", unpreferencedOrder)
+    }
+    readyzStalePolls := getEnvInt("READYZ_STALE_POLLS", 6)
+    corsAllowCredentials := getEnvBool("CORS_ALLOW_CREDENTIALS", true)
+    corsMaxAge := getEnvInt("CORS_MAX_AGE", 600)
+    hstsMaxAge := getEnvInt("HSTS_MAX_AGE", 31536000) // One year
+    defaultPageSize := getEnvInt("PAGE_SIZE_DEFAULT", 50)
+    maxPageSize := getEnvInt("PAGE_SIZE_MAX", 500)
+
+    // Per-endpoint timeouts, e.g. quick preferences vs long report generation
+    requestTimeout := getEnvInt("REQUEST_TIMEOUT", 0)
+    if requestTimeout < 0 {
+        return nil, fmt.Errorf("REQUEST_TIMEOUT must not be negative, got %d", requestTimeout)
+    }
+    routeTimeouts, err := getEnvDurationMap("ROUTE_TIMEOUTS")
+    if err != nil {
+        return nil, err
+    }
+
+    // Multi-tenant hosting maps subdomains of TENANT_BASE_DOMAIN to client ids
+    tenantBaseDomain := getEnvStr("TENANT_BASE_DOMAIN", "")
+    tenants, err := getEnvMap("TENANTS")
+    if err != nil {
+        return nil, err
+    }
+    if tenantBaseDomain != "" && len(tenants) == 0 {
+        return nil, fmt.Errorf("TENANTS must be set when TENANT_BASE_DOMAIN is configured")
+    }
+
+    // Report output fields can come from a comma separated env var or a JSON file
+    reportFields := getEnvSlice("REPORT_OUTPUT_FIELDS", nil)
+    if path := getEnvStr("REPORT_OUTPUT_FIELDS_FILE", ""); path != "" {
+        fileFields, err := loadStringListFile(path)
+        if err != nil {
+            return nil, fmt.Errorf("error loading REPORT_OUTPUT_FIELDS_FILE: %w", err)
+        }
+        reportFields = fileFields
+    }
+
+    // Static display names for deployments without the preferences UI
+    var nameOverrides map[string]string
+    if path := getEnvStr("DEVICE_NAME_OVERRIDES", ""); path != "" {
+        overrides, err := loadStringMapFile(path)
+        if err != nil {
+            return nil, fmt.Errorf("error loading DEVICE_NAME_OVERRIDES: %w", err)
+        }
+        nameOverrides = overrides
+    }
+
     // Load WebSocket settings with defaults
     wsReadBuffer := getEnvInt("WS_READ_BUFFER", 1024)
     wsWriteBuffer := getEnvInt("WS_WRITE_BUFFER", 1024)
     wsOrigins := getEnvSlice("WS_ALLOWED_ORIGINS", []string{"http://localhost:5173"})
+    wsPingInterval := getEnvInt("WS_PING_INTERVAL", 54)
+    wsPongWait := getEnvInt("WS_PONG_WAIT", 60)
+    wsWriteWait := getEnvInt("WS_WRITE_WAIT", 10)
+    wsMaxMessageSize := getEnvInt("WS_MAX_MESSAGE_SIZE", 4096)
+    wsMaxClients := getEnvInt("WS_MAX_CLIENTS", 0)
+    wsAdmitGrace := getEnvInt("WS_ADMIT_GRACE_MS", 0)
+    wsBatchWindow := getEnvInt("WS_BATCH_WINDOW_MS", 0)
+    snapshotDir := getEnvStr("SNAPSHOT_DIR", "")
+    wsWriteWorkers := getEnvInt("WS_WRITE_WORKERS", 16)
+    wsSingleSession := getEnvBool("WS_SINGLE_SESSION", false)
+    wsSendBuffer := getEnvInt("WS_SEND_BUFFER", 0)
+    wsBroadcastBuffer := getEnvInt("WS_BROADCAST_BUFFER", 1)
+    wsSendOverflow := getEnvStr("WS_SEND_OVERFLOW", "drop-newest")
+    if wsPingInterval >= wsPongWait {
+        return nil, fmt.Errorf("WS_PING_INTERVAL (%d) must be less than WS_PONG_WAIT (%d)", wsPingInterval, wsPongWait)
+    }
+    if wsBroadcastBuffer < 1 {
+        return nil, fmt.Errorf("WS_BROADCAST_BUFFER (%d) must be at least 1", wsBroadcastBuffer)
+    }
+
+    // Load webhook settings, polling stays on unless explicitly disabled
+    webhookSecret := getEnvStr("WEBHOOK_SECRET", "")
+    webhookDisablePolling := getEnvBool("WEBHOOK_DISABLE_POLLING", false)
+    webhookAlgorithm := getEnvStr("WEBHOOK_SIGNATURE_ALGORITHM", "sha256")
+    webhookTolerance := getEnvInt("WEBHOOK_SIGNATURE_TOLERANCE", 300)
+
+    // Load report notification settings, disabled by default
+    notifier := NotifierConfig{
+        Type:          getEnvStr("REPORT_NOTIFIER", "noop"),
+        PublicBaseURL: strings.TrimRight(getEnvStr("PUBLIC_BASE_URL", ""), "/"),
+        WebhookURL:    getEnvStr("REPORT_NOTIFY_WEBHOOK_URL", ""),
+        SMTPHost:      getEnvStr("SMTP_HOST", ""),
+        SMTPPort:      getEnvInt("SMTP_PORT", 587),
+        SMTPUsername:  getEnvStr("SMTP_USERNAME", ""),
+        SMTPPassword:  getEnvStr("SMTP_PASSWORD", ""),
+        SMTPFrom:      getEnvStr("SMTP_FROM", ""),
+        SMTPTo:        getEnvSlice("REPORT_NOTIFY_EMAIL_TO", nil),
+    }
+
+    // Serve TLS directly when a certificate is configured, otherwise plain
+    // HTTP behind a TLS-terminating proxy
+    tlsConfig := TLSConfig{
+        CertFile:   getEnvStr("TLS_CERT_FILE", ""),
+        KeyFile:    getEnvStr("TLS_KEY_FILE", ""),
+        MinVersion: getEnvStr("TLS_MIN_VERSION", "1.2"),
+    }
+    if err := tlsConfig.validate(); err != nil {
+        return nil, err
+    }
 
     // Construct and return complete config struct
     return &Config{
@@ -84,12 +303,66 @@ func LoadConfig() (*Config, error) {
             ReadTimeout:    readTimeout,
             WriteTimeout:   writeTimeout,
             GPSApiKey:      gpsApiKey,
+            GPSBaseURL:     gpsBaseURL,
+            AdminAPIKey:    adminApiKey,
+            MaintenanceMode: maintenanceMode,
+            ReportOutputFields: reportFields,
+            DebugEndpoints: debugEndpoints,
+            MaxConcurrentReports: maxConcurrentReports,
+            ReportQueueTimeout: reportQueueTimeout,
+            ReportFileTypes: reportFileTypes,
+            DeviceNameOverrides: nameOverrides,
+            ForceHTTPS:     forceHTTPS,
+            HSTSMaxAge:     hstsMaxAge,
+            DefaultPageSize: defaultPageSize,
+            MaxPageSize:    maxPageSize,
+            TenantBaseDomain: tenantBaseDomain,
+            Tenants:        tenants,
+            UniqueDisplayNames: uniqueDisplayNames,
+            ReadyzStalePolls: readyzStalePolls,
+            CORSAllowCredentials: corsAllowCredentials,
+            CORSMaxAge:     corsMaxAge,
+            RequestTimeout: requestTimeout,
+            RouteTimeouts:  routeTimeouts,
+            InvalidFixMode: invalidFixMode,
+            MetadataFilterKeys: metadataFilterKeys,
+            StrictQueryParams: strictQueryParams,
+            UpstreamMaxIdleConns: upstreamMaxIdleConns,
+            UpstreamMaxIdleConnsPerHost: upstreamMaxIdleConnsPerHost,
+            UpstreamIdleConnTimeout: upstreamIdleConnTimeout,
+            UpstreamKeepAlive: upstreamKeepAlive,
+            RateLimitPerMinute: rateLimitPerMinute,
+            RateLimitBurst: rateLimitBurst,
+            TrustedProxyHops: trustedProxyHops,
+            UnpreferencedVisibility: unpreferencedVisibility,
+            UnpreferencedOrder: unpreferencedOrder,
         },
         WebSocket: WebSocketConfig{
             ReadBufferSize:  wsReadBuffer,
             WriteBufferSize: wsWriteBuffer,
             AllowedOrigins:  wsOrigins,
+            PingInterval:    wsPingInterval,
+            PongWait:        wsPongWait,
+            WriteWait:       wsWriteWait,
+            MaxMessageSize:  int64(wsMaxMessageSize),
+            MaxClients:      wsMaxClients,
+            AdmitGraceMs:    wsAdmitGrace,
+            BatchWindowMs:   wsBatchWindow,
+            SnapshotDir:     snapshotDir,
+            WriteWorkers:    wsWriteWorkers,
+            SingleSession:   wsSingleSession,
+            SendBuffer:      wsSendBuffer,
+            BroadcastBuffer: wsBroadcastBuffer,
+            SendOverflow:    wsSendOverflow,
+        },
+        Webhook: WebhookConfig{
+            Secret:         webhookSecret,
+            DisablePolling: webhookSecret != "" && webhookDisablePolling,
+            Algorithm:      webhookAlgorithm,
+            Tolerance:      webhookTolerance,
         },
+        Notifier: notifier,
+        TLS:      tlsConfig,
     }, nil
 }
 
@@ -112,13 +385,94 @@ func getEnvInt(key string, fallback int) int {
     return fallback
 }
 
+// Helper function to get boolean environment variable with fallback
+// Accepts values understood by strconv.ParseBool ("true", "1", "false", ...)
+func getEnvBool(key string, fallback bool) bool {
+    if value, exists := os.LookupEnv(key); exists {
+        if boolVal, err := strconv.ParseBool(value); err == nil {
+            return boolVal
+        }
+    }
+    return fallback
+}
+
 // Helper function to get string slice environment variable with fallback
-// Currently only supports single value, returns as single-item slice
+// Splits comma separated values and trims whitespace, skipping empty entries
 func getEnvSlice(key string, fallback []string) []string {
     if value, exists := os.LookupEnv(key); exists {
-        if value != "" {
-            return []string{value}
+        var values []string
+        for _, item := range strings.Split(value, ",") {
+            if item = strings.TrimSpace(item); item != "" {
+                values = append(values, item)
+            }
+        }
+        if len(values) > 0 {
+            return values
         }
     }
     return fallback
-}
\ No newline at end of file
+}
+
+// Helper function to get a key=value,key=value environment variable as a map
+// Keys are lowercased, returns an error for entries without a value
+func getEnvMap(key string) (map[string]string, error) {
+    values := make(map[string]string)
+    for _, item := range getEnvSlice(key, nil) {
+        k, v, ok := strings.Cut(item, "=")
+        k, v = strings.ToLower(strings.TrimSpace(k)), strings.TrimSpace(v)
+        if !ok || k == "" || v == "" {
+            return nil, fmt.Errorf("invalid %s entry %q: expected key=value", key, item)
+        }
+        values[k] = v
+    }
+    return values, nil
+}
+
+// Helper function to parse a comma-separated list of path=duration pairs
+// Paths must start with "/" and durations must be positive, e.g. /api/preferences=5s
+func getEnvDurationMap(key string) (map[string]time.Duration, error) {
+    raw, err := getEnvMap(key)
+    if err != nil {
+        return nil, err
+    }
+    durations := make(map[string]time.Duration, len(raw))
+    for path, value := range raw {
+        if !strings.HasPrefix(path, "/") {
+            return nil, fmt.Errorf("invalid %s path %q: must start with /", key, path)
+        }
+        d, err := time.ParseDuration(value)
+        if err != nil || d <= 0 {
+            return nil, fmt.Errorf("invalid %s duration %q for %s: expected a positive duration like 30s", key, value, path)
+        }
+        durations[path] = d
+    }
+    return durations, nil
+}
+
+// Helper function to load a JSON array of strings from a file
+// Used for settings too long to comfortably keep in an env var
+func loadStringListFile(path string) ([]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var values []string
+    if err := json.Unmarshal(data, &values); err != nil {
+        return nil, fmt.Errorf("expected a JSON array of strings: %w", err)
+    }
+    return values, nil
+}
+
+// Helper function to load a JSON object of string values from a file
+// Used for per-device settings such as DEVICE_NAME_OVERRIDES
+func loadStringMapFile(path string) (map[string]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var values map[string]string
+    if err := json.Unmarshal(data, &values); err != nil {
+        return nil, fmt.Errorf("expected a JSON object of strings: %w", err)
+    }
+    return values, nil
+}
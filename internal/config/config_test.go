@@ -0,0 +1,269 @@
+// config_test.go covers environment parsing in LoadConfig.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadWith runs LoadConfig with the required variables plus env
+func loadWith(t *testing.T, env map[string]string) (*Config, error) {
+    t.Helper()
+    t.Setenv("DB_DSN", "user:pass@tcp(localhost:3306)/fleet")
+    t.Setenv("GPS_API_KEY", "test-key")
+    for k, v := range env {
+        t.Setenv(k, v)
+    }
+    return LoadConfig()
+}
+
+// writeFile writes content to a file in a temp dir and returns its path
+func writeFile(t *testing.T, name, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestReportOutputFields(t *testing.T) {
+    tests := []struct {
+        name    string
+        env     map[string]string
+        want    []string
+        wantErr string
+    }{
+        {"unset", nil, nil, ""},
+        {"env list", map[string]string{"REPORT_OUTPUT_FIELDS": "display_name, drive_time"}, []string{"display_name", "drive_time"}, ""},
+        {
+            "file overrides env",
+            map[string]string{
+                "REPORT_OUTPUT_FIELDS":      "display_name",
+                "REPORT_OUTPUT_FIELDS_FILE": writeFile(t, "fields.json", `["drive_time","idle_time"]`),
+            },
+            []string{"drive_time", "idle_time"},
+            "",
+        },
+        {"file not a list", map[string]string{"REPORT_OUTPUT_FIELDS_FILE": writeFile(t, "bad.json", `{"a":1}`)}, nil, "REPORT_OUTPUT_FIELDS_FILE"},
+        {"missing file", map[string]string{"REPORT_OUTPUT_FIELDS_FILE": "/nonexistent/fields.json"}, nil, "REPORT_OUTPUT_FIELDS_FILE"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, err := loadWith(t, tt.env)
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("LoadConfig() error = %v, want one mentioning %s", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("LoadConfig(): %v", err)
+            }
+            if !reflect.DeepEqual(cfg.APIConfig.ReportOutputFields, tt.want) {
+                t.Errorf("ReportOutputFields = %v, want %v", cfg.APIConfig.ReportOutputFields, tt.want)
+            }
+        })
+    }
+}
+
+func TestReportConcurrency(t *testing.T) {
+    cfg, err := loadWith(t, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.MaxConcurrentReports != 4 || cfg.APIConfig.ReportQueueTimeout != 10 {
+        t.Errorf("defaults = %d slots, %ds queue, want 4 and 10", cfg.APIConfig.MaxConcurrentReports, cfg.APIConfig.ReportQueueTimeout)
+    }
+
+    cfg, err = loadWith(t, map[string]string{"REPORT_MAX_CONCURRENT": "2", "REPORT_QUEUE_TIMEOUT": "0"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.MaxConcurrentReports != 2 || cfg.APIConfig.ReportQueueTimeout != 0 {
+        t.Errorf("got %d slots, %ds queue, want 2 and 0", cfg.APIConfig.MaxConcurrentReports, cfg.APIConfig.ReportQueueTimeout)
+    }
+}
+
+func TestForceHTTPS(t *testing.T) {
+    cfg, err := loadWith(t, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.ForceHTTPS {
+        t.Error("FORCE_HTTPS on by default, want off for development")
+    }
+    if cfg.APIConfig.HSTSMaxAge != 31536000 {
+        t.Errorf("HSTSMaxAge = %d, want one year", cfg.APIConfig.HSTSMaxAge)
+    }
+
+    cfg, err = loadWith(t, map[string]string{"FORCE_HTTPS": "true", "HSTS_MAX_AGE": "600"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !cfg.APIConfig.ForceHTTPS || cfg.APIConfig.HSTSMaxAge != 600 {
+        t.Errorf("ForceHTTPS = %v, HSTSMaxAge = %d, want true and 600", cfg.APIConfig.ForceHTTPS, cfg.APIConfig.HSTSMaxAge)
+    }
+}
+
+func TestGPSBaseURL(t *testing.T) {
+    cfg, err := loadWith(t, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.GPSBaseURL != "https://track.onestepgps.com/v3/api/public" {
+        t.Errorf("default GPSBaseURL = %q", cfg.APIConfig.GPSBaseURL)
+    }
+
+    cfg, err = loadWith(t, map[string]string{"GPS_BASE_URL": "https://eu.onestepgps.com/v3/api/public"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.GPSBaseURL != "https://eu.onestepgps.com/v3/api/public" {
+        t.Errorf("GPSBaseURL = %q", cfg.APIConfig.GPSBaseURL)
+    }
+}
+
+func TestDeviceNameOverrides(t *testing.T) {
+    cfg, err := loadWith(t, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.DeviceNameOverrides != nil {
+        t.Errorf("default DeviceNameOverrides = %v, want nil", cfg.APIConfig.DeviceNameOverrides)
+    }
+
+    path := writeFile(t, "names.json", `{"dev1":"Front Loader","dev2":"Tanker"}`)
+    cfg, err = loadWith(t, map[string]string{"DEVICE_NAME_OVERRIDES": path})
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]string{"dev1": "Front Loader", "dev2": "Tanker"}
+    if !reflect.DeepEqual(cfg.APIConfig.DeviceNameOverrides, want) {
+        t.Errorf("DeviceNameOverrides = %v, want %v", cfg.APIConfig.DeviceNameOverrides, want)
+    }
+
+    for _, path := range []string{writeFile(t, "list.json", `["dev1"]`), "/nonexistent/names.json"} {
+        if _, err := loadWith(t, map[string]string{"DEVICE_NAME_OVERRIDES": path}); err == nil || !strings.Contains(err.Error(), "DEVICE_NAME_OVERRIDES") {
+            t.Errorf("DEVICE_NAME_OVERRIDES=%s: error = %v, want one mentioning DEVICE_NAME_OVERRIDES", path, err)
+        }
+    }
+}
+
+func TestCORSSettings(t *testing.T) {
+    cfg, err := loadWith(t, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !cfg.APIConfig.CORSAllowCredentials || cfg.APIConfig.CORSMaxAge != 600 {
+        t.Errorf("defaults: credentials %v, max-age %d, want true and 600", cfg.APIConfig.CORSAllowCredentials, cfg.APIConfig.CORSMaxAge)
+    }
+
+    cfg, err = loadWith(t, map[string]string{"CORS_ALLOW_CREDENTIALS": "false", "CORS_MAX_AGE": "0"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.CORSAllowCredentials || cfg.APIConfig.CORSMaxAge != 0 {
+        t.Errorf("overridden: credentials %v, max-age %d, want false and 0", cfg.APIConfig.CORSAllowCredentials, cfg.APIConfig.CORSMaxAge)
+    }
+}
+
+func TestBroadcastBuffer(t *testing.T) {
+    cfg, err := loadWith(t, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.WebSocket.BroadcastBuffer != 1 {
+        t.Errorf("default BroadcastBuffer = %d, want 1", cfg.WebSocket.BroadcastBuffer)
+    }
+
+    cfg, err = loadWith(t, map[string]string{"WS_BROADCAST_BUFFER": "4"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.WebSocket.BroadcastBuffer != 4 {
+        t.Errorf("BroadcastBuffer = %d, want 4", cfg.WebSocket.BroadcastBuffer)
+    }
+
+    if _, err := loadWith(t, map[string]string{"WS_BROADCAST_BUFFER": "0"}); err == nil || !strings.Contains(err.Error(), "WS_BROADCAST_BUFFER") {
+        t.Errorf("WS_BROADCAST_BUFFER=0 error = %v, want one naming the variable", err)
+    }
+}
+
+func TestUpstreamTransport(t *testing.T) {
+    cfg, err := loadWith(t, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    api := cfg.APIConfig
+    if api.UpstreamMaxIdleConns != 100 || api.UpstreamMaxIdleConnsPerHost != 10 || api.UpstreamIdleConnTimeout != 90 || api.UpstreamKeepAlive != 30 {
+        t.Errorf("defaults = %d, %d, %ds, %ds, want 100, 10, 90s and 30s",
+            api.UpstreamMaxIdleConns, api.UpstreamMaxIdleConnsPerHost, api.UpstreamIdleConnTimeout, api.UpstreamKeepAlive)
+    }
+
+    cfg, err = loadWith(t, map[string]string{"UPSTREAM_MAX_IDLE_CONNS_PER_HOST": "25", "UPSTREAM_KEEP_ALIVE": "-1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.UpstreamMaxIdleConnsPerHost != 25 || cfg.APIConfig.UpstreamKeepAlive != -1 {
+        t.Errorf("per host = %d, keep-alive = %d, want 25 and -1", cfg.APIConfig.UpstreamMaxIdleConnsPerHost, cfg.APIConfig.UpstreamKeepAlive)
+    }
+
+    if _, err := loadWith(t, map[string]string{"UPSTREAM_MAX_IDLE_CONNS": "-5"}); err == nil || !strings.Contains(err.Error(), "UPSTREAM_MAX_IDLE_CONNS") {
+        t.Errorf("UPSTREAM_MAX_IDLE_CONNS=-5 error = %v, want one naming the variable", err)
+    }
+}
+
+func TestUnpreferencedDefaults(t *testing.T) {
+    cfg, err := loadWith(t, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.UnpreferencedVisibility != "visible" || cfg.APIConfig.UnpreferencedOrder != "last" {
+        t.Errorf("defaults = %q, %q, want visible and last", cfg.APIConfig.UnpreferencedVisibility, cfg.APIConfig.UnpreferencedOrder)
+    }
+
+    cfg, err = loadWith(t, map[string]string{"UNPREFERENCED_VISIBILITY": "Hidden", "UNPREFERENCED_ORDER": "FIRST"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.UnpreferencedVisibility != "hidden" || cfg.APIConfig.UnpreferencedOrder != "first" {
+        t.Errorf("got %q, %q, want hidden and first", cfg.APIConfig.UnpreferencedVisibility, cfg.APIConfig.UnpreferencedOrder)
+    }
+}
+
+func TestUnpreferencedDefaultsInvalid(t *testing.T) {
+    for name, value := range map[string]string{"UNPREFERENCED_VISIBILITY": "sometimes", "UNPREFERENCED_ORDER": "middle"} {
+        t.Run(name, func(t *testing.T) {
+            if _, err := loadWith(t, map[string]string{name: value}); err == nil || !strings.Contains(err.Error(), name) {
+                t.Errorf("%s=%s error = %v, want one naming the variable", name, value, err)
+            }
+        })
+    }
+}
+
+func TestTrustedProxyHops(t *testing.T) {
+    cfg, err := loadWith(t, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.TrustedProxyHops != 0 {
+        t.Errorf("default TrustedProxyHops = %d, want 0", cfg.APIConfig.TrustedProxyHops)
+    }
+
+    cfg, err = loadWith(t, map[string]string{"TRUSTED_PROXY_HOPS": "1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.APIConfig.TrustedProxyHops != 1 {
+        t.Errorf("TrustedProxyHops = %d, want 1", cfg.APIConfig.TrustedProxyHops)
+    }
+
+    if _, err := loadWith(t, map[string]string{"TRUSTED_PROXY_HOPS": "-1"}); err == nil || !strings.Contains(err.Error(), "TRUSTED_PROXY_HOPS") {
+        t.Errorf("TRUSTED_PROXY_HOPS=-1 error = %v, want one naming the variable", err)
+    }
+}
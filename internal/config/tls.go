@@ -0,0 +1,62 @@
+// tls.go builds the server's TLS settings for deployments that terminate
+// TLS in the app instead of at a proxy or load balancer.
+
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// TLSConfig holds settings for serving HTTPS directly
+// Used by main.go, TLS is disabled unless both files are set
+type TLSConfig struct {
+    CertFile   string // PEM certificate (chain) path
+    KeyFile    string // PEM private key path
+    MinVersion string // Lowest accepted protocol, "1.2" or "1.3"
+}
+
+// tlsVersions maps TLS_MIN_VERSION values to crypto/tls constants
+var tlsVersions = map[string]uint16{
+    "1.2": tls.VersionTLS12,
+    "1.3": tls.VersionTLS13,
+}
+
+// secureCipherSuites are the TLS 1.2 suites offered: forward-secret ECDHE
+// with AEAD ciphers only. TLS 1.3 suites aren't configurable and are all secure.
+var secureCipherSuites = []uint16{
+    tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+    tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+    tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+    tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+    tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// Enabled reports whether the server should terminate TLS itself
+func (c TLSConfig) Enabled() bool {
+    return c.CertFile != "" && c.KeyFile != ""
+}
+
+// validate rejects half-configured TLS and unknown minimum versions
+func (c TLSConfig) validate() error {
+    if (c.CertFile == "") != (c.KeyFile == "") {
+        return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+    }
+    if _, ok := tlsVersions[c.MinVersion]; !ok {
+        return fmt.Errorf("TLS_MIN_VERSION must be 1.2 or 1.3, got %q", c.MinVersion)
+    }
+    return nil
+}
+
+// Build returns the tls.Config for http.Server.TLSConfig.
+// The certificate itself is loaded by ListenAndServeTLS.
+func (c TLSConfig) Build() (*tls.Config, error) {
+    if err := c.validate(); err != nil {
+        return nil, err
+    }
+    return &tls.Config{
+        MinVersion:   tlsVersions[c.MinVersion],
+        CipherSuites: secureCipherSuites,
+    }, nil
+}
@@ -0,0 +1,79 @@
+// tls_test.go covers building the tls.Config for serving HTTPS directly.
+
+package config
+
+import (
+	"crypto/tls"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTLSBuild(t *testing.T) {
+    tests := []struct {
+        minVersion string
+        want       uint16
+    }{
+        {"1.2", tls.VersionTLS12},
+        {"1.3", tls.VersionTLS13},
+    }
+    for _, tt := range tests {
+        cfg, err := TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: tt.minVersion}.Build()
+        if err != nil {
+            t.Fatalf("Build(%s) error = %v", tt.minVersion, err)
+        }
+        if cfg.MinVersion != tt.want {
+            t.Errorf("Build(%s) MinVersion = %x, want %x", tt.minVersion, cfg.MinVersion, tt.want)
+        }
+        if !reflect.DeepEqual(cfg.CipherSuites, secureCipherSuites) {
+            t.Errorf("Build(%s) CipherSuites = %v", tt.minVersion, cfg.CipherSuites)
+        }
+    }
+}
+
+func TestTLSCipherSuitesSecure(t *testing.T) {
+    insecure := make(map[uint16]bool)
+    for _, s := range tls.InsecureCipherSuites() {
+        insecure[s.ID] = true
+    }
+    for _, id := range secureCipherSuites {
+        name := tls.CipherSuiteName(id)
+        // Only forward-secret AEAD suites
+        if insecure[id] || !strings.HasPrefix(name, "TLS_ECDHE_") || strings.Contains(name, "CBC") {
+            t.Errorf("%s offered", name)
+        }
+    }
+}
+
+func TestTLSSettings(t *testing.T) {
+    cfg, err := loadWith(t, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.TLS.Enabled() || cfg.TLS.MinVersion != "1.2" {
+        t.Errorf("default TLS = %+v, want disabled with min version 1.2", cfg.TLS)
+    }
+
+    cfg, err = loadWith(t, map[string]string{"TLS_CERT_FILE": "cert.pem", "TLS_KEY_FILE": "key.pem", "TLS_MIN_VERSION": "1.3"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !cfg.TLS.Enabled() || cfg.TLS.MinVersion != "1.3" {
+        t.Errorf("TLS = %+v, want enabled with min version 1.3", cfg.TLS)
+    }
+}
+
+func TestTLSSettingsInvalid(t *testing.T) {
+    invalid := map[string]map[string]string{
+        "cert only":   {"TLS_CERT_FILE": "cert.pem"},
+        "key only":    {"TLS_KEY_FILE": "key.pem"},
+        "min version": {"TLS_MIN_VERSION": "1.0"},
+    }
+    for name, env := range invalid {
+        t.Run(name, func(t *testing.T) {
+            if _, err := loadWith(t, env); err == nil || !strings.Contains(err.Error(), "TLS_") {
+                t.Errorf("LoadConfig with %v error = %v, want a TLS error", env, err)
+            }
+        })
+    }
+}
@@ -6,6 +6,8 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -49,7 +51,7 @@ func NewDB(dsn string) (*DB, error) {
 }
 
 // CreateTableIfNotExists initializes database schema
-// Creates table for user preferences
+// Creates tables for user preferences and report presets
 func (db *DB) CreateTableIfNotExists() error {
     // Create preferences table with client_id for frontend display settings
     // Used by VehiclePreferences.vue to store user customizations
@@ -61,22 +63,68 @@ func (db *DB) CreateTableIfNotExists() error {
             display_name VARCHAR(255),
             is_hidden BOOLEAN DEFAULT false,
             sort_order INT,
+            metadata JSON NULL,
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
             updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
             UNIQUE KEY unique_device_client (device_id, client_id)
         ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci
     `)
+    if err != nil {
+        return err
+    }
+
+    // Tables created before metadata existed need the column added
+    if err := db.addColumnIfMissing("user_preferences", "metadata", "JSON NULL AFTER sort_order"); err != nil {
+        return err
+    }
+
+    // Named report specs saved from ReportDialog.vue, one name per client
+    _, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS report_presets (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            client_id VARCHAR(255) NOT NULL DEFAULT 'default',
+            name VARCHAR(255) NOT NULL,
+            spec JSON NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            UNIQUE KEY unique_client_name (client_id, name)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci
+    `)
     return err
 }
 
+// addColumnIfMissing adds a column to an existing table, MySQL has no
+// ADD COLUMN IF NOT EXISTS so information_schema is checked first
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+    var count int
+    err := db.QueryRow(`
+        SELECT COUNT(*)
+        FROM information_schema.COLUMNS
+        WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+    `, table, column).Scan(&count)
+    if err != nil {
+        return fmt.Errorf("error checking for column %s.%s: %w", table, column, err)
+    }
+    if count > 0 {
+        return nil
+    }
+
+    if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+        return fmt.Errorf("error adding column %s.%s: %w", table, column, err)
+    }
+    fmt.Printf("Added column %s.%s\n", table, column)
+    return nil
+}
+
 // GetAllPreferencesForClient retrieves all preferences for a specific client
 // Used by VehicleList.vue during initial load and after updates
+// Ties in sort_order fall back to device_id so the list doesn't reshuffle between loads
 func (db *DB) GetAllPreferencesForClient(clientID string) ([]models.UserPreference, error) {
     query := `
-        SELECT id, device_id, client_id, display_name, is_hidden, sort_order, created_at, updated_at
+        SELECT id, device_id, client_id, display_name, is_hidden, sort_order, metadata, created_at, updated_at
         FROM user_preferences
         WHERE client_id = ?
-        ORDER BY sort_order ASC
+        ORDER BY sort_order ASC, device_id ASC
     `
     fmt.Printf("Executing query: %s with clientID: %s\n", query, clientID)
     
@@ -87,10 +135,45 @@ func (db *DB) GetAllPreferencesForClient(clientID string) ([]models.UserPreferen
     }
     defer rows.Close()
 
-    var preferences []models.UserPreference
+    return scanPreferences(rows)
+}
+
+// GetPreferencesPageForClient retrieves one page of a client's preferences
+// along with the client's total preference count.
+// Used by the admin preferences endpoint to page through each client.
+func (db *DB) GetPreferencesPageForClient(clientID string, limit, offset int) ([]models.UserPreference, int, error) {
+    var total int
+    if err := db.QueryRow("SELECT COUNT(*) FROM user_preferences WHERE client_id = ?", clientID).Scan(&total); err != nil {
+        return nil, 0, fmt.Errorf("error counting preferences: %w", err)
+    }
+
+    rows, err := db.Query(`
+        SELECT id, device_id, client_id, display_name, is_hidden, sort_order, metadata, created_at, updated_at
+        FROM user_preferences
+        WHERE client_id = ?
+        ORDER BY sort_order ASC, device_id ASC
+        LIMIT ? OFFSET ?
+    `, clientID, limit, offset)
+    if err != nil {
+        return nil, 0, fmt.Errorf("error querying preferences: %w", err)
+    }
+    defer rows.Close()
+
+    preferences, err := scanPreferences(rows)
+    if err != nil {
+        return nil, 0, err
+    }
+    return preferences, total, nil
+}
+
+// scanPreferences reads all preference rows from a query result.
+// Always returns a non-nil slice so handlers encode [] instead of null.
+func scanPreferences(rows *sql.Rows) ([]models.UserPreference, error) {
+    preferences := []models.UserPreference{}
     for rows.Next() {
         var pref models.UserPreference
         var createdAt, updatedAt sql.NullTime
+        var metadata sql.NullString
         err := rows.Scan(
             &pref.ID,
             &pref.DeviceID,
@@ -98,12 +181,16 @@ func (db *DB) GetAllPreferencesForClient(clientID string) ([]models.UserPreferen
             &pref.DisplayName,
             &pref.IsHidden,
             &pref.SortOrder,
+            &metadata,
             &createdAt,
             &updatedAt,
         )
         if err != nil {
             return nil, fmt.Errorf("error scanning preference row: %w", err)
         }
+        if pref.Metadata, err = decodeMetadata(metadata); err != nil {
+            return nil, err
+        }
         // Convert nullable timestamps to actual times if valid
         if createdAt.Valid {
             pref.CreatedAt = createdAt.Time
@@ -113,15 +200,38 @@ func (db *DB) GetAllPreferencesForClient(clientID string) ([]models.UserPreferen
         }
         preferences = append(preferences, pref)
     }
-
-    // If no preferences found, return empty slice instead of nil
-    if preferences == nil {
-        preferences = []models.UserPreference{}
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating preference rows: %w", err)
     }
 
     return preferences, nil
 }
 
+// encodeMetadata converts preference metadata to a JSON column value,
+// nil for no metadata so the column is NULL
+func encodeMetadata(metadata map[string]interface{}) (interface{}, error) {
+    if metadata == nil {
+        return nil, nil
+    }
+    data, err := json.Marshal(metadata)
+    if err != nil {
+        return nil, fmt.Errorf("error encoding metadata: %w", err)
+    }
+    return string(data), nil
+}
+
+// decodeMetadata parses a metadata column, NULL decodes to nil
+func decodeMetadata(raw sql.NullString) (map[string]interface{}, error) {
+    if !raw.Valid || raw.String == "" {
+        return nil, nil
+    }
+    var metadata map[string]interface{}
+    if err := json.Unmarshal([]byte(raw.String), &metadata); err != nil {
+        return nil, fmt.Errorf("error decoding metadata: %w", err)
+    }
+    return metadata, nil
+}
+
 // GetPreferenceByDeviceAndClientID retrieves a specific preference
 // Used when updating individual vehicle preferences
 func (db *DB) GetPreferenceByDeviceAndClientID(deviceID, clientID string, execer Execer) (*models.UserPreference, error) {
@@ -132,10 +242,11 @@ func (db *DB) GetPreferenceByDeviceAndClientID(deviceID, clientID string, execer
 
     var pref models.UserPreference
     var createdAt, updatedAt sql.NullTime
+    var metadata sql.NullString
 
     // Query single preference
     err := execer.QueryRow(`
-        SELECT id, device_id, client_id, display_name, is_hidden, sort_order, created_at, updated_at
+        SELECT id, device_id, client_id, display_name, is_hidden, sort_order, metadata, created_at, updated_at
         FROM user_preferences
         WHERE device_id = ? AND client_id = ?
     `, deviceID, clientID).Scan(
@@ -145,6 +256,7 @@ func (db *DB) GetPreferenceByDeviceAndClientID(deviceID, clientID string, execer
         &pref.DisplayName,
         &pref.IsHidden,
         &pref.SortOrder,
+        &metadata,
         &createdAt,
         &updatedAt,
     )
@@ -156,6 +268,9 @@ func (db *DB) GetPreferenceByDeviceAndClientID(deviceID, clientID string, execer
     if err != nil {
         return nil, fmt.Errorf("error getting preference: %w", err)
     }
+    if pref.Metadata, err = decodeMetadata(metadata); err != nil {
+        return nil, err
+    }
 
     if createdAt.Valid {
         pref.CreatedAt = createdAt.Time
@@ -176,20 +291,43 @@ func (db *DB) CreatePreference(pref *models.PreferenceCreate, execer Execer) (*m
         execer = db.DB
     }
     
+    // Omitted metadata (NULL) keeps whatever the row already has
+    metadata, err := encodeMetadata(pref.Metadata)
+    if err != nil {
+        return nil, err
+    }
+
     // Use UPSERT to handle insert or update in one query
-    _, err := execer.Exec(`
-        INSERT INTO user_preferences 
-        (device_id, client_id, display_name, is_hidden, sort_order)
-        VALUES (?, ?, ?, ?, ?)
-        ON DUPLICATE KEY UPDATE
-            display_name = VALUES(display_name),
-            is_hidden = VALUES(is_hidden),
-            sort_order = VALUES(sort_order)
-    `, pref.DeviceID, pref.ClientID, pref.DisplayName, pref.IsHidden, pref.SortOrder)
+    if pref.SortOrder != nil {
+        _, err = execer.Exec(`
+            INSERT INTO user_preferences 
+            (device_id, client_id, display_name, is_hidden, sort_order, metadata)
+            VALUES (?, ?, ?, ?, ?, ?)
+            ON DUPLICATE KEY UPDATE
+                display_name = VALUES(display_name),
+                is_hidden = VALUES(is_hidden),
+                sort_order = VALUES(sort_order),
+                metadata = COALESCE(VALUES(metadata), metadata)
+        `, pref.DeviceID, pref.ClientID, pref.DisplayName, pref.IsHidden, *pref.SortOrder, metadata)
+    } else {
+        // No explicit sort_order: new rows go after the client's last preference,
+        // computed in the same statement so it sees the current transaction's rows.
+        // Existing rows keep their position.
+        _, err = execer.Exec(`
+            INSERT INTO user_preferences 
+            (device_id, client_id, display_name, is_hidden, sort_order, metadata)
+            SELECT ?, ?, ?, ?, COALESCE(MAX(sort_order), -1) + 1, ?
+            FROM user_preferences
+            WHERE client_id = ?
+            ON DUPLICATE KEY UPDATE
+                display_name = VALUES(display_name),
+                is_hidden = VALUES(is_hidden),
+                metadata = COALESCE(VALUES(metadata), metadata)
+        `, pref.DeviceID, pref.ClientID, pref.DisplayName, pref.IsHidden, metadata, pref.ClientID)
+    }
     if err != nil {
         return nil, fmt.Errorf("error creating/updating preference: %w", err)
     }
-    fmt.Printf("Created/Updated preference: device_id=%s, client_id=%s\n", pref.DeviceID, pref.ClientID)
 
     // Return the updated preference data
     return db.GetPreferenceByDeviceAndClientID(pref.DeviceID, pref.ClientID, execer)
@@ -219,6 +357,14 @@ func (db *DB) UpdatePreferenceByDeviceAndClientID(deviceID, clientID string, upd
         query += ", sort_order = ?"
         args = append(args, *updates.SortOrder)
     }
+    if updates.Metadata != nil {
+        metadata, err := encodeMetadata(updates.Metadata)
+        if err != nil {
+            return nil, err
+        }
+        query += ", metadata = ?"
+        args = append(args, metadata)
+    }
 
     query += " WHERE device_id = ? AND client_id = ?"
     args = append(args, deviceID, clientID)
@@ -244,6 +390,54 @@ func (db *DB) UpdatePreferenceByDeviceAndClientID(deviceID, clientID string, upd
     return db.GetPreferenceByDeviceAndClientID(deviceID, clientID, execer)
 }
 
+// ErrDuplicateDisplayName is matched (via errors.Is) by every DisplayNameConflictError
+var ErrDuplicateDisplayName = errors.New("duplicate display name")
+
+// DisplayNameConflictError reports a display_name already used by another device of the client
+type DisplayNameConflictError struct {
+    DisplayName     string
+    ClientID        string
+    ConflictingWith string // device_id already using the name
+}
+
+func (e *DisplayNameConflictError) Error() string {
+    return fmt.Sprintf("display name %q is already used by device %s", e.DisplayName, e.ConflictingWith)
+}
+
+// Is lets errors.Is(err, ErrDuplicateDisplayName) match any DisplayNameConflictError
+func (e *DisplayNameConflictError) Is(target error) bool {
+    return target == ErrDuplicateDisplayName
+}
+
+// CheckDisplayNameAvailable returns a DisplayNameConflictError if another device of
+// clientID already uses displayName. Empty names never conflict.
+// Run inside the write's transaction: FOR UPDATE locks the client's matching rows
+// so a concurrent write can't claim the name between the check and the write.
+func (db *DB) CheckDisplayNameAvailable(clientID, deviceID, displayName string, execer Execer) error {
+    if displayName == "" {
+        return nil
+    }
+    if execer == nil {
+        execer = db.DB
+    }
+
+    var existing string
+    err := execer.QueryRow(`
+        SELECT device_id
+        FROM user_preferences
+        WHERE client_id = ? AND display_name = ? AND device_id <> ?
+        LIMIT 1
+        FOR UPDATE
+    `, clientID, displayName, deviceID).Scan(&existing)
+    if err == sql.ErrNoRows {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("error checking display name: %w", err)
+    }
+    return &DisplayNameConflictError{DisplayName: displayName, ClientID: clientID, ConflictingWith: existing}
+}
+
 // DeletePreference removes a preference from the database
 // Used by VehiclePreferences.vue when removing customizations
 func (db *DB) DeletePreference(deviceID, clientID string) error {
@@ -285,4 +479,109 @@ func (db *DB) CleanupOldPreferences(age time.Duration) (int64, error) {
 
     fmt.Printf("Cleaned up %d old preferences\n", rowsDeleted)
     return rowsDeleted, nil
-}
\ No newline at end of file
+}
+// ListReportPresets retrieves a client's saved report presets ordered by name
+// Used by ReportDialog.vue to list presets
+func (db *DB) ListReportPresets(clientID string) ([]models.ReportPreset, error) {
+    rows, err := db.Query(`
+        SELECT id, client_id, name, spec, created_at, updated_at
+        FROM report_presets
+        WHERE client_id = ?
+        ORDER BY name ASC
+    `, clientID)
+    if err != nil {
+        return nil, fmt.Errorf("error querying report presets: %w", err)
+    }
+    defer rows.Close()
+
+    presets := make([]models.ReportPreset, 0)
+    for rows.Next() {
+        preset, err := scanReportPreset(rows)
+        if err != nil {
+            return nil, err
+        }
+        presets = append(presets, *preset)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("error iterating report presets: %w", err)
+    }
+    return presets, nil
+}
+
+// GetReportPreset retrieves a single preset by name, nil if it doesn't exist
+// Used by /report/presets/{name} and /report/generate?preset=name
+func (db *DB) GetReportPreset(clientID, name string) (*models.ReportPreset, error) {
+    row := db.QueryRow(`
+        SELECT id, client_id, name, spec, created_at, updated_at
+        FROM report_presets
+        WHERE client_id = ? AND name = ?
+    `, clientID, name)
+    preset, err := scanReportPreset(row)
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, nil
+    }
+    return preset, err
+}
+
+// SaveReportPreset creates a preset or replaces the spec of an existing one
+// with the same name
+func (db *DB) SaveReportPreset(preset *models.ReportPresetCreate) (*models.ReportPreset, error) {
+    spec, err := json.Marshal(preset.Spec)
+    if err != nil {
+        return nil, fmt.Errorf("error encoding report spec: %w", err)
+    }
+
+    _, err = db.Exec(`
+        INSERT INTO report_presets (client_id, name, spec)
+        VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE spec = VALUES(spec)
+    `, preset.ClientID, preset.Name, string(spec))
+    if err != nil {
+        return nil, fmt.Errorf("error saving report preset: %w", err)
+    }
+
+    return db.GetReportPreset(preset.ClientID, preset.Name)
+}
+
+// DeleteReportPreset removes a preset, returning false if it didn't exist
+func (db *DB) DeleteReportPreset(clientID, name string) (bool, error) {
+    result, err := db.Exec("DELETE FROM report_presets WHERE client_id = ? AND name = ?", clientID, name)
+    if err != nil {
+        return false, fmt.Errorf("error deleting report preset: %w", err)
+    }
+
+    rows, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("error getting rows affected: %w", err)
+    }
+    return rows > 0, nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+// scanReportPreset reads one report_presets row, decoding the stored spec
+func scanReportPreset(row rowScanner) (*models.ReportPreset, error) {
+    var preset models.ReportPreset
+    var spec []byte
+    var createdAt, updatedAt sql.NullTime
+    err := row.Scan(&preset.ID, &preset.ClientID, &preset.Name, &spec, &createdAt, &updatedAt)
+    if err == sql.ErrNoRows {
+        return nil, err
+    }
+    if err != nil {
+        return nil, fmt.Errorf("error scanning report preset: %w", err)
+    }
+    if err := json.Unmarshal(spec, &preset.Spec); err != nil {
+        return nil, fmt.Errorf("error decoding report preset %q: %w", preset.Name, err)
+    }
+    if createdAt.Valid {
+        preset.CreatedAt = createdAt.Time
+    }
+    if updatedAt.Valid {
+        preset.UpdatedAt = updatedAt.Time
+    }
+    return &preset, nil
+}
@@ -0,0 +1,296 @@
+// database_test.go covers the preference queries against sqlmock, since
+// MySQL-specific statements (upserts, FOR UPDATE) can't run on a fake driver.
+
+package database
+
+import (
+	"database/sql"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// preferenceColumns matches the SELECT in GetPreferenceByDeviceAndClientID
+var preferenceColumns = []string{
+    "id", "device_id", "client_id", "display_name", "is_hidden", "sort_order", "metadata", "created_at", "updated_at",
+}
+
+// newMockDB returns a DB backed by sqlmock, matching queries by regexp
+func newMockDB(t *testing.T) (*DB, sqlmock.Sqlmock) {
+    t.Helper()
+    sqlDB, mock, err := sqlmock.New()
+    if err != nil {
+        t.Fatalf("sqlmock: %v", err)
+    }
+    t.Cleanup(func() {
+        sqlDB.Close()
+    })
+    return &DB{sqlDB}, mock
+}
+
+// expectPreferenceRead stubs the read-back after a write
+func expectPreferenceRead(mock sqlmock.Sqlmock, deviceID, clientID string, sortOrder int, metadata interface{}) {
+    now := time.Now()
+    mock.ExpectQuery(regexp.QuoteMeta("FROM user_preferences\n        WHERE device_id = ? AND client_id = ?")).
+        WithArgs(deviceID, clientID).
+        WillReturnRows(sqlmock.NewRows(preferenceColumns).
+            AddRow(1, deviceID, clientID, "Truck", false, sortOrder, metadata, now, now))
+}
+
+func TestCreatePreferenceAppendsWithoutSortOrder(t *testing.T) {
+    db, mock := newMockDB(t)
+
+    // The position comes from the client's current MAX(sort_order), in the
+    // same statement, and a conflicting row keeps its sort_order
+    mock.ExpectExec(`SELECT \?, \?, \?, \?, COALESCE\(MAX\(sort_order\), -1\) \+ 1, \?\s+FROM user_preferences\s+WHERE client_id = \?`).
+        WithArgs("dev-3", "client-a", "Truck", false, nil, "client-a").
+        WillReturnResult(sqlmock.NewResult(3, 1))
+    expectPreferenceRead(mock, "dev-3", "client-a", 2, nil)
+
+    pref, err := db.CreatePreference(&models.PreferenceCreate{
+        DeviceID:    "dev-3",
+        ClientID:    "client-a",
+        DisplayName: "Truck",
+    }, nil)
+    if err != nil {
+        t.Fatalf("CreatePreference: %v", err)
+    }
+    if pref.SortOrder != 2 {
+        t.Errorf("sort_order = %d, want 2 (after the client's last preference)", pref.SortOrder)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestCreatePreferenceAppendQueryKeepsExistingPosition(t *testing.T) {
+    db, mock := newMockDB(t)
+
+    // ON DUPLICATE KEY UPDATE must not touch sort_order on the append path
+    mock.ExpectExec(`COALESCE\(MAX\(sort_order\), -1\) \+ 1`).
+        WillReturnResult(sqlmock.NewResult(0, 2))
+    expectPreferenceRead(mock, "dev-1", "client-a", 0, nil)
+
+    if _, err := db.CreatePreference(&models.PreferenceCreate{DeviceID: "dev-1", ClientID: "client-a"}, nil); err != nil {
+        t.Fatalf("CreatePreference: %v", err)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestCreatePreferenceExplicitSortOrder(t *testing.T) {
+    db, mock := newMockDB(t)
+
+    sortOrder := 7
+    mock.ExpectExec(`VALUES \(\?, \?, \?, \?, \?, \?\)\s+ON DUPLICATE KEY UPDATE[\s\S]*sort_order = VALUES\(sort_order\)`).
+        WithArgs("dev-1", "client-a", "Truck", true, 7, `{"color":"red"}`).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    expectPreferenceRead(mock, "dev-1", "client-a", 7, `{"color":"red"}`)
+
+    pref, err := db.CreatePreference(&models.PreferenceCreate{
+        DeviceID:    "dev-1",
+        ClientID:    "client-a",
+        DisplayName: "Truck",
+        IsHidden:    true,
+        SortOrder:   &sortOrder,
+        Metadata:    map[string]interface{}{"color": "red"},
+    }, nil)
+    if err != nil {
+        t.Fatalf("CreatePreference: %v", err)
+    }
+    if pref.SortOrder != 7 {
+        t.Errorf("sort_order = %d, want 7", pref.SortOrder)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestCreatePreferenceUsesExecer(t *testing.T) {
+    db, mock := newMockDB(t)
+
+    // Inside a transaction both the upsert and the read-back go through tx,
+    // so MAX(sort_order) sees rows written earlier in the same batch
+    mock.ExpectBegin()
+    mock.ExpectExec(`COALESCE\(MAX\(sort_order\), -1\) \+ 1`).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    expectPreferenceRead(mock, "dev-1", "client-a", 0, nil)
+    mock.ExpectExec(`COALESCE\(MAX\(sort_order\), -1\) \+ 1`).
+        WillReturnResult(sqlmock.NewResult(2, 1))
+    expectPreferenceRead(mock, "dev-2", "client-a", 1, nil)
+    mock.ExpectCommit()
+
+    tx, err := db.Begin()
+    if err != nil {
+        t.Fatalf("Begin: %v", err)
+    }
+    var orders []int
+    for _, id := range []string{"dev-1", "dev-2"} {
+        pref, err := db.CreatePreference(&models.PreferenceCreate{DeviceID: id, ClientID: "client-a"}, tx)
+        if err != nil {
+            t.Fatalf("CreatePreference(%s): %v", id, err)
+        }
+        orders = append(orders, pref.SortOrder)
+    }
+    if err := tx.Commit(); err != nil {
+        t.Fatalf("Commit: %v", err)
+    }
+    if orders[0] != 0 || orders[1] != 1 {
+        t.Errorf("sort orders = %v, want [0 1]", orders)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestPreferenceMetadataRoundTrip(t *testing.T) {
+    db, mock := newMockDB(t)
+
+    metadata := map[string]interface{}{"color": "#ff0000", "pinned": true, "zoom": float64(12)}
+    encoded := `{"color":"#ff0000","pinned":true,"zoom":12}`
+
+    // Create writes the metadata as a JSON column value and reads it back decoded
+    mock.ExpectExec(`INSERT INTO user_preferences`).
+        WithArgs("dev-1", "client-a", "", false, encoded, "client-a").
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    expectPreferenceRead(mock, "dev-1", "client-a", 0, encoded)
+
+    created, err := db.CreatePreference(&models.PreferenceCreate{
+        DeviceID: "dev-1",
+        ClientID: "client-a",
+        Metadata: metadata,
+    }, nil)
+    if err != nil {
+        t.Fatalf("CreatePreference: %v", err)
+    }
+    if !reflect.DeepEqual(created.Metadata, metadata) {
+        t.Errorf("created metadata = %v, want %v", created.Metadata, metadata)
+    }
+
+    // Update replaces it as a whole
+    replaced := map[string]interface{}{"notes": "spare key in glovebox"}
+    mock.ExpectExec(regexp.QuoteMeta("UPDATE user_preferences SET updated_at = NOW(), metadata = ? WHERE device_id = ? AND client_id = ?")).
+        WithArgs(`{"notes":"spare key in glovebox"}`, "dev-1", "client-a").
+        WillReturnResult(sqlmock.NewResult(0, 1))
+    expectPreferenceRead(mock, "dev-1", "client-a", 0, `{"notes":"spare key in glovebox"}`)
+
+    updated, err := db.UpdatePreferenceByDeviceAndClientID("dev-1", "client-a", &models.PreferenceUpdate{Metadata: replaced}, nil)
+    if err != nil {
+        t.Fatalf("UpdatePreferenceByDeviceAndClientID: %v", err)
+    }
+    if !reflect.DeepEqual(updated.Metadata, replaced) {
+        t.Errorf("updated metadata = %v, want %v", updated.Metadata, replaced)
+    }
+
+    // Reading the list decodes each row, NULL stays nil
+    now := time.Now()
+    mock.ExpectQuery(`FROM user_preferences\s+WHERE client_id = \?`).
+        WithArgs("client-a").
+        WillReturnRows(sqlmock.NewRows(preferenceColumns).
+            AddRow(1, "dev-1", "client-a", "", false, 0, `{"notes":"spare key in glovebox"}`, now, now).
+            AddRow(2, "dev-2", "client-a", "", false, 1, nil, now, now))
+
+    prefs, err := db.GetAllPreferencesForClient("client-a")
+    if err != nil {
+        t.Fatalf("GetAllPreferencesForClient: %v", err)
+    }
+    if len(prefs) != 2 {
+        t.Fatalf("got %d preferences, want 2", len(prefs))
+    }
+    if !reflect.DeepEqual(prefs[0].Metadata, replaced) {
+        t.Errorf("listed metadata = %v, want %v", prefs[0].Metadata, replaced)
+    }
+    if prefs[1].Metadata != nil {
+        t.Errorf("NULL metadata = %v, want nil", prefs[1].Metadata)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestCreatePreferenceWithoutMetadataKeepsStored(t *testing.T) {
+    db, mock := newMockDB(t)
+
+    // Omitted metadata is written as NULL, which COALESCE turns into the stored value
+    mock.ExpectExec(`metadata = COALESCE\(VALUES\(metadata\), metadata\)`).
+        WithArgs("dev-1", "client-a", "Truck", false, nil, "client-a").
+        WillReturnResult(sqlmock.NewResult(0, 2))
+    expectPreferenceRead(mock, "dev-1", "client-a", 0, `{"color":"blue"}`)
+
+    pref, err := db.CreatePreference(&models.PreferenceCreate{DeviceID: "dev-1", ClientID: "client-a", DisplayName: "Truck"}, nil)
+    if err != nil {
+        t.Fatalf("CreatePreference: %v", err)
+    }
+    if pref.Metadata["color"] != "blue" {
+        t.Errorf("metadata = %v, want the stored color kept", pref.Metadata)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestDecodeMetadataMalformed(t *testing.T) {
+    if _, err := decodeMetadata(sql.NullString{String: "{not json", Valid: true}); err == nil {
+        t.Error("decodeMetadata accepted malformed JSON")
+    }
+}
+
+func TestPreferenceListsBreakSortOrderTies(t *testing.T) {
+    db, mock := newMockDB(t)
+
+    // Equal sort_orders are ordered by device_id in SQL, and the rows are
+    // kept in that order, so repeated loads list them the same way
+    now := time.Now()
+    tiedRows := func() *sqlmock.Rows {
+        return sqlmock.NewRows(preferenceColumns).
+            AddRow(3, "dev-a", "client-a", "", false, 0, nil, now, now).
+            AddRow(1, "dev-b", "client-a", "", false, 0, nil, now, now).
+            AddRow(2, "dev-c", "client-a", "", false, 0, nil, now, now).
+            AddRow(4, "dev-0", "client-a", "", false, 1, nil, now, now)
+    }
+    for i := 0; i < 2; i++ {
+        mock.ExpectQuery(`WHERE client_id = \?\s+ORDER BY sort_order ASC, device_id ASC\s*$`).
+            WithArgs("client-a").
+            WillReturnRows(tiedRows())
+    }
+    mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM user_preferences WHERE client_id = ?")).
+        WithArgs("client-a").
+        WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+    mock.ExpectQuery(`ORDER BY sort_order ASC, device_id ASC\s+LIMIT \? OFFSET \?`).
+        WithArgs("client-a", 10, 0).
+        WillReturnRows(tiedRows())
+
+    want := []string{"dev-a", "dev-b", "dev-c", "dev-0"}
+    deviceIDs := func(prefs []models.UserPreference) []string {
+        ids := make([]string, 0, len(prefs))
+        for _, p := range prefs {
+            ids = append(ids, p.DeviceID)
+        }
+        return ids
+    }
+    for i := 0; i < 2; i++ {
+        prefs, err := db.GetAllPreferencesForClient("client-a")
+        if err != nil {
+            t.Fatalf("GetAllPreferencesForClient: %v", err)
+        }
+        if got := deviceIDs(prefs); !reflect.DeepEqual(got, want) {
+            t.Errorf("load %d = %v, want %v", i+1, got, want)
+        }
+    }
+    page, total, err := db.GetPreferencesPageForClient("client-a", 10, 0)
+    if err != nil {
+        t.Fatalf("GetPreferencesPageForClient: %v", err)
+    }
+    if got := deviceIDs(page); total != 4 || !reflect.DeepEqual(got, want) {
+        t.Errorf("page = %v of %d, want %v of 4", got, total, want)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Error(err)
+    }
+}
@@ -0,0 +1,57 @@
+// geo.go provides great-circle helpers for working with vehicle positions.
+
+package geo
+
+import "math"
+
+// earthRadiusMeters is the mean Earth radius used by the Haversine formula
+const earthRadiusMeters = 6371000
+
+// Haversine returns the great-circle distance in meters between two points
+// given in decimal degrees
+func Haversine(lat1, lng1, lat2, lng2 float64) float64 {
+    phi1, phi2 := toRadians(lat1), toRadians(lat2)
+    dPhi := toRadians(lat2 - lat1)
+    dLambda := toRadians(lng2 - lng1)
+
+    a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+        math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+    return 2 * earthRadiusMeters * math.Asin(math.Sqrt(math.Min(1, a)))
+}
+
+// Bearing returns the initial compass bearing in degrees [0, 360) from the
+// first point towards the second
+func Bearing(lat1, lng1, lat2, lng2 float64) float64 {
+    phi1, phi2 := toRadians(lat1), toRadians(lat2)
+    dLambda := toRadians(lng2 - lng1)
+
+    y := math.Sin(dLambda) * math.Cos(phi2)
+    x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+    return math.Mod(toDegrees(math.Atan2(y, x))+360, 360)
+}
+
+func toRadians(deg float64) float64 {
+    return deg * math.Pi / 180
+}
+
+func toDegrees(rad float64) float64 {
+    return rad * 180 / math.Pi
+}
+
+// tileSize is the pixel size of a web map tile at every zoom level
+const tileSize = 256
+
+// maxMercatorLat is the latitude limit of Web Mercator, beyond it y diverges
+const maxMercatorLat = 85.05112878
+
+// MercatorPixel projects a point to global Web Mercator pixel coordinates
+// at the given zoom, as used by map tiles (0,0 is the top-left corner).
+// Latitudes beyond the projection's limit are clamped to it.
+func MercatorPixel(lat, lng float64, zoom int) (x, y float64) {
+    lat = math.Max(-maxMercatorLat, math.Min(maxMercatorLat, lat))
+    scale := float64(tileSize) * math.Exp2(float64(zoom))
+    sinLat := math.Sin(toRadians(lat))
+    x = (lng + 180) / 360 * scale
+    y = (0.5 - math.Log((1+sinLat)/(1-sinLat))/(4*math.Pi)) * scale
+    return x, y
+}
@@ -0,0 +1,64 @@
+// geo_test.go covers the great-circle helpers.
+
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversine(t *testing.T) {
+    tests := []struct {
+        name                   string
+        lat1, lng1, lat2, lng2 float64
+        want                   float64 // meters
+    }{
+        {"same point", 39.7392, -104.9903, 39.7392, -104.9903, 0},
+        {"one degree of latitude", 0, 0, 1, 0, 111195},
+        {"Denver to Boulder", 39.7392, -104.9903, 40.0150, -105.2705, 38780},
+    }
+    for _, tt := range tests {
+        got := Haversine(tt.lat1, tt.lng1, tt.lat2, tt.lng2)
+        if math.Abs(got-tt.want) > tt.want*0.005+1 {
+            t.Errorf("%s: Haversine = %.0f m, want about %.0f m", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestBearing(t *testing.T) {
+    tests := []struct {
+        name                   string
+        lat1, lng1, lat2, lng2 float64
+        want                   float64
+    }{
+        {"north", 0, 0, 1, 0, 0},
+        {"east", 0, 0, 0, 1, 90},
+        {"south", 1, 0, 0, 0, 180},
+        {"west", 0, 1, 0, 0, 270},
+    }
+    for _, tt := range tests {
+        if got := Bearing(tt.lat1, tt.lng1, tt.lat2, tt.lng2); math.Abs(got-tt.want) > 0.01 {
+            t.Errorf("%s: Bearing = %.2f, want %.0f", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestMercatorPixel(t *testing.T) {
+    tests := []struct {
+        name     string
+        lat, lng float64
+        zoom     int
+        x, y     float64
+    }{
+        {"origin at zoom 0", 0, 0, 0, 128, 128},
+        {"top-left corner", 85.05112878, -180, 0, 0, 0},
+        {"origin at zoom 2", 0, 0, 2, 512, 512},
+        {"clamped past the pole", 89.9, 180, 1, 512, 0},
+    }
+    for _, tt := range tests {
+        x, y := MercatorPixel(tt.lat, tt.lng, tt.zoom)
+        if math.Abs(x-tt.x) > 0.01 || math.Abs(y-tt.y) > 0.01 {
+            t.Errorf("%s: MercatorPixel = %.2f,%.2f, want %.2f,%.2f", tt.name, x, y, tt.x, tt.y)
+        }
+    }
+}
@@ -0,0 +1,148 @@
+// api_vehicles.go provides the raw OneStepGPS device payload and its mapping
+// onto the domain Vehicle model
+
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// APIDevice mirrors a device entry in the OneStepGPS result_list.
+// Fields upstream may omit or send as null are pointers, so missing
+// data can be told apart from zero values before mapping.
+type APIDevice struct {
+    DeviceID    string          `json:"device_id"`
+    DisplayName string          `json:"display_name"`
+    ActiveState string          `json:"active_state"`
+    Online      *bool           `json:"online"`
+    LatestPoint *APIDevicePoint `json:"latest_device_point"`
+    DeviceState *APIDeviceState `json:"device_state"`
+}
+
+// APIDevicePoint is the raw latest_device_point object
+type APIDevicePoint struct {
+    DtTracker *time.Time            `json:"dt_tracker"`
+    Lat       *float64              `json:"lat"`
+    Lng       *float64              `json:"lng"`
+    Altitude  *float64              `json:"altitude"`
+    Angle     *float64              `json:"angle"` // Sent as a float by some trackers
+    Speed     *float64              `json:"speed"`
+    Detail    *APIDevicePointDetail `json:"device_point_detail"`
+}
+
+// APIDevicePointDetail is the raw device_point_detail object
+type APIDevicePointDetail struct {
+    Speed        *Measurement `json:"speed"`
+    FuelPercent  *float64     `json:"fuel_percent"`
+    VbusEngineOn *bool        `json:"vbus_engine_on"`
+    VbusInMotion *bool        `json:"vbus_in_motion"`
+}
+
+// APIDeviceState is the raw device_state object
+type APIDeviceState struct {
+    DriveStatus          string       `json:"drive_status"`
+    DriveStatusID        string       `json:"drive_status_id"`
+    DriveStatusDistance  *Measurement `json:"drive_status_distance"`
+    DriveStatusBeginTime *time.Time   `json:"drive_status_begin_time"`
+    DriveStatusDuration  *Measurement `json:"drive_status_duration"`
+}
+
+// APIResponse represents the top-level response from OneStepGPS API.
+// Used when fetching vehicle data in onestepgps/client.go and api/webhooks.go
+type APIResponse struct {
+    ResultList []APIDevice `json:"result_list"`
+}
+
+// Vehicles maps every device in the response to the domain model
+func (r APIResponse) Vehicles() []Vehicle {
+    return VehiclesFromAPI(r.ResultList)
+}
+
+// VehiclesFromAPI maps a list of raw devices, never returning nil
+func VehiclesFromAPI(devices []APIDevice) []Vehicle {
+    vehicles := make([]Vehicle, 0, len(devices))
+    for _, d := range devices {
+        vehicles = append(vehicles, VehicleFromAPI(d))
+    }
+    return vehicles
+}
+
+// VehicleFromAPI maps a raw device onto the domain Vehicle.
+// A device without both coordinates has no LastLocation, see LocationFromAPI.
+func VehicleFromAPI(d APIDevice) Vehicle {
+    v := Vehicle{
+        DeviceID:    d.DeviceID,
+        DisplayName: d.DisplayName,
+        ActiveState: d.ActiveState,
+        Online:      d.Online != nil && *d.Online,
+    }
+
+    v.LastLocation = LocationFromAPI(d.LatestPoint)
+
+    if s := d.DeviceState; s != nil {
+        v.DriveState.Status = s.DriveStatus
+        v.DriveState.StatusID = s.DriveStatusID
+        if s.DriveStatusDistance != nil {
+            v.DriveState.Distance = *s.DriveStatusDistance
+        }
+        if s.DriveStatusBeginTime != nil {
+            v.DriveState.BeginTime = *s.DriveStatusBeginTime
+        }
+        if s.DriveStatusDuration != nil {
+            duration := *s.DriveStatusDuration
+            v.DriveState.Duration = &duration
+            if seconds, ok := duration.Seconds(); ok {
+                v.DriveState.DurationSeconds = &seconds
+            }
+        }
+    }
+
+    // Derived at fetch time, snapshots are refreshed every poll
+    if d, ok := v.CurrentStateDuration(time.Now()); ok {
+        seconds := int64(d / time.Second)
+        v.CurrentStateSeconds = &seconds
+    }
+
+    return v
+}
+
+// LocationFromAPI maps a raw device point onto the domain Location.
+// Returns nil for a missing point or one without both coordinates, since a
+// partial point can't be placed on the map in MapView.vue.
+func LocationFromAPI(p *APIDevicePoint) *Location {
+    if p == nil || p.Lat == nil || p.Lng == nil {
+        return nil
+    }
+    loc := &Location{
+        Latitude:  *p.Lat,
+        Longitude: *p.Lng,
+        Altitude:  p.Altitude,
+        HasFix:    ValidCoordinates(*p.Lat, *p.Lng),
+    }
+    if p.DtTracker != nil {
+        loc.Timestamp = *p.DtTracker
+    }
+    if p.Angle != nil {
+        loc.Heading = int(math.Round(*p.Angle)) % 360
+        loc.HeadingReported = true
+    }
+    if p.Speed != nil {
+        loc.Speed = *p.Speed
+        loc.SpeedReported = true
+    }
+    if detail := p.Detail; detail != nil {
+        if detail.Speed != nil {
+            loc.Detail.Speed = *detail.Speed
+        }
+        loc.Detail.FuelPercent = detail.FuelPercent
+        loc.Detail.EngineOn = detail.VbusEngineOn
+        loc.Detail.InMotion = detail.VbusInMotion
+    }
+    return loc
+}
+
+// APIDevicePointResponse is a page of the device point history endpoint
+type APIDevicePointResponse struct {
+    ResultList []APIDevicePoint `json:"result_list"`
+}
@@ -0,0 +1,175 @@
+// api_vehicles_test.go covers mapping raw OneStepGPS device payloads onto Vehicle.
+
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rawDevices is a result_list as OneStepGPS sends it: one complete device,
+// one with nulls, one without a point and one with half a coordinate
+const rawDevices = `{"result_list":[
+    {
+        "device_id": "dev1",
+        "display_name": "Truck 1",
+        "active_state": "active",
+        "online": true,
+        "latest_device_point": {
+            "dt_tracker": "2024-05-01T12:00:00Z",
+            "lat": 39.7392,
+            "lng": -104.9903,
+            "altitude": 1609.3,
+            "angle": 359.6,
+            "speed": 42.5,
+            "device_point_detail": {
+                "speed": {"value": 42.5, "unit": "mph", "display": "42.5 mph"},
+                "fuel_percent": 73,
+                "vbus_engine_on": true,
+                "vbus_in_motion": false
+            }
+        },
+        "device_state": {
+            "drive_status": "driving",
+            "drive_status_id": "d-1",
+            "drive_status_distance": {"value": 12, "unit": "mi", "display": "12 mi"},
+            "drive_status_begin_time": "2024-05-01T11:30:00Z",
+            "drive_status_duration": {"value": 30, "unit": "min", "display": "30 min"}
+        }
+    },
+    {
+        "device_id": "dev2",
+        "display_name": null,
+        "online": null,
+        "latest_device_point": {
+            "lat": 0,
+            "lng": 0,
+            "angle": null,
+            "speed": null,
+            "device_point_detail": null
+        },
+        "device_state": null
+    },
+    {"device_id": "dev3"},
+    {"device_id": "dev4", "latest_device_point": {"lat": 39.7}}
+]}`
+
+// decodeRawDevices decodes rawDevices and maps it
+func decodeRawDevices(t *testing.T) []Vehicle {
+    t.Helper()
+    var resp APIResponse
+    if err := json.Unmarshal([]byte(rawDevices), &resp); err != nil {
+        t.Fatal(err)
+    }
+    vehicles := resp.Vehicles()
+    if len(vehicles) != 4 {
+        t.Fatalf("got %d vehicles, want 4", len(vehicles))
+    }
+    return vehicles
+}
+
+func TestVehicleFromAPIComplete(t *testing.T) {
+    v := decodeRawDevices(t)[0]
+
+    if v.DeviceID != "dev1" || v.DisplayName != "Truck 1" || v.ActiveState != "active" || !v.Online {
+        t.Errorf("vehicle = %+v", v)
+    }
+
+    loc := v.LastLocation
+    if loc == nil {
+        t.Fatal("LastLocation = nil")
+    }
+    if !loc.Timestamp.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+        t.Errorf("Timestamp = %v", loc.Timestamp)
+    }
+    if loc.Latitude != 39.7392 || loc.Longitude != -104.9903 || !loc.HasFix {
+        t.Errorf("position = %v,%v fix %v", loc.Latitude, loc.Longitude, loc.HasFix)
+    }
+    if loc.Altitude == nil || *loc.Altitude != 1609.3 {
+        t.Errorf("Altitude = %v", loc.Altitude)
+    }
+    // angle is rounded to whole degrees and wrapped, 359.6 becomes 0
+    if loc.Heading != 0 || !loc.HeadingReported {
+        t.Errorf("Heading = %d reported %v, want 0 reported", loc.Heading, loc.HeadingReported)
+    }
+    if loc.Speed != 42.5 || !loc.SpeedReported {
+        t.Errorf("Speed = %v reported %v", loc.Speed, loc.SpeedReported)
+    }
+    if loc.Detail.Speed.Display != "42.5 mph" || loc.Detail.FuelPercent == nil || *loc.Detail.FuelPercent != 73 {
+        t.Errorf("Detail = %+v", loc.Detail)
+    }
+    if loc.Detail.EngineOn == nil || !*loc.Detail.EngineOn || loc.Detail.InMotion == nil || *loc.Detail.InMotion {
+        t.Errorf("engine/motion = %v/%v", loc.Detail.EngineOn, loc.Detail.InMotion)
+    }
+
+    ds := v.DriveState
+    if ds.Status != "driving" || ds.StatusID != "d-1" || ds.Distance.Value != 12 {
+        t.Errorf("DriveState = %+v", ds)
+    }
+    if !ds.BeginTime.Equal(time.Date(2024, 5, 1, 11, 30, 0, 0, time.UTC)) {
+        t.Errorf("BeginTime = %v", ds.BeginTime)
+    }
+    if ds.Duration == nil || ds.DurationSeconds == nil || *ds.DurationSeconds != 1800 {
+        t.Errorf("Duration = %v, seconds %v, want 1800", ds.Duration, ds.DurationSeconds)
+    }
+    if v.CurrentStateSeconds == nil || *v.CurrentStateSeconds <= 0 {
+        t.Errorf("CurrentStateSeconds = %v, want time since the begin time", v.CurrentStateSeconds)
+    }
+}
+
+func TestVehicleFromAPIMissingFields(t *testing.T) {
+    vehicles := decodeRawDevices(t)
+
+    // Nulls map to zero values rather than failing the decode
+    v := vehicles[1]
+    if v.DisplayName != "" || v.Online {
+        t.Errorf("vehicle = %+v", v)
+    }
+    loc := v.LastLocation
+    if loc == nil {
+        t.Fatal("LastLocation = nil, want the 0,0 point")
+    }
+    if loc.HasFix {
+        t.Error("0,0 has a fix")
+    }
+    if loc.HeadingReported || loc.SpeedReported || loc.Altitude != nil || loc.Detail.FuelPercent != nil {
+        t.Errorf("location = %+v, want nothing reported", loc)
+    }
+    if v.DriveState.Duration != nil || v.DriveState.DurationSeconds != nil || v.CurrentStateSeconds != nil {
+        t.Errorf("DriveState = %+v, want no duration", v.DriveState)
+    }
+
+    // No point at all, or only half a coordinate, can't be placed on the map
+    if vehicles[2].LastLocation != nil {
+        t.Errorf("dev3 LastLocation = %+v, want nil", vehicles[2].LastLocation)
+    }
+    if vehicles[3].LastLocation != nil {
+        t.Errorf("dev4 LastLocation = %+v, want nil", vehicles[3].LastLocation)
+    }
+}
+
+func TestVehicleJSONKeepsUpstreamNames(t *testing.T) {
+    data, err := json.Marshal(decodeRawDevices(t)[0])
+    if err != nil {
+        t.Fatal(err)
+    }
+    // The frontend still reads the upstream names, only Go code sees the domain ones
+    for _, key := range []string{`"latest_device_point"`, `"angle":0`, `"dt_tracker"`, `"device_state"`, `"drive_status_duration_seconds":1800`} {
+        if !strings.Contains(string(data), key) {
+            t.Errorf("%s missing from %s", key, data)
+        }
+    }
+    for _, key := range []string{"HeadingReported", "SpeedReported"} {
+        if strings.Contains(string(data), key) {
+            t.Errorf("%s serialized in %s", key, data)
+        }
+    }
+}
+
+func TestVehiclesFromAPIEmpty(t *testing.T) {
+    if vehicles := VehiclesFromAPI(nil); vehicles == nil || len(vehicles) != 0 {
+        t.Errorf("VehiclesFromAPI(nil) = %#v, want an empty list", vehicles)
+    }
+}
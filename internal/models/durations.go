@@ -0,0 +1,47 @@
+// durations.go converts OneStepGPS duration measurements (e.g. drive_status_duration)
+// to seconds for the frontend.
+
+package models
+
+import (
+	"math"
+	"strings"
+)
+
+// secondsPerUnit maps the duration units OneStepGPS sends to seconds
+var secondsPerUnit = map[string]float64{
+    "ms":      0.001,
+    "s":       1,
+    "sec":     1,
+    "secs":    1,
+    "second":  1,
+    "seconds": 1,
+    "m":       60,
+    "min":     60,
+    "mins":    60,
+    "minute":  60,
+    "minutes": 60,
+    "h":       3600,
+    "hr":      3600,
+    "hrs":     3600,
+    "hour":    3600,
+    "hours":   3600,
+    "d":       86400,
+    "day":     86400,
+    "days":    86400,
+}
+
+// Seconds converts a duration measurement to whole seconds.
+// ok is false when the unit isn't a known duration unit. A missing unit is
+// taken as seconds, the unit upstream uses for durations.
+func (m Measurement) Seconds() (seconds int64, ok bool) {
+    unit := strings.ToLower(strings.TrimSpace(m.Unit))
+    if unit == "" {
+        unit = "s"
+    }
+    factor, ok := secondsPerUnit[unit]
+    if !ok {
+        return 0, false
+    }
+    return int64(math.Round(m.Value * factor)), true
+}
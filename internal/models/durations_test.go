@@ -0,0 +1,44 @@
+// durations_test.go covers converting duration measurements to seconds.
+
+package models
+
+import "testing"
+
+func TestMeasurementSeconds(t *testing.T) {
+    tests := []struct {
+        m      Measurement
+        want   int64
+        wantOK bool
+    }{
+        {Measurement{Value: 45, Unit: "s"}, 45, true},
+        {Measurement{Value: 30, Unit: "min"}, 1800, true},
+        {Measurement{Value: 1.5, Unit: " Hours "}, 5400, true},
+        {Measurement{Value: 2, Unit: "d"}, 172800, true},
+        {Measurement{Value: 1500, Unit: "ms"}, 2, true}, // Rounded to whole seconds
+        {Measurement{Value: 90}, 90, true},               // No unit means seconds
+        {Measurement{Value: 12, Unit: "mi"}, 0, false},
+    }
+    for _, tt := range tests {
+        got, ok := tt.m.Seconds()
+        if got != tt.want || ok != tt.wantOK {
+            t.Errorf("%+v.Seconds() = %d, %v, want %d, %v", tt.m, got, ok, tt.want, tt.wantOK)
+        }
+    }
+}
+
+func TestVehicleFromAPIUnknownDurationUnit(t *testing.T) {
+    v := VehicleFromAPI(APIDevice{
+        DeviceID: "dev1",
+        DeviceState: &APIDeviceState{
+            DriveStatus:         "idle",
+            DriveStatusDuration: &Measurement{Value: 3, Unit: "laps", Display: "3 laps"},
+        },
+    })
+    // The raw measurement is still passed through, only the seconds are omitted
+    if v.DriveState.Duration == nil || v.DriveState.Duration.Display != "3 laps" {
+        t.Errorf("Duration = %+v, want the upstream measurement", v.DriveState.Duration)
+    }
+    if v.DriveState.DurationSeconds != nil {
+        t.Errorf("DurationSeconds = %d, want nil for an unknown unit", *v.DriveState.DurationSeconds)
+    }
+}
@@ -0,0 +1,74 @@
+// errors.go provides data structures for error payloads returned by OneStepGPS
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// APIError represents an error returned by the OneStepGPS API.
+// Upstream sends errors either as a bare string ("error": "bad key") or as an
+// object with a code and message, so UnmarshalJSON accepts both shapes.
+type APIError struct {
+    StatusCode int    `json:"-"`              // HTTP status of the upstream response
+    Code       string `json:"code,omitempty"` // Upstream error code, if provided
+    Message    string `json:"message"`        // Human readable error message
+}
+
+// Error implements the error interface so APIError can be returned directly
+// from onestepgps.Client methods.
+func (e *APIError) Error() string {
+    switch {
+    case e.Code != "" && e.StatusCode != 0:
+        return fmt.Sprintf("OneStepGPS API error (status %d, code %s): %s", e.StatusCode, e.Code, e.Message)
+    case e.StatusCode != 0:
+        return fmt.Sprintf("OneStepGPS API error (status %d): %s", e.StatusCode, e.Message)
+    case e.Code != "":
+        return fmt.Sprintf("OneStepGPS API error (code %s): %s", e.Code, e.Message)
+    default:
+        return fmt.Sprintf("OneStepGPS API error: %s", e.Message)
+    }
+}
+
+// IsEmpty reports whether the payload carried no error information,
+// e.g. when upstream sends "error": "" on a successful response.
+func (e *APIError) IsEmpty() bool {
+    return e == nil || (e.Code == "" && e.Message == "")
+}
+
+// UnmarshalJSON decodes both the string and object forms of an upstream error.
+func (e *APIError) UnmarshalJSON(data []byte) error {
+    // Bare string form: "error": "message"
+    var msg string
+    if err := json.Unmarshal(data, &msg); err == nil {
+        e.Message = msg
+        return nil
+    }
+
+    // Object form: "error": {"code": ..., "message": ...}
+    // Code can be numeric or a string depending on the endpoint
+    var obj struct {
+        Code    interface{} `json:"code"`
+        Message string      `json:"message"`
+        Error   string      `json:"error"`
+    }
+    if err := json.Unmarshal(data, &obj); err != nil {
+        return fmt.Errorf("error decoding API error: %w", err)
+    }
+
+    e.Message = obj.Message
+    if e.Message == "" {
+        e.Message = obj.Error
+    }
+    switch code := obj.Code.(type) {
+    case nil:
+    case string:
+        e.Code = code
+    case float64:
+        e.Code = fmt.Sprintf("%.0f", code)
+    default:
+        e.Code = fmt.Sprint(code)
+    }
+    return nil
+}
@@ -0,0 +1,76 @@
+// errors_test.go covers decoding OneStepGPS error payloads.
+
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAPIErrorUnmarshal(t *testing.T) {
+    tests := []struct {
+        name        string
+        payload     string
+        wantCode    string
+        wantMessage string
+        wantErr     bool
+    }{
+        {"string", `"bad api key"`, "", "bad api key", false},
+        {"empty string", `""`, "", "", false},
+        {"object", `{"code":"invalid_key","message":"bad api key"}`, "invalid_key", "bad api key", false},
+        {"numeric code", `{"code":401,"message":"unauthorized"}`, "401", "unauthorized", false},
+        {"object with error field", `{"error":"rate limited"}`, "", "rate limited", false},
+        {"empty object", `{}`, "", "", false},
+        {"number", `42`, "", "", true},
+        {"array", `["bad"]`, "", "", true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var e APIError
+            err := json.Unmarshal([]byte(tt.payload), &e)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatalf("got %+v, want an error", e)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if e.Code != tt.wantCode || e.Message != tt.wantMessage {
+                t.Errorf("got code %q message %q, want %q %q", e.Code, e.Message, tt.wantCode, tt.wantMessage)
+            }
+        })
+    }
+}
+
+func TestAPIErrorInResponse(t *testing.T) {
+    // Garbage inside the error field fails the whole decode, like any bad field
+    var payload struct {
+        Error *APIError `json:"error"`
+    }
+    if err := json.Unmarshal([]byte(`{"error":true}`), &payload); err == nil {
+        t.Error("boolean error field decoded without error")
+    }
+    payload.Error = nil
+    if err := json.Unmarshal([]byte(`{"error":null}`), &payload); err != nil || !payload.Error.IsEmpty() {
+        t.Errorf("null error field: got %+v, %v, want empty", payload.Error, err)
+    }
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+    tests := []struct {
+        err  APIError
+        want string
+    }{
+        {APIError{StatusCode: 401, Code: "invalid_key", Message: "bad key"}, "OneStepGPS API error (status 401, code invalid_key): bad key"},
+        {APIError{StatusCode: 500, Message: "boom"}, "OneStepGPS API error (status 500): boom"},
+        {APIError{Code: "x", Message: "boom"}, "OneStepGPS API error (code x): boom"},
+        {APIError{Message: "boom"}, "OneStepGPS API error: boom"},
+    }
+    for _, tt := range tests {
+        if got := tt.err.Error(); got != tt.want {
+            t.Errorf("got %q, want %q", got, tt.want)
+        }
+    }
+}
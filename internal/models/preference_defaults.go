@@ -0,0 +1,70 @@
+// preference_defaults.go describes how devices without a stored preference
+// are treated, e.g. a newly added vehicle the client hasn't seen yet.
+
+package models
+
+import "fmt"
+
+// Visibility of devices without a preference, UNPREFERENCED_VISIBILITY
+const (
+    UnpreferencedVisible = "visible" // Shown until the client hides them
+    UnpreferencedHidden  = "hidden"  // Hidden until the client saves a preference for them
+)
+
+// Placement of devices without a preference in preference order, UNPREFERENCED_ORDER
+const (
+    UnpreferencedLast  = "last"
+    UnpreferencedFirst = "first" // Puts new devices where they'll be noticed
+)
+
+// PreferenceDefaults stands in for the missing preference row of a device.
+// The zero value keeps devices visible and sorted last under their
+// upstream name, the behavior before these were configurable.
+type PreferenceDefaults struct {
+    Hidden bool // Devices without a preference are hidden
+    First  bool // Devices without a preference sort before the others
+}
+
+// ParsePreferenceDefaults reads UNPREFERENCED_VISIBILITY and
+// UNPREFERENCED_ORDER values, empty strings keep the defaults
+func ParsePreferenceDefaults(visibility, order string) (PreferenceDefaults, error) {
+    var d PreferenceDefaults
+    switch visibility {
+    case "", UnpreferencedVisible:
+    case UnpreferencedHidden:
+        d.Hidden = true
+    default:
+        return d, fmt.Errorf("invalid unpreferenced visibility %q: must be %s or %s", visibility, UnpreferencedVisible, UnpreferencedHidden)
+    }
+    switch order {
+    case "", UnpreferencedLast:
+    case UnpreferencedFirst:
+        d.First = true
+    default:
+        return d, fmt.Errorf("invalid unpreferenced order %q: must be %s or %s", order, UnpreferencedLast, UnpreferencedFirst)
+    }
+    return d, nil
+}
+
+// IsHidden reports whether a device with the given preference, nil when
+// it has none, is hidden
+func (d PreferenceDefaults) IsHidden(pref *UserPreference) bool {
+    if pref == nil {
+        return d.Hidden
+    }
+    return pref.IsHidden
+}
+
+// Less orders vehicles by sortOrder, each device's sort_order, the order
+// VehiclePreferences.vue shows them in. Devices missing from sortOrder go
+// first or last per d.First, a stable sort keeps their upstream order.
+func (d PreferenceDefaults) Less(sortOrder map[string]int) func(a, b *Vehicle) bool {
+    return func(a, b *Vehicle) bool {
+        aOrder, aOK := sortOrder[a.DeviceID]
+        bOrder, bOK := sortOrder[b.DeviceID]
+        if aOK != bOK {
+            return aOK != d.First // The one with a preference wins unless new devices go first
+        }
+        return aOK && aOrder < bOrder
+    }
+}
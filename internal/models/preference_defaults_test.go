@@ -0,0 +1,46 @@
+// preference_defaults_test.go covers the stand-in for a missing preference row.
+
+package models
+
+import "testing"
+
+func TestParsePreferenceDefaults(t *testing.T) {
+    tests := []struct {
+        visibility, order string
+        want              PreferenceDefaults
+        wantErr           bool
+    }{
+        {"", "", PreferenceDefaults{}, false},
+        {"visible", "last", PreferenceDefaults{}, false},
+        {"hidden", "", PreferenceDefaults{Hidden: true}, false},
+        {"", "first", PreferenceDefaults{First: true}, false},
+        {"hidden", "first", PreferenceDefaults{Hidden: true, First: true}, false},
+        {"invisible", "", PreferenceDefaults{}, true},
+        {"", "top", PreferenceDefaults{}, true},
+    }
+    for _, tt := range tests {
+        got, err := ParsePreferenceDefaults(tt.visibility, tt.order)
+        if (err != nil) != tt.wantErr {
+            t.Errorf("ParsePreferenceDefaults(%q, %q) error = %v, want error %v", tt.visibility, tt.order, err, tt.wantErr)
+            continue
+        }
+        if err == nil && got != tt.want {
+            t.Errorf("ParsePreferenceDefaults(%q, %q) = %+v, want %+v", tt.visibility, tt.order, got, tt.want)
+        }
+    }
+}
+
+func TestPreferenceDefaultsIsHidden(t *testing.T) {
+    shown := &UserPreference{DeviceID: "dev1"}
+    hidden := &UserPreference{DeviceID: "dev2", IsHidden: true}
+
+    // A stored preference always decides, the default only fills in for none
+    for _, d := range []PreferenceDefaults{{}, {Hidden: true}} {
+        if d.IsHidden(shown) || !d.IsHidden(hidden) {
+            t.Errorf("%+v overrode a stored preference", d)
+        }
+        if got := d.IsHidden(nil); got != d.Hidden {
+            t.Errorf("%+v: IsHidden(nil) = %v, want %v", d, got, d.Hidden)
+        }
+    }
+}
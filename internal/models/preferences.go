@@ -2,7 +2,13 @@
 
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
 
 // UserPreference represents a stored vehicle display preference in the database.
 // Used by VehiclePreferences.vue to customize how vehicles are shown in the UI.
@@ -13,6 +19,7 @@ type UserPreference struct {
     DisplayName string    `json:"display_name"` // Custom name shown in VehicleList.vue
     IsHidden    bool      `json:"is_hidden"`
     SortOrder   int       `json:"sort_order"`
+    Metadata    map[string]interface{} `json:"metadata"` // Free-form UI state (color, icon, notes, units), null when unset
     CreatedAt   time.Time `json:"created_at"`
     UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -24,7 +31,20 @@ type PreferenceCreate struct {
     ClientID    string `json:"client_id"`
     DisplayName string `json:"display_name,omitempty"`
     IsHidden    bool   `json:"is_hidden"`
-    SortOrder   int    `json:"sort_order"`
+    SortOrder   *int   `json:"sort_order,omitempty"` // nil appends after the client's last preference
+    Metadata    map[string]interface{} `json:"metadata,omitempty"` // nil keeps the stored metadata
+}
+
+// Matches reports whether saving p over existing would leave it as is.
+// A nil SortOrder keeps the existing position, so it always matches.
+func (p PreferenceCreate) Matches(existing *UserPreference) bool {
+    if existing == nil {
+        return false
+    }
+    return p.DisplayName == existing.DisplayName &&
+        p.IsHidden == existing.IsHidden &&
+        (p.SortOrder == nil || *p.SortOrder == existing.SortOrder) &&
+        (p.Metadata == nil || reflect.DeepEqual(p.Metadata, existing.Metadata))
 }
 
 // PreferenceUpdate represents a partial update to existing preferences.
@@ -34,4 +54,52 @@ type PreferenceUpdate struct {
 	DisplayName *string `json:"display_name,omitempty"`
 	IsHidden    *bool   `json:"is_hidden,omitempty"`
 	SortOrder   *int    `json:"sort_order,omitempty"`
-}
\ No newline at end of file
+	Metadata    map[string]interface{} `json:"metadata,omitempty"` // Replaces the stored metadata as a whole
+}
+
+// Column limits for user_preferences, see database.CreateTableIfNotExists
+const (
+    maxPreferenceFieldLength = 255
+    maxMetadataBytes         = 4096 // Encoded JSON, metadata is for small bits of UI state
+)
+
+// Validate checks a preference before it is written.
+// Used by the preference handlers to reject malformed items up front.
+func (p *PreferenceCreate) Validate() error {
+    if p.DeviceID == "" {
+        return errors.New("device_id is required")
+    }
+    if len(p.DeviceID) > maxPreferenceFieldLength {
+        return errors.New("device_id exceeds 255 characters")
+    }
+    if len(p.ClientID) > maxPreferenceFieldLength {
+        return errors.New("client_id exceeds 255 characters")
+    }
+    if len(p.DisplayName) > maxPreferenceFieldLength {
+        return errors.New("display_name exceeds 255 characters")
+    }
+    return validateMetadata(p.Metadata)
+}
+
+// Validate checks the fields of a partial update that have limits
+func (u *PreferenceUpdate) Validate() error {
+    if u.DisplayName != nil && len(*u.DisplayName) > maxPreferenceFieldLength {
+        return errors.New("display_name exceeds 255 characters")
+    }
+    return validateMetadata(u.Metadata)
+}
+
+// validateMetadata rejects metadata larger than maxMetadataBytes once encoded
+func validateMetadata(metadata map[string]interface{}) error {
+    if metadata == nil {
+        return nil
+    }
+    data, err := json.Marshal(metadata)
+    if err != nil {
+        return fmt.Errorf("metadata is not valid JSON: %w", err)
+    }
+    if len(data) > maxMetadataBytes {
+        return fmt.Errorf("metadata exceeds %d bytes (got %d)", maxMetadataBytes, len(data))
+    }
+    return nil
+}
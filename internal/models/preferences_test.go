@@ -0,0 +1,71 @@
+// preferences_test.go covers preference validation limits.
+
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreferenceMetadataSize(t *testing.T) {
+    // {"notes":"..."} is 12 bytes of JSON around the value
+    fits := map[string]interface{}{"notes": strings.Repeat("a", maxMetadataBytes-12)}
+    oversized := map[string]interface{}{"notes": strings.Repeat("a", maxMetadataBytes-11)}
+
+    tests := []struct {
+        name     string
+        metadata map[string]interface{}
+        wantErr  bool
+    }{
+        {"none", nil, false},
+        {"small", map[string]interface{}{"color": "#ff0000", "icon": "truck"}, false},
+        {"at limit", fits, false},
+        {"over limit", oversized, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            create := PreferenceCreate{DeviceID: "dev-1", Metadata: tt.metadata}
+            if err := create.Validate(); (err != nil) != tt.wantErr {
+                t.Errorf("PreferenceCreate.Validate() = %v, wantErr %v", err, tt.wantErr)
+            }
+            update := PreferenceUpdate{Metadata: tt.metadata}
+            if err := update.Validate(); (err != nil) != tt.wantErr {
+                t.Errorf("PreferenceUpdate.Validate() = %v, wantErr %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestPreferenceMetadataNotJSON(t *testing.T) {
+    create := PreferenceCreate{DeviceID: "dev-1", Metadata: map[string]interface{}{"bad": func() {}}}
+    if err := create.Validate(); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+        t.Errorf("Validate() = %v, want a not valid JSON error", err)
+    }
+}
+
+func TestPreferenceCreateMatches(t *testing.T) {
+    order := func(n int) *int { return &n }
+    existing := &UserPreference{DisplayName: "Truck", IsHidden: true, SortOrder: 3, Metadata: map[string]interface{}{"depot": "north"}}
+
+    tests := []struct {
+        name string
+        p    PreferenceCreate
+        want bool
+    }{
+        {"same values", PreferenceCreate{DisplayName: "Truck", IsHidden: true, SortOrder: order(3)}, true},
+        {"omitted sort_order keeps the position", PreferenceCreate{DisplayName: "Truck", IsHidden: true}, true},
+        {"same metadata", PreferenceCreate{DisplayName: "Truck", IsHidden: true, Metadata: map[string]interface{}{"depot": "north"}}, true},
+        {"renamed", PreferenceCreate{DisplayName: "Van", IsHidden: true}, false},
+        {"shown", PreferenceCreate{DisplayName: "Truck"}, false},
+        {"moved", PreferenceCreate{DisplayName: "Truck", IsHidden: true, SortOrder: order(0)}, false},
+        {"new metadata", PreferenceCreate{DisplayName: "Truck", IsHidden: true, Metadata: map[string]interface{}{"depot": "south"}}, false},
+    }
+    for _, tt := range tests {
+        if got := tt.p.Matches(existing); got != tt.want {
+            t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+        }
+    }
+    if (PreferenceCreate{DisplayName: "Truck"}).Matches(nil) {
+        t.Error("Matches(nil) = true, want false for a preference that doesn't exist yet")
+    }
+}
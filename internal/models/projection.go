@@ -0,0 +1,88 @@
+// projection.go trims vehicles down to a requested set of fields, for
+// lightweight payloads (e.g. mobile clients that only need id and position).
+
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// vehicleFields are the fields a projection may request, flattened so
+// location fields sit next to the vehicle's own. Location fields are null
+// for vehicles without a position.
+var vehicleFields = map[string]func(v *Vehicle) interface{}{
+    "device_id":    func(v *Vehicle) interface{} { return v.DeviceID },
+    "display_name": func(v *Vehicle) interface{} { return v.DisplayName },
+    "active_state": func(v *Vehicle) interface{} { return v.ActiveState },
+    "online":       func(v *Vehicle) interface{} { return v.Online },
+    "drive_status": func(v *Vehicle) interface{} { return v.DriveState.Status },
+    "lat":          locationField(func(l *Location) interface{} { return l.Latitude }),
+    "lng":          locationField(func(l *Location) interface{} { return l.Longitude }),
+    "speed":        locationField(func(l *Location) interface{} { return l.Speed }),
+    "angle":        locationField(func(l *Location) interface{} { return l.Heading }),
+    "altitude":     locationField(func(l *Location) interface{} { return l.Altitude }),
+    "dt_tracker":   locationField(func(l *Location) interface{} { return l.Timestamp }),
+    "has_fix":      locationField(func(l *Location) interface{} { return l.HasFix }),
+}
+
+func locationField(get func(l *Location) interface{}) func(v *Vehicle) interface{} {
+    return func(v *Vehicle) interface{} {
+        if v.LastLocation == nil {
+            return nil
+        }
+        return get(v.LastLocation)
+    }
+}
+
+// ParseVehicleFields splits a comma-separated field list and checks every
+// entry against the whitelist, listing all unknown fields in the error.
+// Duplicates are dropped, keeping the requested order.
+func ParseVehicleFields(raw string) ([]string, error) {
+    var fields, unknown []string
+    seen := make(map[string]bool)
+    for _, f := range strings.Split(raw, ",") {
+        f = strings.ToLower(strings.TrimSpace(f))
+        if f == "" || seen[f] {
+            continue
+        }
+        seen[f] = true
+        if _, ok := vehicleFields[f]; !ok {
+            unknown = append(unknown, f)
+            continue
+        }
+        fields = append(fields, f)
+    }
+    if len(unknown) > 0 {
+        return nil, fmt.Errorf("unknown fields %s, allowed: %s", strings.Join(unknown, ", "), strings.Join(VehicleFieldNames(), ", "))
+    }
+    if len(fields) == 0 {
+        return nil, fmt.Errorf("fields must list at least one field")
+    }
+    return fields, nil
+}
+
+// VehicleFieldNames returns the fields a projection may request, sorted
+func VehicleFieldNames() []string {
+    names := make([]string, 0, len(vehicleFields))
+    for name := range vehicleFields {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// ProjectVehicles returns each vehicle as an object holding only fields,
+// which must come from ParseVehicleFields
+func ProjectVehicles(vehicles []Vehicle, fields []string) []map[string]interface{} {
+    projected := make([]map[string]interface{}, 0, len(vehicles))
+    for i := range vehicles {
+        item := make(map[string]interface{}, len(fields))
+        for _, f := range fields {
+            item[f] = vehicleFields[f](&vehicles[i])
+        }
+        projected = append(projected, item)
+    }
+    return projected
+}
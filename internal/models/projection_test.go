@@ -0,0 +1,54 @@
+// projection_test.go covers parsing field lists and projecting vehicles to them.
+
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVehicleFields(t *testing.T) {
+    tests := []struct {
+        raw     string
+        want    []string
+        wantErr string
+    }{
+        {"device_id,lat,lng,speed", []string{"device_id", "lat", "lng", "speed"}, ""},
+        {" LAT , device_id,lat,", []string{"lat", "device_id"}, ""},
+        {"device_id,password,lat,secret", nil, "password, secret"},
+        {" , ,", nil, "at least one field"},
+    }
+    for _, tt := range tests {
+        got, err := ParseVehicleFields(tt.raw)
+        if tt.wantErr != "" {
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Errorf("ParseVehicleFields(%q) error = %v, want one mentioning %s", tt.raw, err, tt.wantErr)
+            }
+            continue
+        }
+        if err != nil || !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("ParseVehicleFields(%q) = %v, %v, want %v", tt.raw, got, err, tt.want)
+        }
+    }
+}
+
+func TestProjectVehicles(t *testing.T) {
+    vehicles := []Vehicle{
+        {DeviceID: "dev1", DisplayName: "Truck", LastLocation: &Location{Latitude: 39.7, Longitude: -104.9, Speed: 42}},
+        {DeviceID: "dev2", DisplayName: "Van"}, // No position yet
+    }
+
+    got := ProjectVehicles(vehicles, []string{"device_id", "lat", "lng"})
+    want := []map[string]interface{}{
+        {"device_id": "dev1", "lat": 39.7, "lng": -104.9},
+        {"device_id": "dev2", "lat": nil, "lng": nil},
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("projected = %v, want %v", got, want)
+    }
+
+    if got := ProjectVehicles(nil, []string{"device_id"}); got == nil || len(got) != 0 {
+        t.Errorf("ProjectVehicles(nil) = %#v, want an empty list", got)
+    }
+}
@@ -0,0 +1,111 @@
+// report_diff.go compares two report specs field by field, so ReportDialog.vue
+// can show how a saved report differs from a new request.
+
+package models
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FieldChange is one field whose value differs between two specs
+type FieldChange struct {
+    Field string      `json:"field"` // JSON name, report_options.<key> for options
+    From  interface{} `json:"from"`
+    To    interface{} `json:"to"`
+}
+
+// ReportSpecDiff is the difference from one spec to another.
+// Lists are compared as sets, so reordering devices isn't a change.
+type ReportSpecDiff struct {
+    Identical           bool          `json:"identical"`
+    DevicesAdded        []string      `json:"devices_added"`
+    DevicesRemoved      []string      `json:"devices_removed"`
+    OutputFieldsAdded   []string      `json:"output_fields_added"`
+    OutputFieldsRemoved []string      `json:"output_fields_removed"`
+    FormatsAdded        []string      `json:"formats_added"`
+    FormatsRemoved      []string      `json:"formats_removed"`
+    Changes             []FieldChange `json:"changes"` // Scalar fields, date range and report options
+}
+
+// DiffReportSpecs returns what changed going from spec a to spec b
+func DiffReportSpecs(a, b ReportSpec) ReportSpecDiff {
+    diff := ReportSpecDiff{Changes: []FieldChange{}}
+    diff.DevicesAdded, diff.DevicesRemoved = diffStringSets(a.DeviceIDList, b.DeviceIDList)
+    diff.OutputFieldsAdded, diff.OutputFieldsRemoved = diffStringSets(a.ReportOutputFieldList, b.ReportOutputFieldList)
+    diff.FormatsAdded, diff.FormatsRemoved = diffStringSets(a.Formats, b.Formats)
+
+    scalars := []FieldChange{
+        {"user_report_name", a.UserReportName, b.UserReportName},
+        {"report_type", a.ReportType, b.ReportType},
+        {"datetime_from", a.DateTimeFrom, b.DateTimeFrom},
+        {"datetime_to", a.DateTimeTo, b.DateTimeTo},
+        {"only_active", a.OnlyActive, b.OnlyActive},
+        {"min_engine_time", a.MinEngineTime, b.MinEngineTime},
+        {"file_type", a.FileType, b.FileType},
+        {"all_devices", a.AllDevices, b.AllDevices},
+        {"include_hidden", a.IncludeHidden, b.IncludeHidden},
+    }
+    for _, c := range scalars {
+        if c.From != c.To {
+            diff.Changes = append(diff.Changes, c)
+        }
+    }
+
+    // Options are compared per key, a missing key shows as null
+    keys := make(map[string]bool, len(a.ReportOptions)+len(b.ReportOptions))
+    for k := range a.ReportOptions {
+        keys[k] = true
+    }
+    for k := range b.ReportOptions {
+        keys[k] = true
+    }
+    sortedKeys := make([]string, 0, len(keys))
+    for k := range keys {
+        sortedKeys = append(sortedKeys, k)
+    }
+    sort.Strings(sortedKeys)
+    for _, k := range sortedKeys {
+        from, to := a.ReportOptions[k], b.ReportOptions[k]
+        if !reflect.DeepEqual(from, to) {
+            diff.Changes = append(diff.Changes, FieldChange{Field: "report_options." + k, From: from, To: to})
+        }
+    }
+
+    diff.Identical = len(diff.Changes) == 0 &&
+        len(diff.DevicesAdded)+len(diff.DevicesRemoved) == 0 &&
+        len(diff.OutputFieldsAdded)+len(diff.OutputFieldsRemoved) == 0 &&
+        len(diff.FormatsAdded)+len(diff.FormatsRemoved) == 0
+    return diff
+}
+
+// diffStringSets returns entries only in b (added) and only in a (removed),
+// sorted and never nil. Comparison ignores case and surrounding spaces.
+func diffStringSets(a, b []string) (added, removed []string) {
+    normalize := func(list []string) map[string]string {
+        set := make(map[string]string, len(list))
+        for _, v := range list {
+            if key := strings.ToLower(strings.TrimSpace(v)); key != "" {
+                set[key] = v
+            }
+        }
+        return set
+    }
+    setA, setB := normalize(a), normalize(b)
+
+    added, removed = []string{}, []string{}
+    for k, v := range setB {
+        if _, ok := setA[k]; !ok {
+            added = append(added, v)
+        }
+    }
+    for k, v := range setA {
+        if _, ok := setB[k]; !ok {
+            removed = append(removed, v)
+        }
+    }
+    sort.Strings(added)
+    sort.Strings(removed)
+    return added, removed
+}
@@ -0,0 +1,66 @@
+// report_diff_test.go covers comparing two report specs.
+
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffReportSpecs(t *testing.T) {
+    saved := ReportSpec{
+        ReportType:            "general_info",
+        DeviceIDList:          []string{"dev1", "dev2", "dev3"},
+        DateTimeFrom:          "2024-05-01T00:00:00Z",
+        DateTimeTo:            "2024-05-07T00:00:00Z",
+        ReportOutputFieldList: []string{"distance", "stops"},
+        ReportOptions:         map[string]interface{}{"group_by": "day", "timezone": "UTC"},
+        FileType:              "pdf",
+    }
+    next := ReportSpec{
+        ReportType:            "general_info",
+        DeviceIDList:          []string{"DEV3", "dev1", "dev4"}, // Reordered, dev2 swapped for dev4
+        DateTimeFrom:          "2024-05-01T00:00:00Z",
+        DateTimeTo:            "2024-05-14T00:00:00Z",
+        ReportOutputFieldList: []string{"distance", "stops", "idle_time"},
+        ReportOptions:         map[string]interface{}{"group_by": "week", "units": "metric"},
+        FileType:              "csv",
+    }
+
+    diff := DiffReportSpecs(saved, next)
+    if diff.Identical {
+        t.Error("Identical = true")
+    }
+    if !reflect.DeepEqual(diff.DevicesAdded, []string{"dev4"}) || !reflect.DeepEqual(diff.DevicesRemoved, []string{"dev2"}) {
+        t.Errorf("devices added %v, removed %v; want [dev4], [dev2]", diff.DevicesAdded, diff.DevicesRemoved)
+    }
+    if !reflect.DeepEqual(diff.OutputFieldsAdded, []string{"idle_time"}) || len(diff.OutputFieldsRemoved) != 0 {
+        t.Errorf("output fields added %v, removed %v", diff.OutputFieldsAdded, diff.OutputFieldsRemoved)
+    }
+
+    // Scalars in declaration order, then options sorted by key
+    want := []FieldChange{
+        {"datetime_to", "2024-05-07T00:00:00Z", "2024-05-14T00:00:00Z"},
+        {"file_type", "pdf", "csv"},
+        {"report_options.group_by", "day", "week"},
+        {"report_options.timezone", "UTC", nil},
+        {"report_options.units", nil, "metric"},
+    }
+    if !reflect.DeepEqual(diff.Changes, want) {
+        t.Errorf("changes = %+v, want %+v", diff.Changes, want)
+    }
+}
+
+func TestDiffReportSpecsIdentical(t *testing.T) {
+    a := ReportSpec{ReportType: "trips", DeviceIDList: []string{"dev1", "dev2"}, ReportOptions: map[string]interface{}{"n": 1.0}}
+    b := ReportSpec{ReportType: "trips", DeviceIDList: []string{"dev2", " dev1 "}, ReportOptions: map[string]interface{}{"n": 1.0}}
+
+    diff := DiffReportSpecs(a, b)
+    if !diff.Identical || len(diff.Changes) != 0 {
+        t.Errorf("diff = %+v, want identical", diff)
+    }
+    // Lists are empty rather than null for the frontend
+    if diff.DevicesAdded == nil || diff.FormatsRemoved == nil {
+        t.Errorf("diff lists = %v / %v, want empty", diff.DevicesAdded, diff.FormatsRemoved)
+    }
+}
@@ -0,0 +1,115 @@
+// report_progress.go parses the loosely typed "progress" map OneStepGPS
+// returns while generating a report, so ReportDialog.vue can show a real
+// progress bar instead of a spinner.
+
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ReportProgress is how far along an upstream report generation is.
+// Every field is optional since upstream only sends some of them, and
+// sometimes none at all.
+type ReportProgress struct {
+    Percent     *float64 `json:"percent,omitempty"`      // 0-100
+    CurrentStep string   `json:"current_step,omitempty"` // e.g. "collecting data"
+    ItemsDone   *int     `json:"items_done,omitempty"`
+    ItemsTotal  *int     `json:"items_total,omitempty"`
+}
+
+// Keys upstream has been seen to use for each progress value, first match wins
+var (
+    progressPercentKeys = []string{"percent", "percentage", "pct", "progress"}
+    progressStepKeys    = []string{"current_step", "step", "stage", "status_text", "message"}
+    progressDoneKeys    = []string{"items_done", "done", "completed", "processed", "current"}
+    progressTotalKeys   = []string{"items_total", "total", "count", "of"}
+)
+
+// ParseReportProgress extracts a ReportProgress from an upstream progress map.
+// Numbers may arrive as JSON numbers or strings ("45", "45%"), and a percent
+// below 1 with no "%" is read as a fraction. When no percent is sent it
+// is derived from items done/total. Returns nil when nothing usable is found.
+func ParseReportProgress(raw map[string]interface{}) *ReportProgress {
+    if len(raw) == 0 {
+        return nil
+    }
+
+    var p ReportProgress
+    if v, ok := progressNumber(raw, progressPercentKeys, true); ok {
+        p.Percent = &v
+    }
+    p.CurrentStep = progressString(raw, progressStepKeys)
+    if v, ok := progressNumber(raw, progressDoneKeys, false); ok && v >= 0 {
+        n := int(v)
+        p.ItemsDone = &n
+    }
+    if v, ok := progressNumber(raw, progressTotalKeys, false); ok && v > 0 {
+        n := int(v)
+        p.ItemsTotal = &n
+    }
+
+    if p.Percent == nil && p.ItemsDone != nil && p.ItemsTotal != nil {
+        pct := float64(*p.ItemsDone) / float64(*p.ItemsTotal) * 100
+        p.Percent = &pct
+    }
+    if p.Percent != nil {
+        pct := math.Round(math.Max(0, math.Min(100, *p.Percent))*10) / 10
+        p.Percent = &pct
+    }
+
+    if p.Percent == nil && p.CurrentStep == "" && p.ItemsDone == nil && p.ItemsTotal == nil {
+        return nil
+    }
+    return &p
+}
+
+// progressNumber returns the first key in keys holding a number.
+// Percents below 1 without a "%" are fractions and scaled to 0-100.
+func progressNumber(raw map[string]interface{}, keys []string, percent bool) (float64, bool) {
+    for _, key := range keys {
+        var f float64
+        explicit := false
+        switch v := raw[key].(type) {
+        case float64:
+            f = v
+        case json.Number:
+            var err error
+            if f, err = v.Float64(); err != nil {
+                continue
+            }
+        case string:
+            s := strings.TrimSpace(v)
+            explicit = strings.HasSuffix(s, "%")
+            var err error
+            if f, err = strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64); err != nil {
+                continue
+            }
+        default:
+            continue
+        }
+        if percent && !explicit && f > 0 && f < 1 {
+            f *= 100
+        }
+        return f, true
+    }
+    return 0, false
+}
+
+// progressString returns the first key in keys holding a non-empty string
+func progressString(raw map[string]interface{}, keys []string) string {
+    for _, key := range keys {
+        if s, ok := raw[key].(string); ok && strings.TrimSpace(s) != "" {
+            return strings.TrimSpace(s)
+        }
+    }
+    return ""
+}
+
+// ParsedProgress returns the typed progress of a status response, nil if unknown
+func (s *ReportStatus) ParsedProgress() *ReportProgress {
+    return ParseReportProgress(s.Progress)
+}
@@ -0,0 +1,65 @@
+// report_progress_test.go covers parsing the upstream report progress map.
+
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseReportProgress(t *testing.T) {
+    pct := func(v float64) *float64 { return &v }
+    n := func(v int) *int { return &v }
+
+    tests := []struct {
+        name    string
+        payload string
+        want    *ReportProgress
+    }{
+        {
+            "complete",
+            `{"percent":45,"current_step":"collecting data","items_done":9,"items_total":20}`,
+            &ReportProgress{Percent: pct(45), CurrentStep: "collecting data", ItemsDone: n(9), ItemsTotal: n(20)},
+        },
+        {"percent string", `{"progress":"62.5%"}`, &ReportProgress{Percent: pct(62.5)}},
+        {"fraction", `{"pct":0.25}`, &ReportProgress{Percent: pct(25)}},
+        {"explicit small percent", `{"percent":"0.5%"}`, &ReportProgress{Percent: pct(0.5)}},
+        {"derived from items", `{"done":3,"total":4,"stage":" rendering "}`,
+            &ReportProgress{Percent: pct(75), CurrentStep: "rendering", ItemsDone: n(3), ItemsTotal: n(4)}},
+        {"clamped", `{"percent":140}`, &ReportProgress{Percent: pct(100)}},
+        {"step only", `{"percent":"soon","message":"queued"}`, &ReportProgress{CurrentStep: "queued"}},
+        {"zero total", `{"done":0,"total":0}`, &ReportProgress{ItemsDone: n(0)}},
+        {"nothing usable", `{"eta":null,"step":""}`, nil},
+        {"empty", `{}`, nil},
+        {"missing", `null`, nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var raw map[string]interface{}
+            if err := json.Unmarshal([]byte(tt.payload), &raw); err != nil {
+                t.Fatal(err)
+            }
+            if got := ParseReportProgress(raw); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("ParseReportProgress(%s) = %s, want %s", tt.payload, formatProgress(got), formatProgress(tt.want))
+            }
+        })
+    }
+}
+
+// formatProgress formats a progress for failure messages
+func formatProgress(p *ReportProgress) string {
+    data, _ := json.Marshal(p)
+    return string(data)
+}
+
+func TestReportStatusParsedProgress(t *testing.T) {
+    var status ReportStatus
+    if err := json.Unmarshal([]byte(`{"status":"processing","progress":{"processed":"5","of":"10"}}`), &status); err != nil {
+        t.Fatal(err)
+    }
+    got := status.ParsedProgress()
+    if got == nil || got.Percent == nil || *got.Percent != 50 || *got.ItemsDone != 5 || *got.ItemsTotal != 10 {
+        t.Errorf("ParsedProgress = %s, want 5 of 10 at 50%%", formatProgress(got))
+    }
+}
@@ -2,6 +2,12 @@
 
 package models
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 // ReportSpec represents the report configuration sent from the frontend.
 // Used in ReportDialog.vue when user initiates a report generation.
 type ReportSpec struct {
@@ -12,6 +18,39 @@ type ReportSpec struct {
     DateTimeTo            string                 `json:"datetime_to"`
     ReportOutputFieldList []string               `json:"report_output_field_list"`
     ReportOptions         map[string]interface{} `json:"report_options"`
+    OnlyActive            bool                   `json:"only_active,omitempty"`     // Drop devices with no activity in the period, past periods are read from point history
+    MinEngineTime         int                    `json:"min_engine_time,omitempty"` // Minutes of engine-on time required, implies only_active
+    FileType              string                 `json:"file_type,omitempty"`       // Export type, pdf when empty, must be in REPORT_FILE_TYPES
+    Formats               []string               `json:"formats,omitempty"`         // Several export types at once, returned as a ZIP; overrides file_type
+    AllDevices            bool                   `json:"all_devices,omitempty"`     // Report on every device in the account instead of device_id_list
+    IncludeHidden         bool                   `json:"include_hidden,omitempty"`  // With all_devices, keep devices the client has hidden
+}
+
+// Validate checks the device list before a report is generated.
+// Empty entries are rejected, listing their positions; duplicates are
+// dropped in place, keeping the first occurrence and the original order.
+// Used by GenerateReportHandler.
+func (s *ReportSpec) Validate() error {
+    var empty []string
+    for i, id := range s.DeviceIDList {
+        if strings.TrimSpace(id) == "" {
+            empty = append(empty, fmt.Sprint(i))
+        }
+    }
+    if len(empty) > 0 {
+        return fmt.Errorf("device_id_list contains empty entries at index %s", strings.Join(empty, ", "))
+    }
+
+    seen := make(map[string]bool, len(s.DeviceIDList))
+    unique := s.DeviceIDList[:0]
+    for _, id := range s.DeviceIDList {
+        if !seen[id] {
+            seen[id] = true
+            unique = append(unique, id)
+        }
+    }
+    s.DeviceIDList = unique
+    return nil
 }
 
 // ReportRequest represents the formatted request sent to OneStepGPS API.
@@ -32,7 +71,7 @@ type ReportRequest struct {
 type ReportResponse struct {
     ReportGeneratedID string                `json:"report_generated_id"`    // ID to track report progress
     Status           string                 `json:"status"`                 // Initial status ("pending", etc.)
-    Error            string                 `json:"error,omitempty"`        // Any immediate errors
+    Error            *APIError              `json:"error,omitempty"`        // Any immediate errors
     Progress         map[string]interface{} `json:"progress,omitempty"`     // Generation progress details
 }
 
@@ -40,7 +79,42 @@ type ReportResponse struct {
 // Used during polling to determine when report is ready for download.
 type ReportStatus struct {
     Status     string                 `json:"status"`                   // Current status ("done", "processing", etc.)
-    Error      string                 `json:"error,omitempty"`          // Any errors during generation
+    Error      *APIError              `json:"error,omitempty"`          // Any errors during generation
     Progress   map[string]interface{} `json:"progress,omitempty"`       // Detailed progress information
     OutputPath string                 `json:"OutputFilePath,omitempty"` // Path to completed report
-}
\ No newline at end of file
+}
+// ReportPreset is a named ReportSpec saved by a client.
+// Used in ReportDialog.vue to re-run a saved report via /report/generate?preset=name.
+type ReportPreset struct {
+    ID        int        `json:"id"`
+    ClientID  string     `json:"client_id"`
+    Name      string     `json:"name"`
+    Spec      ReportSpec `json:"report_spec"`
+    CreatedAt time.Time  `json:"created_at"`
+    UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ReportPresetCreate is the body of POST /report/presets
+type ReportPresetCreate struct {
+    ClientID string     `json:"client_id,omitempty"`
+    Name     string     `json:"name"`
+    Spec     ReportSpec `json:"report_spec"`
+}
+
+// maxPresetNameLength matches the report_presets.name column
+const maxPresetNameLength = 255
+
+// Validate checks the preset name, which is also used in URLs
+func (p *ReportPresetCreate) Validate() error {
+    p.Name = strings.TrimSpace(p.Name)
+    if p.Name == "" {
+        return fmt.Errorf("preset name is required")
+    }
+    if len(p.Name) > maxPresetNameLength {
+        return fmt.Errorf("preset name must be at most %d characters", maxPresetNameLength)
+    }
+    if strings.Contains(p.Name, "/") {
+        return fmt.Errorf("preset name must not contain '/'")
+    }
+    return nil
+}
@@ -0,0 +1,45 @@
+// reports_test.go covers validating report device lists.
+
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReportSpecValidate(t *testing.T) {
+    tests := []struct {
+        name    string
+        devices []string
+        want    []string
+        wantErr string
+    }{
+        {"clean list", []string{"dev1", "dev2"}, []string{"dev1", "dev2"}, ""},
+        {"duplicates keep the first occurrence", []string{"dev2", "dev1", "dev2", "dev1", "dev3"}, []string{"dev2", "dev1", "dev3"}, ""},
+        {"empty entry", []string{"dev1", ""}, nil, "index 1"},
+        {"whitespace entries", []string{" ", "dev1", "\t"}, nil, "index 0, 2"},
+        {"empty list", nil, nil, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            spec := ReportSpec{DeviceIDList: tt.devices}
+            err := spec.Validate()
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Validate() error = %v, want one mentioning %s", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Validate() error = %v", err)
+            }
+            if len(tt.want) == 0 && len(spec.DeviceIDList) == 0 {
+                return
+            }
+            if !reflect.DeepEqual(spec.DeviceIDList, tt.want) {
+                t.Errorf("DeviceIDList = %v, want %v", spec.DeviceIDList, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,89 @@
+// units.go provides conversion of OneStepGPS measurements between metric
+// and imperial units, for users who prefer the other system.
+
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Unit systems accepted by ?units=
+const (
+    UnitsMetric   = "metric"
+    UnitsImperial = "imperial"
+)
+
+const kmPerMile = 1.609344
+
+// unitConversions maps a unit to its counterpart in the other system and
+// the factor to multiply by, keyed by target system
+var unitConversions = map[string]map[string]struct {
+    unit   string
+    factor float64
+}{
+    UnitsMetric: {
+        "mph":   {"km/h", kmPerMile},
+        "mi":    {"km", kmPerMile},
+        "miles": {"km", kmPerMile},
+    },
+    UnitsImperial: {
+        "km/h": {"mph", 1 / kmPerMile},
+        "kph":  {"mph", 1 / kmPerMile},
+        "kmh":  {"mph", 1 / kmPerMile},
+        "km":   {"mi", 1 / kmPerMile},
+    },
+}
+
+// conversionTo returns the unit and factor converting unit to the given
+// system, false when unit is already in that system or unknown
+func conversionTo(system, unit string) (string, float64, bool) {
+    conv, ok := unitConversions[system][strings.ToLower(unit)]
+    return conv.unit, conv.factor, ok
+}
+
+// ValidUnits reports whether system is a unit system accepted by ?units=
+func ValidUnits(system string) bool {
+    return system == UnitsMetric || system == UnitsImperial
+}
+
+// ToSystem converts the measurement to the given unit system, regenerating
+// Display. Measurements already in that system or with an unknown unit are
+// returned unchanged.
+func (m Measurement) ToSystem(system string) Measurement {
+    unit, factor, ok := conversionTo(system, m.Unit)
+    if !ok {
+        return m
+    }
+    value := m.Value * factor
+    return Measurement{
+        Value:   value,
+        Unit:    unit,
+        Display: fmt.Sprintf("%.1f %s", value, unit),
+    }
+}
+
+// WithUnits returns a copy of the vehicle with every speed and distance in
+// the given unit system: the drive status distance, the detail speed, the
+// bare position speed (sent upstream in the detail speed's unit) and the
+// hub's computed speed, which moves to ComputedSpeedMph for imperial.
+// The position is copied, not modified, since snapshots share it.
+func (v Vehicle) WithUnits(system string) Vehicle {
+    v.DriveState.Distance = v.DriveState.Distance.ToSystem(system)
+    if v.LastLocation == nil {
+        return v
+    }
+
+    loc := *v.LastLocation
+    if _, factor, ok := conversionTo(system, loc.Detail.Speed.Unit); ok {
+        loc.Speed *= factor
+    }
+    loc.Detail.Speed = loc.Detail.Speed.ToSystem(system)
+    if loc.ComputedSpeedKmh != nil && system == UnitsImperial {
+        mph := math.Round(*loc.ComputedSpeedKmh/kmPerMile*10) / 10
+        loc.ComputedSpeedKmh, loc.ComputedSpeedMph = nil, &mph
+    }
+    v.LastLocation = &loc
+    return v
+}
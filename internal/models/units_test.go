@@ -0,0 +1,107 @@
+// units_test.go covers converting vehicle measurements between unit systems.
+
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+// imperialVehicle is a vehicle as OneStepGPS sends it for an imperial account
+func imperialVehicle() Vehicle {
+    computed := 80.0
+    return Vehicle{
+        DeviceID: "dev1",
+        LastLocation: &Location{
+            Speed:            50,
+            ComputedSpeedKmh: &computed,
+            Detail: LocationDetail{
+                Speed: Measurement{Value: 50, Unit: "mph", Display: "50 mph"},
+            },
+        },
+        DriveState: DriveState{
+            Distance: Measurement{Value: 10, Unit: "mi", Display: "10 mi"},
+        },
+    }
+}
+
+func approx(a, b float64) bool {
+    return math.Abs(a-b) < 0.01
+}
+
+func TestMeasurementToSystem(t *testing.T) {
+    tests := []struct {
+        in     Measurement
+        system string
+        want   Measurement
+    }{
+        {Measurement{Value: 60, Unit: "mph"}, UnitsMetric, Measurement{Value: 96.56, Unit: "km/h", Display: "96.6 km/h"}},
+        {Measurement{Value: 100, Unit: "km/h"}, UnitsImperial, Measurement{Value: 62.14, Unit: "mph", Display: "62.1 mph"}},
+        {Measurement{Value: 100, Unit: "KPH"}, UnitsImperial, Measurement{Value: 62.14, Unit: "mph", Display: "62.1 mph"}},
+        {Measurement{Value: 10, Unit: "miles"}, UnitsMetric, Measurement{Value: 16.09, Unit: "km", Display: "16.1 km"}},
+        {Measurement{Value: 5, Unit: "km"}, UnitsImperial, Measurement{Value: 3.11, Unit: "mi", Display: "3.1 mi"}},
+        // Already in the target system or unknown: unchanged, Display included
+        {Measurement{Value: 60, Unit: "mph", Display: "60 mph"}, UnitsImperial, Measurement{Value: 60, Unit: "mph", Display: "60 mph"}},
+        {Measurement{Value: 3, Unit: "h", Display: "3 h"}, UnitsMetric, Measurement{Value: 3, Unit: "h", Display: "3 h"}},
+    }
+    for _, tt := range tests {
+        got := tt.in.ToSystem(tt.system)
+        if !approx(got.Value, tt.want.Value) || got.Unit != tt.want.Unit || got.Display != tt.want.Display {
+            t.Errorf("%v to %s: got %+v, want %+v", tt.in, tt.system, got, tt.want)
+        }
+    }
+}
+
+func TestVehicleWithUnitsMetric(t *testing.T) {
+    v := imperialVehicle()
+    got := v.WithUnits(UnitsMetric)
+
+    loc := got.LastLocation
+    if !approx(loc.Speed, 80.47) {
+        t.Errorf("speed = %v, want 80.47", loc.Speed)
+    }
+    if loc.Detail.Speed.Unit != "km/h" || loc.Detail.Speed.Display != "80.5 km/h" {
+        t.Errorf("detail speed = %+v, want 80.5 km/h", loc.Detail.Speed)
+    }
+    if got.DriveState.Distance.Unit != "km" || got.DriveState.Distance.Display != "16.1 km" {
+        t.Errorf("distance = %+v, want 16.1 km", got.DriveState.Distance)
+    }
+    if loc.ComputedSpeedKmh == nil || *loc.ComputedSpeedKmh != 80 || loc.ComputedSpeedMph != nil {
+        t.Errorf("computed speed changed for metric: kmh %v, mph %v", loc.ComputedSpeedKmh, loc.ComputedSpeedMph)
+    }
+
+    // Snapshots share positions, the original must be untouched
+    if v.LastLocation.Speed != 50 || v.LastLocation.Detail.Speed.Unit != "mph" {
+        t.Errorf("original position modified: %+v", *v.LastLocation)
+    }
+}
+
+func TestVehicleWithUnitsImperial(t *testing.T) {
+    v := imperialVehicle().WithUnits(UnitsMetric)
+    got := v.WithUnits(UnitsImperial)
+
+    loc := got.LastLocation
+    if !approx(loc.Speed, 50) {
+        t.Errorf("speed = %v, want 50", loc.Speed)
+    }
+    if loc.Detail.Speed.Unit != "mph" || loc.Detail.Speed.Display != "50.0 mph" {
+        t.Errorf("detail speed = %+v, want 50.0 mph", loc.Detail.Speed)
+    }
+    if got.DriveState.Distance.Unit != "mi" || got.DriveState.Distance.Display != "10.0 mi" {
+        t.Errorf("distance = %+v, want 10.0 mi", got.DriveState.Distance)
+    }
+    if loc.ComputedSpeedKmh != nil || loc.ComputedSpeedMph == nil || *loc.ComputedSpeedMph != 49.7 {
+        t.Errorf("computed speed: kmh %v, mph %v, want mph 49.7", loc.ComputedSpeedKmh, loc.ComputedSpeedMph)
+    }
+    if v.LastLocation.ComputedSpeedKmh == nil {
+        t.Error("original computed speed cleared")
+    }
+}
+
+func TestVehicleWithUnitsNoPosition(t *testing.T) {
+    v := Vehicle{DriveState: DriveState{Distance: Measurement{Value: 1, Unit: "km"}}}
+    got := v.WithUnits(UnitsImperial)
+    if got.LastLocation != nil || got.DriveState.Distance.Unit != "mi" {
+        t.Errorf("got %+v", got)
+    }
+}
@@ -2,11 +2,15 @@
 
 package models
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 // Vehicle represents the essential vehicle information from OneStepGPS API.
 // Used when receiving vehicle updates through WebSocket in HomeView.vue
-// Transform API response to our domain model
+// Built from the raw API payload by VehicleFromAPI, see api_vehicles.go.
+// JSON tags keep the upstream names the frontend already reads.
 type Vehicle struct {
     DeviceID     string     `json:"device_id"`
     DisplayName  string     `json:"display_name"`
@@ -14,6 +18,20 @@ type Vehicle struct {
     Online       bool       `json:"online"`
     LastLocation *Location  `json:"latest_device_point"`
     DriveState   DriveState `json:"device_state"`
+    CurrentStateSeconds *int64 `json:"current_state_seconds,omitempty"` // Time in the current drive status as of mapping, see VehicleFromAPI
+}
+
+// CurrentStateDuration returns how long the vehicle has been in its current
+// drive status at now, false when upstream didn't send a begin time
+func (v *Vehicle) CurrentStateDuration(now time.Time) (time.Duration, bool) {
+    if v.DriveState.BeginTime.IsZero() {
+        return 0, false
+    }
+    d := now.Sub(v.DriveState.BeginTime)
+    if d < 0 {
+        d = 0 // Tracker clock ahead of ours
+    }
+    return d, true
 }
 
 // Location represents a point-in-time vehicle location.
@@ -26,37 +44,49 @@ type Location struct {
     Heading   int       `json:"angle"`
     Speed     float64   `json:"speed"`
     Detail    LocationDetail `json:"device_point_detail"`
+    HasFix    bool      `json:"has_fix"` // False for 0,0 or out-of-range coordinates, see ValidCoordinates
+
+    // Derived by the WebSocket hub from consecutive positions, only sent
+    // when the device didn't report its own speed/heading
+    ComputedSpeedKmh *float64 `json:"computed_speed_kmh,omitempty"`
+    ComputedSpeedMph *float64 `json:"computed_speed_mph,omitempty"` // Replaces ComputedSpeedKmh in imperial responses, see WithUnits
+    ComputedHeading  *int     `json:"computed_heading,omitempty"`
+
+    // Whether upstream sent speed/angle, set by VehicleFromAPI, not serialized
+    SpeedReported   bool `json:"-"`
+    HeadingReported bool `json:"-"`
 }
 
 // LocationDetail contains additional point information displayed in map info windows
 type LocationDetail struct {
-    Speed struct {
-        Value   float64 `json:"value"`
-        Unit    string  `json:"unit"`
-        Display string  `json:"display"`
-    } `json:"speed"`
+    Speed          Measurement `json:"speed"`
     FuelPercent    *float64 `json:"fuel_percent,omitempty"`
     EngineOn       *bool    `json:"vbus_engine_on,omitempty"`
     InMotion       *bool    `json:"vbus_in_motion,omitempty"`
 }
 
+// ValidCoordinates reports whether lat/lng can be a real GPS fix.
+// Trackers without a fix send 0,0 (which would render off the coast of
+// Africa in MapView.vue) or garbage outside the valid ranges.
+func ValidCoordinates(lat, lng float64) bool {
+    if math.IsNaN(lat) || math.IsNaN(lng) {
+        return false
+    }
+    if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+        return false
+    }
+    return lat != 0 || lng != 0
+}
+
 // DriveState represents the vehicle's current driving status.
 // Used in VehicleCard.vue for status display
 type DriveState struct {
     Status     string `json:"drive_status"` // "off", "idle", "driving"
     StatusID   string `json:"drive_status_id"`
-    Distance   struct {
-        Value   float64 `json:"value"`
-        Unit    string  `json:"unit"`
-        Display string  `json:"display"`
-    } `json:"drive_status_distance"`
+    Distance   Measurement `json:"drive_status_distance"`
     BeginTime time.Time `json:"drive_status_begin_time"`
-}
-
-// APIResponse represents the top-level response from OneStepGPS API.
-// Used when fetching vehicle data in api/handlers.go
-type APIResponse struct {
-    ResultList []Vehicle `json:"result_list"`
+    Duration   *Measurement `json:"drive_status_duration,omitempty"` // As sent upstream, nil when missing
+    DurationSeconds *int64  `json:"drive_status_duration_seconds,omitempty"` // Duration converted to seconds, nil if the unit is unknown
 }
 
 // Measurement represents OneStepGPS's standard measurement format.
@@ -0,0 +1,64 @@
+// notify.go provides pluggable notifications sent when an asynchronous
+// report generation finishes, in addition to the HTTP response itself.
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+)
+
+// ReportNotification describes a finished report generation
+type ReportNotification struct {
+    RequestID   string    `json:"request_id"`           // X-Request-ID of the generate call
+    ReportID    string    `json:"report_id,omitempty"`  // Upstream report id, empty on failure
+    ReportName  string    `json:"report_name"`
+    Status      string    `json:"status"`               // "done" or "failed"
+    Error       string    `json:"error,omitempty"`
+    Link        string    `json:"link"`                 // Where the report can be fetched, see /report/status/{id}
+    CompletedAt time.Time `json:"completed_at"`
+}
+
+// Notifier delivers report completion notifications.
+// Called from a background goroutine, so implementations should respect ctx.
+type Notifier interface {
+    NotifyReport(ctx context.Context, n ReportNotification) error
+}
+
+// Noop discards notifications, used when none are configured
+type Noop struct{}
+
+// NotifyReport does nothing
+func (Noop) NotifyReport(context.Context, ReportNotification) error {
+    return nil
+}
+
+// New builds the notifier selected by REPORT_NOTIFIER
+func New(cfg config.NotifierConfig) (Notifier, error) {
+    switch cfg.Type {
+    case "", "noop":
+        return Noop{}, nil
+    case "webhook":
+        if cfg.WebhookURL == "" {
+            return nil, fmt.Errorf("REPORT_NOTIFY_WEBHOOK_URL is required for the webhook notifier")
+        }
+        return NewWebhook(cfg.WebhookURL), nil
+    case "smtp":
+        if cfg.SMTPHost == "" || cfg.SMTPFrom == "" || len(cfg.SMTPTo) == 0 {
+            return nil, fmt.Errorf("SMTP_HOST, SMTP_FROM and REPORT_NOTIFY_EMAIL_TO are required for the smtp notifier")
+        }
+        return &SMTP{
+            Addr:     fmt.Sprintf("%s:%d", cfg.SMTPHost, cfg.SMTPPort),
+            Host:     cfg.SMTPHost,
+            Username: cfg.SMTPUsername,
+            Password: cfg.SMTPPassword,
+            From:     cfg.SMTPFrom,
+            To:       cfg.SMTPTo,
+        }, nil
+    default:
+        return nil, fmt.Errorf("unknown REPORT_NOTIFIER %q: must be noop, webhook or smtp", cfg.Type)
+    }
+}
@@ -0,0 +1,138 @@
+// notify_test.go covers selecting notifiers and what each one sends.
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+)
+
+// doneNotification is a successful generation
+var doneNotification = ReportNotification{
+    RequestID:   "req-1",
+    ReportID:    "rep-1",
+    ReportName:  "Weekly",
+    Status:      "done",
+    Link:        "https://fleet.example.com/api/report/status/req-1",
+    CompletedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestNew(t *testing.T) {
+    tests := []struct {
+        name    string
+        cfg     config.NotifierConfig
+        want    string
+        wantErr string
+    }{
+        {"default", config.NotifierConfig{}, "notify.Noop", ""},
+        {"noop", config.NotifierConfig{Type: "noop"}, "notify.Noop", ""},
+        {"webhook", config.NotifierConfig{Type: "webhook", WebhookURL: "https://hooks.example.com"}, "*notify.Webhook", ""},
+        {"webhook without url", config.NotifierConfig{Type: "webhook"}, "", "REPORT_NOTIFY_WEBHOOK_URL"},
+        {"smtp", config.NotifierConfig{Type: "smtp", SMTPHost: "mail", SMTPPort: 587, SMTPFrom: "fleet@example.com", SMTPTo: []string{"ops@example.com"}}, "*notify.SMTP", ""},
+        {"smtp without recipients", config.NotifierConfig{Type: "smtp", SMTPHost: "mail", SMTPFrom: "fleet@example.com"}, "", "REPORT_NOTIFY_EMAIL_TO"},
+        {"unknown", config.NotifierConfig{Type: "pager"}, "", "unknown REPORT_NOTIFIER"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            n, err := New(tt.cfg)
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("New() error = %v, want one mentioning %s", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("New() error = %v", err)
+            }
+            if got := fmt.Sprintf("%T", n); got != tt.want {
+                t.Errorf("New() = %s, want %s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestNewSMTPAddr(t *testing.T) {
+    n, err := New(config.NotifierConfig{Type: "smtp", SMTPHost: "mail.example.com", SMTPPort: 2525, SMTPFrom: "fleet@example.com", SMTPTo: []string{"ops@example.com"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if s := n.(*SMTP); s.Addr != "mail.example.com:2525" || s.Host != "mail.example.com" {
+        t.Errorf("Addr = %q, Host = %q", s.Addr, s.Host)
+    }
+}
+
+func TestWebhookPostsNotification(t *testing.T) {
+    received := make(chan ReportNotification, 1)
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+            t.Errorf("got %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+        }
+        var n ReportNotification
+        if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+            t.Errorf("decoding body: %v", err)
+        }
+        received <- n
+        w.WriteHeader(http.StatusNoContent)
+    }))
+    t.Cleanup(srv.Close)
+
+    if err := NewWebhook(srv.URL).NotifyReport(context.Background(), doneNotification); err != nil {
+        t.Fatalf("NotifyReport: %v", err)
+    }
+    if got := <-received; got != doneNotification {
+        t.Errorf("posted %+v, want %+v", got, doneNotification)
+    }
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusBadGateway)
+    }))
+    t.Cleanup(srv.Close)
+
+    err := NewWebhook(srv.URL).NotifyReport(context.Background(), doneNotification)
+    if err == nil || !strings.Contains(err.Error(), "502") {
+        t.Errorf("NotifyReport() error = %v, want the 502", err)
+    }
+}
+
+func TestSMTPMessage(t *testing.T) {
+    s := &SMTP{From: "fleet@example.com", To: []string{"ops@example.com", "lead@example.com"}}
+
+    done := string(s.message(doneNotification))
+    for _, want := range []string{
+        "From: fleet@example.com\r\n",
+        "To: ops@example.com, lead@example.com\r\n",
+        "Subject: Report ready: Weekly\r\n",
+        "Download: " + doneNotification.Link,
+    } {
+        if !strings.Contains(done, want) {
+            t.Errorf("done message missing %q:\n%s", want, done)
+        }
+    }
+
+    failed := string(s.message(ReportNotification{Status: "failed", Error: "upstream timed out"}))
+    for _, want := range []string{"Subject: Report failed: Fleet report\r\n", "upstream timed out"} {
+        if !strings.Contains(failed, want) {
+            t.Errorf("failed message missing %q:\n%s", want, failed)
+        }
+    }
+}
+
+func TestSMTPCancelledContext(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    // Nothing is dialed once the context is done
+    s := &SMTP{Addr: "127.0.0.1:1", From: "fleet@example.com", To: []string{"ops@example.com"}}
+    if err := s.NotifyReport(ctx, doneNotification); err != context.Canceled {
+        t.Errorf("NotifyReport() error = %v, want context.Canceled", err)
+    }
+}
@@ -0,0 +1,63 @@
+// smtp.go provides a notifier that emails report completions.
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// SMTP emails each notification to a fixed recipient list
+type SMTP struct {
+    Addr     string // host:port of the mail server
+    Host     string // Used for PLAIN auth
+    Username string // Auth is skipped when empty
+    Password string
+    From     string
+    To       []string
+}
+
+// NotifyReport sends a short plain text email with the report link.
+// net/smtp has no context support, so ctx is only checked before sending.
+func (s *SMTP) NotifyReport(ctx context.Context, n ReportNotification) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+
+    var auth smtp.Auth
+    if s.Username != "" {
+        auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+    }
+
+    if err := smtp.SendMail(s.Addr, auth, s.From, s.To, s.message(n)); err != nil {
+        return fmt.Errorf("error sending notification email: %w", err)
+    }
+    return nil
+}
+
+// message builds the RFC 5322 email for a notification
+func (s *SMTP) message(n ReportNotification) []byte {
+    name := n.ReportName
+    if name == "" {
+        name = "Fleet report"
+    }
+
+    var subject, body string
+    if n.Status == "done" {
+        subject = fmt.Sprintf("Report ready: %s", name)
+        body = fmt.Sprintf("Your report \"%s\" is ready.\r\n\r\nDownload: %s\r\n", name, n.Link)
+    } else {
+        subject = fmt.Sprintf("Report failed: %s", name)
+        body = fmt.Sprintf("Your report \"%s\" could not be generated: %s\r\n", name, n.Error)
+    }
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "From: %s\r\n", s.From)
+    fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.To, ", "))
+    fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+    b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+    b.WriteString(body)
+    return []byte(b.String())
+}
@@ -0,0 +1,51 @@
+// webhook.go provides a notifier that POSTs report completions as JSON.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook POSTs each notification as JSON to a fixed URL
+type Webhook struct {
+    URL        string
+    httpClient *http.Client
+}
+
+// NewWebhook creates a webhook notifier with a request timeout
+func NewWebhook(url string) *Webhook {
+    return &Webhook{
+        URL:        url,
+        httpClient: &http.Client{Timeout: 10 * time.Second},
+    }
+}
+
+// NotifyReport sends the notification, treating any non-2xx response as an error
+func (w *Webhook) NotifyReport(ctx context.Context, n ReportNotification) error {
+    body, err := json.Marshal(n)
+    if err != nil {
+        return fmt.Errorf("error marshaling notification: %w", err)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+    if err != nil {
+        return fmt.Errorf("error creating notification request: %w", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := w.httpClient.Do(req)
+    if err != nil {
+        return fmt.Errorf("error sending notification: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("notification webhook returned status %d", resp.StatusCode)
+    }
+    return nil
+}
@@ -0,0 +1,82 @@
+// base_url_test.go covers sending every request under the configured API root.
+
+package onestepgps
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+func TestNewClientDefaultBaseURL(t *testing.T) {
+    if got := NewClient("key", "", nil).BaseURL(); got != DefaultBaseURL {
+        t.Errorf("BaseURL() = %q, want %q", got, DefaultBaseURL)
+    }
+}
+
+func TestClientUsesCustomBasePath(t *testing.T) {
+    var mu sync.Mutex
+    var paths []string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        mu.Lock()
+        paths = append(paths, r.URL.Path)
+        mu.Unlock()
+        w.Header().Set("Content-Type", "application/json")
+        switch {
+        case strings.HasSuffix(r.URL.Path, "/device"):
+            w.Write([]byte(`{"result_list":[{"device_id":"dev1"}]}`))
+        case strings.HasSuffix(r.URL.Path, "/device-point"):
+            w.Write([]byte(`{"result_list":[]}`))
+        case strings.HasSuffix(r.URL.Path, "/report/generate"):
+            w.Write([]byte(`{"report_generated_id":"rep-1","status":"pending"}`))
+        case strings.Contains(r.URL.Path, "/report-generated/export/"):
+            w.Header().Set("Content-Type", "application/pdf")
+            w.Write([]byte("%PDF-1.4"))
+        case strings.Contains(r.URL.Path, "/report-generated/"):
+            w.Write([]byte(`{"status":"done"}`))
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    t.Cleanup(srv.Close)
+
+    // A trailing slash on the configured root doesn't double up
+    c := NewClient("key", srv.URL+"/eu/v3/api/public/", nil)
+    if got := c.BaseURL(); got != srv.URL+"/eu/v3/api/public" {
+        t.Errorf("BaseURL() = %q", got)
+    }
+
+    if _, err := c.GetDevices(); err != nil {
+        t.Fatalf("GetDevices: %v", err)
+    }
+    if _, err := c.GetDeviceHistory("dev1", time.Now().Add(-time.Hour), time.Now()); err != nil {
+        t.Fatalf("GetDeviceHistory: %v", err)
+    }
+    if _, err := c.GenerateReport(&models.ReportRequest{DeviceIDList: []string{"dev1"}}); err != nil {
+        t.Fatalf("GenerateReport: %v", err)
+    }
+    if _, err := c.GetReportStatus("rep-1"); err != nil {
+        t.Fatalf("GetReportStatus: %v", err)
+    }
+    if _, _, err := c.DownloadReport("rep-1", "pdf"); err != nil {
+        t.Fatalf("DownloadReport: %v", err)
+    }
+
+    want := []string{
+        "/eu/v3/api/public/device",
+        "/eu/v3/api/public/device-point",
+        "/eu/v3/api/public/report/generate",
+        "/eu/v3/api/public/report-generated/rep-1",
+        "/eu/v3/api/public/report-generated/export/rep-1",
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    if strings.Join(paths, " ") != strings.Join(want, " ") {
+        t.Errorf("requested paths = %v, want %v", paths, want)
+    }
+}
@@ -0,0 +1,95 @@
+// cache.go keeps the last successful GetDevices result so the first
+// /vehicles request and WebSocket connect don't wait on a cold upstream fetch.
+
+package onestepgps
+
+import (
+	"sync"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"golang.org/x/sync/singleflight"
+)
+
+// deviceCache holds the last device list returned by OneStepGPS
+type deviceCache struct {
+    mu        sync.RWMutex
+    vehicles  []models.Vehicle
+    fetchedAt time.Time
+    refresh   singleflight.Group // Collapses concurrent cache-miss refreshes into one upstream call
+}
+
+// store replaces the cached list, returning the time it was stored at
+func (dc *deviceCache) store(vehicles []models.Vehicle) time.Time {
+    dc.mu.Lock()
+    defer dc.mu.Unlock()
+    dc.vehicles = vehicles
+    dc.fetchedAt = time.Now()
+    return dc.fetchedAt
+}
+
+// load returns a copy of the cached list, so callers can sort or convert it in place
+func (dc *deviceCache) load() ([]models.Vehicle, time.Time) {
+    dc.mu.RLock()
+    defer dc.mu.RUnlock()
+    if dc.fetchedAt.IsZero() {
+        return nil, time.Time{}
+    }
+    return copyVehicles(dc.vehicles), dc.fetchedAt
+}
+
+// WarmCache fetches the device list once so the cache is populated.
+// Called in main.go at startup, before the server starts accepting traffic.
+func (c *Client) WarmCache() error {
+    _, err := c.GetDevices()
+    return err
+}
+
+// CacheWarm reports whether a device list has been fetched successfully yet.
+// Used by /readyz so traffic isn't routed to an instance with a cold cache.
+func (c *Client) CacheWarm() bool {
+    c.cache.mu.RLock()
+    defer c.cache.mu.RUnlock()
+    return !c.cache.fetchedAt.IsZero()
+}
+
+// GetDevicesCached returns the cached device list when it is younger than
+// maxAge, otherwise fetches a fresh one with GetDevices.
+// Used for the initial WebSocket snapshot and GET /api/vehicles.
+func (c *Client) GetDevicesCached(maxAge time.Duration) ([]models.Vehicle, error) {
+    vehicles, _, err := c.GetDevicesCachedAt(maxAge)
+    return vehicles, err
+}
+
+// cachedDevices is a device list and when it was fetched from OneStepGPS
+type cachedDevices struct {
+    vehicles  []models.Vehicle
+    fetchedAt time.Time
+}
+
+// GetDevicesCachedAt is GetDevicesCached, also returning when the list was
+// fetched from OneStepGPS. Used for /vehicles Last-Modified, so it matches the body.
+func (c *Client) GetDevicesCachedAt(maxAge time.Duration) ([]models.Vehicle, time.Time, error) {
+    if vehicles, fetchedAt := c.cache.load(); !fetchedAt.IsZero() && time.Since(fetchedAt) < maxAge {
+        return vehicles, fetchedAt, nil
+    }
+
+    // On expiry every waiting request shares one upstream refresh instead of
+    // each fetching its own (cache stampede)
+    result, err, _ := c.cache.refresh.Do("devices", func() (interface{}, error) {
+        vehicles, fetchedAt, err := c.fetchDevices()
+        return cachedDevices{vehicles: vehicles, fetchedAt: fetchedAt}, err
+    })
+    if err != nil {
+        return nil, time.Time{}, err
+    }
+    // Each caller gets its own copy, the result is shared between them
+    fetched := result.(cachedDevices)
+    return copyVehicles(fetched.vehicles), fetched.fetchedAt, nil
+}
+
+// copyVehicles returns a copy callers may modify, never nil so an empty
+// fleet still encodes as [] rather than null
+func copyVehicles(vehicles []models.Vehicle) []models.Vehicle {
+    return append(make([]models.Vehicle, 0, len(vehicles)), vehicles...)
+}
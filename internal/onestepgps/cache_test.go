@@ -0,0 +1,132 @@
+// cache_test.go covers warming the device cache and GetDevicesCached
+// deduplicating upstream fetches.
+
+package onestepgps
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingUpstream serves a one-device list, counting requests. Requests
+// block until release is closed.
+func countingUpstream(t *testing.T, release <-chan struct{}) (*httptest.Server, *atomic.Int32) {
+    t.Helper()
+    var calls atomic.Int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls.Add(1)
+        <-release
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(`{"result_list":[{"device_id":"dev1","display_name":"Truck 1"}]}`))
+    }))
+    t.Cleanup(srv.Close)
+    return srv, &calls
+}
+
+func TestGetDevicesCachedConcurrentMisses(t *testing.T) {
+    release := make(chan struct{})
+    srv, calls := countingUpstream(t, release)
+    c := NewClient("key", srv.URL, nil)
+
+    const callers = 50
+    var ready, done sync.WaitGroup
+    ready.Add(callers)
+    done.Add(callers)
+    errs := make(chan error, callers)
+    for i := 0; i < callers; i++ {
+        go func() {
+            defer done.Done()
+            ready.Done()
+            vehicles, err := c.GetDevicesCached(time.Minute)
+            if err == nil && len(vehicles) != 1 {
+                t.Errorf("got %d vehicles, want 1", len(vehicles))
+            }
+            errs <- err
+        }()
+    }
+    ready.Wait()
+    time.Sleep(50 * time.Millisecond) // Let every caller reach the in-flight fetch
+    close(release)
+    done.Wait()
+    close(errs)
+
+    for err := range errs {
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    if n := calls.Load(); n != 1 {
+        t.Errorf("upstream called %d times for %d concurrent misses, want 1", n, callers)
+    }
+}
+
+func TestGetDevicesCachedExpiry(t *testing.T) {
+    release := make(chan struct{})
+    close(release)
+    srv, calls := countingUpstream(t, release)
+    c := NewClient("key", srv.URL, nil)
+
+    for i := 0; i < 3; i++ {
+        if _, err := c.GetDevicesCached(time.Minute); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if n := calls.Load(); n != 1 {
+        t.Fatalf("upstream called %d times within maxAge, want 1", n)
+    }
+
+    time.Sleep(5 * time.Millisecond)
+    if _, err := c.GetDevicesCached(time.Millisecond); err != nil {
+        t.Fatal(err)
+    }
+    if n := calls.Load(); n != 2 {
+        t.Errorf("upstream called %d times after expiry, want 2", n)
+    }
+}
+
+func TestWarmCache(t *testing.T) {
+    release := make(chan struct{})
+    close(release)
+    srv, calls := countingUpstream(t, release)
+    c := NewClient("key", srv.URL, nil)
+
+    if c.CacheWarm() {
+        t.Fatal("new client reports a warm cache")
+    }
+    if err := c.WarmCache(); err != nil {
+        t.Fatal(err)
+    }
+    if !c.CacheWarm() {
+        t.Fatal("cache still cold after WarmCache")
+    }
+
+    // The first request is served from the warmed cache
+    vehicles, err := c.GetDevicesCached(time.Minute)
+    if err != nil || len(vehicles) != 1 {
+        t.Fatalf("GetDevicesCached = %d vehicles, %v", len(vehicles), err)
+    }
+    if n := calls.Load(); n != 1 {
+        t.Errorf("upstream called %d times, want only the warm-up", n)
+    }
+}
+
+func TestWarmCacheFailureStaysCold(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusServiceUnavailable)
+        w.Write([]byte(`{"message":"maintenance"}`))
+    }))
+    t.Cleanup(srv.Close)
+    c := NewClient("key", srv.URL, nil)
+
+    if err := c.WarmCache(); err == nil {
+        t.Fatal("WarmCache succeeded against a failing upstream")
+    }
+    if c.CacheWarm() {
+        t.Error("cache reported warm after a failed warm-up")
+    }
+}
@@ -9,20 +9,31 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/davidwiese/fleet-tracker-backend/internal/models"
 )
 
-const (
-	baseURL = "https://track.onestepgps.com/v3/api/public"
-)
+// DefaultBaseURL is the public OneStepGPS API used when no region is configured
+const DefaultBaseURL = "https://track.onestepgps.com/v3/api/public"
 
 // Client handles authenticated communication with OneStepGPS API.
 // Used by handlers.go and websocket/hub.go for vehicle data and reports.
 type Client struct {
     apiKey     string
+    baseURL    string // API root for the account's region, without a trailing slash
+    fileTypes  map[string]bool // Report export types this account may download
+    nameOverrides map[string]string // device_id -> display name, see SetNameOverrides
+    fixMode    string // Handling of positions without a valid fix, see fix.go
+    cache      deviceCache // Last successful GetDevices result, see cache.go
+    paused     atomic.Bool // Set by Pause, see pause.go
     httpClient *http.Client
 }
 
@@ -34,51 +45,195 @@ type ReportStatus struct {
     DownloadURL  string                 `json:"download_url,omitempty"`
 }
 
-// NewClient creates a new OneStepGPS API client with configured timeout.
+// NewClient creates a new OneStepGPS API client with configured timeout,
+// pooling connections per DefaultTransportConfig (see transport.go).
 // Called in main.go during application initialization.
-func NewClient(apiKey string) *Client {
+// An empty baseURL uses DefaultBaseURL, and no fileTypes allows only pdf.
+func NewClient(apiKey, baseURL string, fileTypes []string) *Client {
+    baseURL = strings.TrimRight(baseURL, "/")
+    if baseURL == "" {
+        baseURL = DefaultBaseURL
+    }
+    if len(fileTypes) == 0 {
+        fileTypes = []string{DefaultFileType}
+    }
+    allowed := make(map[string]bool, len(fileTypes))
+    for _, t := range fileTypes {
+        allowed[strings.ToLower(t)] = true
+    }
     return &Client{
-        apiKey: apiKey,
+        apiKey:    apiKey,
+        baseURL:   baseURL,
+        fileTypes: allowed,
         httpClient: &http.Client{
-            Timeout: time.Second * 10,
+            Timeout:   time.Second * 10,
+            Transport: newTransport(DefaultTransportConfig),
         },
     }
 }
 
+// SetNameOverrides replaces upstream display names for the given devices in
+// every GetDevices result. Must be called before the client is shared.
+// Per-client preferences are applied by the frontend on top of these names,
+// so a stored preference still wins over an override.
+func (c *Client) SetNameOverrides(overrides map[string]string) {
+    c.nameOverrides = overrides
+}
+
+// ApplyNameOverrides sets configured display names on vehicles in place.
+// Also used for vehicles pushed via webhook, which bypass GetDevices.
+func (c *Client) ApplyNameOverrides(vehicles []models.Vehicle) {
+    if len(c.nameOverrides) == 0 {
+        return
+    }
+    for i := range vehicles {
+        if name, ok := c.nameOverrides[vehicles[i].DeviceID]; ok && name != "" {
+            vehicles[i].DisplayName = name
+        }
+    }
+}
+
+// CheckFileType returns ErrFileTypeNotAllowed unless the report export
+// type is in the configured allowlist. Used before generating a report so
+// a disallowed type fails up front instead of at download time.
+func (c *Client) CheckFileType(fileType string) error {
+    if !c.fileTypes[fileType] {
+        return fmt.Errorf("%w: %q", ErrFileTypeNotAllowed, fileType)
+    }
+    return nil
+}
+
+// BaseURL returns the API root requests are sent to
+func (c *Client) BaseURL() string {
+    return c.baseURL
+}
+
 // GetDevices retrieves all vehicles with their latest positions.
 // Used by websocket hub for real-time updates and initial data load.
 func (c *Client) GetDevices() ([]models.Vehicle, error) {
+    vehicles, _, err := c.fetchDevices()
+    return vehicles, err
+}
+
+// fetchDevices is GetDevices, also returning when the list was fetched
+func (c *Client) fetchDevices() ([]models.Vehicle, time.Time, error) {
+    // While paused keep serving the last list rather than failing every read
+    if c.Paused() {
+        if vehicles, fetchedAt := c.cache.load(); !fetchedAt.IsZero() {
+            return vehicles, fetchedAt, nil
+        }
+        return nil, time.Time{}, ErrUpstreamPaused
+    }
+
     // Build URL without api key in query param
-    url := fmt.Sprintf("%s/device?latest_point=true", baseURL)
+    url := fmt.Sprintf("%s/device?latest_point=true", c.baseURL)
     fmt.Printf("Making request to URL: %s\n", url)
     
     // Create authenticated request
     req, err := http.NewRequest("GET", url, nil)
     if err != nil {
-        return nil, fmt.Errorf("error creating request: %w", err)
+        return nil, time.Time{}, fmt.Errorf("error creating request: %w", err)
     }
     req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
     fmt.Printf("Request headers: %+v\n", req.Header)
     
     // Make request and handle response
-    resp, err := c.httpClient.Do(req)
+    resp, err := c.do(req)
     if err != nil {
-        return nil, fmt.Errorf("error making request: %w", err)
+        return nil, time.Time{}, fmt.Errorf("error making request: %w", err)
     }
     defer resp.Body.Close()
 
-    if resp.StatusCode != http.StatusOK {
-        body, _ := io.ReadAll(resp.Body)
-        return nil, fmt.Errorf("API request failed with status: %d, body: %s", resp.StatusCode, string(body))
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return nil, time.Time{}, fmt.Errorf("error reading response body: %w", err)
+    }
+    if err := checkResponse(resp, body); err != nil {
+        return nil, time.Time{}, err
     }
 
-    // Parse response into Vehicle struct
+    // Decode the raw payload and map it onto our domain model
     var apiResp models.APIResponse
-    if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-        return nil, fmt.Errorf("error decoding response: %w", err)
+    if err := json.Unmarshal(body, &apiResp); err != nil {
+        return nil, time.Time{}, fmt.Errorf("error decoding response: %w", err)
     }
 
-    return apiResp.ResultList, nil
+    vehicles := apiResp.Vehicles()
+    c.ApplyNameOverrides(vehicles)
+    c.ApplyFixPolicy(vehicles)
+    SortDevices(vehicles)
+    fetchedAt := c.cache.store(copyVehicles(vehicles))
+    return vehicles, fetchedAt, nil
+}
+
+// SortDevices orders vehicles by device id in place.
+// OneStepGPS doesn't return devices in a stable order, so without this the
+// list in VehicleList.vue and every broadcast could reshuffle between polls.
+func SortDevices(vehicles []models.Vehicle) {
+    sort.Slice(vehicles, func(i, j int) bool {
+        return vehicles[i].DeviceID < vehicles[j].DeviceID
+    })
+}
+
+// Device point history paging, see GetDeviceHistory
+const (
+    historyPageSize = 1000
+    historyMaxPages = 20 // Caps a single track at 20k points
+)
+
+// GetDeviceHistory returns a device's recorded points between from and to,
+// oldest first. Pages through the device-point endpoint until a short page,
+// up to historyMaxPages. An empty range returns an empty, non-nil slice.
+// Used by the /vehicles/{id}/track endpoint for trails in MapView.vue.
+func (c *Client) GetDeviceHistory(deviceID string, from, to time.Time) ([]models.Location, error) {
+    points := make([]models.Location, 0)
+
+    for page := 0; page < historyMaxPages; page++ {
+        params := url.Values{}
+        params.Set("device_id", deviceID)
+        params.Set("dt_tracker_from", from.UTC().Format(time.RFC3339))
+        params.Set("dt_tracker_to", to.UTC().Format(time.RFC3339))
+        params.Set("limit", strconv.Itoa(historyPageSize))
+        params.Set("offset", strconv.Itoa(page*historyPageSize))
+        reqURL := fmt.Sprintf("%s/device-point?%s", c.baseURL, params.Encode())
+
+        req, err := http.NewRequest("GET", reqURL, nil)
+        if err != nil {
+            return nil, fmt.Errorf("error creating request: %w", err)
+        }
+        req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+
+        resp, err := c.do(req)
+        if err != nil {
+            return nil, fmt.Errorf("error making request: %w", err)
+        }
+        body, err := io.ReadAll(resp.Body)
+        resp.Body.Close()
+        if err != nil {
+            return nil, fmt.Errorf("error reading response body: %w", err)
+        }
+        if err := checkResponse(resp, body); err != nil {
+            return nil, err
+        }
+
+        var pageResp models.APIDevicePointResponse
+        if err := json.Unmarshal(body, &pageResp); err != nil {
+            return nil, fmt.Errorf("error decoding response: %w", err)
+        }
+        for i := range pageResp.ResultList {
+            if loc := models.LocationFromAPI(&pageResp.ResultList[i]); loc != nil {
+                points = append(points, *loc)
+            }
+        }
+        if len(pageResp.ResultList) < historyPageSize {
+            break
+        }
+    }
+
+    sort.SliceStable(points, func(i, j int) bool {
+        return points[i].Timestamp.Before(points[j].Timestamp)
+    })
+    return points, nil
 }
 
 // GetVehicleUpdates polls for vehicle updates at specified interval
@@ -101,7 +256,7 @@ func (c *Client) GetVehicleUpdates(interval time.Duration, updates chan<- []mode
 // GenerateReport initiates report generation with OneStepGPS API.
 // Called by GenerateReportHandler when user requests a report in ReportDialog.vue.
 func (c *Client) GenerateReport(req *models.ReportRequest) (*models.ReportResponse, error) {
-    url := fmt.Sprintf("%s/report/generate", baseURL)
+    url := fmt.Sprintf("%s/report/generate", c.baseURL)
     
     // Prepare request body
     jsonData, err := json.Marshal(req)
@@ -119,23 +274,33 @@ func (c *Client) GenerateReport(req *models.ReportRequest) (*models.ReportRespon
     request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
 
     // Send request and handle response
-    resp, err := c.httpClient.Do(request)
+    resp, err := c.do(request)
     if err != nil {
         return nil, fmt.Errorf("error sending request: %w", err)
     }
     defer resp.Body.Close()
 
-    // Check response status
-    if resp.StatusCode != http.StatusOK {
-        return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return nil, fmt.Errorf("error reading response body: %w", err)
+    }
+    fmt.Printf("Initial response: %s\n", string(body))
+    if err := checkResponse(resp, body); err != nil {
+        return nil, err
     }
 
     // Parse response into ReportResponse struct
     var reportResp models.ReportResponse
-    if err := json.NewDecoder(resp.Body).Decode(&reportResp); err != nil {
+    if err := json.Unmarshal(body, &reportResp); err != nil {
         return nil, fmt.Errorf("error decoding response: %w", err)
     }
 
+    // OneStepGPS can report errors in the body of a 200 response
+    if !reportResp.Error.IsEmpty() {
+        reportResp.Error.StatusCode = resp.StatusCode
+        return nil, reportResp.Error
+    }
+
     return &reportResp, nil
 }
 
@@ -145,7 +310,7 @@ func (c *Client) GetReportStatus(reportID string) (*models.ReportStatus, error)
     fmt.Printf("Getting status for report: %s\n", reportID)
 
     // Use the correct endpoint for report status
-    url := fmt.Sprintf("%s/report-generated/%s", baseURL, reportID)
+    url := fmt.Sprintf("%s/report-generated/%s", c.baseURL, reportID)
     fmt.Printf("Making request to: %s\n", url)
     
     // Create and send status check request
@@ -157,7 +322,7 @@ func (c *Client) GetReportStatus(reportID string) (*models.ReportStatus, error)
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
 
-    resp, err := c.httpClient.Do(req)
+    resp, err := c.do(req)
     if err != nil {
         return nil, fmt.Errorf("error getting report status: %w", err)
     }
@@ -169,9 +334,8 @@ func (c *Client) GetReportStatus(reportID string) (*models.ReportStatus, error)
         return nil, fmt.Errorf("error reading response body: %w", err)
     }
     fmt.Printf("Raw response from OneStepGPS: %s\n", string(body))
-
-    if resp.StatusCode != http.StatusOK {
-        return nil, fmt.Errorf("API request failed with status: %d, body: %s", resp.StatusCode, string(body))
+    if err := checkResponse(resp, body); err != nil {
+        return nil, err
     }
 
     // Parse response into ReportStatus struct
@@ -180,15 +344,27 @@ func (c *Client) GetReportStatus(reportID string) (*models.ReportStatus, error)
         return nil, fmt.Errorf("error decoding response: %w", err)
     }
 
+    // Generation failures are reported in the body of a 200 response
+    if !status.Error.IsEmpty() {
+        status.Error.StatusCode = resp.StatusCode
+        return nil, status.Error
+    }
+
     return &status, nil
 }
 
 
-// DownloadReport downloads a generated report PDF.
-// Called when report is ready in GenerateReportHandler.
-func (c *Client) DownloadReport(reportID string) ([]byte, string, error) {
-    url := fmt.Sprintf("%s/report-generated/export/%s?file_type=pdf", baseURL, reportID)
-    fmt.Printf("Attempting to download report from: %s\n", url)
+// DownloadReport downloads a generated report into memory in the given
+// export type (pdf, xlsx, ...), which must be allowed by CheckFileType.
+// For sending a report to a client prefer OpenReport, which doesn't buffer.
+func (c *Client) DownloadReport(reportID, fileType string) ([]byte, string, error) {
+    if err := c.CheckFileType(fileType); err != nil {
+        return nil, "", err
+    }
+
+    // Export endpoint also expects the key as a query param
+    url := fmt.Sprintf("%s/report-generated/export/%s?file_type=%s&api-key=%s", c.baseURL, reportID, fileType, c.apiKey)
+    fmt.Printf("Attempting to download report: %s\n", reportID)
 
     // Create download request
     req, err := http.NewRequest("GET", url, nil)
@@ -199,7 +375,7 @@ func (c *Client) DownloadReport(reportID string) ([]byte, string, error) {
     req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
 
     // Execute download request
-    resp, err := c.httpClient.Do(req)
+    resp, err := c.do(req)
     if err != nil {
         return nil, "", fmt.Errorf("error downloading report: %w", err)
     }
@@ -208,7 +384,7 @@ func (c *Client) DownloadReport(reportID string) ([]byte, string, error) {
     // Handle failed download
     if resp.StatusCode != http.StatusOK {
         bodyBytes, _ := io.ReadAll(resp.Body)
-        return nil, "", fmt.Errorf("download failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+        return nil, "", checkResponse(resp, bodyBytes)
     }
 
     // Read PDF content
@@ -219,4 +395,90 @@ func (c *Client) DownloadReport(reportID string) ([]byte, string, error) {
 
     contentType := resp.Header.Get("Content-Type")
     return content, contentType, nil
-}
\ No newline at end of file
+}
+
+// OpenReport starts downloading a generated report export and returns its
+// body for the caller to read and close, along with its content type.
+// Used to stream a report to the client and to bundle several formats into one archive.
+func (c *Client) OpenReport(reportID, fileType string) (io.ReadCloser, string, error) {
+    if err := c.CheckFileType(fileType); err != nil {
+        return nil, "", err
+    }
+
+    url := fmt.Sprintf("%s/report-generated/export/%s?file_type=%s&api-key=%s", c.baseURL, reportID, fileType, c.apiKey)
+    fmt.Printf("Attempting to stream report: %s (%s)\n", reportID, fileType)
+
+    req, err := http.NewRequest("GET", url, nil)
+    if err != nil {
+        return nil, "", fmt.Errorf("error creating download request: %w", err)
+    }
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+
+    resp, err := c.do(req)
+    if err != nil {
+        return nil, "", fmt.Errorf("error downloading report: %w", err)
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        defer resp.Body.Close()
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return nil, "", checkResponse(resp, bodyBytes)
+    }
+
+    contentType := resp.Header.Get("Content-Type")
+    if contentType == "" {
+        contentType = mime.TypeByExtension("." + fileType)
+    }
+    if contentType == "" {
+        contentType = "application/octet-stream"
+    }
+    return resp.Body, contentType, nil
+}
+
+// FlushWriter flushes after every write so the client receives each chunk
+// as soon as it's read from upstream instead of when the buffer fills
+type FlushWriter struct {
+    W http.ResponseWriter
+}
+
+func (fw FlushWriter) Write(p []byte) (int, error) {
+    n, err := fw.W.Write(p)
+    if f, ok := fw.W.(http.Flusher); ok {
+        f.Flush()
+    }
+    return n, err
+}
+
+// parseAPIError converts a failed OneStepGPS response into a typed APIError.
+// Upstream uses {"error": "..."}, {"error": {"code": ..., "message": ...}} or a
+// top-level {"code": ..., "message": ...}; anything else falls back to the raw body.
+func parseAPIError(statusCode int, body []byte) *models.APIError {
+    apiErr := &models.APIError{StatusCode: statusCode}
+
+    var payload struct {
+        Error   *models.APIError `json:"error"`
+        Code    interface{}      `json:"code"`
+        Message string           `json:"message"`
+    }
+    if err := json.Unmarshal(body, &payload); err == nil {
+        if !payload.Error.IsEmpty() {
+            apiErr.Code = payload.Error.Code
+            apiErr.Message = payload.Error.Message
+            return apiErr
+        }
+        if payload.Message != "" {
+            apiErr.Message = payload.Message
+            if payload.Code != nil {
+                apiErr.Code = fmt.Sprint(payload.Code)
+            }
+            return apiErr
+        }
+    }
+
+    // Unstructured body, keep it as the message so nothing is lost
+    apiErr.Message = strings.TrimSpace(string(body))
+    if apiErr.Message == "" {
+        apiErr.Message = http.StatusText(statusCode)
+    }
+    return apiErr
+}
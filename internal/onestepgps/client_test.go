@@ -0,0 +1,92 @@
+// client_test.go covers how OneStepGPS responses are turned into errors.
+
+package onestepgps
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+const htmlPage = "<html><body>Error</body></html>"
+
+func TestResponseErrors(t *testing.T) {
+    tests := []struct {
+        name        string
+        status      int
+        contentType string
+        body        string
+        wantStatus  int  // Expected APIError status, 0 for none
+        unavailable bool // Expected ErrUpstreamUnavailable
+    }{
+        {"ok", http.StatusOK, "application/json", `{"result_list":[]}`, 0, false},
+        {"unauthorized html", http.StatusUnauthorized, "text/html", htmlPage, http.StatusUnauthorized, false},
+        {"forbidden html", http.StatusForbidden, "text/html", htmlPage, http.StatusForbidden, false},
+        {"not found json", http.StatusNotFound, "application/json", `{"message":"no such report"}`, http.StatusNotFound, false},
+        {"server error json", http.StatusInternalServerError, "application/json", `{"error":"boom"}`, http.StatusInternalServerError, false},
+        {"bad gateway html", http.StatusBadGateway, "text/html", htmlPage, 0, true},
+        {"ok html", http.StatusOK, "text/html", htmlPage, 0, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set("Content-Type", tt.contentType)
+                w.WriteHeader(tt.status)
+                w.Write([]byte(tt.body))
+            }))
+            defer srv.Close()
+            c := NewClient("key", srv.URL, nil)
+
+            _, getErr := c.GetDevices()
+            _, _, downloadErr := c.DownloadReport("r1", DefaultFileType)
+            for call, err := range map[string]error{"GetDevices": getErr, "DownloadReport": downloadErr} {
+                if tt.status == http.StatusOK && call == "DownloadReport" {
+                    continue // A 200 download is the file itself, whatever its type
+                }
+                var apiErr *models.APIError
+                switch {
+                case tt.wantStatus != 0:
+                    if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus {
+                        t.Errorf("%s: err = %v, want APIError with status %d", call, err, tt.wantStatus)
+                    }
+                case tt.unavailable:
+                    if !errors.Is(err, ErrUpstreamUnavailable) {
+                        t.Errorf("%s: err = %v, want ErrUpstreamUnavailable", call, err)
+                    }
+                case err != nil:
+                    t.Errorf("%s: unexpected error %v", call, err)
+                }
+            }
+        })
+    }
+}
+
+func TestParseAPIError(t *testing.T) {
+    tests := []struct {
+        name        string
+        status      int
+        body        string
+        wantCode    string
+        wantMessage string
+    }{
+        {"string error", 401, `{"error":"bad api key"}`, "", "bad api key"},
+        {"object error", 403, `{"error":{"code":"forbidden","message":"no access"}}`, "forbidden", "no access"},
+        {"top-level message", 404, `{"code":404,"message":"device not found"}`, "404", "device not found"},
+        {"empty error falls back to message", 400, `{"error":"","message":"bad date"}`, "", "bad date"},
+        {"plain text", 500, "upstream exploded\n", "", "upstream exploded"},
+        {"garbage json", 502, `{"error":`, "", `{"error":`},
+        {"empty body", 503, "", "", "Service Unavailable"},
+        {"json without error fields", 500, `{"status":"bad"}`, "", `{"status":"bad"}`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := parseAPIError(tt.status, []byte(tt.body))
+            if got.StatusCode != tt.status || got.Code != tt.wantCode || got.Message != tt.wantMessage {
+                t.Errorf("got %+v, want status %d code %q message %q", got, tt.status, tt.wantCode, tt.wantMessage)
+            }
+        })
+    }
+}
@@ -0,0 +1,67 @@
+// errors.go provides the client's sentinel errors and detection of non-API
+// responses from OneStepGPS, such as the HTML error pages served during upstream incidents.
+
+package onestepgps
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+)
+
+// ErrUpstreamUnavailable is returned when OneStepGPS answers with something
+// other than its JSON API, usually an HTML error page from its load balancer.
+// Handlers map it to 502 Bad Gateway.
+var ErrUpstreamUnavailable = errors.New("OneStepGPS is temporarily unavailable")
+
+// DefaultFileType is the report export type used when none is requested
+const DefaultFileType = "pdf"
+
+// ErrFileTypeNotAllowed is returned for report export types outside the
+// deployment's REPORT_FILE_TYPES allowlist
+var ErrFileTypeNotAllowed = errors.New("report file type not allowed")
+
+// maxSnippetLength caps how much of an unexpected body is logged
+const maxSnippetLength = 200
+
+// checkJSONBody returns ErrUpstreamUnavailable if body isn't a JSON API response.
+// The content type is trusted when it says JSON, otherwise the body must
+// start like a JSON document. The offending body is logged server-side only.
+func checkJSONBody(resp *http.Response, body []byte) error {
+    mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+    if mediaType == "application/json" {
+        return nil
+    }
+    trimmed := bytes.TrimSpace(body)
+    if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+        return nil
+    }
+
+    snippet := trimmed
+    if len(snippet) > maxSnippetLength {
+        snippet = snippet[:maxSnippetLength]
+    }
+    log.Printf("OneStepGPS returned non-JSON response (status %d, content type %q): %s", resp.StatusCode, resp.Header.Get("Content-Type"), snippet)
+    return fmt.Errorf("%w (status %d)", ErrUpstreamUnavailable, resp.StatusCode)
+}
+
+// checkResponse returns the error for a OneStepGPS JSON response, nil on 200.
+// Client errors (4xx) are parsed as an APIError first so auth and validation
+// failures keep their status even when the body is an HTML error page. Other
+// statuses must have a JSON body, a non-JSON one means upstream (or a proxy
+// in front of it) is unavailable.
+func checkResponse(resp *http.Response, body []byte) error {
+    if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+        return parseAPIError(resp.StatusCode, body)
+    }
+    if err := checkJSONBody(resp, body); err != nil {
+        return err
+    }
+    if resp.StatusCode != http.StatusOK {
+        return parseAPIError(resp.StatusCode, body)
+    }
+    return nil
+}
@@ -0,0 +1,66 @@
+// file_types_test.go covers the REPORT_FILE_TYPES export allowlist.
+
+package onestepgps
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckFileType(t *testing.T) {
+    tests := []struct {
+        name    string
+        allowed []string
+        check   string
+        wantErr bool
+    }{
+        {"default allows pdf", nil, "pdf", false},
+        {"default disallows xlsx", nil, "xlsx", true},
+        {"configured type", []string{"pdf", "xlsx"}, "xlsx", false},
+        {"configured case-insensitively", []string{"PDF", "XLSX"}, "xlsx", false},
+        {"outside the list", []string{"pdf", "xlsx"}, "csv", true},
+        {"pdf not implied", []string{"xlsx"}, "pdf", true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := NewClient("key", "", tt.allowed).CheckFileType(tt.check)
+            if !tt.wantErr {
+                if err != nil {
+                    t.Errorf("CheckFileType(%q) = %v, want allowed", tt.check, err)
+                }
+                return
+            }
+            if !errors.Is(err, ErrFileTypeNotAllowed) {
+                t.Errorf("CheckFileType(%q) = %v, want ErrFileTypeNotAllowed", tt.check, err)
+            }
+        })
+    }
+}
+
+func TestDownloadDisallowedFileType(t *testing.T) {
+    var calls atomic.Int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls.Add(1)
+        w.Write([]byte("data"))
+    }))
+    t.Cleanup(srv.Close)
+    c := NewClient("key", srv.URL, []string{"pdf"})
+
+    // Rejected before anything is requested upstream
+    if _, _, err := c.DownloadReport("rep-1", "xlsx"); !errors.Is(err, ErrFileTypeNotAllowed) {
+        t.Errorf("DownloadReport error = %v, want ErrFileTypeNotAllowed", err)
+    }
+    if _, _, err := c.OpenReport("rep-1", "xlsx"); !errors.Is(err, ErrFileTypeNotAllowed) {
+        t.Errorf("OpenReport error = %v, want ErrFileTypeNotAllowed", err)
+    }
+    if n := calls.Load(); n != 0 {
+        t.Errorf("upstream requests = %d, want 0", n)
+    }
+
+    if _, _, err := c.DownloadReport("rep-1", "pdf"); err != nil {
+        t.Errorf("DownloadReport(pdf) = %v", err)
+    }
+}
@@ -0,0 +1,44 @@
+// fix.go applies the configured policy for device positions without a valid
+// GPS fix (0,0 or out-of-range coordinates), see models.ValidCoordinates.
+
+package onestepgps
+
+import (
+	"fmt"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// Invalid fix policies accepted by INVALID_FIX_MODE
+const (
+    FixModeFlag = "flag" // Keep the position with has_fix:false, the frontend decides
+    FixModeDrop = "drop" // Remove the position, the vehicle is listed without a location
+)
+
+// SetInvalidFixMode sets how positions without a valid fix are handled in
+// every GetDevices result. Must be called before the client is shared.
+func (c *Client) SetInvalidFixMode(mode string) error {
+    switch mode {
+    case "", FixModeFlag:
+        c.fixMode = FixModeFlag
+    case FixModeDrop:
+        c.fixMode = FixModeDrop
+    default:
+        return fmt.Errorf("invalid fix mode %q: must be %s or %s", mode, FixModeFlag, FixModeDrop)
+    }
+    return nil
+}
+
+// ApplyFixPolicy drops positions without a valid fix in place when the mode
+// is FixModeDrop. In FixModeFlag they are left as mapped, with HasFix false.
+// Also used for vehicles pushed via webhook, which bypass GetDevices.
+func (c *Client) ApplyFixPolicy(vehicles []models.Vehicle) {
+    if c.fixMode != FixModeDrop {
+        return
+    }
+    for i := range vehicles {
+        if loc := vehicles[i].LastLocation; loc != nil && !loc.HasFix {
+            vehicles[i].LastLocation = nil
+        }
+    }
+}
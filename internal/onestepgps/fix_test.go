@@ -0,0 +1,124 @@
+// fix_test.go covers flagging and dropping positions without a valid GPS fix.
+
+package onestepgps
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// fixDevices has one real position, one at 0,0 and two out of range
+const fixDevices = `{"result_list":[
+    {"device_id":"fix","latest_device_point":{"lat":39.7392,"lng":-104.9903}},
+    {"device_id":"null-island","latest_device_point":{"lat":0,"lng":0}},
+    {"device_id":"bad-lat","latest_device_point":{"lat":95.2,"lng":-104.9}},
+    {"device_id":"bad-lng","latest_device_point":{"lat":39.7,"lng":-204.9}}
+]}`
+
+// fixClient is a client fetching fixDevices in the given mode
+func fixClient(t *testing.T, mode string) *Client {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(fixDevices))
+    }))
+    t.Cleanup(srv.Close)
+
+    c := NewClient("key", srv.URL, nil)
+    if err := c.SetInvalidFixMode(mode); err != nil {
+        t.Fatal(err)
+    }
+    return c
+}
+
+func TestGetDevicesFlagsInvalidFix(t *testing.T) {
+    for _, mode := range []string{"", FixModeFlag} {
+        vehicles, err := fixClient(t, mode).GetDevices()
+        if err != nil {
+            t.Fatal(err)
+        }
+        for _, v := range vehicles {
+            loc := v.LastLocation
+            if loc == nil {
+                t.Errorf("mode %q: %s LastLocation = nil, want it kept", mode, v.DeviceID)
+                continue
+            }
+            if want := v.DeviceID == "fix"; loc.HasFix != want {
+                t.Errorf("mode %q: %s has_fix = %v, want %v", mode, v.DeviceID, loc.HasFix, want)
+            }
+        }
+    }
+}
+
+func TestGetDevicesDropsInvalidFix(t *testing.T) {
+    vehicles, err := fixClient(t, FixModeDrop).GetDevices()
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Vehicles stay listed, only their unusable positions go
+    if len(vehicles) != 4 {
+        t.Fatalf("got %d vehicles, want 4", len(vehicles))
+    }
+    for _, v := range vehicles {
+        if v.DeviceID == "fix" {
+            if v.LastLocation == nil || !v.LastLocation.HasFix {
+                t.Errorf("fix LastLocation = %+v, want the position", v.LastLocation)
+            }
+        } else if v.LastLocation != nil {
+            t.Errorf("%s LastLocation = %+v, want dropped", v.DeviceID, v.LastLocation)
+        }
+    }
+}
+
+func TestApplyFixPolicyPushedVehicles(t *testing.T) {
+    pushed := func() []models.Vehicle {
+        return []models.Vehicle{{DeviceID: "dev1", LastLocation: &models.Location{HasFix: false}}}
+    }
+
+    flagged := pushed()
+    NewClient("key", "", nil).ApplyFixPolicy(flagged)
+    if flagged[0].LastLocation == nil {
+        t.Error("flag mode dropped the position")
+    }
+
+    c := NewClient("key", "", nil)
+    if err := c.SetInvalidFixMode(FixModeDrop); err != nil {
+        t.Fatal(err)
+    }
+    dropped := pushed()
+    c.ApplyFixPolicy(dropped)
+    if dropped[0].LastLocation != nil {
+        t.Errorf("drop mode kept %+v", dropped[0].LastLocation)
+    }
+}
+
+func TestSetInvalidFixModeRejectsUnknown(t *testing.T) {
+    if err := NewClient("key", "", nil).SetInvalidFixMode("hide"); err == nil {
+        t.Error("SetInvalidFixMode(hide) = nil, want an error")
+    }
+}
+
+func TestValidCoordinates(t *testing.T) {
+    tests := []struct {
+        lat, lng float64
+        want     bool
+    }{
+        {39.7392, -104.9903, true},
+        {0, 12.5, true}, // On the equator
+        {-90, 180, true},
+        {0, 0, false},
+        {90.1, 0, false},
+        {-91, 10, false},
+        {10, 180.5, false},
+        {10, -181, false},
+        {math.NaN(), 10, false},
+    }
+    for _, tt := range tests {
+        if got := models.ValidCoordinates(tt.lat, tt.lng); got != tt.want {
+            t.Errorf("ValidCoordinates(%v, %v) = %v, want %v", tt.lat, tt.lng, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,83 @@
+// history_test.go covers paging through the device point history.
+
+package onestepgps
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// historyStart is the time of the first point in pointSeries
+var historyStart = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+// pointSeries serves n points a minute apart from historyStart, newest
+// first like upstream, honoring limit and offset, and counts the pages asked for
+func pointSeries(t *testing.T, n int) (*httptest.Server, *atomic.Int32) {
+    t.Helper()
+    var pages atomic.Int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        pages.Add(1)
+        q := r.URL.Query()
+        if r.URL.Path != "/device-point" || q.Get("device_id") != "dev1" {
+            http.NotFound(w, r)
+            return
+        }
+        limit, _ := strconv.Atoi(q.Get("limit"))
+        offset, _ := strconv.Atoi(q.Get("offset"))
+        var points []string
+        for i := offset; i < n && i < offset+limit; i++ {
+            ts := historyStart.Add(time.Duration(n-1-i) * time.Minute)
+            points = append(points, fmt.Sprintf(`{"dt_tracker":%q,"lat":39.7,"lng":-104.9,"speed":%d}`, ts.Format(time.RFC3339), i))
+        }
+        w.Header().Set("Content-Type", "application/json")
+        fmt.Fprintf(w, `{"result_list":[%s]}`, strings.Join(points, ","))
+    }))
+    t.Cleanup(srv.Close)
+    return srv, &pages
+}
+
+func TestGetDeviceHistoryPages(t *testing.T) {
+    const total = historyPageSize + 3
+    srv, pages := pointSeries(t, total)
+
+    points, err := NewClient("key", srv.URL, nil).GetDeviceHistory("dev1", historyStart, historyStart.Add(24*time.Hour))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(points) != total {
+        t.Fatalf("got %d points, want %d", len(points), total)
+    }
+    // A full page is followed by a short one, which ends paging
+    if n := pages.Load(); n != 2 {
+        t.Errorf("requested %d pages, want 2", n)
+    }
+    for i := 1; i < len(points); i++ {
+        if !points[i-1].Timestamp.Before(points[i].Timestamp) {
+            t.Fatalf("points %d and %d out of order: %v, %v", i-1, i, points[i-1].Timestamp, points[i].Timestamp)
+        }
+    }
+    if !points[0].Timestamp.Equal(historyStart) || points[0].Latitude != 39.7 || points[0].Longitude != -104.9 {
+        t.Errorf("first point = %+v, want the oldest at %v", points[0], historyStart)
+    }
+}
+
+func TestGetDeviceHistoryEmptyRange(t *testing.T) {
+    srv, pages := pointSeries(t, 0)
+
+    points, err := NewClient("key", srv.URL, nil).GetDeviceHistory("dev1", historyStart, historyStart.Add(time.Hour))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if points == nil || len(points) != 0 {
+        t.Errorf("points = %#v, want an empty non-nil slice", points)
+    }
+    if n := pages.Load(); n != 1 {
+        t.Errorf("requested %d pages, want 1", n)
+    }
+}
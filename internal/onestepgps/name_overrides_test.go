@@ -0,0 +1,67 @@
+// name_overrides_test.go covers applying DEVICE_NAME_OVERRIDES to fetched
+// and pushed devices.
+
+package onestepgps
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// overrideNames is the display name of each vehicle in order
+func overrideNames(vehicles []models.Vehicle) []string {
+    names := make([]string, 0, len(vehicles))
+    for _, v := range vehicles {
+        names = append(names, v.DisplayName)
+    }
+    return names
+}
+
+func TestGetDevicesAppliesNameOverrides(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(`{"result_list":[
+            {"device_id":"dev1","display_name":"Upstream 1"},
+            {"device_id":"dev2","display_name":"Upstream 2"},
+            {"device_id":"dev3","display_name":"Upstream 3"}
+        ]}`))
+    }))
+    t.Cleanup(srv.Close)
+
+    c := NewClient("key", srv.URL, nil)
+    c.SetNameOverrides(map[string]string{
+        "dev1":    "Front Loader",
+        "dev3":    "", // Empty overrides keep the upstream name
+        "missing": "Not In Account",
+    })
+
+    vehicles, err := c.GetDevices()
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []string{"Front Loader", "Upstream 2", "Upstream 3"}
+    if got := overrideNames(vehicles); !reflect.DeepEqual(got, want) {
+        t.Errorf("display names = %v, want %v", got, want)
+    }
+}
+
+func TestApplyNameOverrides(t *testing.T) {
+    pushed := []models.Vehicle{{DeviceID: "dev1", DisplayName: "Upstream 1"}, {DeviceID: "dev2", DisplayName: "Upstream 2"}}
+
+    // Without overrides vehicles are left alone
+    NewClient("key", "", nil).ApplyNameOverrides(pushed)
+    if got, want := overrideNames(pushed), []string{"Upstream 1", "Upstream 2"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("without overrides = %v, want %v", got, want)
+    }
+
+    c := NewClient("key", "", nil)
+    c.SetNameOverrides(map[string]string{"dev2": "Tanker"})
+    c.ApplyNameOverrides(pushed)
+    if got, want := overrideNames(pushed), []string{"Upstream 1", "Tanker"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("with overrides = %v, want %v", got, want)
+    }
+}
@@ -0,0 +1,57 @@
+// order_test.go covers GetDevices returning devices in a stable order.
+
+package onestepgps
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// deviceIDs is the device id of each vehicle in order
+func deviceIDs(vehicles []models.Vehicle) []string {
+    ids := make([]string, 0, len(vehicles))
+    for _, v := range vehicles {
+        ids = append(ids, v.DeviceID)
+    }
+    return ids
+}
+
+func TestGetDevicesStableOrder(t *testing.T) {
+    // Upstream lists the same devices in a different order on each call
+    replies := []string{
+        `{"result_list":[{"device_id":"dev-c"},{"device_id":"dev-a"},{"device_id":"dev-b"}]}`,
+        `{"result_list":[{"device_id":"dev-b"},{"device_id":"dev-c"},{"device_id":"dev-a"}]}`,
+    }
+    var calls atomic.Int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(replies[int(calls.Add(1)-1)%len(replies)]))
+    }))
+    t.Cleanup(srv.Close)
+    c := NewClient("key", srv.URL, nil)
+
+    want := []string{"dev-a", "dev-b", "dev-c"}
+    for i := range replies {
+        vehicles, err := c.GetDevices()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got := deviceIDs(vehicles); !reflect.DeepEqual(got, want) {
+            t.Errorf("call %d: devices = %v, want %v", i+1, got, want)
+        }
+    }
+}
+
+func TestSortDevices(t *testing.T) {
+    vehicles := []models.Vehicle{{DeviceID: "b"}, {DeviceID: "B"}, {DeviceID: "a10"}, {DeviceID: "a2"}}
+    SortDevices(vehicles)
+    // Plain byte order, the same on every server
+    if got, want := deviceIDs(vehicles), []string{"B", "a10", "a2", "b"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("sorted = %v, want %v", got, want)
+    }
+}
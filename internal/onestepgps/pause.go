@@ -0,0 +1,38 @@
+// pause.go lets operators stop every request to OneStepGPS, e.g. during
+// upstream maintenance. Device reads keep serving the last fetched list.
+
+package onestepgps
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrUpstreamPaused is returned instead of calling OneStepGPS while requests
+// are paused. Handlers map it to 503 Service Unavailable.
+var ErrUpstreamPaused = errors.New("OneStepGPS requests are paused")
+
+// Pause stops requests to OneStepGPS until Resume is called: polls, report
+// generation and downloads, and device history fail with ErrUpstreamPaused,
+// GetDevices returns the cached list
+func (c *Client) Pause() {
+    c.paused.Store(true)
+}
+
+// Resume allows requests to OneStepGPS again
+func (c *Client) Resume() {
+    c.paused.Store(false)
+}
+
+// Paused reports whether requests to OneStepGPS are paused
+func (c *Client) Paused() bool {
+    return c.paused.Load()
+}
+
+// do sends req to OneStepGPS unless requests are paused
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+    if c.paused.Load() {
+        return nil, ErrUpstreamPaused
+    }
+    return c.httpClient.Do(req)
+}
@@ -0,0 +1,57 @@
+// transport.go configures connection pooling for requests to OneStepGPS.
+// Every request goes to the same host, so idle connections are kept per host
+// instead of being reopened for each poll or report status check.
+
+package onestepgps
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig tunes the pooled transport shared by a Client's requests
+type TransportConfig struct {
+    MaxIdleConns        int           // Idle connections kept across all hosts
+    MaxIdleConnsPerHost int           // Idle connections kept to OneStepGPS
+    IdleConnTimeout     time.Duration // How long an idle connection stays open
+    KeepAlive           time.Duration // TCP keep-alive probe interval, negative disables
+}
+
+// DefaultTransportConfig is used by NewClient until SetTransport is called
+var DefaultTransportConfig = TransportConfig{
+    MaxIdleConns:        100,
+    MaxIdleConnsPerHost: 10,
+    IdleConnTimeout:     90 * time.Second,
+    KeepAlive:           30 * time.Second,
+}
+
+// newTransport builds an http.Transport from cfg, keeping the proxy and
+// TLS defaults of http.DefaultTransport
+func newTransport(cfg TransportConfig) *http.Transport {
+    dialer := &net.Dialer{
+        Timeout:   30 * time.Second,
+        KeepAlive: cfg.KeepAlive,
+    }
+    return &http.Transport{
+        Proxy:                 http.ProxyFromEnvironment,
+        DialContext:           dialer.DialContext,
+        ForceAttemptHTTP2:     true,
+        MaxIdleConns:          cfg.MaxIdleConns,
+        MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+        IdleConnTimeout:       cfg.IdleConnTimeout,
+        TLSHandshakeTimeout:   10 * time.Second,
+        ExpectContinueTimeout: 1 * time.Second,
+    }
+}
+
+// SetTransport replaces the client's connection pool with one built from
+// cfg. Must be called before the client is shared.
+func (c *Client) SetTransport(cfg TransportConfig) error {
+    if cfg.MaxIdleConns < 0 || cfg.MaxIdleConnsPerHost < 0 || cfg.IdleConnTimeout < 0 {
+        return fmt.Errorf("invalid transport config: idle connection limits and timeout must not be negative")
+    }
+    c.httpClient.Transport = newTransport(cfg)
+    return nil
+}
@@ -0,0 +1,87 @@
+// transport_test.go covers the pooled transport shared by a Client's requests.
+
+package onestepgps
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// clientTransport returns the client's *http.Transport
+func clientTransport(t *testing.T, c *Client) *http.Transport {
+    t.Helper()
+    transport, ok := c.httpClient.Transport.(*http.Transport)
+    if !ok {
+        t.Fatalf("Transport = %T, want the pooled *http.Transport", c.httpClient.Transport)
+    }
+    return transport
+}
+
+func TestNewClientPooledTransport(t *testing.T) {
+    c := NewClient("test-key", "", nil)
+    transport := clientTransport(t, c)
+    if transport == http.DefaultTransport {
+        t.Fatal("client shares http.DefaultTransport")
+    }
+    if transport.MaxIdleConns != 100 || transport.MaxIdleConnsPerHost != 10 || transport.IdleConnTimeout != 90*time.Second {
+        t.Errorf("transport = %d idle, %d per host, %v timeout, want DefaultTransportConfig",
+            transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+    }
+}
+
+func TestSetTransport(t *testing.T) {
+    c := NewClient("test-key", "", nil)
+    cfg := TransportConfig{MaxIdleConns: 20, MaxIdleConnsPerHost: 5, IdleConnTimeout: time.Minute, KeepAlive: 15 * time.Second}
+    if err := c.SetTransport(cfg); err != nil {
+        t.Fatal(err)
+    }
+    transport := clientTransport(t, c)
+    if transport.MaxIdleConns != 20 || transport.MaxIdleConnsPerHost != 5 || transport.IdleConnTimeout != time.Minute {
+        t.Errorf("transport = %d idle, %d per host, %v timeout, want 20, 5 and 1m",
+            transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+    }
+
+    // Invalid settings leave the configured transport in place
+    for _, bad := range []TransportConfig{
+        {MaxIdleConns: -1},
+        {MaxIdleConnsPerHost: -1},
+        {IdleConnTimeout: -time.Second},
+    } {
+        if err := c.SetTransport(bad); err == nil {
+            t.Errorf("SetTransport(%+v) succeeded, want an error", bad)
+        }
+    }
+    if clientTransport(t, c) != transport {
+        t.Error("rejected config replaced the transport")
+    }
+}
+
+func TestTransportReusesConnections(t *testing.T) {
+    var opened atomic.Int32
+    srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(`{"result_list":[]}`))
+    }))
+    srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+        if state == http.StateNew {
+            opened.Add(1)
+        }
+    }
+    srv.Start()
+    defer srv.Close()
+
+    c := NewClient("test-key", srv.URL, nil)
+    for i := 0; i < 3; i++ {
+        if _, err := c.GetDevices(); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // Sequential polls share one keep-alive connection
+    if n := opened.Load(); n != 1 {
+        t.Errorf("3 requests opened %d connections, want 1", n)
+    }
+}
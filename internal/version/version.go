@@ -0,0 +1,46 @@
+// version.go holds build metadata injected at link time, e.g.
+//
+//	go build -ldflags "-X github.com/davidwiese/fleet-tracker-backend/internal/version.Version=v1.2.0 \
+//	  -X github.com/davidwiese/fleet-tracker-backend/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/davidwiese/fleet-tracker-backend/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+//	  -o bin/server ./cmd/server
+//
+// Values stay "dev" for local builds and go run.
+
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Set via -ldflags -X, see the file comment
+var (
+    Version   = "dev"
+    Commit    = "dev"
+    BuildTime = "dev"
+)
+
+// Info is the build metadata returned by /version
+type Info struct {
+    Version   string `json:"version"`
+    Commit    string `json:"commit"`
+    BuildTime string `json:"build_time"`
+    GoVersion string `json:"go_version"`
+}
+
+// Get returns the build metadata of the running binary
+func Get() Info {
+    return Info{
+        Version:   Version,
+        Commit:    Commit,
+        BuildTime: BuildTime,
+        GoVersion: runtime.Version(),
+    }
+}
+
+// Banner is the one-line summary logged at startup
+func Banner() string {
+    i := Get()
+    return fmt.Sprintf("fleet-tracker-backend version=%s commit=%s built=%s go=%s", i.Version, i.Commit, i.BuildTime, i.GoVersion)
+}
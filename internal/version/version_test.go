@@ -0,0 +1,28 @@
+// version_test.go covers the build metadata defaults and banner.
+
+package version
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGetDefaultsToDev(t *testing.T) {
+    want := Info{Version: "dev", Commit: "dev", BuildTime: "dev", GoVersion: runtime.Version()}
+    if got := Get(); got != want {
+        t.Errorf("Get() = %+v, want %+v", got, want)
+    }
+}
+
+func TestBanner(t *testing.T) {
+    Version, Commit, BuildTime = "v1.2.0", "abc1234", "2024-05-01T12:00:00Z"
+    t.Cleanup(func() { Version, Commit, BuildTime = "dev", "dev", "dev" })
+
+    banner := Banner()
+    for _, want := range []string{"version=v1.2.0", "commit=abc1234", "built=2024-05-01T12:00:00Z", "go=" + runtime.Version()} {
+        if !strings.Contains(banner, want) {
+            t.Errorf("Banner() = %q, missing %q", banner, want)
+        }
+    }
+}
@@ -0,0 +1,183 @@
+// signature.go verifies HMAC signatures on inbound webhook requests.
+// Used by api/webhooks.go for OneStepGPS push updates.
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinel reasons wrapped by SignatureError, compare with errors.Is
+var (
+    ErrMissingSignature     = errors.New("missing signature")
+    ErrMalformedSignature   = errors.New("malformed signature")
+    ErrUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+    ErrSignatureMismatch    = errors.New("signature mismatch")
+    ErrSignatureExpired     = errors.New("signature timestamp outside tolerance")
+)
+
+// SignatureError is returned for every failed verification.
+// Handlers can treat any *SignatureError as a 401.
+type SignatureError struct {
+    Err    error  // One of the sentinel errors above
+    Detail string // Optional extra context, never includes the expected signature
+}
+
+func (e *SignatureError) Error() string {
+    if e.Detail != "" {
+        return fmt.Sprintf("webhook signature invalid: %v (%s)", e.Err, e.Detail)
+    }
+    return fmt.Sprintf("webhook signature invalid: %v", e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+    return e.Err
+}
+
+// DefaultTolerance is the replay window used by the package-level VerifyHMAC,
+// matching the WEBHOOK_SIGNATURE_TOLERANCE default
+const DefaultTolerance = 5 * time.Minute
+
+// Verifier checks signatures using a configured algorithm and replay tolerance.
+// The zero value verifies HMAC-SHA256 without timestamps.
+type Verifier struct {
+    Algorithm string           // "sha256" (default), "sha1" or "sha512"
+    Tolerance time.Duration    // Max age of timestamped signatures, 0 disables the check
+    Now       func() time.Time // Clock override, defaults to time.Now
+}
+
+// VerifyHMAC checks signatureHeader against body using HMAC-SHA256,
+// rejecting timestamped signatures older than DefaultTolerance.
+// See Verifier.VerifyHMAC for the accepted header formats.
+func VerifyHMAC(secret string, body []byte, signatureHeader string) error {
+    return Verifier{Tolerance: DefaultTolerance}.VerifyHMAC(secret, body, signatureHeader)
+}
+
+// VerifyHMAC checks signatureHeader against body in constant time.
+// Accepted header formats:
+//   - "<hex>" or "<algorithm>=<hex>": HMAC of the raw body
+//   - "t=<unix seconds>,v1=<hex>": HMAC of "<t>.<body>", rejected when t is
+//     further than Tolerance from now so captured requests can't be replayed later
+func (v Verifier) VerifyHMAC(secret string, body []byte, signatureHeader string) error {
+    signatureHeader = strings.TrimSpace(signatureHeader)
+    if signatureHeader == "" {
+        return &SignatureError{Err: ErrMissingSignature}
+    }
+
+    algorithm := v.Algorithm
+    if algorithm == "" {
+        algorithm = "sha256"
+    }
+
+    // Timestamped form signs "<t>.<body>"
+    if strings.HasPrefix(signatureHeader, "t=") {
+        timestamp, signature, err := parseTimestampedHeader(signatureHeader)
+        if err != nil {
+            return err
+        }
+        if err := v.checkTimestamp(timestamp); err != nil {
+            return err
+        }
+        payload := append([]byte(strconv.FormatInt(timestamp, 10)+"."), body...)
+        return compareHMAC(algorithm, secret, payload, signature)
+    }
+
+    // Plain form, an algorithm prefix must match the configured one
+    signature := signatureHeader
+    if prefix, rest, found := strings.Cut(signatureHeader, "="); found {
+        if !strings.EqualFold(prefix, algorithm) {
+            return &SignatureError{Err: ErrUnsupportedAlgorithm, Detail: prefix}
+        }
+        signature = rest
+    }
+    return compareHMAC(algorithm, secret, body, signature)
+}
+
+// checkTimestamp enforces the replay tolerance window
+func (v Verifier) checkTimestamp(timestamp int64) error {
+    if v.Tolerance <= 0 {
+        return nil
+    }
+    now := time.Now
+    if v.Now != nil {
+        now = v.Now
+    }
+    age := now().Sub(time.Unix(timestamp, 0))
+    if age < 0 {
+        age = -age
+    }
+    if age > v.Tolerance {
+        return &SignatureError{Err: ErrSignatureExpired, Detail: fmt.Sprintf("age %s exceeds %s", age.Round(time.Second), v.Tolerance)}
+    }
+    return nil
+}
+
+// parseTimestampedHeader splits "t=<unix>,v1=<hex>" into its parts
+func parseTimestampedHeader(header string) (int64, string, error) {
+    var timestamp int64
+    var signature string
+    for _, part := range strings.Split(header, ",") {
+        key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+        if !found {
+            return 0, "", &SignatureError{Err: ErrMalformedSignature}
+        }
+        switch key {
+        case "t":
+            t, err := strconv.ParseInt(value, 10, 64)
+            if err != nil {
+                return 0, "", &SignatureError{Err: ErrMalformedSignature, Detail: "invalid timestamp"}
+            }
+            timestamp = t
+        case "v1":
+            signature = value
+        }
+    }
+    if timestamp == 0 || signature == "" {
+        return 0, "", &SignatureError{Err: ErrMalformedSignature}
+    }
+    return timestamp, signature, nil
+}
+
+// compareHMAC computes the HMAC of payload and compares it using hmac.Equal
+func compareHMAC(algorithm, secret string, payload []byte, signature string) error {
+    newHash, err := hashFunc(algorithm)
+    if err != nil {
+        return err
+    }
+
+    got, err := hex.DecodeString(signature)
+    if err != nil || len(got) == 0 {
+        return &SignatureError{Err: ErrMalformedSignature}
+    }
+
+    mac := hmac.New(newHash, []byte(secret))
+    mac.Write(payload)
+    if !hmac.Equal(got, mac.Sum(nil)) {
+        return &SignatureError{Err: ErrSignatureMismatch}
+    }
+    return nil
+}
+
+// hashFunc maps a configured algorithm name to its hash constructor
+func hashFunc(algorithm string) (func() hash.Hash, error) {
+    switch strings.ToLower(algorithm) {
+    case "sha256":
+        return sha256.New, nil
+    case "sha512":
+        return sha512.New, nil
+    case "sha1":
+        return sha1.New, nil
+    default:
+        return nil, &SignatureError{Err: ErrUnsupportedAlgorithm, Detail: algorithm}
+    }
+}
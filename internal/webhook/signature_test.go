@@ -0,0 +1,124 @@
+// signature_test.go covers HMAC verification of webhook signatures.
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "shared-secret"
+
+var testBody = []byte(`{"result_list":[{"device_id":"dev-1"}]}`)
+
+func sign(newHash func() hash.Hash, secret string, payload []byte) string {
+    mac := hmac.New(newHash, []byte(secret))
+    mac.Write(payload)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// timestamped returns a "t=<unix>,v1=<hex>" header signed at t
+func timestamped(secret string, t time.Time, body []byte) string {
+    ts := strconv.FormatInt(t.Unix(), 10)
+    return fmt.Sprintf("t=%s,v1=%s", ts, sign(sha256.New, secret, append([]byte(ts+"."), body...)))
+}
+
+func TestVerifyHMAC(t *testing.T) {
+    now := time.Now()
+    tests := []struct {
+        name    string
+        header  string
+        wantErr error
+    }{
+        {"bare hex", sign(sha256.New, testSecret, testBody), nil},
+        {"algorithm prefix", "sha256=" + sign(sha256.New, testSecret, testBody), nil},
+        {"timestamped", timestamped(testSecret, now, testBody), nil},
+        {"missing", "", ErrMissingSignature},
+        {"wrong secret", sign(sha256.New, "other", testBody), ErrSignatureMismatch},
+        {"tampered body", sign(sha256.New, testSecret, append([]byte(" "), testBody...)), ErrSignatureMismatch},
+        {"not hex", "sha256=zz", ErrMalformedSignature},
+        {"other algorithm", "sha1=" + sign(sha1.New, testSecret, testBody), ErrUnsupportedAlgorithm},
+        {"timestamp without signature", "t=123", ErrMalformedSignature},
+        {"replayed", timestamped(testSecret, now.Add(-DefaultTolerance-time.Minute), testBody), ErrSignatureExpired},
+        {"from the future", timestamped(testSecret, now.Add(DefaultTolerance+time.Minute), testBody), ErrSignatureExpired},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := VerifyHMAC(testSecret, testBody, tt.header)
+            if tt.wantErr == nil {
+                if err != nil {
+                    t.Fatalf("VerifyHMAC() = %v, want nil", err)
+                }
+                return
+            }
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("VerifyHMAC() = %v, want %v", err, tt.wantErr)
+            }
+            var sigErr *SignatureError
+            if !errors.As(err, &sigErr) {
+                t.Errorf("VerifyHMAC() = %T, want *SignatureError", err)
+            }
+        })
+    }
+}
+
+func TestVerifierTolerance(t *testing.T) {
+    signedAt := time.Unix(1700000000, 0)
+    header := timestamped(testSecret, signedAt, testBody)
+
+    tests := []struct {
+        name      string
+        tolerance time.Duration
+        now       time.Time
+        wantErr   bool
+    }{
+        {"within window", time.Minute, signedAt.Add(59 * time.Second), false},
+        {"replayed after window", time.Minute, signedAt.Add(2 * time.Minute), true},
+        {"check disabled", 0, signedAt.Add(24 * time.Hour), false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            v := Verifier{Tolerance: tt.tolerance, Now: func() time.Time { return tt.now }}
+            err := v.VerifyHMAC(testSecret, testBody, header)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("VerifyHMAC() = %v, wantErr %v", err, tt.wantErr)
+            }
+            if tt.wantErr && !errors.Is(err, ErrSignatureExpired) {
+                t.Errorf("VerifyHMAC() = %v, want ErrSignatureExpired", err)
+            }
+        })
+    }
+}
+
+func TestVerifierAlgorithm(t *testing.T) {
+    v := Verifier{Algorithm: "sha1"}
+    if err := v.VerifyHMAC(testSecret, testBody, "sha1="+sign(sha1.New, testSecret, testBody)); err != nil {
+        t.Errorf("sha1 signature rejected: %v", err)
+    }
+    if err := v.VerifyHMAC(testSecret, testBody, "sha256="+sign(sha256.New, testSecret, testBody)); !errors.Is(err, ErrUnsupportedAlgorithm) {
+        t.Errorf("sha256 signature against sha1 verifier = %v, want ErrUnsupportedAlgorithm", err)
+    }
+    if err := (Verifier{Algorithm: "md5"}).VerifyHMAC(testSecret, testBody, "deadbeef"); !errors.Is(err, ErrUnsupportedAlgorithm) {
+        t.Errorf("md5 verifier = %v, want ErrUnsupportedAlgorithm", err)
+    }
+}
+
+func TestSignatureErrorOmitsExpected(t *testing.T) {
+    expected := sign(sha256.New, testSecret, testBody)
+    err := VerifyHMAC(testSecret, testBody, sign(sha256.New, "other", testBody))
+    if err == nil {
+        t.Fatal("mismatch accepted")
+    }
+    if msg := err.Error(); strings.Contains(msg, expected) {
+        t.Errorf("error %q leaks the expected signature", msg)
+    }
+}
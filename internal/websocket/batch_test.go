@@ -0,0 +1,95 @@
+// batch_test.go covers coalescing bursts of updates within WS_BATCH_WINDOW_MS.
+
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// deviceAt is a one-vehicle update placing deviceID at lat
+func deviceAt(deviceID string, lat float64) []models.Vehicle {
+    return []models.Vehicle{{
+        DeviceID:     deviceID,
+        LastLocation: &models.Location{Latitude: lat, Longitude: -122.25, HasFix: true},
+    }}
+}
+
+// runHub runs h's broadcast loop until the test ends
+func runHub(t *testing.T, h *Hub) {
+    stopped := make(chan struct{})
+    go func() {
+        h.Run()
+        close(stopped)
+    }()
+    t.Cleanup(func() {
+        close(h.Broadcast)
+        <-stopped
+    })
+}
+
+// waitQuiet waits until conn has received want messages and nothing more arrives
+func waitQuiet(t *testing.T, conn *fakeConn, want int) {
+    t.Helper()
+    deadline := time.Now().Add(2 * time.Second)
+    for conn.received() < want && time.Now().Before(deadline) {
+        time.Sleep(5 * time.Millisecond)
+    }
+    time.Sleep(150 * time.Millisecond)
+    if n := conn.received(); n != want {
+        t.Fatalf("received %d broadcasts, want %d", n, want)
+    }
+}
+
+// sentLats maps each device in the last broadcast to its latitude
+func sentLats(t *testing.T, conn *fakeConn) map[string]float64 {
+    t.Helper()
+    lats := make(map[string]float64)
+    for _, v := range sentVehicles(t, conn.last()) {
+        lats[v.DeviceID] = v.LastLocation.Latitude
+    }
+    return lats
+}
+
+func TestBatchWindowCoalescesBurst(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{BatchWindowMs: 100})
+    conn := &fakeConn{}
+    connect(h, conn)
+    runHub(t, h)
+
+    // A burst well inside one window, dev1 updated twice
+    h.Broadcast <- deviceAt("dev1", 1)
+    h.Broadcast <- deviceAt("dev2", 1)
+    h.Broadcast <- deviceAt("dev1", 2)
+    h.Broadcast <- deviceAt("dev3", 1)
+
+    waitQuiet(t, conn, 1)
+    got := sentLats(t, conn)
+    if len(got) != 3 || got["dev1"] != 2 || got["dev2"] != 1 || got["dev3"] != 1 {
+        t.Errorf("coalesced broadcast = %v, want dev1 at 2 plus dev2 and dev3", got)
+    }
+
+    // The next burst starts a new window
+    h.Broadcast <- deviceAt("dev2", 5)
+    h.Broadcast <- deviceAt("dev2", 6)
+    waitQuiet(t, conn, 2)
+    if got := sentLats(t, conn); got["dev2"] != 6 {
+        t.Errorf("second broadcast = %v, want dev2 at 6", got)
+    }
+}
+
+func TestBatchWindowDisabled(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+    conn := &fakeConn{}
+    connect(h, conn)
+    runHub(t, h)
+
+    // Without a window each snapshot goes out as it arrives
+    for _, lat := range []float64{1, 2, 3} {
+        h.Broadcast <- deviceAt("dev1", lat)
+        waitQuiet(t, conn, int(lat))
+    }
+}
@@ -0,0 +1,296 @@
+// client.go wraps individual WebSocket connections and handles
+// messages sent from the frontend (latency pings, device subscriptions).
+
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+// clientConn is the connection a client is written to: a *websocket.Conn,
+// or an sseConn for clients streaming over Server-Sent Events (see sse.go)
+type clientConn interface {
+    SetWriteDeadline(t time.Time) error
+    WriteMessage(messageType int, data []byte) error
+    WriteControl(messageType int, data []byte, deadline time.Time) error
+    Close() error
+}
+
+// client is a single connected frontend.
+// Gorilla connections support one concurrent writer, so all writes go through mu.
+type client struct {
+    id          string          // Random id, safe to expose in debug output
+    clientID    string          // Frontend client id from ?client_id=, empty if not sent
+    byPreference bool           // Streams in preference order without hidden devices, see preferences.go
+    connectedAt time.Time
+    conn        clientConn
+    encoder     Encoder         // Wire encoding negotiated at connect time
+    writeWait   time.Duration   // Deadline for each write
+    mu          sync.Mutex      // Serializes writes from broadcasts and pong replies
+    subMu       sync.RWMutex    // Guards subscriptions, set from the read loop and read by broadcasts
+    subscriptions map[string]bool // Subscribed device ids, nil receives every device
+    fields      []string        // Projected vehicle fields from "subscribe", nil sends full vehicles
+    queue       chan []byte     // Buffered broadcasts when WS_SEND_BUFFER > 0, see send_buffer.go
+    done        chan struct{}   // Closed on disconnect to stop the writer goroutine
+    dropped     atomic.Uint64   // Broadcasts dropped because queue was full
+    closing     atomic.Bool     // Set once when overflow disconnects the client
+}
+
+// clientMessage is a message sent by the frontend over the socket
+type clientMessage struct {
+    Action    string      `json:"action"`
+    T         interface{} `json:"t,omitempty"`          // Client timestamp, echoed back as received
+    DeviceIDs []string    `json:"device_ids,omitempty"` // For "subscribe"
+    Fields    string      `json:"fields,omitempty"`     // For "subscribe", e.g. "device_id,lat,lng"
+}
+
+// subscribedMessage confirms the devices a client now receives, ["*"] for all
+type subscribedMessage struct {
+    Type      string   `json:"type"`
+    DeviceIDs []string `json:"device_ids"`
+    Fields    []string `json:"fields,omitempty"` // Projected fields, omitted for full vehicles
+}
+
+// errorMessage reports a rejected client message
+type errorMessage struct {
+    Type    string `json:"type"`
+    Action  string `json:"action"`
+    Message string `json:"message"`
+}
+
+// pongMessage answers a client ping so it can compute RTT and clock offset
+type pongMessage struct {
+    Type       string      `json:"type"`
+    T          interface{} `json:"t,omitempty"`
+    ServerTime int64       `json:"server_time"` // Unix milliseconds when the pong was sent
+}
+
+// vehiclesMessage is a vehicle broadcast, including the initial snapshot.
+// sent_at lets clients measure end-to-end latency, alongside ping/pong.
+type vehiclesMessage struct {
+    Type     string      `json:"type"`     // Always "vehicles"
+    SentAt   int64       `json:"sent_at"`  // Unix milliseconds when the broadcast was sent
+    Vehicles interface{} `json:"vehicles"` // Vehicles, or projected vehicles for subscribed fields
+}
+
+// newVehiclesMessage wraps vehicles in a broadcast sent at sentAt
+func newVehiclesMessage(vehicles interface{}, sentAt time.Time) vehiclesMessage {
+    return vehiclesMessage{Type: "vehicles", SentAt: sentAt.UnixMilli(), Vehicles: vehicles}
+}
+
+// newClient wraps a connection using the given encoding
+func newClient(conn clientConn, encoder Encoder, writeWait time.Duration) *client {
+    return &client{
+        id:          newClientID(),
+        connectedAt: time.Now(),
+        conn:        conn,
+        encoder:     encoder,
+        writeWait:   writeWait,
+    }
+}
+
+// newClientID returns a short random id that doesn't reveal the client's address
+func newClientID() string {
+    b := make([]byte, 6)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// send encodes and writes a message, safe for concurrent use
+func (c *client) send(v interface{}) error {
+    data, err := c.encoder.Encode(v)
+    if err != nil {
+        return err
+    }
+    return c.write(data)
+}
+
+// write sends an already-encoded message, safe for concurrent use
+func (c *client) write(data []byte) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
+    return c.conn.WriteMessage(c.encoder.MessageType(), data)
+}
+
+// closeWith sends a close frame with the given code and reason, then closes
+// the connection, which ends the client's read loop and its cleanup
+func (c *client) closeWith(code int, reason string) {
+    c.mu.Lock()
+    c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(c.writeWait))
+    c.mu.Unlock()
+    c.conn.Close()
+}
+
+// clientIDContextKey carries a client id resolved before the hub, see WithClientID
+type clientIDContextKey struct{}
+
+// WithClientID returns ctx carrying the client id a stream belongs to, set by
+// the api package from the tenant subdomain. It wins over X-Client-ID and
+// ?client_id= so a tenant can't stream another client's preferences.
+func WithClientID(ctx context.Context, clientID string) context.Context {
+    return context.WithValue(ctx, clientIDContextKey{}, clientID)
+}
+
+// sessionClientID returns the frontend client id a connection belongs to,
+// in the same order as the REST API: the id from WithClientID, then
+// X-Client-ID, then ?client_id=. Empty if none is set.
+func sessionClientID(r *http.Request) string {
+    if id, ok := r.Context().Value(clientIDContextKey{}).(string); ok && id != "" {
+        return id
+    }
+    if id := strings.TrimSpace(r.Header.Get("X-Client-ID")); id != "" {
+        return id
+    }
+    return strings.TrimSpace(r.URL.Query().Get("client_id"))
+}
+
+// preferenceOwner returns the client id whose preferences apply, "default"
+// for connections that didn't send one
+func (c *client) preferenceOwner() string {
+    if c.clientID == "" {
+        return defaultClientID
+    }
+    return c.clientID
+}
+
+// pingLoop pings the client every interval until stop is closed.
+// A failed ping closes the connection, which ends the read loop.
+func (c *client) pingLoop(interval time.Duration, stop <-chan struct{}) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+            c.mu.Lock()
+            err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.writeWait))
+            c.mu.Unlock()
+            if err != nil {
+                c.conn.Close()
+                return
+            }
+        case <-stop:
+            return
+        }
+    }
+}
+
+// handleMessage processes a single message received from the frontend.
+// Client messages are always JSON regardless of the outgoing encoding.
+// Unknown or malformed messages are ignored to keep old clients working.
+func (c *client) handleMessage(data []byte) error {
+    var msg clientMessage
+    if err := json.Unmarshal(data, &msg); err != nil {
+        return nil
+    }
+
+    switch msg.Action {
+    case "ping":
+        return c.send(pongMessage{
+            Type:       "pong",
+            T:          msg.T,
+            ServerTime: time.Now().UnixMilli(),
+        })
+    case "subscribe":
+        var fields []string
+        if msg.Fields != "" {
+            var err error
+            if fields, err = models.ParseVehicleFields(msg.Fields); err != nil {
+                return c.send(errorMessage{Type: "error", Action: msg.Action, Message: err.Error()})
+            }
+        }
+        c.subscribe(msg.DeviceIDs, fields)
+        return c.send(subscribedMessage{Type: "subscribed", DeviceIDs: c.subscriptionList(), Fields: fields})
+    case "unsubscribe":
+        c.subscribe(nil, nil)
+        return c.send(subscribedMessage{Type: "subscribed", DeviceIDs: c.subscriptionList()})
+    }
+    return nil
+}
+
+// subscribe limits broadcasts to the given devices, an empty list restores all,
+// and projects them to fields when set.
+// Clients that never subscribe receive every device, so nothing waits on this.
+func (c *client) subscribe(deviceIDs []string, fields []string) {
+    var subs map[string]bool
+    if len(deviceIDs) > 0 {
+        subs = make(map[string]bool, len(deviceIDs))
+        for _, id := range deviceIDs {
+            subs[id] = true
+        }
+    }
+    c.subMu.Lock()
+    c.subscriptions = subs
+    c.fields = fields
+    c.subMu.Unlock()
+}
+
+// subscriptionList returns the subscribed device ids sorted, ["*"] for all
+func (c *client) subscriptionList() []string {
+    c.subMu.RLock()
+    defer c.subMu.RUnlock()
+    if c.subscriptions == nil {
+        return []string{"*"}
+    }
+    ids := make([]string, 0, len(c.subscriptions))
+    for id := range c.subscriptions {
+        ids = append(ids, id)
+    }
+    sort.Strings(ids)
+    return ids
+}
+
+// subscribedTo reports whether the client receives deviceID, and whether
+// that's because it receives every device
+func (c *client) subscribedTo(deviceID string) (subscribed, everything bool) {
+    c.subMu.RLock()
+    defer c.subMu.RUnlock()
+    if c.subscriptions == nil {
+        return true, true
+    }
+    return c.subscriptions[deviceID], false
+}
+
+// payload returns what to broadcast to this client for vehicles: the
+// subscribed devices, projected to the subscribed fields.
+// ok is false when the client takes the full snapshot, which can be shared.
+func (c *client) payload(vehicles []models.Vehicle) (payload interface{}, ok bool) {
+    filtered, subscribed := c.filter(vehicles)
+    c.subMu.RLock()
+    fields := c.fields
+    c.subMu.RUnlock()
+    if fields != nil {
+        return models.ProjectVehicles(filtered, fields), true
+    }
+    return filtered, subscribed
+}
+
+// filter returns the vehicles this client is subscribed to.
+// ok is false when the client receives everything and vehicles can be shared.
+func (c *client) filter(vehicles []models.Vehicle) (filtered []models.Vehicle, ok bool) {
+    c.subMu.RLock()
+    defer c.subMu.RUnlock()
+    if c.subscriptions == nil {
+        return vehicles, false
+    }
+    filtered = make([]models.Vehicle, 0, len(c.subscriptions))
+    for _, v := range vehicles {
+        if c.subscriptions[v.DeviceID] {
+            filtered = append(filtered, v)
+        }
+    }
+    return filtered, true
+}
@@ -0,0 +1,40 @@
+// close.go defines the close frames the hub sends when it turns clients
+// away, so HomeView.vue can tell a shutdown from a full server and back off.
+
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Application close codes (4000-4999 are reserved for applications)
+const (
+    CloseServerShutdown = 4000 // Server is restarting, reconnect after retry_after
+    CloseServerFull     = 4001 // Hub at WS_MAX_CLIENTS, reconnect after retry_after
+    CloseClientTooSlow  = 4002 // Send buffer overflowed with WS_SEND_OVERFLOW=disconnect
+)
+
+// Suggested reconnect delays sent with each close code
+const (
+    shutdownRetryAfter = 5 * time.Second  // A new instance is usually up by then
+    capacityRetryAfter = 15 * time.Second // Give existing clients time to disconnect
+    slowRetryAfter     = 1 * time.Second  // Reconnecting starts over with a fresh snapshot
+)
+
+// shutdownDrainTimeout bounds how long Shutdown waits for writers to flush
+// their queues before closing connections without a close frame
+const shutdownDrainTimeout = 3 * time.Second
+
+// closeReason is the JSON close frame reason, e.g.
+// {"reason":"server_shutdown","retry_after":5}
+type closeReason struct {
+    Reason     string `json:"reason"`
+    RetryAfter int    `json:"retry_after"` // Seconds
+}
+
+// closeReasonText encodes a close reason, well under the 123-byte frame limit
+func closeReasonText(reason string, retryAfter time.Duration) string {
+    data, _ := json.Marshal(closeReason{Reason: reason, RetryAfter: int(retryAfter / time.Second)})
+    return string(data)
+}
@@ -0,0 +1,84 @@
+// close_test.go covers the close codes and retry hints sent to clients the
+// hub turns away.
+
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/gorilla/websocket"
+)
+
+// expectClose checks conn is closed with code and a JSON reason
+func expectClose(t *testing.T, conn *websocket.Conn, code int, reason string, retryAfter int) {
+    t.Helper()
+    closeErr := closeCode(t, conn, 2*time.Second)
+    if closeErr == nil {
+        t.Fatalf("connection still open, want close code %d", code)
+    }
+    if closeErr.Code != code {
+        t.Errorf("close code = %d, want %d", closeErr.Code, code)
+    }
+    var got closeReason
+    if err := json.Unmarshal([]byte(closeErr.Text), &got); err != nil {
+        t.Fatalf("close reason %q: %v", closeErr.Text, err)
+    }
+    if got.Reason != reason || got.RetryAfter != retryAfter {
+        t.Errorf("close reason = %+v, want %s retrying after %ds", got, reason, retryAfter)
+    }
+}
+
+func TestShutdownCloseReason(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{PingInterval: 30, PongWait: 60, WriteWait: 1})
+    srv := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+    defer srv.Close()
+
+    connected := dialSession(t, h, srv, "alice", 1)
+    h.Shutdown(context.Background())
+    expectClose(t, connected, CloseServerShutdown, "server_shutdown", 5)
+
+    // Connections arriving during shutdown are turned away the same way
+    late, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer late.Close()
+    expectClose(t, late, CloseServerShutdown, "server_shutdown", 5)
+}
+
+func TestCapacityCloseReason(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{MaxClients: 1, PingInterval: 30, PongWait: 60, WriteWait: 1})
+    srv := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+    defer srv.Close()
+
+    admitted := dialSession(t, h, srv, "alice", 1)
+    rejected, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer rejected.Close()
+
+    // Capacity asks for a longer back-off than a restart
+    expectClose(t, rejected, CloseServerFull, "server_full", 15)
+    if closeErr := closeCode(t, admitted, 200*time.Millisecond); closeErr != nil {
+        t.Errorf("admitted connection closed with %v", closeErr)
+    }
+}
+
+func TestCloseReasonText(t *testing.T) {
+    got := closeReasonText("server_shutdown", shutdownRetryAfter)
+    if got != `{"reason":"server_shutdown","retry_after":5}` {
+        t.Errorf("closeReasonText = %s", got)
+    }
+    // Close frame payloads are limited to 125 bytes, 2 of them for the code
+    if len(got) > 123 {
+        t.Errorf("reason is %d bytes, too long for a close frame", len(got))
+    }
+}
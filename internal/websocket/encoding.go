@@ -0,0 +1,65 @@
+// encoding.go provides the wire encodings available to WebSocket clients.
+// Clients choose one when connecting with ?encoding=json|msgpack.
+
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encoder serializes outgoing messages for a WebSocket client
+type Encoder interface {
+    Name() string                         // Value used in ?encoding=
+    MessageType() int                     // websocket.TextMessage or websocket.BinaryMessage
+    Encode(v interface{}) ([]byte, error) // Serialize a message
+}
+
+// jsonEncoder is the default encoding, matching what the frontend has always received
+type jsonEncoder struct{}
+
+func (jsonEncoder) Name() string     { return "json" }
+func (jsonEncoder) MessageType() int { return websocket.TextMessage }
+
+func (jsonEncoder) Encode(v interface{}) ([]byte, error) {
+    return json.Marshal(v)
+}
+
+// msgpackEncoder produces compact binary frames for high-frequency fleets.
+// Struct fields use their json tag names so both encodings share one schema.
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) Name() string     { return "msgpack" }
+func (msgpackEncoder) MessageType() int { return websocket.BinaryMessage }
+
+func (msgpackEncoder) Encode(v interface{}) ([]byte, error) {
+    var buf bytes.Buffer
+    enc := msgpack.NewEncoder(&buf)
+    enc.SetCustomStructTag("json")
+    if err := enc.Encode(v); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+// encoders lists the supported encodings by name
+var encoders = map[string]Encoder{
+    "json":    jsonEncoder{},
+    "msgpack": msgpackEncoder{},
+}
+
+// encoderFor resolves the ?encoding= value, defaulting to JSON when empty
+func encoderFor(name string) (Encoder, error) {
+    if name == "" {
+        return jsonEncoder{}, nil
+    }
+    enc, ok := encoders[name]
+    if !ok {
+        return nil, fmt.Errorf("unsupported encoding %q", name)
+    }
+    return enc, nil
+}
@@ -0,0 +1,168 @@
+// encoding_test.go covers the JSON and MessagePack WebSocket encodings.
+
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// encodedVehicles has every kind of field a broadcast carries: nested
+// structs, nil and set pointers, times and a vehicle without a position
+func encodedVehicles() []models.Vehicle {
+    altitude, fuel, engineOn := 1609.3, 72.5, true
+    computed, heading := 48.2, 270
+    seconds := int64(900)
+    seen := time.Date(2026, 3, 1, 14, 30, 0, 0, time.UTC)
+    return []models.Vehicle{
+        {
+            DeviceID:    "dev-1",
+            DisplayName: "Truck 1",
+            ActiveState: "active",
+            Online:      true,
+            LastLocation: &models.Location{
+                Timestamp: seen,
+                Latitude:  39.7392,
+                Longitude: -104.9903,
+                Altitude:  &altitude,
+                Heading:   90,
+                Speed:     52.1,
+                Detail: models.LocationDetail{
+                    Speed:       models.Measurement{Value: 52.1, Unit: "km/h", Display: "52 km/h"},
+                    FuelPercent: &fuel,
+                    EngineOn:    &engineOn,
+                },
+                HasFix:           true,
+                ComputedSpeedKmh: &computed,
+                ComputedHeading:  &heading,
+            },
+            DriveState: models.DriveState{
+                Status:          "driving",
+                Distance:        models.Measurement{Value: 3.2, Unit: "km", Display: "3.2 km"},
+                BeginTime:       seen.Add(-15 * time.Minute),
+                Duration:        &models.Measurement{Value: 15, Unit: "min", Display: "15 min"},
+                DurationSeconds: &seconds,
+            },
+            CurrentStateSeconds: &seconds,
+        },
+        {DeviceID: "dev-2", DisplayName: "Parked van", DriveState: models.DriveState{Status: "off"}},
+    }
+}
+
+// decodeMsgpack mirrors msgpackEncoder, using json tags for field names
+func decodeMsgpack(data []byte, v interface{}) error {
+    dec := msgpack.NewDecoder(bytes.NewReader(data))
+    dec.SetCustomStructTag("json")
+    return dec.Decode(v)
+}
+
+// normalizeTimes puts decoded times in UTC, msgpack decodes them as local time
+func normalizeTimes(vehicles []models.Vehicle) {
+    for i := range vehicles {
+        vehicles[i].DriveState.BeginTime = vehicles[i].DriveState.BeginTime.UTC()
+        if loc := vehicles[i].LastLocation; loc != nil {
+            loc.Timestamp = loc.Timestamp.UTC()
+        }
+    }
+}
+
+func TestEncodersRoundTripVehicles(t *testing.T) {
+    tests := []struct {
+        encoder     Encoder
+        messageType int
+        decode      func([]byte, interface{}) error
+    }{
+        {jsonEncoder{}, websocket.TextMessage, json.Unmarshal},
+        {msgpackEncoder{}, websocket.BinaryMessage, decodeMsgpack},
+    }
+    for _, tt := range tests {
+        t.Run(tt.encoder.Name(), func(t *testing.T) {
+            if got := tt.encoder.MessageType(); got != tt.messageType {
+                t.Errorf("MessageType() = %d, want %d", got, tt.messageType)
+            }
+
+            want := encodedVehicles()
+            data, err := tt.encoder.Encode(want)
+            if err != nil {
+                t.Fatalf("Encode: %v", err)
+            }
+            var got []models.Vehicle
+            if err := tt.decode(data, &got); err != nil {
+                t.Fatalf("decode: %v", err)
+            }
+            normalizeTimes(got)
+            if !reflect.DeepEqual(got, want) {
+                t.Errorf("round trip changed the vehicles:\n got %+v\nwant %+v", got, want)
+            }
+        })
+    }
+}
+
+func TestEncodersShareFieldNames(t *testing.T) {
+    // Frontends decode both encodings with the same field names
+    message := newVehiclesMessage(encodedVehicles(), time.UnixMilli(1767225600000))
+
+    jsonData, err := jsonEncoder{}.Encode(message)
+    if err != nil {
+        t.Fatal(err)
+    }
+    msgpackData, err := msgpackEncoder{}.Encode(message)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(msgpackData) >= len(jsonData) {
+        t.Errorf("msgpack is %d bytes, json %d, want msgpack smaller", len(msgpackData), len(jsonData))
+    }
+
+    var fromJSON, fromMsgpack map[string]interface{}
+    if err := json.Unmarshal(jsonData, &fromJSON); err != nil {
+        t.Fatal(err)
+    }
+    if err := decodeMsgpack(msgpackData, &fromMsgpack); err != nil {
+        t.Fatal(err)
+    }
+    for _, key := range []string{"type", "sent_at", "vehicles"} {
+        if _, ok := fromMsgpack[key]; !ok {
+            t.Errorf("msgpack message missing %q", key)
+        }
+    }
+    jsonVehicle := fromJSON["vehicles"].([]interface{})[0].(map[string]interface{})
+    msgpackVehicle := fromMsgpack["vehicles"].([]interface{})[0].(map[string]interface{})
+    for key := range jsonVehicle {
+        if _, ok := msgpackVehicle[key]; !ok {
+            t.Errorf("msgpack vehicle missing %q", key)
+        }
+    }
+}
+
+func TestEncoderFor(t *testing.T) {
+    tests := []struct {
+        name    string
+        want    string
+        wantErr bool
+    }{
+        {"", "json", false},
+        {"json", "json", false},
+        {"msgpack", "msgpack", false},
+        {"protobuf", "", true},
+        {"JSON", "", true},
+    }
+    for _, tt := range tests {
+        enc, err := encoderFor(tt.name)
+        if (err != nil) != tt.wantErr {
+            t.Errorf("encoderFor(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+            continue
+        }
+        if err == nil && enc.Name() != tt.want {
+            t.Errorf("encoderFor(%q) = %s, want %s", tt.name, enc.Name(), tt.want)
+        }
+    }
+}
@@ -0,0 +1,65 @@
+// fanout.go spreads broadcast writes over a bounded pool of workers so one
+// slow client doesn't delay delivery to everyone after it.
+
+package websocket
+
+import (
+	"log"
+	"sync"
+)
+
+// clientWrite is one encoded message destined for one client
+type clientWrite struct {
+    client *client
+    data   []byte
+}
+
+// writeAll sends every write using up to h.writeWorkers goroutines and
+// returns the clients whose write failed. Each client appears at most once
+// per broadcast and client.write serializes on the client's own lock, so
+// workers never touch h.clients; the caller prunes failed clients.
+func (h *Hub) writeAll(writes []clientWrite) []*client {
+    workers := h.writeWorkers
+    if workers > len(writes) {
+        workers = len(writes)
+    }
+
+    // Small fanouts aren't worth the goroutines
+    if workers <= 1 {
+        var failed []*client
+        for _, wr := range writes {
+            if err := wr.client.write(wr.data); err != nil {
+                log.Printf("WebSocket Write Error: %v", err)
+                failed = append(failed, wr.client)
+            }
+        }
+        return failed
+    }
+
+    jobs := make(chan clientWrite)
+    var (
+        wg     sync.WaitGroup
+        mu     sync.Mutex
+        failed []*client
+    )
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for wr := range jobs {
+                if err := wr.client.write(wr.data); err != nil {
+                    log.Printf("WebSocket Write Error: %v", err)
+                    mu.Lock()
+                    failed = append(failed, wr.client)
+                    mu.Unlock()
+                }
+            }
+        }()
+    }
+    for _, wr := range writes {
+        jobs <- wr
+    }
+    close(jobs)
+    wg.Wait()
+    return failed
+}
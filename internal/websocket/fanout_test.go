@@ -0,0 +1,71 @@
+// fanout_test.go covers delivering a broadcast through the write worker pool.
+
+package websocket
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+)
+
+func TestBroadcastFanout(t *testing.T) {
+    for _, workers := range []int{0, 1, 4, 32} {
+        t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+            h := newTestHub(t, config.WebSocketConfig{WriteWorkers: workers})
+            var healthy, dead []*fakeConn
+            for i := 0; i < 20; i++ {
+                conn := &fakeConn{}
+                healthy = append(healthy, conn)
+                connect(h, conn)
+            }
+            deadClients := make(map[*client]bool)
+            for i := 0; i < 5; i++ {
+                conn := &fakeConn{fail: true}
+                dead = append(dead, conn)
+                deadClients[connect(h, conn)] = true
+            }
+
+            h.broadcast(snapshot(37.5))
+
+            for i, conn := range healthy {
+                if n := conn.received(); n != 1 {
+                    t.Errorf("healthy client %d received %d messages, want 1", i, n)
+                }
+            }
+            for i, conn := range dead {
+                if !conn.closed {
+                    t.Errorf("dead client %d was not closed", i)
+                }
+            }
+            h.mu.Lock()
+            defer h.mu.Unlock()
+            if len(h.clients) != len(healthy) {
+                t.Errorf("%d clients left, want %d", len(h.clients), len(healthy))
+            }
+            for c := range h.clients {
+                if deadClients[c] {
+                    t.Error("dead client still registered")
+                }
+            }
+        })
+    }
+}
+
+// BenchmarkBroadcastFanout broadcasts to 200 clients whose writes each take
+// 50µs, like a fleet of dashboards on real network connections
+func BenchmarkBroadcastFanout(b *testing.B) {
+    for _, workers := range []int{1, 8, 32} {
+        b.Run(fmt.Sprintf("%d workers", workers), func(b *testing.B) {
+            h := newTestHub(b, config.WebSocketConfig{WriteWorkers: workers})
+            for i := 0; i < 200; i++ {
+                connect(h, &fakeConn{delay: 50 * time.Microsecond})
+            }
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                h.broadcast(snapshot(float64(i))) // Each one differs so none is skipped
+            }
+        })
+    }
+}
@@ -4,41 +4,133 @@
 package websocket
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
 	"log"
 	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
 	"github.com/davidwiese/fleet-tracker-backend/internal/models"
 	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
 	"github.com/gorilla/websocket"
 )
 
+// initialSnapshotMaxAge is how old a cached device list may be when sent to a
+// newly connected client, one poll interval
+const initialSnapshotMaxAge = 5 * time.Second
+
 // Hub coordinates WebSocket connections and vehicle data broadcasting.
 // It maintains connected clients and handles real-time updates from OneStepGPS.
 type Hub struct {
-    clients map[*websocket.Conn]bool    // Track active WebSocket connections
+    clients map[*client]bool            // Track active WebSocket connections
+    mu sync.Mutex                       // Guards clients, accessed from Run and connection goroutines
     Broadcast chan []models.Vehicle     // Channel for sending vehicle updates to all clients, like a thread-safe message queue
     upgrader websocket.Upgrader         // WebSocket connection upgrader
     gpsClient *onestepgps.Client        // Client for fetching updates
-    updateInterval time.Duration        // How often to poll OneStepGPS
+    updateInterval time.Duration        // How often to poll OneStepGPS, polling disabled when <= 0
+    latest []models.Vehicle             // Last broadcast snapshot, used to merge pushed updates
+    pingInterval time.Duration          // How often to ping each client
+    pongWait time.Duration              // Read deadline, extended on every pong or message
+    writeWait time.Duration             // Deadline for a single write
+    maxMessageSize int64                // Read limit for client messages
+    maxClients int                      // Connection cap, 0 for unlimited
+    reserved   int                      // Slots taken by connections not registered yet, guarded by mu
+    admitGrace time.Duration            // How long a connection waits for a slot when full, see reserveSlot
+    sendBuffer int                      // Per-client queued broadcasts, 0 writes through the worker pool
+    sendOverflow string                 // What a full per-client queue does, see send_buffer.go
+    droppedTotal atomic.Uint64          // Broadcasts dropped across all clients, see send_buffer.go
+    shuttingDown atomic.Bool            // Set by Shutdown, new connections are closed at once
+    lastPoll time.Time                  // Last successful OneStepGPS poll, guarded by mu
+    lastBroadcast time.Time             // When the last snapshot was sent, guarded by mu
+    lastHash uint64                     // Hash of the last broadcast snapshot, only used by Run
+    lastPositions map[string]models.Location // Previous fix per device for derived motion, guarded by mu
+    batchWindow time.Duration           // Coalesce snapshots arriving within this window, 0 broadcasts each
+    sink *snapshotSink                  // Optional NDJSON snapshot export, nil when disabled
+    writeWorkers int                    // Concurrent client writes per broadcast
+    singleSession bool                  // Close a client's older connection when it reconnects
+    writerCtx context.Context           // Cancelled by Shutdown, client writers drain their queues and exit
+    stopWriters context.CancelFunc      // Cancels writerCtx
+    writers sync.WaitGroup              // Running client writer goroutines, see send_buffer.go
+    heartbeat chan chan struct{}        // Liveness checks answered by Run, see Alive
+    preferences PreferenceSource        // Saved preferences for ?sort=preference, nil streams upstream order
+    preferenceDefaults models.PreferenceDefaults // Visibility and order of devices without a preference
+}
+
+// HubState is a point-in-time view of the hub for debugging
+type HubState struct {
+    ClientCount       int           `json:"client_count"`
+    Clients           []ClientState `json:"clients"`
+    LastPollTime      time.Time     `json:"last_poll_time"`
+    LastBroadcastTime time.Time     `json:"last_broadcast_time"`
+    LastSnapshotSize  int           `json:"last_snapshot_size"`
+    PollingEnabled    bool          `json:"polling_enabled"`
+    PollingPaused     bool          `json:"polling_paused"`
+    DroppedMessages   uint64        `json:"dropped_messages"` // Total since start, only with WS_SEND_BUFFER
+}
+
+// ClientState describes one connected client without identifying it
+type ClientState struct {
+    ID            string    `json:"id"`            // Anonymized, stable for the life of the connection
+    Encoding      string    `json:"encoding"`
+    ConnectedAt   time.Time `json:"connected_at"`
+    Subscriptions []string  `json:"subscriptions"` // Device ids, or ["*"] for all devices
+    Dropped       uint64    `json:"dropped"`       // Broadcasts dropped for this client
 }
 
 // NewHub creates a new WebSocket hub with specified update frequency.
+// Buffer sizes, timeouts and limits come from the WebSocket config.
+// Returns an error if the snapshot directory can't be created or the
+// send overflow policy is unknown.
+// An updateInterval <= 0 disables polling, e.g. when updates arrive via webhook.
 // Called in main.go during server initialization.
-func NewHub(gpsClient *onestepgps.Client, updateInterval time.Duration) *Hub {
+func NewHub(gpsClient *onestepgps.Client, updateInterval time.Duration, cfg config.WebSocketConfig) (*Hub, error) {
+    sink, err := newSnapshotSink(cfg.SnapshotDir)
+    if err != nil {
+        return nil, err
+    }
+    sendOverflow, err := validateOverflowPolicy(cfg.SendOverflow)
+    if err != nil {
+        return nil, err
+    }
+    broadcastBuffer := cfg.BroadcastBuffer
+    if broadcastBuffer < 1 {
+        broadcastBuffer = 1
+    }
+    writerCtx, stopWriters := context.WithCancel(context.Background())
     return &Hub{
-        clients:   make(map[*websocket.Conn]bool),
-        Broadcast: make(chan []models.Vehicle),
+        clients:   make(map[*client]bool),
+        Broadcast: make(chan []models.Vehicle, broadcastBuffer), // Pending snapshots, see publish
         upgrader: websocket.Upgrader{
-            ReadBufferSize:  1024,
-            WriteBufferSize: 1024,
+            ReadBufferSize:  cfg.ReadBufferSize,
+            WriteBufferSize: cfg.WriteBufferSize,
             CheckOrigin: func(r *http.Request) bool {
                 return true // Allow all origins (development)
             },
         },
         gpsClient:      gpsClient,
         updateInterval: updateInterval,
-    }
+        pingInterval:   time.Duration(cfg.PingInterval) * time.Second,
+        pongWait:       time.Duration(cfg.PongWait) * time.Second,
+        writeWait:      time.Duration(cfg.WriteWait) * time.Second,
+        maxMessageSize: cfg.MaxMessageSize,
+        maxClients:     cfg.MaxClients,
+        admitGrace:     time.Duration(cfg.AdmitGraceMs) * time.Millisecond,
+        sendBuffer:     cfg.SendBuffer,
+        sendOverflow:   sendOverflow,
+        batchWindow:    time.Duration(cfg.BatchWindowMs) * time.Millisecond,
+        sink:           sink,
+        writeWorkers:   cfg.WriteWorkers,
+        writerCtx:      writerCtx,
+        stopWriters:    stopWriters,
+        heartbeat:      make(chan chan struct{}),
+        singleSession:  cfg.SingleSession,
+    }, nil
 }
 
 // Run starts the hub's main operations:
@@ -47,22 +139,149 @@ func NewHub(gpsClient *onestepgps.Client, updateInterval time.Duration) *Hub {
 // Started as a goroutine in main.go
 func (h *Hub) Run() {
     // Start polling in separate goroutine
-    go h.pollUpdates()
+    if h.updateInterval > 0 {
+        go h.pollUpdates()
+    }
+
+    // Broadcasting updates to all clients, answering liveness heartbeats in between
+    for {
+        select {
+        case vehicles, ok := <-h.Broadcast: // Listens to channel
+            if !ok {
+                return
+            }
+            h.broadcast(vehicles)
+        case reply := <-h.heartbeat:
+            // Taking mu also catches a deadlock elsewhere in the hub
+            h.mu.Lock()
+            h.mu.Unlock()
+            close(reply)
+        }
+    }
+}
+
+// broadcast sends one snapshot to every connected client, called from Run
+func (h *Hub) broadcast(vehicles []models.Vehicle) {
+    // Bursts within the batching window go out as a single broadcast
+    if h.batchWindow > 0 {
+        vehicles = h.coalesce(vehicles)
+    }
+
+    // Read preferences before locking so a slow database doesn't hold up the hub
+    prefs := h.loadPreferences(h.preferenceClientIDs())
+
+    // Idle fleets often poll the exact same snapshot, clients already have it.
+    // A changed preference still goes out, sort=preference clients see it.
+    hash, ok := snapshotHash(vehicles)
+    if ok && prefs != nil {
+        hash ^= preferencesHash(prefs)
+    }
+    if ok && hash == h.lastHash {
+        return
+    }
+    h.lastHash = hash
+
+    // Send updates to all connected clients
+    // Each encoding is serialized once and shared by its clients
+    payloads := make(map[string][]byte)
+    h.mu.Lock()
+    h.deriveMotion(vehicles) // Fill in speed/heading for devices that don't report them
+    h.latest = vehicles
+    h.lastBroadcast = time.Now()
+    sentAt := h.lastBroadcast
+    writes := make([]clientWrite, 0, len(h.clients))
+    for c := range h.clients {
+        // Subscribed or preference-ordered clients get their own payload
+        own, arranged := h.arrange(c, vehicles, prefs)
+        if payload, ok := c.payload(own); ok || arranged {
+            data, err := c.encoder.Encode(newVehiclesMessage(payload, sentAt))
+            if err != nil {
+                log.Printf("Error encoding %s broadcast: %v", c.encoder.Name(), err)
+                continue
+            }
+            writes = append(writes, clientWrite{client: c, data: data})
+            continue
+        }
 
-    // Broadcasting updates to all clients
-    for vehicles := range h.Broadcast { // Listens to channel
-        // Send updates to all connected clients
-        for client := range h.clients {
-            err := client.WriteJSON(vehicles)
+        data, ok := payloads[c.encoder.Name()]
+        if !ok {
+            var err error
+            data, err = c.encoder.Encode(newVehiclesMessage(vehicles, sentAt))
             if err != nil {
-                log.Printf("WebSocket Write Error: %v", err)
-                client.Close()
-                delete(h.clients, client) // Remove disconnected client
+                log.Printf("Error encoding %s broadcast: %v", c.encoder.Name(), err)
+                continue
             }
+            payloads[c.encoder.Name()] = data
+        }
+        writes = append(writes, clientWrite{client: c, data: data})
+    }
+    if h.sendBuffer > 0 {
+        // Queue for each client's writer, clients that are behind are
+        // handled by the WS_SEND_OVERFLOW policy. Nothing new is queued
+        // while Shutdown drains the writers.
+        if h.shuttingDown.Load() {
+            writes = nil
+        }
+        for _, wr := range writes {
+            if !wr.client.enqueue(wr.data, h.sendOverflow) {
+                h.droppedTotal.Add(1)
+            }
+        }
+    } else {
+        // Remove disconnected clients once every write has finished
+        for _, c := range h.writeAll(writes) {
+            c.conn.Close()
+            delete(h.clients, c)
+        }
+    }
+    h.mu.Unlock()
+
+    // Export outside the lock so slow disks don't hold up clients
+    if h.sink != nil {
+        if err := h.sink.Write(vehicles); err != nil {
+            log.Printf("Error writing snapshot: %v", err)
         }
     }
 }
 
+// Alive reports whether Run is still processing, by sending it a heartbeat
+// and waiting for the reply. Run answers between broadcasts after taking mu,
+// so a broadcast stuck on a client or a deadlock on mu times out with ctx.
+// Used by /livez so a hung process gets restarted.
+func (h *Hub) Alive(ctx context.Context) error {
+    reply := make(chan struct{})
+    select {
+    case h.heartbeat <- reply:
+    case <-ctx.Done():
+        return fmt.Errorf("hub did not take heartbeat: %w", ctx.Err())
+    }
+    select {
+    case <-reply:
+        return nil
+    case <-ctx.Done():
+        return fmt.Errorf("hub did not answer heartbeat: %w", ctx.Err())
+    }
+}
+
+// snapshotHash hashes the JSON form of a snapshot, ok is false if it can't be encoded.
+// CurrentStateSeconds is left out: VehicleFromAPI recomputes it from the clock
+// on every fetch, so it would make identical upstream data hash differently.
+// Clients can keep it current from drive_status_begin_time.
+func snapshotHash(vehicles []models.Vehicle) (uint64, bool) {
+    stable := make([]models.Vehicle, len(vehicles))
+    for i, v := range vehicles {
+        v.CurrentStateSeconds = nil
+        stable[i] = v
+    }
+    data, err := json.Marshal(stable)
+    if err != nil {
+        return 0, false
+    }
+    hash := fnv.New64a()
+    hash.Write(data)
+    return hash.Sum64(), true
+}
+
 // pollUpdates periodically fetches vehicle data from OneStepGPS.
 // Runs in background, pushing updates to the Broadcast channel.
 func (h *Hub) pollUpdates() {
@@ -70,18 +289,324 @@ func (h *Hub) pollUpdates() {
     defer ticker.Stop()
 
     for range ticker.C {
+        if h.gpsClient.Paused() {
+            continue // Paused by an operator, e.g. during upstream maintenance
+        }
         vehicles, err := h.gpsClient.GetDevices()
         if err != nil {
             log.Printf("Error fetching vehicle updates: %v", err)
             continue // Skip this update on error
         }
-        h.Broadcast <- vehicles // Send update to broadcast channel, thread-safe
+        h.mu.Lock()
+        h.lastPoll = time.Now()
+        h.mu.Unlock()
+        h.publish(vehicles) // Never blocks, so a slow broadcast can't delay the next poll
+    }
+}
+
+// publish queues a snapshot for broadcasting without blocking, so a slow
+// broadcast never delays the next poll.
+// Up to WS_BROADCAST_BUFFER snapshots wait for the broadcast loop. When the
+// queue is full the oldest pending one is discarded, so the newest state
+// always goes out. The default of 1 only ever sends the latest snapshot; a
+// larger buffer delivers every intermediate snapshot through short stalls,
+// at the cost of a burst of slightly stale ones afterwards.
+func (h *Hub) publish(vehicles []models.Vehicle) {
+    for {
+        select {
+        case h.Broadcast <- vehicles:
+            return
+        default:
+        }
+
+        // Consumer is behind, drop the stale pending snapshot and retry
+        select {
+        case <-h.Broadcast:
+        default:
+        }
+    }
+}
+
+// State returns a snapshot of connected clients and poll/broadcast activity.
+// Used by the /debug/hub endpoint.
+func (h *Hub) State() HubState {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    state := HubState{
+        ClientCount:       len(h.clients),
+        Clients:           make([]ClientState, 0, len(h.clients)),
+        LastPollTime:      h.lastPoll,
+        LastBroadcastTime: h.lastBroadcast,
+        LastSnapshotSize:  len(h.latest),
+        PollingEnabled:    h.updateInterval > 0,
+        PollingPaused:     h.PollingPaused(),
+        DroppedMessages:   h.droppedTotal.Load(),
+    }
+    for c := range h.clients {
+        state.Clients = append(state.Clients, ClientState{
+            ID:            c.id,
+            Encoding:      c.encoder.Name(),
+            ConnectedAt:   c.connectedAt,
+            Subscriptions: c.subscriptionList(),
+            Dropped:       c.dropped.Load(),
+        })
+    }
+    sort.Slice(state.Clients, func(i, j int) bool {
+        return state.Clients[i].ConnectedAt.Before(state.Clients[j].ConnectedAt)
+    })
+    return state
+}
+
+// SubscriberCounts reports how many connected clients receive deviceID:
+// explicit is those subscribed to it by id, all those receiving every device.
+func (h *Hub) SubscriberCounts(deviceID string) (explicit, all int) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    for c := range h.clients {
+        subscribed, everything := c.subscribedTo(deviceID)
+        switch {
+        case everything:
+            all++
+        case subscribed:
+            explicit++
+        }
+    }
+    return explicit, all
+}
+
+// PausePolling stops OneStepGPS polls until ResumePolling is called, along
+// with every other request through the hub's client (reports, history, see
+// onestepgps.Client.Pause). Clients stay connected and pushed webhook
+// updates are still broadcast.
+func (h *Hub) PausePolling() {
+    h.gpsClient.Pause()
+}
+
+// ResumePolling restarts polling on the next tick
+func (h *Hub) ResumePolling() {
+    h.gpsClient.Resume()
+}
+
+// PollingPaused reports whether polling is paused
+func (h *Hub) PollingPaused() bool {
+    return h.gpsClient.Paused()
+}
+
+// IngestVehicles merges pushed device updates (e.g. from the OneStepGPS webhook)
+// into the last snapshot and broadcasts the merged list, so clients always
+// receive the full fleet even when upstream only pushes changed devices.
+func (h *Hub) IngestVehicles(updates []models.Vehicle) {
+    h.mu.Lock()
+    merged := mergeVehicles(h.latest, updates)
+    h.latest = merged // Record now so concurrent pushes merge on top of this one
+    h.mu.Unlock()
+
+    h.publish(merged)
+}
+
+// mergeVehicles returns base with each update replacing the vehicle with the
+// same DeviceID, adding unknown devices in device id order. base is not modified.
+func mergeVehicles(base, updates []models.Vehicle) []models.Vehicle {
+    merged := make([]models.Vehicle, len(base), len(base)+len(updates))
+    copy(merged, base)
+
+    index := make(map[string]int, len(merged))
+    for i, v := range merged {
+        index[v.DeviceID] = i
+    }
+    for _, v := range updates {
+        if i, ok := index[v.DeviceID]; ok {
+            merged[i] = v
+        } else {
+            index[v.DeviceID] = len(merged)
+            merged = append(merged, v)
+        }
+    }
+    if len(merged) > len(base) {
+        onestepgps.SortDevices(merged)
+    }
+    return merged
+}
+
+// coalesce collects snapshots arriving within batchWindow of first and
+// returns them merged into one, keeping the latest state per device
+func (h *Hub) coalesce(first []models.Vehicle) []models.Vehicle {
+    timer := time.NewTimer(h.batchWindow)
+    defer timer.Stop()
+
+    vehicles := first
+    for {
+        select {
+        case next, ok := <-h.Broadcast:
+            if !ok {
+                return vehicles
+            }
+            vehicles = mergeVehicles(vehicles, next)
+        case <-timer.C:
+            return vehicles
+        }
+    }
+}
+
+// Shutdown closes every client with CloseServerShutdown so they reconnect
+// to another instance, and turns away new connections the same way.
+// With WS_SEND_BUFFER, client writers first flush what they have queued.
+// If they haven't finished within shutdownDrainTimeout (or ctx's deadline,
+// if sooner) connections are closed without a close frame, which fails any
+// write still in progress and ends its writer.
+// Called in main.go before the HTTP server shuts down, which doesn't
+// close hijacked WebSocket connections itself.
+func (h *Hub) Shutdown(ctx context.Context) {
+    h.shuttingDown.Store(true)
+
+    // Writers drain their queues and exit
+    h.stopWriters()
+    drained := make(chan struct{})
+    go func() {
+        h.writers.Wait()
+        close(drained)
+    }()
+    ctx, cancel := context.WithTimeout(ctx, shutdownDrainTimeout)
+    defer cancel()
+    forced := false
+    select {
+    case <-drained:
+    case <-ctx.Done():
+        forced = true
+    }
+
+    h.mu.Lock()
+    clients := make([]*client, 0, len(h.clients))
+    for c := range h.clients {
+        clients = append(clients, c)
+    }
+    h.mu.Unlock()
+
+    if forced {
+        for _, c := range clients {
+            c.conn.Close()
+        }
+        log.Printf("Force closed %d WebSocket clients, send queues didn't drain in time", len(clients))
+        return
+    }
+    reason := closeReasonText("server_shutdown", shutdownRetryAfter)
+    for _, c := range clients {
+        c.closeWith(CloseServerShutdown, reason)
+    }
+    log.Printf("Closed %d WebSocket clients for shutdown", len(clients))
+}
+
+// admitPollInterval is how often a waiting connection rechecks for a free slot
+const admitPollInterval = 50 * time.Millisecond
+
+// reserveSlot takes a slot for another client, waiting up to admitGrace for
+// one to free up, and reports whether it got one. During a deploy every
+// dashboard reconnects at once while old connections are still being cleaned
+// up, the grace lets that burst through instead of rejecting it at the cap.
+// The check and the reservation happen under one lock, so concurrent
+// connects can't overshoot MaxClients. A reserved slot must be handed to
+// register or given back with releaseSlot.
+func (h *Hub) reserveSlot(ctx context.Context) bool {
+    deadline := time.Now().Add(h.admitGrace)
+    for {
+        h.mu.Lock()
+        full := h.maxClients > 0 && len(h.clients)+h.reserved >= h.maxClients
+        if !full {
+            h.reserved++
+        }
+        h.mu.Unlock()
+        if !full {
+            return true
+        }
+        if !time.Now().Before(deadline) {
+            return false
+        }
+
+        select {
+        case <-ctx.Done():
+            return false
+        case <-time.After(admitPollInterval):
+        }
+    }
+}
+
+// releaseSlot gives back a slot from reserveSlot for a connection that
+// failed before register
+func (h *Hub) releaseSlot() {
+    h.mu.Lock()
+    h.reserved--
+    h.mu.Unlock()
+}
+
+// register adds a client into the slot it reserved and starts its writer,
+// in single-session mode replacing any earlier connection from the same
+// client id (e.g. a reconnect that beat cleanup)
+func (h *Hub) register(c *client) {
+    if h.sendBuffer > 0 {
+        c.startWriter(h.writerCtx, h.sendBuffer, &h.writers)
+    }
+    h.mu.Lock()
+    h.reserved--
+    var superseded []*client
+    if h.singleSession && c.clientID != "" {
+        for other := range h.clients {
+            if other.clientID == c.clientID {
+                superseded = append(superseded, other)
+                delete(h.clients, other)
+            }
+        }
+    }
+    h.clients[c] = true
+    h.mu.Unlock()
+    for _, other := range superseded {
+        other.closeWith(websocket.ClosePolicyViolation, "superseded by a newer connection")
+    }
+}
+
+// sendInitial sends a new client the current vehicles, from the
+// startup-warmed cache when fresh, filtered to its subscription
+func (h *Hub) sendInitial(c *client) {
+    vehicles, err := h.gpsClient.GetDevicesCached(initialSnapshotMaxAge)
+    if err != nil {
+        log.Printf("Error fetching initial vehicle data: %v", err)
+        return
+    }
+    var payload interface{} = vehicles
+    var prefs map[string]map[string]*models.UserPreference
+    if c.byPreference {
+        prefs = h.loadPreferences([]string{c.preferenceOwner()})
+    }
+    own, arranged := h.arrange(c, vehicles, prefs)
+    if filtered, ok := c.payload(own); ok || arranged {
+        payload = filtered
+    }
+    if err := c.send(newVehiclesMessage(payload, time.Now())); err != nil {
+        log.Printf("Error sending initial data: %v", err)
     }
 }
 
 // HandleWebSocket manages individual WebSocket connections.
 // Called when frontend (HomeView.vue) initiates WebSocket connection.
+// Clients may pick the payload encoding with ?encoding=json|msgpack (default json)
+// and identify themselves with ?client_id= for single-session mode.
+// ?sort=preference streams the client's devices in preference order, see preferences.go.
+// Speeds and distances are sent in the units OneStepGPS uses, stored unit
+// preferences only apply to REST responses (see api/units.go).
 func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+    // Resolve encoding before upgrading so bad values get a plain HTTP 400
+    encoder, err := encoderFor(r.URL.Query().Get("encoding"))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    byPreference, err := parseStreamSort(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
     // Upgrade HTTP connection to WebSocket
     conn, err := h.upgrader.Upgrade(w, r, nil)
     if err != nil {
@@ -89,34 +614,58 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Register new client
-    h.clients[conn] = true
+    // Turn the client away with a close frame rather than an HTTP error,
+    // browsers don't expose the status of a failed handshake
+    if h.shuttingDown.Load() {
+        newClient(conn, encoder, h.writeWait).closeWith(CloseServerShutdown, closeReasonText("server_shutdown", shutdownRetryAfter))
+        return
+    }
+    if !h.reserveSlot(r.Context()) {
+        log.Println("Rejected WebSocket client, hub is full")
+        newClient(conn, encoder, h.writeWait).closeWith(CloseServerFull, closeReasonText("server_full", capacityRetryAfter))
+        return
+    }
+
+    // Limit message size and drop clients that stop answering pings
+    conn.SetReadLimit(h.maxMessageSize)
+    conn.SetReadDeadline(time.Now().Add(h.pongWait))
+    conn.SetPongHandler(func(string) error {
+        return conn.SetReadDeadline(time.Now().Add(h.pongWait))
+    })
+
+    c := newClient(conn, encoder, h.writeWait)
+    c.clientID = sessionClientID(r)
+    c.byPreference = byPreference
+    h.register(c)
     log.Println("Client connected")
+    h.sendInitial(c)
 
-    // Send initial vehicle data to new client
-    vehicles, err := h.gpsClient.GetDevices()
-    if err != nil {
-        log.Printf("Error fetching initial vehicle data: %v", err)
-    } else {
-        err = conn.WriteJSON(vehicles)
-        if err != nil {
-            log.Printf("Error sending initial data: %v", err)
-        }
-    }
+    // Keep the connection alive with periodic pings
+    stopPing := make(chan struct{})
+    go c.pingLoop(h.pingInterval, stopPing)
 
     // Cleanup on disconnect
     defer func() {
+        close(stopPing)
+        c.stopWriter()
         conn.Close()
-        delete(h.clients, conn)
+        h.mu.Lock()
+        delete(h.clients, c)
+        h.mu.Unlock()
         log.Println("Client disconnected")
     }()
 
-    // Keep connection alive until error occurs
+    // Read client messages (e.g. latency pings) until error occurs
     for {
-        _, _, err := conn.ReadMessage()
+        _, data, err := conn.ReadMessage()
         if err != nil {
             log.Printf("WebSocket Read Error: %v", err)
             break
         }
+        conn.SetReadDeadline(time.Now().Add(h.pongWait)) // Any message counts as activity
+        if err := c.handleMessage(data); err != nil {
+            log.Printf("WebSocket Write Error: %v", err)
+            break
+        }
     }
 }
\ No newline at end of file
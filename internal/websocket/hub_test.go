@@ -0,0 +1,518 @@
+// hub_test.go covers broadcasting snapshots to connected clients.
+
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// fakeConn records the messages written to a client. With fail set every
+// write errors, like a connection the peer dropped.
+type fakeConn struct {
+    mu       sync.Mutex
+    messages [][]byte
+    fail     bool
+    delay    time.Duration // Simulated network latency per write
+    closed   bool
+}
+
+func (f *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func (f *fakeConn) WriteMessage(messageType int, data []byte) error {
+    if f.delay > 0 {
+        time.Sleep(f.delay)
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if f.fail {
+        return errors.New("connection reset")
+    }
+    f.messages = append(f.messages, data)
+    return nil
+}
+
+func (f *fakeConn) WriteControl(messageType int, data []byte, deadline time.Time) error { return nil }
+
+func (f *fakeConn) Close() error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.closed = true
+    return nil
+}
+
+// received returns how many messages were written
+func (f *fakeConn) received() int {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return len(f.messages)
+}
+
+// newTestHub creates a hub without polling
+func newTestHub(t testing.TB, cfg config.WebSocketConfig) *Hub {
+    t.Helper()
+    h, err := NewHub(onestepgps.NewClient("key", "http://127.0.0.1:0", nil), 0, cfg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return h
+}
+
+// connect adds a JSON client writing to conn
+func connect(h *Hub, conn *fakeConn) *client {
+    c := newClient(conn, jsonEncoder{}, time.Second)
+    h.mu.Lock()
+    h.clients[c] = true
+    h.mu.Unlock()
+    return c
+}
+
+// snapshot maps a fresh one-vehicle upstream payload, like a poll would.
+// Broadcast fills in derived motion so each call needs its own slice, and
+// the mapping sets current_state_seconds from the clock.
+func snapshot(lat float64) []models.Vehicle {
+    timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+    lng := -122.25
+    return models.VehiclesFromAPI([]models.APIDevice{{
+        DeviceID:    "dev1",
+        DisplayName: "Truck 1",
+        LatestPoint: &models.APIDevicePoint{
+            DtTracker: &timestamp,
+            Lat:       &lat,
+            Lng:       &lng,
+        },
+        DeviceState: &models.APIDeviceState{
+            DriveStatus:          "idle",
+            DriveStatusBeginTime: &timestamp,
+        },
+    }})
+}
+
+func TestBroadcastSkipsIdenticalSnapshot(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+    conn := &fakeConn{}
+    connect(h, conn)
+
+    h.broadcast(snapshot(37.5))
+    if n := conn.received(); n != 1 {
+        t.Fatalf("after first snapshot: %d messages, want 1", n)
+    }
+
+    // The next poll maps the same payload at a later time, so its
+    // current_state_seconds differs
+    time.Sleep(1100 * time.Millisecond)
+    h.broadcast(snapshot(37.5))
+    if n := conn.received(); n != 1 {
+        t.Errorf("identical snapshot was rebroadcast: %d messages, want 1", n)
+    }
+
+    h.broadcast(snapshot(37.6))
+    if n := conn.received(); n != 2 {
+        t.Errorf("changed snapshot: %d messages, want 2", n)
+    }
+
+    // Returning to an earlier state is still a change from the last one
+    h.broadcast(snapshot(37.5))
+    if n := conn.received(); n != 3 {
+        t.Errorf("snapshot changed back: %d messages, want 3", n)
+    }
+}
+
+// last returns the most recent message written
+func (f *fakeConn) last() []byte {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if len(f.messages) == 0 {
+        return nil
+    }
+    return f.messages[len(f.messages)-1]
+}
+
+func TestPingPong(t *testing.T) {
+    conn := &fakeConn{}
+    c := newClient(conn, jsonEncoder{}, time.Second)
+
+    before := time.Now().UnixMilli()
+    if err := c.handleMessage([]byte(`{"action":"ping","t":1712345678901}`)); err != nil {
+        t.Fatal(err)
+    }
+    var pong struct {
+        Type       string `json:"type"`
+        T          int64  `json:"t"`
+        ServerTime *int64 `json:"server_time"`
+    }
+    if err := json.Unmarshal(conn.last(), &pong); err != nil {
+        t.Fatal(err)
+    }
+    if pong.Type != "pong" || pong.T != 1712345678901 {
+        t.Errorf("got type %q t %d, want pong echoing 1712345678901", pong.Type, pong.T)
+    }
+    if pong.ServerTime == nil || *pong.ServerTime < before || *pong.ServerTime > time.Now().UnixMilli() {
+        t.Errorf("server_time = %v, want the time the pong was sent", pong.ServerTime)
+    }
+}
+
+func TestBroadcastSentAt(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+    jsonConn, msgpackConn, subscribedConn := &fakeConn{}, &fakeConn{}, &fakeConn{}
+    connect(h, jsonConn)
+    mc := newClient(msgpackConn, msgpackEncoder{}, time.Second)
+    h.mu.Lock()
+    h.clients[mc] = true
+    h.mu.Unlock()
+    sc := connect(h, subscribedConn)
+    sc.subscribe([]string{"dev1"}, []string{"device_id"})
+
+    before := time.Now().UnixMilli()
+    h.broadcast(snapshot(37.5))
+    after := time.Now().UnixMilli()
+
+    type message struct {
+        Type     string            `json:"type"`
+        SentAt   int64             `json:"sent_at"`
+        Vehicles []json.RawMessage `json:"vehicles"`
+    }
+    check := func(name string, msg message) {
+        if msg.Type != "vehicles" || len(msg.Vehicles) != 1 {
+            t.Errorf("%s: got type %q with %d vehicles, want vehicles with 1", name, msg.Type, len(msg.Vehicles))
+        }
+        if msg.SentAt < before || msg.SentAt > after {
+            t.Errorf("%s: sent_at = %d, want between %d and %d", name, msg.SentAt, before, after)
+        }
+    }
+
+    for name, conn := range map[string]*fakeConn{"json": jsonConn, "subscribed": subscribedConn} {
+        var msg message
+        if err := json.Unmarshal(conn.last(), &msg); err != nil {
+            t.Fatalf("%s: %v", name, err)
+        }
+        check(name, msg)
+    }
+
+    var decoded struct {
+        Type     string        `msgpack:"type"`
+        SentAt   int64         `msgpack:"sent_at"`
+        Vehicles []interface{} `msgpack:"vehicles"`
+    }
+    if err := msgpack.Unmarshal(msgpackConn.last(), &decoded); err != nil {
+        t.Fatal(err)
+    }
+    check("msgpack", message{Type: decoded.Type, SentAt: decoded.SentAt, Vehicles: make([]json.RawMessage, len(decoded.Vehicles))})
+}
+
+func TestConcurrentConnectsRespectMaxClients(t *testing.T) {
+    const maxClients, attempts = 5, 40
+    h := newTestHub(t, config.WebSocketConfig{MaxClients: maxClients, PingInterval: 30, PongWait: 60, WriteWait: 1})
+    mux := http.NewServeMux()
+    mux.HandleFunc("/ws", h.HandleWebSocket)
+    mux.HandleFunc("/stream", h.HandleSSE)
+    srv := httptest.NewServer(mux)
+    defer srv.Close()
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    // Half the attempts are WebSockets and half SSE streams, all at once
+    var wg sync.WaitGroup
+    var mu sync.Mutex
+    admitted := 0
+    var conns []*websocket.Conn // Admitted connections stay open until the hub has been checked
+    defer func() {
+        for _, conn := range conns {
+            conn.Close()
+        }
+    }()
+    start := make(chan struct{})
+    for i := 0; i < attempts; i++ {
+        wg.Add(1)
+        go func(sse bool) {
+            defer wg.Done()
+            <-start
+            ok := false
+            if sse {
+                req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/stream", nil)
+                resp, err := http.DefaultClient.Do(req)
+                if err != nil {
+                    t.Error(err)
+                    return
+                }
+                ok = resp.StatusCode == http.StatusOK
+                if !ok {
+                    resp.Body.Close()
+                }
+            } else {
+                conn, _, err := websocket.DefaultDialer.DialContext(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+                if err != nil {
+                    t.Error(err)
+                    return
+                }
+                mu.Lock()
+                conns = append(conns, conn)
+                mu.Unlock()
+                // A rejected client gets a close frame right away, an admitted
+                // one nothing (upstream is unreachable, so no initial snapshot)
+                conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+                _, _, err = conn.ReadMessage()
+                var closeErr *websocket.CloseError
+                ok = !errors.As(err, &closeErr) || closeErr.Code != CloseServerFull
+            }
+            if ok {
+                mu.Lock()
+                admitted++
+                mu.Unlock()
+            }
+        }(i%2 == 0)
+    }
+    close(start)
+    wg.Wait()
+
+    if admitted != maxClients {
+        t.Errorf("%d connections admitted, want %d", admitted, maxClients)
+    }
+    h.mu.Lock()
+    registered, reserved := len(h.clients), h.reserved
+    h.mu.Unlock()
+    if registered != maxClients || reserved != 0 {
+        t.Errorf("%d clients registered with %d slots reserved, want %d and 0", registered, reserved, maxClients)
+    }
+}
+
+func TestReleasedSlotIsReusable(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{MaxClients: 1})
+    if !h.reserveSlot(context.Background()) {
+        t.Fatal("first reservation failed")
+    }
+    if h.reserveSlot(context.Background()) {
+        t.Fatal("second reservation succeeded past MaxClients 1")
+    }
+    h.releaseSlot()
+    if !h.reserveSlot(context.Background()) {
+        t.Error("slot not reusable after release")
+    }
+}
+
+// dialSession opens a WebSocket to srv as clientID and waits until the hub
+// has registered want clients
+func dialSession(t *testing.T, h *Hub, srv *httptest.Server, clientID string, want int) *websocket.Conn {
+    t.Helper()
+    conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?client_id="+clientID, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        h.mu.Lock()
+        n := len(h.clients)
+        h.mu.Unlock()
+        if n == want {
+            return conn
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("%d clients registered after connecting %s, want %d", n, clientID, want)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+// closeCode reads from conn until it fails and returns the close frame it got,
+// nil when the connection is still open after timeout
+func closeCode(t *testing.T, conn *websocket.Conn, timeout time.Duration) *websocket.CloseError {
+    t.Helper()
+    conn.SetReadDeadline(time.Now().Add(timeout))
+    for {
+        _, _, err := conn.ReadMessage()
+        if err == nil {
+            continue
+        }
+        var closeErr *websocket.CloseError
+        if errors.As(err, &closeErr) {
+            return closeErr
+        }
+        var netErr interface{ Timeout() bool }
+        if errors.As(err, &netErr) && netErr.Timeout() {
+            return nil
+        }
+        t.Fatalf("reading: %v", err)
+    }
+}
+
+func TestSingleSessionSupersedesOlderConnection(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{SingleSession: true, PingInterval: 30, PongWait: 60, WriteWait: 1})
+    srv := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+    defer srv.Close()
+
+    first := dialSession(t, h, srv, "alice", 1)
+    other := dialSession(t, h, srv, "bob", 2)
+    // alice reconnects before her first socket was cleaned up
+    second := dialSession(t, h, srv, "alice", 2)
+
+    closeErr := closeCode(t, first, 2*time.Second)
+    if closeErr == nil || closeErr.Code != websocket.ClosePolicyViolation || !strings.Contains(closeErr.Text, "superseded") {
+        t.Errorf("first connection closed with %v, want a policy violation close naming the newer connection", closeErr)
+    }
+    if closeErr := closeCode(t, second, 200*time.Millisecond); closeErr != nil {
+        t.Errorf("newer connection closed with %v", closeErr)
+    }
+    if closeErr := closeCode(t, other, 200*time.Millisecond); closeErr != nil {
+        t.Errorf("another client's connection closed with %v", closeErr)
+    }
+
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    sessions := make(map[string]int)
+    for c := range h.clients {
+        sessions[c.clientID]++
+    }
+    if len(h.clients) != 2 || sessions["alice"] != 1 || sessions["bob"] != 1 {
+        t.Errorf("registered sessions = %v, want one each for alice and bob", sessions)
+    }
+}
+
+func TestWithoutSingleSessionConnectionsCoexist(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{PingInterval: 30, PongWait: 60, WriteWait: 1})
+    srv := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+    defer srv.Close()
+
+    first := dialSession(t, h, srv, "alice", 1)
+    dialSession(t, h, srv, "alice", 2)
+
+    if closeErr := closeCode(t, first, 200*time.Millisecond); closeErr != nil {
+        t.Errorf("first connection closed with %v, want it kept outside single-session mode", closeErr)
+    }
+}
+
+// reconnectBurst fills a hub of maxClients with old connections, then has
+// reconnects new connections try to get in while the old ones drop one every
+// 20ms, as during a deploy. Returns how many new connections were admitted.
+func reconnectBurst(t *testing.T, maxClients, reconnects, graceMs int) int {
+    t.Helper()
+    h := newTestHub(t, config.WebSocketConfig{MaxClients: maxClients, AdmitGraceMs: graceMs})
+    for i := 0; i < maxClients; i++ {
+        if !h.reserveSlot(context.Background()) {
+            t.Fatalf("old connection %d rejected", i)
+        }
+    }
+
+    var wg sync.WaitGroup
+    var mu sync.Mutex
+    admitted := 0
+    for i := 0; i < reconnects; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            if h.reserveSlot(context.Background()) {
+                mu.Lock()
+                admitted++
+                mu.Unlock()
+            }
+        }()
+    }
+    for i := 0; i < maxClients; i++ {
+        time.Sleep(20 * time.Millisecond)
+        h.releaseSlot()
+    }
+    wg.Wait()
+    return admitted
+}
+
+func TestAdmitGraceSmoothsReconnectBurst(t *testing.T) {
+    // Every old connection drops within the grace, so every reconnect gets in
+    if n := reconnectBurst(t, 5, 5, 1000); n != 5 {
+        t.Errorf("with grace: %d of 5 reconnects admitted, want 5", n)
+    }
+    // The cap still holds, the reconnect beyond it is turned away after the grace
+    if n := reconnectBurst(t, 5, 6, 500); n != 5 {
+        t.Errorf("burst over the cap: %d of 6 reconnects admitted, want 5", n)
+    }
+    // Without a grace a full hub rejects at once
+    if n := reconnectBurst(t, 5, 5, 0); n != 0 {
+        t.Errorf("without grace: %d of 5 reconnects admitted, want 0", n)
+    }
+}
+
+func TestAdmitGraceGivesUpWithTheRequest(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{MaxClients: 1, AdmitGraceMs: 5000})
+    if !h.reserveSlot(context.Background()) {
+        t.Fatal("first reservation failed")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    if h.reserveSlot(ctx) {
+        t.Fatal("reserved a slot past MaxClients")
+    }
+    if waited := time.Since(start); waited > time.Second {
+        t.Errorf("waited %v after the client went away, want it to stop with the request", waited)
+    }
+}
+
+func TestMergeVehiclesKeepsDeviceOrder(t *testing.T) {
+    base := []models.Vehicle{{DeviceID: "dev1"}, {DeviceID: "dev3"}}
+    updates := []models.Vehicle{{DeviceID: "dev4"}, {DeviceID: "dev2"}, {DeviceID: "dev3", DisplayName: "Updated"}}
+
+    merged := mergeVehicles(base, updates)
+    var ids []string
+    for _, v := range merged {
+        ids = append(ids, v.DeviceID)
+    }
+    // Pushed devices slot in by id instead of trailing the polled ones
+    if want := []string{"dev1", "dev2", "dev3", "dev4"}; !reflect.DeepEqual(ids, want) {
+        t.Errorf("merged = %v, want %v", ids, want)
+    }
+    if merged[2].DisplayName != "Updated" {
+        t.Errorf("dev3 = %+v, want the update", merged[2])
+    }
+    if base[1].DisplayName != "" {
+        t.Error("base was modified")
+    }
+}
+
+func TestAlive(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+
+    // alive checks the hub with a short deadline
+    alive := func() error {
+        ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+        defer cancel()
+        return h.Alive(ctx)
+    }
+
+    // Nothing answers before Run starts
+    if err := alive(); err == nil {
+        t.Error("Alive succeeded without Run")
+    }
+
+    runHub(t, h)
+    if err := alive(); err != nil {
+        t.Errorf("Alive = %v on a running hub", err)
+    }
+
+    // A deadlock on mu stops the heartbeat being answered
+    h.mu.Lock()
+    err := alive()
+    h.mu.Unlock()
+    if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("Alive = %v with mu held, want a deadline error", err)
+    }
+
+    // Once the hub recovers it is alive again
+    if err := alive(); err != nil {
+        t.Errorf("Alive = %v after releasing mu", err)
+    }
+}
@@ -0,0 +1,57 @@
+// motion.go derives speed and heading for devices that don't report them,
+// from the change in position between consecutive snapshots.
+
+package websocket
+
+import (
+	"math"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/geo"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// minHeadingDistance is how far (meters) a device must move before a heading
+// is derived, below this GPS jitter makes the bearing meaningless
+const minHeadingDistance = 5.0
+
+// deriveMotion fills ComputedSpeedKmh/ComputedHeading on positions that lack
+// reported values, comparing against each device's previous position.
+// Positions are copied before being modified since snapshots share them.
+// Must be called with h.mu held.
+func (h *Hub) deriveMotion(vehicles []models.Vehicle) {
+    if h.lastPositions == nil {
+        h.lastPositions = make(map[string]models.Location)
+    }
+
+    for i := range vehicles {
+        cur := vehicles[i].LastLocation
+        if cur == nil || !cur.HasFix {
+            continue // No position to derive from, and an invalid one would poison the next
+        }
+        prev, ok := h.lastPositions[vehicles[i].DeviceID]
+        if !ok || !cur.Timestamp.After(prev.Timestamp) {
+            // No earlier fix, or the same fix seen again (e.g. a webhook merge)
+            if !ok {
+                h.lastPositions[vehicles[i].DeviceID] = *cur
+            }
+            continue
+        }
+        h.lastPositions[vehicles[i].DeviceID] = *cur
+
+        if cur.SpeedReported && cur.HeadingReported {
+            continue
+        }
+
+        loc := *cur
+        distance := geo.Haversine(prev.Latitude, prev.Longitude, loc.Latitude, loc.Longitude)
+        if !loc.SpeedReported {
+            kmh := math.Round(distance/loc.Timestamp.Sub(prev.Timestamp).Seconds()*3.6*10) / 10
+            loc.ComputedSpeedKmh = &kmh
+        }
+        if !loc.HeadingReported && distance >= minHeadingDistance {
+            heading := int(math.Round(geo.Bearing(prev.Latitude, prev.Longitude, loc.Latitude, loc.Longitude))) % 360
+            loc.ComputedHeading = &heading
+        }
+        vehicles[i].LastLocation = &loc
+    }
+}
@@ -0,0 +1,133 @@
+// motion_test.go covers deriving speed and heading from consecutive positions.
+
+package websocket
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// motionStart is the time of the first position in each test
+var motionStart = time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+
+// positionAt maps one upstream device at lat,lng, seconds after motionStart.
+// speed and angle are only sent when non-nil.
+func positionAt(lat, lng float64, seconds int, speed, angle *float64) []models.Vehicle {
+    ts := motionStart.Add(time.Duration(seconds) * time.Second)
+    return models.VehiclesFromAPI([]models.APIDevice{{
+        DeviceID:    "dev1",
+        LatestPoint: &models.APIDevicePoint{DtTracker: &ts, Lat: &lat, Lng: &lng, Speed: speed, Angle: angle},
+    }})
+}
+
+// derive runs deriveMotion on vehicles and returns the first location
+func derive(h *Hub, vehicles []models.Vehicle) *models.Location {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    h.deriveMotion(vehicles)
+    return vehicles[0].LastLocation
+}
+
+func TestDeriveMotionNorth(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+
+    if loc := derive(h, positionAt(37.0, -122.0, 0, nil, nil)); loc.ComputedSpeedKmh != nil || loc.ComputedHeading != nil {
+        t.Fatalf("first position derived motion: %+v", loc)
+    }
+
+    // 0.01 degrees of latitude is about 1112 m, in a minute that's about 66.7 km/h
+    loc := derive(h, positionAt(37.01, -122.0, 60, nil, nil))
+    if loc.ComputedSpeedKmh == nil || math.Abs(*loc.ComputedSpeedKmh-66.7) > 0.1 {
+        t.Errorf("computed_speed_kmh = %v, want about 66.7", loc.ComputedSpeedKmh)
+    }
+    if loc.ComputedHeading == nil || *loc.ComputedHeading != 0 {
+        t.Errorf("computed_heading = %v, want 0 (north)", loc.ComputedHeading)
+    }
+}
+
+func TestDeriveMotionEast(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+
+    derive(h, positionAt(0.5, 10.0, 0, nil, nil))
+    loc := derive(h, positionAt(0.5, 10.01, 30, nil, nil))
+    if loc.ComputedHeading == nil || *loc.ComputedHeading != 90 {
+        t.Errorf("computed_heading = %v, want 90 (east)", loc.ComputedHeading)
+    }
+}
+
+func TestDeriveMotionKeepsReportedValues(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+    speed, angle := 50.0, 45.0
+
+    derive(h, positionAt(37.0, -122.0, 0, &speed, &angle))
+    loc := derive(h, positionAt(37.01, -122.0, 60, &speed, &angle))
+    if loc.ComputedSpeedKmh != nil || loc.ComputedHeading != nil {
+        t.Errorf("derived over reported values: speed %v heading %v", loc.ComputedSpeedKmh, loc.ComputedHeading)
+    }
+
+    // Only the missing one is derived
+    loc = derive(h, positionAt(37.02, -122.0, 120, &speed, nil))
+    if loc.ComputedSpeedKmh != nil || loc.ComputedHeading == nil {
+        t.Errorf("speed %v heading %v, want only a heading", loc.ComputedSpeedKmh, loc.ComputedHeading)
+    }
+}
+
+func TestDeriveMotionJitter(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+
+    // About 1 m of movement is GPS noise, the bearing would be meaningless
+    derive(h, positionAt(37.0, -122.0, 0, nil, nil))
+    loc := derive(h, positionAt(37.00001, -122.0, 10, nil, nil))
+    if loc.ComputedHeading != nil {
+        t.Errorf("computed_heading = %d from jitter, want none", *loc.ComputedHeading)
+    }
+    if loc.ComputedSpeedKmh == nil || *loc.ComputedSpeedKmh > 1 {
+        t.Errorf("computed_speed_kmh = %v, want near 0", loc.ComputedSpeedKmh)
+    }
+}
+
+func TestDeriveMotionSkipsRepeatsAndNoFix(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+
+    derive(h, positionAt(37.0, -122.0, 0, nil, nil))
+
+    // The same fix seen again (e.g. a webhook merge) has no elapsed time
+    if loc := derive(h, positionAt(37.0, -122.0, 0, nil, nil)); loc.ComputedSpeedKmh != nil {
+        t.Errorf("repeat derived speed %v", *loc.ComputedSpeedKmh)
+    }
+
+    // 0,0 is no fix, and doesn't replace the last good position
+    if loc := derive(h, positionAt(0, 0, 30, nil, nil)); loc.ComputedSpeedKmh != nil {
+        t.Errorf("no-fix position derived speed %v", *loc.ComputedSpeedKmh)
+    }
+    loc := derive(h, positionAt(37.01, -122.0, 60, nil, nil))
+    if loc.ComputedSpeedKmh == nil || math.Abs(*loc.ComputedSpeedKmh-66.7) > 0.1 {
+        t.Errorf("computed_speed_kmh = %v, want about 66.7 from the last good fix", loc.ComputedSpeedKmh)
+    }
+}
+
+func TestBroadcastIncludesDerivedMotion(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+    conn := &fakeConn{}
+    connect(h, conn)
+
+    first := positionAt(37.0, -122.0, 0, nil, nil)
+    h.broadcast(first)
+    h.broadcast(positionAt(37.01, -122.0, 60, nil, nil))
+
+    sent := sentVehicles(t, conn.last())
+    if len(sent) != 1 || sent[0].LastLocation == nil {
+        t.Fatalf("sent = %+v", sent)
+    }
+    if sent[0].LastLocation.ComputedSpeedKmh == nil || sent[0].LastLocation.ComputedHeading == nil {
+        t.Errorf("broadcast location = %+v, want computed speed and heading", sent[0].LastLocation)
+    }
+    // Positions are copied, the caller's snapshot isn't modified
+    if first[0].LastLocation.ComputedSpeedKmh != nil {
+        t.Error("first snapshot was modified")
+    }
+}
@@ -0,0 +1,127 @@
+// preferences.go streams vehicles in the client's preference order with
+// ?sort=preference, like GET /api/vehicles?sort=preference, leaving out
+// hidden devices. Devices without a preference follow the same
+// UNPREFERENCED_VISIBILITY and UNPREFERENCED_ORDER defaults as the REST API.
+
+package websocket
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// defaultClientID owns the preferences of connections without ?client_id=, as in the REST API
+const defaultClientID = "default"
+
+// PreferenceSource reads a client's saved preferences, the *database.DB in main.go
+type PreferenceSource interface {
+    GetAllPreferencesForClient(clientID string) ([]models.UserPreference, error)
+}
+
+// SetPreferences lets clients connecting with ?sort=preference receive
+// their devices in preference order, without the hidden ones.
+// Without a source those clients get upstream order. Called before Run.
+func (h *Hub) SetPreferences(source PreferenceSource, defaults models.PreferenceDefaults) {
+    h.preferences = source
+    h.preferenceDefaults = defaults
+}
+
+// parseStreamSort reads ?sort= for a stream, "preference" is the only key
+func parseStreamSort(r *http.Request) (byPreference bool, err error) {
+    switch key := r.URL.Query().Get("sort"); key {
+    case "":
+        return false, nil
+    case "preference":
+        return true, nil
+    default:
+        return false, fmt.Errorf("invalid sort key %q: must be preference", key)
+    }
+}
+
+// preferenceClientIDs returns the client ids streaming in preference order
+func (h *Hub) preferenceClientIDs() []string {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    seen := make(map[string]bool)
+    var ids []string
+    for c := range h.clients {
+        if id := c.preferenceOwner(); c.byPreference && !seen[id] {
+            seen[id] = true
+            ids = append(ids, id)
+        }
+    }
+    return ids
+}
+
+// loadPreferences reads the preferences of each client id by device id.
+// Clients whose lookup fails are left out and stream in upstream order
+// until the next broadcast.
+func (h *Hub) loadPreferences(clientIDs []string) map[string]map[string]*models.UserPreference {
+    if h.preferences == nil || len(clientIDs) == 0 {
+        return nil
+    }
+    loaded := make(map[string]map[string]*models.UserPreference, len(clientIDs))
+    for _, id := range clientIDs {
+        prefs, err := h.preferences.GetAllPreferencesForClient(id)
+        if err != nil {
+            log.Printf("Error fetching preferences for stream: %v", err)
+            continue
+        }
+        byDevice := make(map[string]*models.UserPreference, len(prefs))
+        for i := range prefs {
+            byDevice[prefs[i].DeviceID] = &prefs[i]
+        }
+        loaded[id] = byDevice
+    }
+    return loaded
+}
+
+// preferencesHash fingerprints loaded preferences for broadcast's snapshot
+// dedup, independent of map order
+func preferencesHash(loaded map[string]map[string]*models.UserPreference) uint64 {
+    lines := make([]string, 0, len(loaded))
+    for clientID, prefs := range loaded {
+        for deviceID, pref := range prefs {
+            lines = append(lines, fmt.Sprintf("%s\x00%s\x00%d\x00%t", clientID, deviceID, pref.SortOrder, pref.IsHidden))
+        }
+    }
+    sort.Strings(lines)
+    hash := fnv.New64a()
+    for _, line := range lines {
+        hash.Write([]byte(line + "\n"))
+    }
+    return hash.Sum64()
+}
+
+// arrange returns the visible vehicles in c's preference order.
+// ok is false when c streams in upstream order, vehicles is then returned as is.
+func (h *Hub) arrange(c *client, vehicles []models.Vehicle, loaded map[string]map[string]*models.UserPreference) (arranged []models.Vehicle, ok bool) {
+    if !c.byPreference {
+        return vehicles, false
+    }
+    prefs, ok := loaded[c.preferenceOwner()]
+    if !ok {
+        return vehicles, false
+    }
+
+    sortOrder := make(map[string]int, len(prefs))
+    for id, pref := range prefs {
+        sortOrder[id] = pref.SortOrder
+    }
+    arranged = make([]models.Vehicle, 0, len(vehicles))
+    for _, v := range vehicles {
+        if !h.preferenceDefaults.IsHidden(prefs[v.DeviceID]) {
+            arranged = append(arranged, v)
+        }
+    }
+    less := h.preferenceDefaults.Less(sortOrder)
+    sort.SliceStable(arranged, func(i, j int) bool {
+        return less(&arranged[i], &arranged[j])
+    })
+    return arranged, true
+}
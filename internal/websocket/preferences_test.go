@@ -0,0 +1,165 @@
+// preferences_test.go covers streaming vehicles in preference order with ?sort=preference.
+
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+)
+
+// fakePreferences serves preferences by client id, failing for unknown ids
+type fakePreferences map[string][]models.UserPreference
+
+func (f fakePreferences) GetAllPreferencesForClient(clientID string) ([]models.UserPreference, error) {
+    prefs, ok := f[clientID]
+    if !ok {
+        return nil, errors.New("database down")
+    }
+    return prefs, nil
+}
+
+// fleet is dev1 to dev4 in upstream order
+func fleet() []models.Vehicle {
+    var vehicles []models.Vehicle
+    for i, id := range []string{"dev1", "dev2", "dev3", "dev4"} {
+        vehicles = append(vehicles, deviceAt(id, 37.5+float64(i)/10)...)
+    }
+    return vehicles
+}
+
+// sentIDs returns the device ids of the last broadcast conn received
+func sentIDs(t *testing.T, conn *fakeConn) []string {
+    t.Helper()
+    var ids []string
+    for _, v := range sentVehicles(t, conn.last()) {
+        ids = append(ids, v.DeviceID)
+    }
+    return ids
+}
+
+func TestBroadcastPreferenceOrder(t *testing.T) {
+    // For client-a dev2 and dev4 have no preference and dev3 is hidden,
+    // the default client only has one for dev4
+    prefs := fakePreferences{
+        "client-a": {
+            {DeviceID: "dev1", ClientID: "client-a", SortOrder: 2},
+            {DeviceID: "dev3", ClientID: "client-a", SortOrder: 1, IsHidden: true},
+        },
+        "default": {{DeviceID: "dev4", ClientID: "default", SortOrder: 1}},
+    }
+    tests := []struct {
+        name     string
+        clientID string
+        defaults models.PreferenceDefaults
+        want     []string
+    }{
+        {"unpreferenced last", "client-a", models.PreferenceDefaults{}, []string{"dev1", "dev2", "dev4"}},
+        {"UNPREFERENCED_ORDER=first", "client-a", models.PreferenceDefaults{First: true}, []string{"dev2", "dev4", "dev1"}},
+        {"UNPREFERENCED_VISIBILITY=hidden", "client-a", models.PreferenceDefaults{Hidden: true, First: true}, []string{"dev1"}},
+        {"default client", "", models.PreferenceDefaults{}, []string{"dev4", "dev1", "dev2", "dev3"}},
+        {"failed lookup", "client-b", models.PreferenceDefaults{Hidden: true}, []string{"dev1", "dev2", "dev3", "dev4"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h := newTestHub(t, config.WebSocketConfig{})
+            h.SetPreferences(prefs, tt.defaults)
+            conn, upstream := &fakeConn{}, &fakeConn{}
+            c := connect(h, conn)
+            c.clientID = tt.clientID
+            c.byPreference = true
+            connect(h, upstream) // Didn't ask for preference order
+            runHub(t, h)
+
+            h.Broadcast <- fleet()
+            waitQuiet(t, conn, 1)
+            if got := sentIDs(t, conn); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("preference order = %v, want %v", got, tt.want)
+            }
+            if got := sentIDs(t, upstream); !reflect.DeepEqual(got, []string{"dev1", "dev2", "dev3", "dev4"}) {
+                t.Errorf("upstream order = %v, want dev1 to dev4", got)
+            }
+        })
+    }
+}
+
+func TestStreamSortRejected(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+    for _, handler := range []http.HandlerFunc{h.HandleWebSocket, h.HandleSSE} {
+        w := httptest.NewRecorder()
+        handler(w, httptest.NewRequest(http.MethodGet, "/stream?sort=name", nil))
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("?sort=name: status = %d, want 400", w.Code)
+        }
+    }
+}
+
+func TestBroadcastPreferenceChange(t *testing.T) {
+    prefs := fakePreferences{"client-a": {{DeviceID: "dev1", ClientID: "client-a", SortOrder: 1}}}
+    h := newTestHub(t, config.WebSocketConfig{})
+    h.SetPreferences(prefs, models.PreferenceDefaults{})
+    conn := &fakeConn{}
+    c := connect(h, conn)
+    c.clientID = "client-a"
+    c.byPreference = true
+
+    h.broadcast(fleet())
+    h.broadcast(fleet())
+    if n := conn.received(); n != 1 {
+        t.Fatalf("unchanged snapshot and preferences: %d messages, want 1", n)
+    }
+
+    // The fleet is idle, but the client moved dev3 to the top
+    prefs["client-a"] = append(prefs["client-a"], models.UserPreference{DeviceID: "dev3", ClientID: "client-a", SortOrder: 0})
+    h.broadcast(fleet())
+    if n := conn.received(); n != 2 {
+        t.Fatalf("changed preference: %d messages, want 2", n)
+    }
+    if got, want := sentIDs(t, conn), []string{"dev3", "dev1", "dev2", "dev4"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("order = %v, want %v", got, want)
+    }
+}
+
+// countingPreferences counts lookups, every client has no preferences
+type countingPreferences struct{ calls atomic.Int32 }
+
+func (c *countingPreferences) GetAllPreferencesForClient(clientID string) ([]models.UserPreference, error) {
+    c.calls.Add(1)
+    return nil, nil
+}
+
+func TestInitialSnapshotReadsPreferencesOnlyWhenSorted(t *testing.T) {
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(`{"result_list":[{"device_id":"dev1"}]}`))
+    }))
+    defer upstream.Close()
+    h, err := NewHub(onestepgps.NewClient("key", upstream.URL, nil), 0, config.WebSocketConfig{WriteWait: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    source := &countingPreferences{}
+    h.SetPreferences(source, models.PreferenceDefaults{Hidden: true})
+
+    plain, sorted := &fakeConn{}, &fakeConn{}
+    h.sendInitial(connect(h, plain))
+    if n := source.calls.Load(); n != 0 {
+        t.Errorf("plain connection read preferences %d times, want 0", n)
+    }
+    c := connect(h, sorted)
+    c.byPreference = true
+    h.sendInitial(c)
+    if n := source.calls.Load(); n != 1 {
+        t.Errorf("sort=preference connection read preferences %d times, want 1", n)
+    }
+    if plain.received() != 1 || sorted.received() != 1 {
+        t.Errorf("initial snapshots = %d and %d, want one each", plain.received(), sorted.received())
+    }
+}
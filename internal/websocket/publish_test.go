@@ -0,0 +1,166 @@
+// publish_test.go covers queueing snapshots when the broadcast loop falls behind.
+
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+)
+
+// pendingLats drains the broadcast queue, returning each snapshot's latitude
+func pendingLats(h *Hub) []float64 {
+    var lats []float64
+    for {
+        select {
+        case vehicles := <-h.Broadcast:
+            lats = append(lats, vehicles[0].LastLocation.Latitude)
+        default:
+            return lats
+        }
+    }
+}
+
+// sentVehicles decodes the vehicles of a JSON broadcast
+func sentVehicles(t *testing.T, data []byte) []models.Vehicle {
+    t.Helper()
+    var msg struct {
+        Vehicles []models.Vehicle `json:"vehicles"`
+    }
+    if err := json.Unmarshal(data, &msg); err != nil {
+        t.Fatalf("decoding %q: %v", data, err)
+    }
+    if len(msg.Vehicles) == 0 {
+        t.Fatalf("broadcast %q has no vehicles", data)
+    }
+    return msg.Vehicles
+}
+
+func TestPublishLatestWins(t *testing.T) {
+    tests := []struct {
+        buffer int
+        want   []float64
+    }{
+        {0, []float64{100}}, // Default of 1 keeps only the newest
+        {1, []float64{100}},
+        {3, []float64{98, 99, 100}}, // Newest ones, in order
+    }
+    for _, tt := range tests {
+        t.Run(fmt.Sprintf("buffer %d", tt.buffer), func(t *testing.T) {
+            h := newTestHub(t, config.WebSocketConfig{BroadcastBuffer: tt.buffer})
+
+            // Nothing consumes Broadcast, every publish must still return
+            published := make(chan struct{})
+            go func() {
+                for lat := 1; lat <= 100; lat++ {
+                    h.publish(snapshot(float64(lat)))
+                }
+                close(published)
+            }()
+            select {
+            case <-published:
+            case <-time.After(2 * time.Second):
+                t.Fatal("publish blocked without a consumer")
+            }
+
+            lats := pendingLats(h)
+            if fmt.Sprint(lats) != fmt.Sprint(tt.want) {
+                t.Errorf("pending = %v, want %v", lats, tt.want)
+            }
+        })
+    }
+}
+
+func TestSlowConsumerReceivesNewestSnapshot(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+    conn := &fakeConn{}
+    connect(h, conn)
+
+    // Snapshots pile up while the broadcast loop isn't running
+    for lat := 1; lat <= 20; lat++ {
+        h.publish(snapshot(float64(lat)))
+    }
+    go h.Run()
+
+    deadline := time.Now().Add(2 * time.Second)
+    for conn.received() == 0 && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+    time.Sleep(50 * time.Millisecond) // Anything stale would arrive after the first
+    if n := conn.received(); n != 1 {
+        t.Fatalf("client received %d broadcasts, want only the newest", n)
+    }
+    if lat := sentVehicles(t, conn.last())[0].LastLocation.Latitude; lat != 20 {
+        t.Errorf("client received lat %v, want the newest (20)", lat)
+    }
+}
+
+func TestPollingNotBlockedByStalledBroadcast(t *testing.T) {
+    var polls atomic.Int32
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        polls.Add(1)
+        w.Header().Set("Content-Type", "application/json")
+        fmt.Fprintf(w, `{"result_list":[{"device_id":"dev1","latest_device_point":{"lat":%d,"lng":1}}]}`, polls.Load())
+    }))
+    defer upstream.Close()
+
+    gpsClient := onestepgps.NewClient("key", upstream.URL, nil)
+    h, err := NewHub(gpsClient, 20*time.Millisecond, config.WebSocketConfig{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer gpsClient.Pause() // pollUpdates has no stop, quiet it once the test is done
+
+    // Only the poll loop runs, nothing ever reads Broadcast
+    go h.pollUpdates()
+
+    deadline := time.Now().Add(2 * time.Second)
+    for polls.Load() < 5 && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+    if n := polls.Load(); n < 5 {
+        t.Fatalf("polled %d times, want polling to continue with a stalled broadcast", n)
+    }
+    if lats := pendingLats(h); len(lats) != 1 || lats[0] < 4 {
+        t.Errorf("pending = %v, want a single recent snapshot", lats)
+    }
+}
+
+func TestBroadcastBufferSize(t *testing.T) {
+    for _, tt := range []struct{ configured, want int }{{0, 1}, {1, 1}, {8, 8}} {
+        h := newTestHub(t, config.WebSocketConfig{BroadcastBuffer: tt.configured})
+        if got := cap(h.Broadcast); got != tt.want {
+            t.Errorf("BroadcastBuffer %d: Broadcast holds %d snapshots, want %d", tt.configured, got, tt.want)
+        }
+    }
+}
+
+func TestBufferedSnapshotsSurviveBriefStall(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{BroadcastBuffer: 3})
+    conn := &fakeConn{}
+    connect(h, conn)
+
+    // The broadcast loop is briefly unavailable while three polls come in
+    for lat := 1; lat <= 3; lat++ {
+        h.publish(snapshot(float64(lat)))
+    }
+    runHub(t, h)
+
+    // With room for all of them, none are skipped and they arrive in order
+    waitQuiet(t, conn, 3)
+    conn.mu.Lock()
+    defer conn.mu.Unlock()
+    for i, data := range conn.messages {
+        if lat := sentVehicles(t, data)[0].LastLocation.Latitude; lat != float64(i+1) {
+            t.Errorf("broadcast %d has lat %v, want %d", i, lat, i+1)
+        }
+    }
+}
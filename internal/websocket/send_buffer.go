@@ -0,0 +1,133 @@
+// send_buffer.go gives each client an optional buffered send queue drained by
+// its own writer goroutine, so broadcasts never wait on a slow client.
+// What happens when a client's queue is full is set by WS_SEND_OVERFLOW.
+
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Send buffer overflow policies, chosen with WS_SEND_OVERFLOW.
+// Every broadcast is a full snapshot, so a dropped one is made up by the next.
+const (
+    // OverflowDropNewest discards the incoming broadcast. The client keeps
+    // receiving what it already queued, so it falls furthest behind.
+    OverflowDropNewest = "drop-newest"
+    // OverflowDropOldest discards the oldest queued broadcast to make room.
+    // The client skips ahead and catches up to the latest state soonest.
+    OverflowDropOldest = "drop-oldest"
+    // OverflowDisconnect closes the client with CloseClientTooSlow. It
+    // reconnects to a fresh snapshot instead of showing stale positions,
+    // at the cost of a gap while it does.
+    OverflowDisconnect = "disconnect"
+)
+
+// validateOverflowPolicy checks a WS_SEND_OVERFLOW value, empty means drop-newest
+func validateOverflowPolicy(policy string) (string, error) {
+    switch policy {
+    case "":
+        return OverflowDropNewest, nil
+    case OverflowDropNewest, OverflowDropOldest, OverflowDisconnect:
+        return policy, nil
+    }
+    return "", fmt.Errorf("unsupported WS_SEND_OVERFLOW %q, use %s, %s or %s", policy, OverflowDropNewest, OverflowDropOldest, OverflowDisconnect)
+}
+
+// startWriter gives the client a send queue of size messages and starts its
+// writer, tracked in writers until it exits. Cancelling ctx makes the writer
+// drain its queue and exit, see Hub.Shutdown.
+// Called in Hub.register when WS_SEND_BUFFER > 0.
+func (c *client) startWriter(ctx context.Context, size int, writers *sync.WaitGroup) {
+    c.queue = make(chan []byte, size)
+    c.done = make(chan struct{})
+    writers.Add(1)
+    go func() {
+        defer writers.Done()
+        c.writeLoop(ctx)
+    }()
+}
+
+// writeLoop writes queued messages until the client disconnects or ctx is
+// cancelled. A failed write closes the connection, which ends the read loop
+// and its cleanup.
+func (c *client) writeLoop(ctx context.Context) {
+    for {
+        select {
+        case data := <-c.queue:
+            if err := c.write(data); err != nil {
+                log.Printf("WebSocket Write Error: %v", err)
+                c.conn.Close()
+                return
+            }
+        case <-c.done:
+            return
+        case <-ctx.Done():
+            c.drain()
+            return
+        }
+    }
+}
+
+// drain writes the messages still queued, stopping at the first failed
+// write. Each write is bounded by writeWait, so a stuck client can hold
+// shutdown up for at most writeWait per queued message.
+func (c *client) drain() {
+    for {
+        select {
+        case data := <-c.queue:
+            if err := c.write(data); err != nil {
+                return
+            }
+        default:
+            return
+        }
+    }
+}
+
+// stopWriter ends the writer goroutine, called once on disconnect.
+// The queue is left open so a concurrent enqueue can't panic.
+func (c *client) stopWriter() {
+    if c.done != nil {
+        close(c.done)
+    }
+}
+
+// enqueue queues a message without blocking. When the queue is full the
+// policy decides what happens; false means a message was dropped (counted
+// for the client) or the client is being disconnected.
+func (c *client) enqueue(data []byte, policy string) bool {
+    select {
+    case c.queue <- data:
+        return true
+    default:
+    }
+
+    switch policy {
+    case OverflowDropOldest:
+        // Make room by discarding the oldest, the writer may have taken it already
+        select {
+        case <-c.queue:
+        default:
+        }
+        select {
+        case c.queue <- data:
+        default:
+            // Another message took the freed slot, this one is dropped
+        }
+        c.dropped.Add(1)
+    case OverflowDisconnect:
+        c.dropped.Add(1)
+        if c.closing.CompareAndSwap(false, true) {
+            log.Printf("Disconnecting client %s, send buffer full", c.id)
+            // Off the broadcast loop, the close frame waits behind any write in progress
+            go c.closeWith(CloseClientTooSlow, closeReasonText("too_slow", slowRetryAfter))
+        }
+    default:
+        c.dropped.Add(1)
+    }
+    return false
+}
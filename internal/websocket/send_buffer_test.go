@@ -0,0 +1,231 @@
+// send_buffer_test.go covers per-client send queues, counting the broadcasts
+// dropped for clients that fall behind, each WS_SEND_OVERFLOW policy and
+// draining the queues on shutdown.
+
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+)
+
+// connectBuffered adds a JSON client writing to conn through its own queue
+func connectBuffered(t *testing.T, h *Hub, conn *fakeConn) *client {
+    c := connect(h, conn)
+    c.startWriter(h.writerCtx, h.sendBuffer, &h.writers)
+    t.Cleanup(c.stopWriter)
+    return c
+}
+
+func TestSendBufferCountsDrops(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{SendBuffer: 2})
+    slow := connectBuffered(t, h, &fakeConn{delay: 500 * time.Millisecond})
+    fast := connectBuffered(t, h, &fakeConn{})
+
+    // The slow client is stuck on its first write with its queue filling up
+    for i := 0; i < 6; i++ {
+        h.broadcast(snapshot(37.5 + float64(i)/10))
+        time.Sleep(20 * time.Millisecond)
+    }
+
+    if n := slow.dropped.Load(); n < 3 {
+        t.Errorf("slow client dropped %d broadcasts, want at least 3", n)
+    }
+    if n := fast.dropped.Load(); n != 0 {
+        t.Errorf("fast client dropped %d broadcasts, want 0", n)
+    }
+
+    state := h.State()
+    if state.DroppedMessages != slow.dropped.Load() {
+        t.Errorf("total dropped = %d, want the slow client's %d", state.DroppedMessages, slow.dropped.Load())
+    }
+    for _, c := range state.Clients {
+        if c.ID == slow.id && c.Dropped != slow.dropped.Load() {
+            t.Errorf("state for the slow client shows %d dropped, want %d", c.Dropped, slow.dropped.Load())
+        }
+    }
+}
+
+func TestSendBufferDisabledWritesEverything(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{})
+    conn := &fakeConn{delay: 20 * time.Millisecond}
+    connect(h, conn)
+
+    // Without a queue broadcasts wait for the write, nothing is dropped
+    for i := 0; i < 3; i++ {
+        h.broadcast(snapshot(37.5 + float64(i)/10))
+    }
+    if n := conn.received(); n != 3 {
+        t.Errorf("received %d broadcasts, want 3", n)
+    }
+    if n := h.State().DroppedMessages; n != 0 {
+        t.Errorf("dropped = %d, want 0", n)
+    }
+}
+
+// queued drains c's queue, returning what was waiting in order
+func queued(c *client) []string {
+    var msgs []string
+    for {
+        select {
+        case data := <-c.queue:
+            msgs = append(msgs, string(data))
+        default:
+            return msgs
+        }
+    }
+}
+
+func TestOverflowPolicies(t *testing.T) {
+    tests := []struct {
+        policy string
+        want   []string
+    }{
+        {OverflowDropNewest, []string{"1", "2"}}, // Falls furthest behind
+        {OverflowDropOldest, []string{"3", "4"}}, // Catches up to the latest
+    }
+    for _, tt := range tests {
+        t.Run(tt.policy, func(t *testing.T) {
+            // No writer, so the queue of two stays full
+            c := newClient(&fakeConn{}, jsonEncoder{}, time.Second)
+            c.queue = make(chan []byte, 2)
+
+            var accepted []bool
+            for i := 1; i <= 4; i++ {
+                accepted = append(accepted, c.enqueue([]byte(fmt.Sprint(i)), tt.policy))
+            }
+            if want := []bool{true, true, false, false}; !reflect.DeepEqual(accepted, want) {
+                t.Errorf("enqueue results = %v, want %v", accepted, want)
+            }
+            if got := queued(c); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("queued = %v, want %v", got, tt.want)
+            }
+            if n := c.dropped.Load(); n != 2 {
+                t.Errorf("dropped = %d, want 2", n)
+            }
+        })
+    }
+}
+
+func TestOverflowDisconnect(t *testing.T) {
+    conn := &fakeConn{}
+    c := newClient(conn, jsonEncoder{}, time.Second)
+    c.queue = make(chan []byte, 1)
+
+    c.enqueue([]byte("1"), OverflowDisconnect)
+    if c.enqueue([]byte("2"), OverflowDisconnect) {
+        t.Fatal("enqueue on a full queue succeeded")
+    }
+    // Further overflows while closing don't close it again
+    c.enqueue([]byte("3"), OverflowDisconnect)
+
+    deadline := time.Now().Add(time.Second)
+    for {
+        conn.mu.Lock()
+        closed := conn.closed
+        conn.mu.Unlock()
+        if closed {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("slow client not disconnected")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    if !c.closing.Load() || c.dropped.Load() != 2 {
+        t.Errorf("closing = %v, dropped = %d, want closing with 2 dropped", c.closing.Load(), c.dropped.Load())
+    }
+}
+
+func TestUnknownOverflowPolicy(t *testing.T) {
+    if _, err := NewHub(nil, 0, config.WebSocketConfig{SendOverflow: "block"}); err == nil {
+        t.Error("NewHub accepted WS_SEND_OVERFLOW=block")
+    }
+    h := newTestHub(t, config.WebSocketConfig{})
+    if h.sendOverflow != OverflowDropNewest {
+        t.Errorf("default policy = %q, want %s", h.sendOverflow, OverflowDropNewest)
+    }
+}
+
+// writersExited reports whether every client writer returned within timeout
+func writersExited(h *Hub, timeout time.Duration) bool {
+    exited := make(chan struct{})
+    go func() {
+        h.writers.Wait()
+        close(exited)
+    }()
+    select {
+    case <-exited:
+        return true
+    case <-time.After(timeout):
+        return false
+    }
+}
+
+func TestShutdownDrainsSendQueues(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{SendBuffer: 4})
+    conn := &fakeConn{delay: 30 * time.Millisecond}
+    c := connectBuffered(t, h, conn)
+
+    // The first broadcast is being written, the other three are queued
+    for i := 0; i < 4; i++ {
+        h.broadcast(snapshot(37.5 + float64(i)/10))
+    }
+    h.Shutdown(context.Background())
+
+    if n := conn.received(); n != 4 {
+        t.Errorf("%d of 4 broadcasts written before closing, want all", n)
+    }
+    if n := c.dropped.Load(); n != 0 {
+        t.Errorf("dropped %d broadcasts, want 0", n)
+    }
+    conn.mu.Lock()
+    closed := conn.closed
+    conn.mu.Unlock()
+    if !closed {
+        t.Error("connection still open after Shutdown")
+    }
+    if !writersExited(h, time.Second) {
+        t.Error("writer still running after Shutdown")
+    }
+
+    // Broadcasts racing shutdown aren't queued behind the drain
+    h.broadcast(snapshot(38.5))
+    if n := len(c.queue); n != 0 {
+        t.Errorf("%d messages queued after Shutdown, want 0", n)
+    }
+}
+
+func TestShutdownForceClosesStuckWriters(t *testing.T) {
+    h := newTestHub(t, config.WebSocketConfig{SendBuffer: 4})
+    conn := &fakeConn{delay: 300 * time.Millisecond}
+    connectBuffered(t, h, conn)
+    for i := 0; i < 4; i++ {
+        h.broadcast(snapshot(37.5 + float64(i)/10))
+    }
+
+    // The queue needs over a second to drain, the deadline is sooner
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    h.Shutdown(ctx)
+    if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+        t.Errorf("Shutdown took %v, want it bounded by the deadline", elapsed)
+    }
+    conn.mu.Lock()
+    closed := conn.closed
+    conn.mu.Unlock()
+    if !closed {
+        t.Error("connection still open after a forced Shutdown")
+    }
+
+    // The writer still ends once its in-flight writes return
+    if !writersExited(h, 2*time.Second) {
+        t.Error("writer didn't exit after a forced Shutdown")
+    }
+}
@@ -0,0 +1,96 @@
+// snapshot_sink.go appends broadcast snapshots to hourly NDJSON files
+// for offline analytics. Enabled by SNAPSHOT_DIR.
+
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+)
+
+// snapshotFileLayout names one file per UTC hour, e.g. snapshots-2024-05-01T13.ndjson
+const snapshotFileLayout = "2006-01-02T15"
+
+// snapshotLine is one NDJSON record
+type snapshotLine struct {
+    Time     time.Time        `json:"time"`
+    Vehicles []models.Vehicle `json:"vehicles"`
+}
+
+// snapshotSink writes each snapshot as a line to the current hour's file,
+// rotating to a new file when the hour changes
+type snapshotSink struct {
+    dir  string
+    now  func() time.Time // Overridable clock
+    mu   sync.Mutex
+    file *os.File
+    hour time.Time        // Hour the open file belongs to
+}
+
+// newSnapshotSink creates the output directory, returns nil when dir is empty
+func newSnapshotSink(dir string) (*snapshotSink, error) {
+    if dir == "" {
+        return nil, nil
+    }
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return nil, fmt.Errorf("error creating snapshot directory: %w", err)
+    }
+    return &snapshotSink{dir: dir, now: time.Now}, nil
+}
+
+// Write appends one snapshot, opening or rotating the file as needed
+func (s *snapshotSink) Write(vehicles []models.Vehicle) error {
+    line, err := json.Marshal(snapshotLine{Time: s.now().UTC(), Vehicles: vehicles})
+    if err != nil {
+        return fmt.Errorf("error encoding snapshot: %w", err)
+    }
+    line = append(line, '\n')
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if err := s.rotateLocked(); err != nil {
+        return err
+    }
+    if _, err := s.file.Write(line); err != nil {
+        return fmt.Errorf("error writing snapshot: %w", err)
+    }
+    return nil
+}
+
+// rotateLocked makes sure the open file is the one for the current hour
+func (s *snapshotSink) rotateLocked() error {
+    hour := s.now().UTC().Truncate(time.Hour)
+    if s.file != nil && hour.Equal(s.hour) {
+        return nil
+    }
+    if s.file != nil {
+        s.file.Close()
+        s.file = nil
+    }
+
+    path := filepath.Join(s.dir, "snapshots-"+hour.Format(snapshotFileLayout)+".ndjson")
+    f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+    if err != nil {
+        return fmt.Errorf("error opening snapshot file: %w", err)
+    }
+    s.file, s.hour = f, hour
+    return nil
+}
+
+// Close closes the current file
+func (s *snapshotSink) Close() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.file == nil {
+        return nil
+    }
+    err := s.file.Close()
+    s.file = nil
+    return err
+}
@@ -0,0 +1,127 @@
+// snapshot_sink_test.go covers the hourly NDJSON snapshot export.
+
+package websocket
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+)
+
+// readSnapshotLines decodes every line of an NDJSON snapshot file
+func readSnapshotLines(t *testing.T, path string) []snapshotLine {
+    t.Helper()
+    f, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+
+    var lines []snapshotLine
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        var line snapshotLine
+        if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+            t.Fatalf("decoding %q: %v", scanner.Text(), err)
+        }
+        lines = append(lines, line)
+    }
+    if err := scanner.Err(); err != nil {
+        t.Fatal(err)
+    }
+    return lines
+}
+
+func TestSnapshotSinkDisabled(t *testing.T) {
+    sink, err := newSnapshotSink("")
+    if sink != nil || err != nil {
+        t.Errorf("newSnapshotSink(\"\") = %v, %v, want nil, nil", sink, err)
+    }
+}
+
+func TestSnapshotSinkRotatesHourly(t *testing.T) {
+    dir := filepath.Join(t.TempDir(), "snapshots") // Created on demand
+    sink, err := newSnapshotSink(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { sink.Close() })
+
+    // Local times are filed under their UTC hour
+    est := time.FixedZone("EST", -5*60*60)
+    var now time.Time
+    sink.now = func() time.Time { return now }
+    write := func(at time.Time, lat float64) {
+        t.Helper()
+        now = at
+        if err := sink.Write(snapshot(lat)); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    write(time.Date(2024, 5, 1, 8, 10, 0, 0, est), 1)
+    write(time.Date(2024, 5, 1, 8, 59, 59, 999, est), 2)
+    write(time.Date(2024, 5, 1, 9, 0, 0, 0, est), 3) // First instant of the next hour
+
+    first := readSnapshotLines(t, filepath.Join(dir, "snapshots-2024-05-01T13.ndjson"))
+    if len(first) != 2 {
+        t.Fatalf("13:00 file has %d lines, want 2", len(first))
+    }
+    if first[0].Vehicles[0].LastLocation.Latitude != 1 || first[1].Vehicles[0].LastLocation.Latitude != 2 {
+        t.Errorf("13:00 lines out of order: %+v", first)
+    }
+    if !first[0].Time.Equal(time.Date(2024, 5, 1, 13, 10, 0, 0, time.UTC)) || first[0].Time.Location() != time.UTC {
+        t.Errorf("line time = %v, want 13:10 UTC", first[0].Time)
+    }
+
+    second := readSnapshotLines(t, filepath.Join(dir, "snapshots-2024-05-01T14.ndjson"))
+    if len(second) != 1 || second[0].Vehicles[0].LastLocation.Latitude != 3 {
+        t.Errorf("14:00 file = %+v, want the third snapshot only", second)
+    }
+}
+
+func TestSnapshotSinkAppendsToExistingFile(t *testing.T) {
+    dir := t.TempDir()
+    at := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+
+    // A restart within the hour keeps adding to the same file
+    for i := 0; i < 2; i++ {
+        sink, err := newSnapshotSink(dir)
+        if err != nil {
+            t.Fatal(err)
+        }
+        sink.now = func() time.Time { return at }
+        if err := sink.Write(snapshot(float64(i))); err != nil {
+            t.Fatal(err)
+        }
+        sink.Close()
+    }
+
+    if lines := readSnapshotLines(t, filepath.Join(dir, "snapshots-2024-05-01T13.ndjson")); len(lines) != 2 {
+        t.Errorf("got %d lines, want 2", len(lines))
+    }
+}
+
+func TestBroadcastWritesSnapshot(t *testing.T) {
+    dir := t.TempDir()
+    h := newTestHub(t, config.WebSocketConfig{SnapshotDir: dir})
+    t.Cleanup(func() { h.sink.Close() })
+    h.sink.now = func() time.Time { return time.Date(2024, 5, 1, 13, 30, 0, 0, time.UTC) }
+
+    // Written without any connected clients, and independent of the database
+    h.broadcast(snapshot(37.5))
+    h.broadcast(snapshot(37.6))
+
+    files, err := filepath.Glob(filepath.Join(dir, "*.ndjson"))
+    if err != nil || len(files) != 1 || filepath.Base(files[0]) != "snapshots-2024-05-01T13.ndjson" {
+        t.Fatalf("snapshot files = %v (%v), want the 13:00 file", files, err)
+    }
+    lines := readSnapshotLines(t, files[0])
+    if len(lines) != 2 || lines[1].Vehicles[0].DeviceID != "dev1" {
+        t.Errorf("lines = %+v, want both snapshots", lines)
+    }
+}
@@ -0,0 +1,193 @@
+// sse.go streams vehicle updates over Server-Sent Events for networks whose
+// proxies block WebSockets. SSE clients join the hub like WebSocket clients
+// and receive the same JSON messages, one "vehicles" event per broadcast.
+
+package websocket
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+// errSSEClosed is returned for writes after the stream has ended
+var errSSEClosed = errors.New("sse stream closed")
+
+// sseConn adapts an HTTP response to clientConn.
+// Messages become "vehicles" events, pings become comment lines that keep
+// proxies from timing out the idle stream, and a close frame becomes a
+// "close" event whose retry_after also sets the EventSource reconnect delay.
+type sseConn struct {
+    mu     sync.Mutex // Guards w, so no write happens after Close returns
+    w      http.ResponseWriter
+    rc     *http.ResponseController
+    closed bool
+    done   chan struct{} // Closed by Close, ends HandleSSE
+}
+
+func newSSEConn(w http.ResponseWriter) *sseConn {
+    return &sseConn{w: w, rc: http.NewResponseController(w), done: make(chan struct{})}
+}
+
+func (s *sseConn) SetWriteDeadline(t time.Time) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.closed {
+        return errSSEClosed
+    }
+    // Not every writer supports deadlines, writes still go through
+    _ = s.rc.SetWriteDeadline(t)
+    return nil
+}
+
+// WriteMessage sends data as a "vehicles" event. Messages are always JSON,
+// which never contains raw newlines, so data fits on one line.
+func (s *sseConn) WriteMessage(messageType int, data []byte) error {
+    return s.writeEvent(fmt.Sprintf("event: vehicles\ndata: %s\n\n", data))
+}
+
+func (s *sseConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+    switch messageType {
+    case websocket.PingMessage:
+        return s.writeEvent(": ping\n\n")
+    case websocket.CloseMessage:
+        // data is a close frame: a 2-byte code followed by the reason
+        if len(data) < 2 {
+            return nil
+        }
+        msg := sseCloseMessage{Code: int(binary.BigEndian.Uint16(data))}
+        if json.Unmarshal(data[2:], &msg.closeReason) != nil {
+            msg.Reason = string(data[2:]) // Plain text reason, e.g. superseded
+        }
+        payload, err := json.Marshal(msg)
+        if err != nil {
+            return err
+        }
+        event := fmt.Sprintf("event: close\ndata: %s\n\n", payload)
+        if msg.RetryAfter > 0 {
+            event = fmt.Sprintf("retry: %d\n", msg.RetryAfter*1000) + event
+        }
+        return s.writeEvent(event)
+    }
+    return nil
+}
+
+// sseCloseMessage is the "close" event data, the close code alongside the
+// WebSocket close reason, e.g. {"code":4000,"reason":"server_shutdown","retry_after":5}
+type sseCloseMessage struct {
+    Code int `json:"code"`
+    closeReason
+}
+
+// Close ends the stream, safe to call more than once
+func (s *sseConn) Close() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if !s.closed {
+        s.closed = true
+        close(s.done)
+    }
+    return nil
+}
+
+// writeEvent writes and flushes one event
+func (s *sseConn) writeEvent(event string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.closed {
+        return errSSEClosed
+    }
+    if _, err := fmt.Fprint(s.w, event); err != nil {
+        return err
+    }
+    return s.rc.Flush()
+}
+
+// HandleSSE streams vehicle updates as Server-Sent Events, an alternative
+// to HandleWebSocket for HomeView.vue when WebSockets are blocked.
+// Subscriptions are set with query params instead of messages:
+// ?device_ids=a,b limits devices and ?fields=device_id,lat,lng projects them.
+// ?client_id= identifies the client for single-session mode.
+// ?sort=preference streams in the client's preference order, see preferences.go.
+func (h *Hub) HandleSSE(w http.ResponseWriter, r *http.Request) {
+    var deviceIDs []string
+    for _, id := range strings.Split(r.URL.Query().Get("device_ids"), ",") {
+        if id = strings.TrimSpace(id); id != "" {
+            deviceIDs = append(deviceIDs, id)
+        }
+    }
+    var fields []string
+    if raw := r.URL.Query().Get("fields"); raw != "" {
+        var err error
+        if fields, err = models.ParseVehicleFields(raw); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+    }
+    byPreference, err := parseStreamSort(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    // Unlike a WebSocket handshake, EventSource sees the status, so plain
+    // 503s with Retry-After are enough to turn clients away
+    if h.shuttingDown.Load() {
+        w.Header().Set("Retry-After", fmt.Sprint(int(shutdownRetryAfter/time.Second)))
+        http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+        return
+    }
+    if !h.reserveSlot(r.Context()) {
+        log.Println("Rejected SSE client, hub is full")
+        w.Header().Set("Retry-After", fmt.Sprint(int(capacityRetryAfter/time.Second)))
+        http.Error(w, "Server full", http.StatusServiceUnavailable)
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("X-Accel-Buffering", "no") // Stop nginx buffering the stream
+    w.WriteHeader(http.StatusOK)
+
+    conn := newSSEConn(w)
+    if err := conn.rc.Flush(); err != nil {
+        log.Printf("SSE streaming unsupported: %v", err)
+        h.releaseSlot()
+        return
+    }
+
+    // SSE streams are always JSON, EventSource only carries text
+    c := newClient(conn, jsonEncoder{}, h.writeWait)
+    c.clientID = sessionClientID(r)
+    c.byPreference = byPreference
+    c.subscribe(deviceIDs, fields)
+    h.register(c)
+    log.Println("SSE client connected")
+    h.sendInitial(c)
+
+    stopPing := make(chan struct{})
+    go c.pingLoop(h.pingInterval, stopPing)
+
+    // Stream until the client goes away or the hub closes the connection
+    select {
+    case <-r.Context().Done():
+    case <-conn.done:
+    }
+
+    close(stopPing)
+    c.stopWriter()
+    conn.Close()
+    h.mu.Lock()
+    delete(h.clients, c)
+    h.mu.Unlock()
+    log.Println("SSE client disconnected")
+}
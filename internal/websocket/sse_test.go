@@ -0,0 +1,183 @@
+// sse_test.go covers streaming vehicle updates as Server-Sent Events.
+
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+)
+
+// sseEvent is one parsed event from the stream
+type sseEvent struct {
+    name, data, retry string
+}
+
+// sseServer runs a hub whose upstream lists dev1 and dev2 and serves its
+// SSE stream
+func sseServer(t *testing.T) (*Hub, *httptest.Server) {
+    t.Helper()
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(`{"result_list":[{"device_id":"dev1"},{"device_id":"dev2"}]}`))
+    }))
+    t.Cleanup(upstream.Close)
+    h, err := NewHub(onestepgps.NewClient("key", upstream.URL, nil), 0, config.WebSocketConfig{PingInterval: 30, PongWait: 60, WriteWait: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    runHub(t, h)
+    srv := httptest.NewServer(http.HandlerFunc(h.HandleSSE))
+    t.Cleanup(srv.Close)
+    return h, srv
+}
+
+// openStream connects to the stream at target and returns its events,
+// the channel is closed when the stream ends
+func openStream(t *testing.T, target string) <-chan sseEvent {
+    t.Helper()
+    ctx, cancel := context.WithCancel(context.Background())
+    t.Cleanup(cancel)
+    req, _ := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+        resp.Body.Close()
+        t.Fatalf("status = %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+    }
+
+    events := make(chan sseEvent, 16)
+    go func() {
+        defer resp.Body.Close()
+        defer close(events)
+        var ev sseEvent
+        scanner := bufio.NewScanner(resp.Body)
+        for scanner.Scan() {
+            line := scanner.Text()
+            switch {
+            case line == "":
+                if ev.name != "" {
+                    events <- ev
+                }
+                ev = sseEvent{}
+            case strings.HasPrefix(line, "event: "):
+                ev.name = strings.TrimPrefix(line, "event: ")
+            case strings.HasPrefix(line, "data: "):
+                ev.data = strings.TrimPrefix(line, "data: ")
+            case strings.HasPrefix(line, "retry: "):
+                ev.retry = strings.TrimPrefix(line, "retry: ")
+            }
+        }
+    }()
+    return events
+}
+
+// nextEvent waits up to a second for the next event
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+    t.Helper()
+    select {
+    case ev, ok := <-events:
+        if !ok {
+            t.Fatal("stream ended")
+        }
+        return ev
+    case <-time.After(time.Second):
+        t.Fatal("no event within a second")
+    }
+    return sseEvent{}
+}
+
+// eventVehicleIDs returns the device ids of a "vehicles" event
+func eventVehicleIDs(t *testing.T, ev sseEvent) []string {
+    t.Helper()
+    if ev.name != "vehicles" {
+        t.Fatalf("event %q, want vehicles", ev.name)
+    }
+    var ids []string
+    for _, v := range sentVehicles(t, []byte(ev.data)) {
+        ids = append(ids, v.DeviceID)
+    }
+    return ids
+}
+
+func TestSSEStreamsBroadcasts(t *testing.T) {
+    h, srv := sseServer(t)
+    events := openStream(t, srv.URL)
+
+    if got, want := eventVehicleIDs(t, nextEvent(t, events)), []string{"dev1", "dev2"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("initial snapshot = %v, want %v", got, want)
+    }
+    h.Broadcast <- append(deviceAt("dev1", 37.5), deviceAt("dev3", 37.6)...)
+    if got, want := eventVehicleIDs(t, nextEvent(t, events)), []string{"dev1", "dev3"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("broadcast = %v, want %v", got, want)
+    }
+}
+
+func TestSSESubscriptionParams(t *testing.T) {
+    h, srv := sseServer(t)
+    events := openStream(t, srv.URL+"?device_ids=dev2,%20dev3&fields=device_id,lat")
+
+    // The initial snapshot is filtered like every broadcast
+    if got := eventVehicleIDs(t, nextEvent(t, events)); !reflect.DeepEqual(got, []string{"dev2"}) {
+        t.Errorf("initial snapshot = %v, want [dev2]", got)
+    }
+
+    h.Broadcast <- append(deviceAt("dev1", 37.5), deviceAt("dev3", 37.6)...)
+    ev := nextEvent(t, events)
+    var msg struct {
+        Vehicles []map[string]interface{} `json:"vehicles"`
+    }
+    if err := json.Unmarshal([]byte(ev.data), &msg); err != nil {
+        t.Fatal(err)
+    }
+    want := []map[string]interface{}{{"device_id": "dev3", "lat": 37.6}}
+    if !reflect.DeepEqual(msg.Vehicles, want) {
+        t.Errorf("broadcast = %v, want %v", msg.Vehicles, want)
+    }
+}
+
+func TestSSEInvalidFields(t *testing.T) {
+    _, srv := sseServer(t)
+
+    resp, err := http.Get(srv.URL + "?fields=device_id,secret")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Errorf("status = %d, want 400", resp.StatusCode)
+    }
+}
+
+func TestSSEShutdownCloseEvent(t *testing.T) {
+    h, srv := sseServer(t)
+    events := openStream(t, srv.URL)
+    nextEvent(t, events) // Initial snapshot
+
+    h.Shutdown(context.Background())
+    ev := nextEvent(t, events)
+    if ev.name != "close" || ev.retry != "5000" {
+        t.Fatalf("event = %+v, want close with retry 5000", ev)
+    }
+    var msg sseCloseMessage
+    if err := json.Unmarshal([]byte(ev.data), &msg); err != nil {
+        t.Fatal(err)
+    }
+    if msg.Code != CloseServerShutdown || msg.Reason != "server_shutdown" || msg.RetryAfter != 5 {
+        t.Errorf("close = %+v", msg)
+    }
+    if _, ok := <-events; ok {
+        t.Error("stream still open after the close event")
+    }
+}
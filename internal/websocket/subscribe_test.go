@@ -0,0 +1,144 @@
+// subscribe_test.go covers clients receiving every device until they subscribe.
+
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidwiese/fleet-tracker-backend/internal/config"
+	"github.com/davidwiese/fleet-tracker-backend/internal/onestepgps"
+	"github.com/gorilla/websocket"
+)
+
+// readVehicleIDs reads the next message from conn and returns the device ids
+// of its vehicles, failing if nothing arrives within a second
+func readVehicleIDs(t *testing.T, conn *websocket.Conn) []string {
+    t.Helper()
+    conn.SetReadDeadline(time.Now().Add(time.Second))
+    _, data, err := conn.ReadMessage()
+    if err != nil {
+        t.Fatalf("reading: %v", err)
+    }
+    var ids []string
+    for _, v := range sentVehicles(t, data) {
+        ids = append(ids, v.DeviceID)
+    }
+    return ids
+}
+
+func TestSilentClientReceivesEverything(t *testing.T) {
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(`{"result_list":[{"device_id":"dev1"},{"device_id":"dev2"}]}`))
+    }))
+    defer upstream.Close()
+    h, err := NewHub(onestepgps.NewClient("key", upstream.URL, nil), 0, config.WebSocketConfig{PingInterval: 30, PongWait: 60, WriteWait: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    runHub(t, h)
+    srv := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+    defer srv.Close()
+
+    // The client never sends anything
+    conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+
+    // The initial snapshot arrives without waiting for a subscription
+    if got, want := readVehicleIDs(t, conn), []string{"dev1", "dev2"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("initial snapshot = %v, want %v", got, want)
+    }
+
+    h.Broadcast <- append(deviceAt("dev1", 37.5), deviceAt("dev3", 37.6)...)
+    if got, want := readVehicleIDs(t, conn), []string{"dev1", "dev3"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("broadcast = %v, want every device %v", got, want)
+    }
+
+    state := h.State()
+    if len(state.Clients) != 1 || !reflect.DeepEqual(state.Clients[0].Subscriptions, []string{"*"}) {
+        t.Errorf("hub clients = %+v, want one subscribed to *", state.Clients)
+    }
+}
+
+func TestSubscribeAndUnsubscribe(t *testing.T) {
+    conn := &fakeConn{}
+    c := newClient(conn, jsonEncoder{}, time.Second)
+    vehicles := append(deviceAt("dev1", 37.5), deviceAt("dev2", 37.6)...)
+
+    if _, ok := c.filter(vehicles); ok {
+        t.Error("new client filters vehicles, want everything until it subscribes")
+    }
+
+    if err := c.handleMessage([]byte(`{"action":"subscribe","device_ids":["dev2"]}`)); err != nil {
+        t.Fatal(err)
+    }
+    var confirmed subscribedMessage
+    if err := json.Unmarshal(conn.last(), &confirmed); err != nil {
+        t.Fatal(err)
+    }
+    if confirmed.Type != "subscribed" || !reflect.DeepEqual(confirmed.DeviceIDs, []string{"dev2"}) {
+        t.Errorf("confirmation = %+v, want subscribed to [dev2]", confirmed)
+    }
+    if filtered, ok := c.filter(vehicles); !ok || len(filtered) != 1 || filtered[0].DeviceID != "dev2" {
+        t.Errorf("filtered = %v, %v, want only dev2", filtered, ok)
+    }
+
+    if err := c.handleMessage([]byte(`{"action":"unsubscribe"}`)); err != nil {
+        t.Fatal(err)
+    }
+    if err := json.Unmarshal(conn.last(), &confirmed); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(confirmed.DeviceIDs, []string{"*"}) {
+        t.Errorf("after unsubscribe = %v, want [*]", confirmed.DeviceIDs)
+    }
+    if _, ok := c.filter(vehicles); ok {
+        t.Error("unsubscribed client still filters vehicles")
+    }
+}
+
+func TestSubscribeWithFields(t *testing.T) {
+    conn := &fakeConn{}
+    c := newClient(conn, jsonEncoder{}, time.Second)
+    vehicles := append(deviceAt("dev1", 37.5), deviceAt("dev2", 37.6)...)
+
+    if err := c.handleMessage([]byte(`{"action":"subscribe","device_ids":["dev2"],"fields":"device_id,lat"}`)); err != nil {
+        t.Fatal(err)
+    }
+    var confirmed subscribedMessage
+    if err := json.Unmarshal(conn.last(), &confirmed); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(confirmed.Fields, []string{"device_id", "lat"}) {
+        t.Errorf("confirmed fields = %v, want [device_id lat]", confirmed.Fields)
+    }
+    payload, ok := c.payload(vehicles)
+    want := []map[string]interface{}{{"device_id": "dev2", "lat": 37.6}}
+    if !ok || !reflect.DeepEqual(payload, want) {
+        t.Errorf("payload = %v, %v, want %v", payload, ok, want)
+    }
+
+    // A rejected projection is reported and keeps the current subscription
+    if err := c.handleMessage([]byte(`{"action":"subscribe","fields":"device_id,token"}`)); err != nil {
+        t.Fatal(err)
+    }
+    var rejected errorMessage
+    if err := json.Unmarshal(conn.last(), &rejected); err != nil {
+        t.Fatal(err)
+    }
+    if rejected.Type != "error" || rejected.Action != "subscribe" || !strings.Contains(rejected.Message, "token") {
+        t.Errorf("error = %+v", rejected)
+    }
+    if payload, _ := c.payload(vehicles); !reflect.DeepEqual(payload, want) {
+        t.Errorf("after rejection payload = %v, want %v", payload, want)
+    }
+}